@@ -0,0 +1,309 @@
+package bag
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"go.uber.org/zap"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// A bag file starts with fileMagic followed by messages. Each message is a header (reception date as unix nanoseconds,
+// qos, flags, topic length, payload length) followed by topic and payload. Index of messages (offset and reception
+// date) and a footer are appended on close. Bags without index, like bags of an interrupted recording, are indexed by
+// reading all messages.
+var (
+	fileMagic   = []byte("RCBAG01\n")
+	footerMagic = []byte("RCBAGIDX")
+	byteOrder   = binary.BigEndian
+)
+
+const (
+	headerSize     = 8 + 1 + 1 + 2 + 4
+	indexEntrySize = 8 + 8
+	footerSize     = 8 + 8 + 8
+
+	flagRetained byte = 1
+)
+
+// Message is a mqtt message recorded into a bag
+type Message struct {
+	Topic    string
+	Payload  []byte
+	Qos      byte
+	Retained bool
+	// ReceivedAt is the date of message reception by recorder
+	ReceivedAt time.Time
+}
+
+type indexEntry struct {
+	offset     int64
+	receivedAt int64
+}
+
+// Writer appends messages to a bag file
+type Writer struct {
+	muWriter sync.Mutex
+	f        *os.File
+	w        *bufio.Writer
+	offset   int64
+	index    []indexEntry
+	// closed is true once index has been written, messages can't be added anymore
+	closed bool
+}
+
+// Create creates bag file name, existing file is truncated
+func Create(name string) (*Writer, error) {
+	f, err := os.Create(name)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create bag file %v: %w", name, err)
+	}
+	w := Writer{f: f, w: bufio.NewWriterSize(f, 1<<20), index: make([]indexEntry, 0)}
+	if _, err := w.w.Write(fileMagic); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("unable to write bag file %v: %w", name, err)
+	}
+	w.offset = int64(len(fileMagic))
+	return &w, nil
+}
+
+// Write appends msg, it is safe for concurrent use
+func (w *Writer) Write(msg *Message) error {
+	if len(msg.Topic) > 0xffff {
+		return fmt.Errorf("topic of %d bytes is too long", len(msg.Topic))
+	}
+
+	header := make([]byte, headerSize)
+	byteOrder.PutUint64(header[0:], uint64(msg.ReceivedAt.UnixNano()))
+	header[8] = msg.Qos
+	if msg.Retained {
+		header[9] |= flagRetained
+	}
+	byteOrder.PutUint16(header[10:], uint16(len(msg.Topic)))
+	byteOrder.PutUint32(header[12:], uint32(len(msg.Payload)))
+
+	w.muWriter.Lock()
+	defer w.muWriter.Unlock()
+	if w.closed {
+		return fmt.Errorf("bag closed, message of topic %v not written", msg.Topic)
+	}
+	for _, b := range [][]byte{header, []byte(msg.Topic), msg.Payload} {
+		if _, err := w.w.Write(b); err != nil {
+			return fmt.Errorf("unable to write message of topic %v: %w", msg.Topic, err)
+		}
+	}
+	w.index = append(w.index, indexEntry{offset: w.offset, receivedAt: msg.ReceivedAt.UnixNano()})
+	w.offset += int64(headerSize + len(msg.Topic) + len(msg.Payload))
+	return nil
+}
+
+// Len returns number of written messages
+func (w *Writer) Len() int {
+	w.muWriter.Lock()
+	defer w.muWriter.Unlock()
+	return len(w.index)
+}
+
+// Flush writes buffered messages to bag file
+func (w *Writer) Flush() error {
+	w.muWriter.Lock()
+	defer w.muWriter.Unlock()
+	if w.closed {
+		return nil
+	}
+	if err := w.w.Flush(); err != nil {
+		return fmt.Errorf("unable to write bag file: %w", err)
+	}
+	return nil
+}
+
+// Close writes index and closes bag file, messages written after close are rejected
+func (w *Writer) Close() error {
+	w.muWriter.Lock()
+	defer w.muWriter.Unlock()
+	if w.closed {
+		return fmt.Errorf("bag already closed")
+	}
+	w.closed = true
+
+	buf := make([]byte, indexEntrySize*len(w.index)+footerSize)
+	for i, e := range w.index {
+		byteOrder.PutUint64(buf[i*indexEntrySize:], uint64(e.offset))
+		byteOrder.PutUint64(buf[i*indexEntrySize+8:], uint64(e.receivedAt))
+	}
+	footer := buf[indexEntrySize*len(w.index):]
+	byteOrder.PutUint64(footer[0:], uint64(w.offset))
+	byteOrder.PutUint64(footer[8:], uint64(len(w.index)))
+	copy(footer[16:], footerMagic)
+
+	if _, err := w.w.Write(buf); err != nil {
+		_ = w.f.Close()
+		return fmt.Errorf("unable to write bag index: %w", err)
+	}
+	if err := w.w.Flush(); err != nil {
+		_ = w.f.Close()
+		return fmt.Errorf("unable to write bag file: %w", err)
+	}
+	if err := w.f.Close(); err != nil {
+		return fmt.Errorf("unable to close bag file: %w", err)
+	}
+	return nil
+}
+
+// Bag gives access to messages of a bag file ordered by reception date
+type Bag struct {
+	f     *os.File
+	index []indexEntry
+}
+
+// Open reads index of bag file name
+func Open(name string) (*Bag, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open bag file %v: %w", name, err)
+	}
+	b := Bag{f: f}
+	if err := b.readIndex(); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("unable to read bag file %v: %w", name, err)
+	}
+	// Messages handled concurrently may be written out of order
+	sort.SliceStable(b.index, func(i, j int) bool { return b.index[i].receivedAt < b.index[j].receivedAt })
+	return &b, nil
+}
+
+func (b *Bag) readIndex() error {
+	info, err := b.f.Stat()
+	if err != nil {
+		return err
+	}
+	size := info.Size()
+
+	magic := make([]byte, len(fileMagic))
+	if _, err := b.f.ReadAt(magic, 0); err != nil || !bytes.Equal(magic, fileMagic) {
+		return fmt.Errorf("not a bag file")
+	}
+
+	if size >= int64(len(fileMagic)+footerSize) {
+		footer := make([]byte, footerSize)
+		if _, err := b.f.ReadAt(footer, size-footerSize); err != nil {
+			return fmt.Errorf("unable to read footer: %w", err)
+		}
+		indexOffset := int64(byteOrder.Uint64(footer[0:]))
+		count := int64(byteOrder.Uint64(footer[8:]))
+		if bytes.Equal(footer[16:], footerMagic) && indexOffset+count*indexEntrySize+footerSize == size {
+			buf := make([]byte, count*indexEntrySize)
+			if _, err := b.f.ReadAt(buf, indexOffset); err != nil {
+				return fmt.Errorf("unable to read index: %w", err)
+			}
+			b.index = make([]indexEntry, count)
+			for i := range b.index {
+				b.index[i].offset = int64(byteOrder.Uint64(buf[i*indexEntrySize:]))
+				b.index[i].receivedAt = int64(byteOrder.Uint64(buf[i*indexEntrySize+8:]))
+			}
+			return nil
+		}
+	}
+
+	zap.S().Warnf("no index in bag file %v, read all messages", b.f.Name())
+	return b.scan(size)
+}
+
+// scan indexes messages of a bag without index, a truncated last message is ignored
+func (b *Bag) scan(size int64) error {
+	b.index = make([]indexEntry, 0)
+	r := bufio.NewReader(io.NewSectionReader(b.f, 0, size))
+	if _, err := r.Discard(len(fileMagic)); err != nil {
+		return err
+	}
+	offset := int64(len(fileMagic))
+	header := make([]byte, headerSize)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			if err != io.EOF {
+				zap.S().Warnf("truncated message at end of bag file %v", b.f.Name())
+			}
+			return nil
+		}
+		n := int(byteOrder.Uint16(header[10:])) + int(byteOrder.Uint32(header[12:]))
+		if offset+int64(headerSize+n) > size {
+			zap.S().Warnf("truncated message at end of bag file %v", b.f.Name())
+			return nil
+		}
+		if _, err := r.Discard(n); err != nil {
+			return err
+		}
+		b.index = append(b.index, indexEntry{offset: offset, receivedAt: int64(byteOrder.Uint64(header[0:]))})
+		offset += int64(headerSize + n)
+	}
+}
+
+// Len returns number of messages
+func (b *Bag) Len() int {
+	return len(b.index)
+}
+
+// Offset returns delay between reception of first message and message i
+func (b *Bag) Offset(i int) time.Duration {
+	return time.Duration(b.index[i].receivedAt - b.index[0].receivedAt)
+}
+
+// IndexAt returns position of first message received at or after t
+func (b *Bag) IndexAt(t time.Time) (int, error) {
+	ts := t.UnixNano()
+	return sort.Search(len(b.index), func(i int) bool { return b.index[i].receivedAt >= ts }), nil
+}
+
+// Message reads message i
+func (b *Bag) Message(i int) (*Message, error) {
+	msg, payloadLen, err := b.readHeader(i)
+	if err != nil {
+		return nil, err
+	}
+	msg.Payload = make([]byte, payloadLen)
+	if _, err := b.f.ReadAt(msg.Payload, b.index[i].offset+headerSize+int64(len(msg.Topic))); err != nil {
+		return nil, fmt.Errorf("unable to read message %d: %w", i, err)
+	}
+	return msg, nil
+}
+
+// readHeader reads message i without its payload
+func (b *Bag) readHeader(i int) (msg *Message, payloadLen int, err error) {
+	offset := b.index[i].offset
+	header := make([]byte, headerSize)
+	if _, err := b.f.ReadAt(header, offset); err != nil {
+		return nil, 0, fmt.Errorf("unable to read message %d: %w", i, err)
+	}
+	topic := make([]byte, byteOrder.Uint16(header[10:]))
+	if _, err := b.f.ReadAt(topic, offset+headerSize); err != nil {
+		return nil, 0, fmt.Errorf("unable to read message %d: %w", i, err)
+	}
+	return &Message{
+		Topic:      string(topic),
+		Qos:        header[8],
+		Retained:   header[9]&flagRetained != 0,
+		ReceivedAt: time.Unix(0, int64(byteOrder.Uint64(header[0:]))),
+	}, int(byteOrder.Uint32(header[12:])), nil
+}
+
+// Topics returns number of messages of each topic
+func (b *Bag) Topics() (map[string]int, error) {
+	topics := make(map[string]int)
+	for i := range b.index {
+		msg, _, err := b.readHeader(i)
+		if err != nil {
+			return nil, err
+		}
+		topics[msg.Topic] += 1
+	}
+	return topics, nil
+}
+
+func (b *Bag) Close() error {
+	return b.f.Close()
+}
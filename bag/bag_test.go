@@ -0,0 +1,154 @@
+package bag
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func writeBag(t *testing.T, msgs ...*Message) string {
+	name := path.Join(t.TempDir(), "test.bag")
+	w, err := Create(name)
+	if err != nil {
+		t.Fatalf("unable to create bag: %v", err)
+	}
+	for _, m := range msgs {
+		if err := w.Write(m); err != nil {
+			t.Fatalf("unable to write message: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("unable to close bag: %v", err)
+	}
+	return name
+}
+
+func openBag(t *testing.T, name string) *Bag {
+	b, err := Open(name)
+	if err != nil {
+		t.Fatalf("unable to open bag: %v", err)
+	}
+	t.Cleanup(func() { _ = b.Close() })
+	return b
+}
+
+func testMessages() []*Message {
+	start := time.Unix(1600000000, 0)
+	return []*Message{
+		{Topic: "car/frame", Payload: []byte("frame 1"), ReceivedAt: start},
+		{Topic: "car/steering", Payload: []byte("steering"), Qos: 1, ReceivedAt: start.Add(10 * time.Millisecond)},
+		{Topic: "car/drive-mode", Payload: []byte{}, Qos: 2, Retained: true, ReceivedAt: start.Add(15 * time.Millisecond)},
+		{Topic: "car/frame", Payload: []byte("frame 2"), ReceivedAt: start.Add(40 * time.Millisecond)},
+	}
+}
+
+func checkMessages(t *testing.T, b *Bag, expected []*Message) {
+	if b.Len() != len(expected) {
+		t.Fatalf("bad number of messages: %v, wants %v", b.Len(), len(expected))
+	}
+	for i, e := range expected {
+		m, err := b.Message(i)
+		if err != nil {
+			t.Fatalf("unable to read message %d: %v", i, err)
+		}
+		if m.Topic != e.Topic || string(m.Payload) != string(e.Payload) || m.Qos != e.Qos || m.Retained != e.Retained || !m.ReceivedAt.Equal(e.ReceivedAt) {
+			t.Errorf("bad message %d: %+v, wants %+v", i, m, e)
+		}
+		if offset := b.Offset(i); offset != e.ReceivedAt.Sub(expected[0].ReceivedAt) {
+			t.Errorf("bad offset of message %d: %v", i, offset)
+		}
+	}
+}
+
+func TestBag(t *testing.T) {
+	msgs := testMessages()
+	b := openBag(t, writeBag(t, msgs...))
+	checkMessages(t, b, msgs)
+
+	topics, err := b.Topics()
+	if err != nil {
+		t.Fatalf("unable to list topics: %v", err)
+	}
+	expected := map[string]int{"car/frame": 2, "car/steering": 1, "car/drive-mode": 1}
+	if !reflect.DeepEqual(topics, expected) {
+		t.Errorf("bad topics: %v, wants %v", topics, expected)
+	}
+
+	idx, _ := b.IndexAt(time.Unix(1600000000, 0).Add(12 * time.Millisecond))
+	if idx != 2 {
+		t.Errorf("bad index at date: %v, wants %v", idx, 2)
+	}
+}
+
+func TestBag_OutOfOrder(t *testing.T) {
+	msgs := testMessages()
+	b := openBag(t, writeBag(t, msgs[1], msgs[0], msgs[3], msgs[2]))
+	checkMessages(t, b, msgs)
+}
+
+func TestBag_WithoutIndex(t *testing.T) {
+	msgs := testMessages()
+	name := path.Join(t.TempDir(), "test.bag")
+	w, err := Create(name)
+	if err != nil {
+		t.Fatalf("unable to create bag: %v", err)
+	}
+	for _, m := range msgs {
+		if err := w.Write(m); err != nil {
+			t.Fatalf("unable to write message: %v", err)
+		}
+	}
+	// Interrupted recording, last message is truncated
+	if err := w.Flush(); err != nil {
+		t.Fatalf("unable to flush bag: %v", err)
+	}
+	info, err := os.Stat(name)
+	if err != nil {
+		t.Fatalf("unable to stat bag: %v", err)
+	}
+	if err := os.Truncate(name, info.Size()-3); err != nil {
+		t.Fatalf("unable to truncate bag: %v", err)
+	}
+
+	b := openBag(t, name)
+	checkMessages(t, b, msgs[:3])
+}
+
+func TestOpen_NotABag(t *testing.T) {
+	name := path.Join(t.TempDir(), "test.bag")
+	if err := ioutil.WriteFile(name, []byte("not a bag file"), 0644); err != nil {
+		t.Fatalf("unable to write file: %v", err)
+	}
+	if _, err := Open(name); err == nil {
+		t.Errorf("invalid bag file must return an error")
+	}
+}
+
+func TestWriter_Closed(t *testing.T) {
+	msgs := testMessages()
+	name := path.Join(t.TempDir(), "test.bag")
+	w, err := Create(name)
+	if err != nil {
+		t.Fatalf("unable to create bag: %v", err)
+	}
+	if err := w.Write(msgs[0]); err != nil {
+		t.Fatalf("unable to write message: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("unable to close bag: %v", err)
+	}
+
+	if err := w.Write(msgs[1]); err == nil {
+		t.Errorf("message written after close must return an error")
+	}
+	if err := w.Close(); err == nil {
+		t.Errorf("bag closed twice must return an error")
+	}
+	if w.Len() != 1 {
+		t.Errorf("message written after close must not be indexed: %v", w.Len())
+	}
+	checkMessages(t, openBag(t, name), msgs[:1])
+}
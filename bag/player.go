@@ -0,0 +1,72 @@
+package bag
+
+import (
+	"fmt"
+	"github.com/cyrilix/robocar-tools/replay"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"time"
+)
+
+// Player republishes messages of a bag with their original timing, qos and retain flag
+type Player struct {
+	client mqtt.Client
+	bag    *Bag
+	remap  *Remap
+	player *replay.Player
+}
+
+// NewPlayer builds player of b, topics are renamed with remap and speed multiplies original timing
+func NewPlayer(client mqtt.Client, b *Bag, remap *Remap, speed float64, loop bool) (*Player, error) {
+	if speed <= 0 {
+		return nil, fmt.Errorf("invalid speed %v, must be greater than 0", speed)
+	}
+	if b.Len() == 0 {
+		return nil, fmt.Errorf("no message in bag")
+	}
+	p := Player{client: client, bag: b, remap: remap}
+	p.player = replay.NewPlayer(&p, speed, loop)
+	return &p, nil
+}
+
+// Start publishes messages and returns at the end of the bag, or when stopped in loop mode
+func (p *Player) Start() error {
+	return p.player.Run()
+}
+
+func (p *Player) Stop() {
+	p.player.Stop()
+}
+
+// Player returns the player that controls replay
+func (p *Player) Player() *replay.Player {
+	return p.player
+}
+
+func (p *Player) Len() int {
+	return p.bag.Len()
+}
+
+func (p *Player) Offset(i int) time.Duration {
+	return p.bag.Offset(i)
+}
+
+func (p *Player) IndexAt(t time.Time) (int, error) {
+	return p.bag.IndexAt(t)
+}
+
+func (p *Player) Publish(i int) error {
+	msg, err := p.bag.Message(i)
+	if err != nil {
+		return err
+	}
+	topic := p.remap.Topic(msg.Topic)
+	if topic == "" {
+		return nil
+	}
+	publish(p.client, topic, msg.Qos, msg.Retained, msg.Payload)
+	return nil
+}
+
+var publish = func(client mqtt.Client, topic string, qos byte, retained bool, payload []byte) {
+	client.Publish(topic, qos, retained, payload)
+}
@@ -0,0 +1,79 @@
+package bag
+
+import (
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"sync"
+	"testing"
+	"time"
+)
+
+type published struct {
+	topic    string
+	qos      byte
+	retained bool
+	payload  []byte
+	at       time.Time
+}
+
+func mockPublish(t *testing.T) (*[]published, *sync.Mutex) {
+	oldPublish := publish
+	t.Cleanup(func() {
+		publish = oldPublish
+	})
+
+	var mu sync.Mutex
+	msgs := make([]published, 0, 10)
+	publish = func(client mqtt.Client, topic string, qos byte, retained bool, payload []byte) {
+		mu.Lock()
+		defer mu.Unlock()
+		msgs = append(msgs, published{topic: topic, qos: qos, retained: retained, payload: payload, at: time.Now()})
+	}
+	return &msgs, &mu
+}
+
+func TestPlayer_Start(t *testing.T) {
+	msgs, _ := mockPublish(t)
+	b := openBag(t, writeBag(t, testMessages()...))
+	remap, err := ParseRemap("car/frame=sim/frame,car/steering=")
+	if err != nil {
+		t.Fatalf("unable to parse remap: %v", err)
+	}
+
+	p, err := NewPlayer(nil, b, remap, 2., false)
+	if err != nil {
+		t.Fatalf("unable to build player: %v", err)
+	}
+	if err := p.Start(); err != nil {
+		t.Fatalf("unable to play bag: %v", err)
+	}
+
+	expected := []published{
+		{topic: "sim/frame", payload: []byte("frame 1")},
+		{topic: "car/drive-mode", qos: 2, retained: true, payload: []byte{}},
+		{topic: "sim/frame", payload: []byte("frame 2")},
+	}
+	if len(*msgs) != len(expected) {
+		t.Fatalf("bad number of messages published: %v, wants %v", len(*msgs), len(expected))
+	}
+	for i, e := range expected {
+		m := (*msgs)[i]
+		if m.topic != e.topic || m.qos != e.qos || m.retained != e.retained || string(m.payload) != string(e.payload) {
+			t.Errorf("bad message %d: %+v, wants %+v", i, m, e)
+		}
+	}
+	// Messages are received over 40ms, played twice as fast
+	if elapsed := (*msgs)[2].at.Sub((*msgs)[0].at); elapsed < 20*time.Millisecond {
+		t.Errorf("play is too fast: %v, wants at least %v", elapsed, 20*time.Millisecond)
+	}
+}
+
+func TestNewPlayer_Invalid(t *testing.T) {
+	b := openBag(t, writeBag(t, testMessages()...))
+	if _, err := NewPlayer(nil, b, nil, 0, false); err == nil {
+		t.Errorf("null speed must return an error")
+	}
+	empty := openBag(t, writeBag(t))
+	if _, err := NewPlayer(nil, empty, nil, 1, false); err == nil {
+		t.Errorf("empty bag must return an error")
+	}
+}
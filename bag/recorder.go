@@ -0,0 +1,91 @@
+package bag
+
+import (
+	"fmt"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+// flushInterval is the delay between writes of buffered messages, messages received since last flush are lost if
+// recorder is killed
+const flushInterval = time.Second
+
+// NewRecorder builds part that writes messages of topics to w, topics may contain mqtt wildcards
+func NewRecorder(client mqtt.Client, w *Writer, topics ...string) *Recorder {
+	return &Recorder{
+		client: client,
+		writer: w,
+		topics: topics,
+		cancel: make(chan interface{}),
+	}
+}
+
+type Recorder struct {
+	client mqtt.Client
+	writer *Writer
+	topics []string
+
+	cancel   chan interface{}
+	stopOnce sync.Once
+}
+
+func (r *Recorder) Start() error {
+	for _, topic := range r.topics {
+		// Messages are delivered with the min of publish and subscribe qos, subscribe with max qos to record publish qos
+		token := r.client.Subscribe(topic, 2, r.onMessage)
+		token.Wait()
+		if token.Error() != nil {
+			return fmt.Errorf("unable to subscribe to topic %v: %v", topic, token.Error())
+		}
+		zap.S().Infof("record topic %v", topic)
+	}
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := r.writer.Flush(); err != nil {
+				zap.S().Errorf("unable to flush recorded messages: %v", err)
+			}
+		case <-r.cancel:
+			return nil
+		}
+	}
+}
+
+// Stop closes bag file, it may be called several times
+func (r *Recorder) Stop() {
+	r.stopOnce.Do(r.stop)
+}
+
+func (r *Recorder) stop() {
+	close(r.cancel)
+
+	token := r.client.Unsubscribe(r.topics...)
+	token.Wait()
+	if token.Error() != nil {
+		zap.S().Errorf("unable to unsubscribe service: %v", token.Error())
+	}
+
+	if err := r.writer.Close(); err != nil {
+		zap.S().Errorf("unable to close bag: %v", err)
+		return
+	}
+	zap.S().Infof("%d messages recorded", r.writer.Len())
+}
+
+func (r *Recorder) onMessage(_ mqtt.Client, message mqtt.Message) {
+	err := r.writer.Write(&Message{
+		Topic:      message.Topic(),
+		Payload:    message.Payload(),
+		Qos:        message.Qos(),
+		Retained:   message.Retained(),
+		ReceivedAt: time.Now(),
+	})
+	if err != nil {
+		zap.S().Errorf("unable to record message: %v", err)
+	}
+}
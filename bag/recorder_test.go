@@ -0,0 +1,33 @@
+package bag
+
+import (
+	"github.com/cyrilix/robocar-tools/pkg/testutil"
+	"path"
+	"testing"
+)
+
+func TestRecorder_OnMessage(t *testing.T) {
+	name := path.Join(t.TempDir(), "test.bag")
+	w, err := Create(name)
+	if err != nil {
+		t.Fatalf("unable to create bag: %v", err)
+	}
+	r := NewRecorder(nil, w, "car/#")
+	r.onMessage(nil, testutil.NewMessage("car/frame", []byte("frame")))
+	r.onMessage(nil, &testutil.FakeMessage{TopicName: "car/drive-mode", QoS: 1, Retain: true, Content: []byte("mode")})
+	if err := w.Close(); err != nil {
+		t.Fatalf("unable to close bag: %v", err)
+	}
+
+	b := openBag(t, name)
+	if b.Len() != 2 {
+		t.Fatalf("bad number of recorded messages: %v, wants %v", b.Len(), 2)
+	}
+	m, err := b.Message(1)
+	if err != nil {
+		t.Fatalf("unable to read message: %v", err)
+	}
+	if m.Topic != "car/drive-mode" || m.Qos != 1 || !m.Retained || string(m.Payload) != "mode" || m.ReceivedAt.IsZero() {
+		t.Errorf("bad recorded message: %+v", m)
+	}
+}
@@ -0,0 +1,89 @@
+package bag
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Remap renames topics of played messages
+type Remap struct {
+	topics map[string]string
+	// prefixes are sorted by decreasing length so that the longest prefix matches first
+	prefixes []prefixRule
+}
+
+type prefixRule struct {
+	from, to string
+	drop     bool
+}
+
+// ParseRemap parses comma separated list of from=to topic renames. A from topic ending with '/#', or equal to '#',
+// renames all topics under prefix and the parent topic itself, like mqtt '#' wildcard, to must then be a wildcard
+// topic too. Messages of topics renamed to an empty topic aren't played.
+func ParseRemap(s string) (*Remap, error) {
+	r := Remap{topics: make(map[string]string), prefixes: make([]prefixRule, 0)}
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid remap '%v', from=to expected", item)
+		}
+		from, to := parts[0], parts[1]
+		if !strings.HasSuffix(from, "#") {
+			r.topics[from] = to
+			continue
+		}
+		if !isWildcard(from) {
+			return nil, fmt.Errorf("invalid remap '%v', wildcard '#' must follow a '/'", item)
+		}
+		if to != "" && !isWildcard(to) {
+			return nil, fmt.Errorf("invalid remap '%v', wildcard topic must be renamed to a wildcard topic", item)
+		}
+		r.prefixes = append(r.prefixes, prefixRule{from: strings.TrimSuffix(from, "#"), to: strings.TrimSuffix(to, "#"), drop: to == ""})
+	}
+	sort.SliceStable(r.prefixes, func(i, j int) bool { return len(r.prefixes[i].from) > len(r.prefixes[j].from) })
+	return &r, nil
+}
+
+// isWildcard returns true for mqtt multi-level wildcard topics, like 'car/#' or '#'
+func isWildcard(topic string) bool {
+	return topic == "#" || strings.HasSuffix(topic, "/#")
+}
+
+// Topic returns new name of topic, empty if messages of topic must be dropped
+func (r *Remap) Topic(topic string) string {
+	if r == nil {
+		return topic
+	}
+	if to, ok := r.topics[topic]; ok {
+		return to
+	}
+	for _, p := range r.prefixes {
+		parent := isParent(topic, p.from)
+		if !parent && !strings.HasPrefix(topic, p.from) {
+			continue
+		}
+		switch {
+		case p.drop:
+			return ""
+		case parent && p.to == "":
+			// Parent topic has no equivalent when renamed to root wildcard
+			return topic
+		case parent:
+			// 'car/#=sim/#' renames topic 'car' to 'sim'
+			return strings.TrimSuffix(p.to, "/")
+		default:
+			return p.to + strings.TrimPrefix(topic, p.from)
+		}
+	}
+	return topic
+}
+
+// isParent returns true if topic is the parent level of wildcard prefix, like 'car' for prefix 'car/'
+func isParent(topic, prefix string) bool {
+	return prefix != "" && topic+"/" == prefix
+}
@@ -0,0 +1,41 @@
+package bag
+
+import "testing"
+
+func TestRemap_Topic(t *testing.T) {
+	r, err := ParseRemap("car/frame=sim/frame, car/#=replay/#, car/part/#=replay/part/#, car/debug/#=, car/steering=")
+	if err != nil {
+		t.Fatalf("unable to parse remap: %v", err)
+	}
+	cases := map[string]string{
+		"car/frame":               "sim/frame",
+		"car/throttle":            "replay/throttle",
+		"car/part/road":           "replay/part/road",
+		"car/debug/objects":       "",
+		"car/steering":            "",
+		"other/frame":             "other/frame",
+		"cars/frame":              "cars/frame",
+		"car/part/pilot/steering": "replay/part/pilot/steering",
+		"car":                     "replay",
+		"car/part":                "replay/part",
+		"car/debug":               "",
+	}
+	for topic, expected := range cases {
+		if to := r.Topic(topic); to != expected {
+			t.Errorf("bad topic for %v: '%v', wants '%v'", topic, to, expected)
+		}
+	}
+
+	var identity *Remap
+	if to := identity.Topic("car/frame"); to != "car/frame" {
+		t.Errorf("nil remap must keep topic: %v", to)
+	}
+}
+
+func TestParseRemap_Invalid(t *testing.T) {
+	for _, s := range []string{"car/frame", "=sim/frame", "car/#=sim/frame", "car#=sim/#", "car/#=sim#"} {
+		if _, err := ParseRemap(s); err == nil {
+			t.Errorf("remap '%v' must be invalid", s)
+		}
+	}
+}
@@ -5,18 +5,39 @@ import (
 	"flag"
 	"fmt"
 	"github.com/cyrilix/robocar-base/cli"
+	"github.com/cyrilix/robocar-tools/bag"
+	"github.com/cyrilix/robocar-tools/dashboard"
 	"github.com/cyrilix/robocar-tools/dkimpt"
+	"github.com/cyrilix/robocar-tools/latency"
 	"github.com/cyrilix/robocar-tools/part"
 	"github.com/cyrilix/robocar-tools/pkg/data"
 	"github.com/cyrilix/robocar-tools/pkg/display"
+	"github.com/cyrilix/robocar-tools/pkg/export"
 	"github.com/cyrilix/robocar-tools/pkg/models"
+	"github.com/cyrilix/robocar-tools/pkg/overlay"
+	"github.com/cyrilix/robocar-tools/pkg/recordset"
+	"github.com/cyrilix/robocar-tools/pkg/stream"
+	"github.com/cyrilix/robocar-tools/pkg/synth"
 	"github.com/cyrilix/robocar-tools/pkg/train"
 	"github.com/cyrilix/robocar-tools/record"
+	"github.com/cyrilix/robocar-tools/replay"
+	"github.com/cyrilix/robocar-tools/sim"
 	"github.com/cyrilix/robocar-tools/video"
+	"github.com/cyrilix/robocar-tools/videxpt"
+	"github.com/cyrilix/robocar-tools/vidimpt"
+	"github.com/cyrilix/robocar-tools/viewer"
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 	"go.uber.org/zap"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 )
 
 const (
@@ -35,6 +56,7 @@ func main() {
 	var trainSliceSize int
 	var bucket, ociImage string
 	var debug bool
+	var controlTopic, controlAddr string
 
 	mqttQos := cli.InitIntFlag("MQTT_QOS", 0)
 	_, mqttRetain := os.LookupEnv("MQTT_RETAIN")
@@ -46,6 +68,15 @@ func main() {
 		fmt.Printf("  training  \n  \tManage training\n")
 		fmt.Printf("  models  \n  \tManage models\n")
 		fmt.Printf("  import-donkey-records \n  \tCopy donkeycar records to new format\n")
+		fmt.Printf("  import-video \n  \tBuild record set from video file and steering log\n")
+		fmt.Printf("  export-video \n  \tRender record set or live topics as video file with overlays\n")
+		fmt.Printf("  records \n  \tManage record sets\n")
+		fmt.Printf("  export \n  \tExport records to npz, csv or jsonl file\n")
+		fmt.Printf("  replay \n  \tReplay record set on mqtt topics\n")
+		fmt.Printf("  sim \n  \tSimulate car on a track from steering and throttle topics\n")
+		fmt.Printf("  dashboard \n  \tServe web dashboard with live frames and telemetry\n")
+		fmt.Printf("  latency \n  \tMeasure latency of topics computed from frames\n")
+		fmt.Printf("  bag \n  \tRecord and play raw mqtt messages\n")
 	}
 
 	err := cli.SetIntDefaultValueFromEnv(&trainSliceSize, "RC_TRAIN_SLICE_SIZE", DefaultTrainSliceSize)
@@ -57,23 +88,71 @@ func main() {
 
 	flag.BoolVar(&debug, "debug", false, "Display debug logs")
 
+	overlayStyle := overlay.DefaultStyle()
+
 	displayFlags := flag.NewFlagSet("display", flag.ExitOnError)
 
 	displayFlags.Usage = func() {
 		fmt.Printf("Usage of %s %s:\n", os.Args[0], displayFlags.Name())
 		fmt.Printf("  camera\n  \tLive from car camera\n")
 		fmt.Printf("  record\n  \tLive from published records\n")
+		fmt.Printf("  cameras\n  \tLive from several cameras tiled in one window\n")
 	}
 
 	displayRecordFlags := flag.NewFlagSet("record", flag.ExitOnError)
 	cli.InitMqttFlagSet(displayRecordFlags, DefaultClientId, &mqttBroker, &username, &password, &clientId, &mqttQos, &mqttRetain)
 	displayRecordFlags.StringVar(&recordTopic, "mqtt-topic-records", os.Getenv("MQTT_TOPIC_RECORDS"), "Mqtt topic that contains record data for training, use MQTT_TOPIC_RECORDS if args not set")
+	displayRecordFlags.StringVar(&controlTopic, "mqtt-topic-replay-control", os.Getenv("MQTT_TOPIC_REPLAY_CONTROL"), "Mqtt topic where to publish replay commands from window keystrokes, use MQTT_TOPIC_REPLAY_CONTROL if args not set")
+	var displayThrottleTopic, displayPilotSteeringTopic string
+	var displayChartWindow time.Duration
+	displayRecordFlags.StringVar(&displayThrottleTopic, "mqtt-topic-throttle", os.Getenv("MQTT_TOPIC_THROTTLE"), "Mqtt topic that contains throttle, use MQTT_TOPIC_THROTTLE if args not set")
+	displayRecordFlags.StringVar(&displayPilotSteeringTopic, "mqtt-topic-pilot-steering", os.Getenv("MQTT_TOPIC_PILOT_STEERING"), "Mqtt topic that contains steering predicted by autopilot, compared to record steering, use MQTT_TOPIC_PILOT_STEERING if args not set")
+	displayRecordFlags.DurationVar(&displayChartWindow, "chart-window", 5*time.Second, "Duration of steering and throttle history drawn as chart")
+	var displayDriveModeTopic string
+	var displayStaleAfter time.Duration
+	var displayMaxFps int
+	displayRecordFlags.StringVar(&displayDriveModeTopic, "mqtt-topic-drive-mode", os.Getenv("MQTT_TOPIC_DRIVE_MODE"), "Mqtt topic that contains drive mode, use MQTT_TOPIC_DRIVE_MODE if args not set")
+	displayRecordFlags.DurationVar(&displayStaleAfter, "stale-after", time.Second, "Highlight topics without message since this duration in status bar")
+	displayRecordFlags.IntVar(&displayMaxFps, "max-frame-per-second", 30, "Max frame per second rendered, records received faster are dropped")
+
+	var displayFrameTopics string
+	var displayColumns int
+	displayCamerasFlags := flag.NewFlagSet("cameras", flag.ExitOnError)
+	cli.InitMqttFlagSet(displayCamerasFlags, DefaultClientId, &mqttBroker, &username, &password, &clientId, &mqttQos, &mqttRetain)
+	displayCamerasFlags.StringVar(&displayFrameTopics, "mqtt-topic-frames", os.Getenv("MQTT_TOPIC_FRAMES"), "Comma separated list of mqtt topics that contain frames to display, use MQTT_TOPIC_FRAMES if args not set")
+	displayCamerasFlags.IntVar(&displayColumns, "columns", 0, "Number of tiles columns, 0 to tile frames as a square grid")
+	displayCamerasFlags.DurationVar(&displayStaleAfter, "stale-after", time.Second, "Highlight topics without frame since this duration in status bar")
+	displayCamerasFlags.IntVar(&displayMaxFps, "max-frame-per-second", 30, "Max frame per second rendered, frames received faster are dropped")
 
 	displayCameraFlags := flag.NewFlagSet("camera", flag.ExitOnError)
 	cli.InitMqttFlagSet(displayCameraFlags, DefaultClientId, &mqttBroker, &username, &password, &clientId, &mqttQos, &mqttRetain)
 	displayCameraFlags.StringVar(&frameTopic, "mqtt-topic-frame", os.Getenv("MQTT_TOPIC_FRAME"), "Mqtt topic that contains frame to display, use MQTT_TOPIC_FRAME if args not set")
 	displayCameraFlags.StringVar(&framePath, "frame-path", "", "Directory path where to read jpeg frame to inject in frame topic")
 	displayCameraFlags.IntVar(&fps, "frame-per-second", 25, "Video frame per second of frame to publish")
+	var cameraVideoFile string
+	var cameraWidth, cameraHeight int
+	var cameraLoop bool
+	displayCameraFlags.StringVar(&cameraVideoFile, "video-file", "", "mp4/avi video file where to read frames to inject in frame topic")
+	displayCameraFlags.IntVar(&cameraWidth, "video-width", 160, "Width of frames decoded from video file or synthetic frames, original video size if 0")
+	displayCameraFlags.IntVar(&cameraHeight, "video-height", 120, "Height of frames decoded from video file or synthetic frames, original video size if 0")
+	displayCameraFlags.BoolVar(&cameraLoop, "video-loop", true, "Restart video file at the end")
+	var synthFrames int
+	displayCameraFlags.IntVar(&synthFrames, "synthetic-frames", 0, "Number of synthetic track frames to inject in loop in frame topic, disabled if 0")
+	displayCameraFlags.StringVar(&controlTopic, "mqtt-topic-replay-control", os.Getenv("MQTT_TOPIC_REPLAY_CONTROL"), "Mqtt topic of replay commands sent from window keystrokes and applied to frames read from frame path, video file or synthetic frames, use MQTT_TOPIC_REPLAY_CONTROL if args not set")
+	displayCameraFlags.StringVar(&controlAddr, "control-addr", "", "Http address where to listen replay commands for frames read from frame path, video file or synthetic frames, disabled if not set")
+	var streamAddr string
+	var streamQuality, streamFps int
+	var noWindow bool
+	displayCameraFlags.StringVar(&streamAddr, "stream-addr", "", "Http address where to serve annotated frames as mjpeg stream on /stream and jpeg snapshot on /snapshot, like ':8081', disabled if not set")
+	displayCameraFlags.IntVar(&streamQuality, "stream-quality", 75, "Jpeg quality of streamed frames, from 1 to 100")
+	displayCameraFlags.IntVar(&streamFps, "stream-frame-per-second", 10, "Max frame per second of stream")
+	displayCameraFlags.BoolVar(&noWindow, "no-window", false, "Don't open display window, only serve http stream")
+	var syncDelay time.Duration
+	initOverlayFlagSet(displayCameraFlags, overlayStyle)
+	displayCameraFlags.StringVar(&displayDriveModeTopic, "mqtt-topic-drive-mode", os.Getenv("MQTT_TOPIC_DRIVE_MODE"), "Mqtt topic that contains drive mode, use MQTT_TOPIC_DRIVE_MODE if args not set")
+	displayCameraFlags.DurationVar(&displayStaleAfter, "stale-after", time.Second, "Highlight topics without message since this duration in status bar")
+	displayCameraFlags.IntVar(&displayMaxFps, "max-frame-per-second", 30, "Max frame per second rendered, frames received faster are dropped")
+	displayCameraFlags.DurationVar(&syncDelay, "sync-delay", 200*time.Millisecond, "Max delay to wait objects, road and throttle messages of a frame before to display it with missing or stale results")
 
 	displayCameraFlags.StringVar(&objectsTopic, "mqtt-topic-objects", os.Getenv("MQTT_TOPIC_OBJECTS"), "Mqtt topic that contains detected objects, use MQTT_TOPIC_OBJECTS if args not set")
 	displayCameraFlags.BoolVar(&withObjects, "with-objects", false, "Display detected objects")
@@ -88,11 +167,122 @@ func main() {
 	cli.InitMqttFlagSet(recordFlags, DefaultClientId, &mqttBroker, &username, &password, &clientId, &mqttQos, &mqttRetain)
 	recordFlags.StringVar(&recordTopic, "mqtt-topic-records", os.Getenv("MQTT_TOPIC_RECORDS"), "Mqtt topic that contains record data for training, use MQTT_TOPIC_RECORDS if args not set")
 	recordFlags.StringVar(&recordsPath, "record-path", os.Getenv("RECORD_PATH"), "Path where to write records files, use RECORD_PATH if args not set")
+	var recordMainCamera string
+	recordFlags.StringVar(&recordMainCamera, "main-camera", "", "Name of camera whose frames are labeled and written into cam directory, frames of other cameras are written into cam-<name>; all frames are labeled if empty")
+
+	var replayRecordSet, steeringTopic string
+	var replaySpeed float64
+	var replayLoop bool
+	replayFlags := flag.NewFlagSet("replay", flag.ExitOnError)
+	cli.InitMqttFlagSet(replayFlags, DefaultClientId, &mqttBroker, &username, &password, &clientId, &mqttQos, &mqttRetain)
+	replayFlags.StringVar(&replayRecordSet, "record-set", "", "Record set directory to replay (required)")
+	replayFlags.StringVar(&frameTopic, "mqtt-topic-frame", os.Getenv("MQTT_TOPIC_FRAME"), "Mqtt topic where to publish frames, use MQTT_TOPIC_FRAME if args not set")
+	replayFlags.StringVar(&steeringTopic, "mqtt-topic-steering", os.Getenv("MQTT_TOPIC_STEERING"), "Mqtt topic where to publish steering, use MQTT_TOPIC_STEERING if args not set")
+	replayFlags.StringVar(&recordTopic, "mqtt-topic-records", os.Getenv("MQTT_TOPIC_RECORDS"), "Mqtt topic where to publish records, use MQTT_TOPIC_RECORDS if args not set")
+	replayFlags.Float64Var(&replaySpeed, "speed", 1., "Speed multiplier applied to original timing")
+	replayFlags.IntVar(&fps, "frame-per-second", 25, "Video frame per second when frame ids aren't timestamps")
+	replayFlags.BoolVar(&replayLoop, "loop", false, "Replay record set until interrupted, replay once if not set")
+	replayFlags.StringVar(&controlTopic, "mqtt-topic-replay-control", os.Getenv("MQTT_TOPIC_REPLAY_CONTROL"), "Mqtt topic where to listen replay commands (pause, resume, toggle, step, back, seek, speed, faster, slower), use MQTT_TOPIC_REPLAY_CONTROL if args not set")
+	replayFlags.StringVar(&controlAddr, "control-addr", "", "Http address where to listen replay commands, like ':8080', disabled if not set")
+
+	var simThrottleTopic, simEventsTopic, simTrack string
+	var simWidth, simHeight int
+	simFlags := flag.NewFlagSet("sim", flag.ExitOnError)
+	cli.InitMqttFlagSet(simFlags, DefaultClientId, &mqttBroker, &username, &password, &clientId, &mqttQos, &mqttRetain)
+	simFlags.StringVar(&steeringTopic, "mqtt-topic-steering", os.Getenv("MQTT_TOPIC_STEERING"), "Mqtt topic that contains steering to apply, use MQTT_TOPIC_STEERING if args not set")
+	simFlags.StringVar(&simThrottleTopic, "mqtt-topic-throttle", os.Getenv("MQTT_TOPIC_THROTTLE"), "Mqtt topic that contains throttle to apply, use MQTT_TOPIC_THROTTLE if args not set")
+	simFlags.StringVar(&frameTopic, "mqtt-topic-frame", os.Getenv("MQTT_TOPIC_FRAME"), "Mqtt topic where to publish camera frames, use MQTT_TOPIC_FRAME if args not set")
+	simFlags.StringVar(&simEventsTopic, "mqtt-topic-sim-events", os.Getenv("MQTT_TOPIC_SIM_EVENTS"), "Mqtt topic where to publish lap and off-track json events, use MQTT_TOPIC_SIM_EVENTS if args not set")
+	simFlags.StringVar(&simTrack, "track", "", "Json track file like {\"width\": 1.2, \"points\": [[0, 0], [10, 0], [10, 10]]}, default winding track if not set")
+	simFlags.IntVar(&fps, "frame-per-second", 20, "Simulation steps and frames per second")
+	simFlags.IntVar(&simWidth, "image-width", 160, "Camera frame width")
+	simFlags.IntVar(&simHeight, "image-height", 120, "Camera frame height")
+
+	var dashboardAddr, dashboardThrottleTopic, dashboardDriveModeTopic string
+	var dashboardQuality, dashboardFps, dashboardTelemetryRate int
+	dashboardFlags := flag.NewFlagSet("dashboard", flag.ExitOnError)
+	cli.InitMqttFlagSet(dashboardFlags, DefaultClientId, &mqttBroker, &username, &password, &clientId, &mqttQos, &mqttRetain)
+	dashboardFlags.StringVar(&dashboardAddr, "http-addr", ":8080", "Http address where to serve dashboard")
+	dashboardFlags.StringVar(&frameTopic, "mqtt-topic-frame", os.Getenv("MQTT_TOPIC_FRAME"), "Mqtt topic that contains frames, use MQTT_TOPIC_FRAME if args not set")
+	dashboardFlags.StringVar(&steeringTopic, "mqtt-topic-steering", os.Getenv("MQTT_TOPIC_STEERING"), "Mqtt topic that contains steering, use MQTT_TOPIC_STEERING if args not set")
+	dashboardFlags.StringVar(&dashboardThrottleTopic, "mqtt-topic-throttle", os.Getenv("MQTT_TOPIC_THROTTLE"), "Mqtt topic that contains throttle, use MQTT_TOPIC_THROTTLE if args not set")
+	dashboardFlags.StringVar(&throttleFeedbackTopic, "mqtt-topic-throttle-feedback", os.Getenv("MQTT_TOPIC_THROTTLE_FEEDBACK"), "Mqtt topic that contains throttle feedback, use MQTT_TOPIC_THROTTLE_FEEDBACK if args not set")
+	dashboardFlags.StringVar(&dashboardDriveModeTopic, "mqtt-topic-drive-mode", os.Getenv("MQTT_TOPIC_DRIVE_MODE"), "Mqtt topic that contains drive mode, use MQTT_TOPIC_DRIVE_MODE if args not set")
+	dashboardFlags.StringVar(&objectsTopic, "mqtt-topic-objects", os.Getenv("MQTT_TOPIC_OBJECTS"), "Mqtt topic that contains detected objects, use MQTT_TOPIC_OBJECTS if args not set")
+	dashboardFlags.StringVar(&roadTopic, "mqtt-topic-road", os.Getenv("MQTT_TOPIC_ROAD"), "Mqtt topic that contains road description, use MQTT_TOPIC_ROAD if args not set")
+	dashboardFlags.IntVar(&dashboardQuality, "stream-quality", 75, "Jpeg quality of streamed frames, from 1 to 100")
+	dashboardFlags.IntVar(&dashboardFps, "stream-frame-per-second", 10, "Max frame per second of stream")
+	dashboardFlags.IntVar(&dashboardTelemetryRate, "telemetry-rate", 10, "Number of telemetry updates sent to browsers per second")
+	initOverlayFlagSet(dashboardFlags, overlayStyle)
 
 	var basedir, destdir string
+	var latencyStages string
+	var latencyTimeout, latencyInterval time.Duration
+	latencyFlags := flag.NewFlagSet("latency", flag.ExitOnError)
+	cli.InitMqttFlagSet(latencyFlags, DefaultClientId, &mqttBroker, &username, &password, &clientId, &mqttQos, &mqttRetain)
+	latencyFlags.StringVar(&frameTopic, "mqtt-topic-frame", os.Getenv("MQTT_TOPIC_FRAME"), "Mqtt topic that contains frames, use MQTT_TOPIC_FRAME if args not set")
+	latencyFlags.StringVar(&latencyStages, "stages", os.Getenv("LATENCY_STAGES"), "Comma separated list of [name=]type:topic stages computed from frames, type is one of steering, throttle, objects or road, use LATENCY_STAGES if args not set")
+	latencyFlags.DurationVar(&latencyTimeout, "timeout", 1*time.Second, "Delay after which a frame without response is counted as missing")
+	latencyFlags.DurationVar(&latencyInterval, "report-interval", 5*time.Second, "Delay between live reports")
+
+	bagFlags := flag.NewFlagSet("bag", flag.ExitOnError)
+	bagFlags.Usage = func() {
+		fmt.Printf("Usage of %s %s:\n", os.Args[0], bagFlags.Name())
+		fmt.Printf("  record\n  \tRecord messages of topics into a bag file\n")
+		fmt.Printf("  play\n  \tPublish messages of a bag file with their original timing\n")
+		fmt.Printf("  info\n  \tList topics of a bag file\n")
+	}
+
+	var bagFile, bagTopics, bagRemap string
+	bagRecordFlags := flag.NewFlagSet("record", flag.ExitOnError)
+	cli.InitMqttFlagSet(bagRecordFlags, DefaultClientId, &mqttBroker, &username, &password, &clientId, &mqttQos, &mqttRetain)
+	bagRecordFlags.StringVar(&bagFile, "output", "", "Bag file where to write messages (required)")
+	bagRecordFlags.StringVar(&bagTopics, "topics", os.Getenv("BAG_TOPICS"), "Comma separated list of topics to record, mqtt wildcards '+' and '#' are allowed, use BAG_TOPICS if args not set")
+
+	bagPlayFlags := flag.NewFlagSet("play", flag.ExitOnError)
+	cli.InitMqttFlagSet(bagPlayFlags, DefaultClientId, &mqttBroker, &username, &password, &clientId, &mqttQos, &mqttRetain)
+	bagPlayFlags.StringVar(&bagFile, "bag", "", "Bag file to play (required)")
+	bagPlayFlags.StringVar(&bagRemap, "remap", os.Getenv("BAG_REMAP"), "Comma separated list of from=to topic renames, 'car/#=sim/#' renames all topics under car/, messages of topics renamed to nothing aren't played, use BAG_REMAP if args not set")
+	bagPlayFlags.Float64Var(&replaySpeed, "speed", 1., "Speed multiplier applied to original timing")
+	bagPlayFlags.BoolVar(&replayLoop, "loop", false, "Play bag until interrupted, play once if not set")
+	bagPlayFlags.StringVar(&controlTopic, "mqtt-topic-replay-control", os.Getenv("MQTT_TOPIC_REPLAY_CONTROL"), "Mqtt topic where to listen replay commands (pause, resume, toggle, step, back, seek, speed, faster, slower), use MQTT_TOPIC_REPLAY_CONTROL if args not set")
+	bagPlayFlags.StringVar(&controlAddr, "control-addr", "", "Http address where to listen replay commands, like ':8080', disabled if not set")
+
+	bagInfoFlags := flag.NewFlagSet("info", flag.ExitOnError)
+	bagInfoFlags.StringVar(&bagFile, "bag", "", "Bag file to describe (required)")
+
 	impdkFlags := flag.NewFlagSet("import-donkey-records", flag.ExitOnError)
 	impdkFlags.StringVar(&basedir, "from", "", "source directory")
 	impdkFlags.StringVar(&destdir, "to", "", "destination directory")
+	var dryRun bool
+	impdkFlags.BoolVar(&dryRun, "dry-run", false, "List planned copies without writing files")
+
+	var videoFile, steeringLogFile, videoRecordSet, videoStart string
+	var videoOffset, videoMaxDelta time.Duration
+	impVideoFlags := flag.NewFlagSet("import-video", flag.ExitOnError)
+	impVideoFlags.StringVar(&videoFile, "video", "", "mp4/avi video file (required)")
+	impVideoFlags.StringVar(&steeringLogFile, "steering-log", "", "csv file with 'timestamp' and 'steering' columns (required)")
+	impVideoFlags.StringVar(&destdir, "to", "", "destination directory (required)")
+	impVideoFlags.StringVar(&videoRecordSet, "record-set", "", "record set name, video file name if not set")
+	impVideoFlags.StringVar(&videoStart, "video-start", "", "RFC3339 date of first video frame, first steering log timestamp if not set")
+	impVideoFlags.DurationVar(&videoOffset, "offset", 0, "Shift added to frame timestamps to align them with steering log")
+	impVideoFlags.DurationVar(&videoMaxDelta, "max-delta", 100*time.Millisecond, "Max duration between a frame and its steering log row, frames without row are skipped")
+
+	var expVideoRecordSet, expVideoOutput, expVideoThrottleTopic, expVideoDriveModeTopic string
+	var expVideoDuration time.Duration
+	expVideoFlags := flag.NewFlagSet("export-video", flag.ExitOnError)
+	cli.InitMqttFlagSet(expVideoFlags, DefaultClientId, &mqttBroker, &username, &password, &clientId, &mqttQos, &mqttRetain)
+	expVideoFlags.StringVar(&expVideoRecordSet, "record-set", "", "Record set directory to render, live mqtt topics are rendered if not set")
+	expVideoFlags.StringVar(&expVideoOutput, "output", "", "mp4/avi video file to write (required)")
+	expVideoFlags.IntVar(&fps, "frame-per-second", 25, "Video frame per second, also used for record sets whose frame ids aren't timestamps")
+	expVideoFlags.DurationVar(&expVideoDuration, "duration", time.Minute, "Duration of live recording, stopped before on interrupt")
+	expVideoFlags.StringVar(&frameTopic, "mqtt-topic-frame", os.Getenv("MQTT_TOPIC_FRAME"), "Mqtt topic that contains frames, use MQTT_TOPIC_FRAME if args not set")
+	expVideoFlags.StringVar(&steeringTopic, "mqtt-topic-steering", os.Getenv("MQTT_TOPIC_STEERING"), "Mqtt topic that contains steering, use MQTT_TOPIC_STEERING if args not set")
+	expVideoFlags.StringVar(&expVideoThrottleTopic, "mqtt-topic-throttle", os.Getenv("MQTT_TOPIC_THROTTLE"), "Mqtt topic that contains throttle, use MQTT_TOPIC_THROTTLE if args not set")
+	expVideoFlags.StringVar(&objectsTopic, "mqtt-topic-objects", os.Getenv("MQTT_TOPIC_OBJECTS"), "Mqtt topic that contains detected objects, use MQTT_TOPIC_OBJECTS if args not set")
+	expVideoFlags.StringVar(&roadTopic, "mqtt-topic-road", os.Getenv("MQTT_TOPIC_ROAD"), "Mqtt topic that contains road description, use MQTT_TOPIC_ROAD if args not set")
+	expVideoFlags.StringVar(&expVideoDriveModeTopic, "mqtt-topic-drive-mode", os.Getenv("MQTT_TOPIC_DRIVE_MODE"), "Mqtt topic that contains drive mode, use MQTT_TOPIC_DRIVE_MODE if args not set")
+	initOverlayFlagSet(expVideoFlags, overlayStyle)
 
 	trainingFlags := flag.NewFlagSet("training", flag.ExitOnError)
 	trainingFlags.Usage = func() {
@@ -107,9 +297,12 @@ func main() {
 	var withFlipImage bool
 	var trainImageHeight, trainImageWidth int
 	var enableSpotTraining bool
+	var steeringBins int
+	var steeringBinsDistribution string
+	var trainArchiveCameras string
 	trainingRunFlags := flag.NewFlagSet("run", flag.ExitOnError)
 	trainingRunFlags.StringVar(&bucket, "bucket", os.Getenv("RC_TRAIN_BUCKET"), "AWS bucket where store data required, use RC_TRAIN_BUCKET if arg not set")
-	trainingRunFlags.StringVar(&recordsPath, "record-path", os.Getenv("RECORD_PATH"), "Input data path where records and img files are stored, use RECORD_PATH if arg not set")
+	trainingRunFlags.StringVar(&recordsPath, "record-path", os.Getenv("RECORD_PATH"), "Comma separated list of record sets, root directories, glob patterns or s3://bucket/prefix where records and img files are stored, use RECORD_PATH if arg not set")
 	trainingRunFlags.StringVar(&modelPath, "output-model-path", "", "Path where to write output model archive")
 	trainingRunFlags.IntVar(&trainSliceSize, "slice-size", trainSliceSize, "Number of record to shift with image, use RC_TRAIN_SLICE_SIZE if args not set")
 	trainingRunFlags.StringVar(&ociImage, "oci-image", os.Getenv("RC_TRAIN_OCI_IMAGE"), "OCI image to run (required), use RC_TRAIN_OCI_IMAGE if args not set")
@@ -121,18 +314,24 @@ func main() {
 	trainingRunFlags.IntVar(&trainImageWidth, "image-width", 160, "Pixels image width")
 	trainingRunFlags.IntVar(&horizon, "horizon", 0, "Upper zone image to crop (in pixels)")
 	trainingRunFlags.StringVar(&modelType, "model-type", train.ModelTypeCategorical.String(), "Type model to build")
+	trainingRunFlags.IntVar(&steeringBins, "steering-bins", 0, "Number of categorical steering bins to compute into archive, 0 to let training compute them (categorical model only)")
+	trainingRunFlags.StringVar(&steeringBinsDistribution, "steering-bins-distribution", data.BinDistributionLinear.String(), "Steering bins edges distribution: linear or nonlinear")
+	trainingRunFlags.StringVar(&trainArchiveCameras, "cameras", record.MainCamera, "Comma separated list of cameras whose images are used, images of several cameras are stacked vertically")
 
 	trainingRunFlags.BoolVar(&enableSpotTraining, "enable-spot-training", true, "Train models using managed spot training")
 	trainingListJobFlags := flag.NewFlagSet("list", flag.ExitOnError)
 
 	trainArchiveFlags := flag.NewFlagSet("archive", flag.ExitOnError)
-	trainArchiveFlags.StringVar(&recordsPath, "record-path", os.Getenv("RECORD_PATH"), "Path where records files are stored, use RECORD_PATH if args not set")
+	trainArchiveFlags.StringVar(&recordsPath, "record-path", os.Getenv("RECORD_PATH"), "Comma separated list of record sets, root directories, glob patterns or s3://bucket/prefix where records files are stored, use RECORD_PATH if args not set")
 	trainArchiveFlags.StringVar(&trainArchiveName, "output", os.Getenv("TRAIN_ARCHIVE_NAME"), "Zip archive file name, use TRAIN_ARCHIVE_NAME if args not set")
 	trainArchiveFlags.IntVar(&trainSliceSize, "slice-size", trainSliceSize, "Number of record to shift with image, use TRAIN_SLICE_SIZE if args not set")
 	trainArchiveFlags.IntVar(&trainImageWidth, "image-width", 0, "Resize image width")
 	trainArchiveFlags.IntVar(&trainImageHeight, "image-height", 0, "Resize image height")
 	trainArchiveFlags.IntVar(&horizon, "horizon", 0, "Upper zone image to crop (in pixels)")
 	trainArchiveFlags.BoolVar(&withFlipImage, "with-flip-image", withFlipImage, "Flip horiontal image and reverse steering to increase data into training archive")
+	trainArchiveFlags.IntVar(&steeringBins, "steering-bins", 0, "Number of categorical steering bins to compute into archive, 0 to disable")
+	trainArchiveFlags.StringVar(&steeringBinsDistribution, "steering-bins-distribution", data.BinDistributionLinear.String(), "Steering bins edges distribution: linear or nonlinear")
+	trainArchiveFlags.StringVar(&trainArchiveCameras, "cameras", record.MainCamera, "Comma separated list of cameras whose images are used, images of several cameras are stacked vertically")
 
 	modelsFlags := flag.NewFlagSet("models", flag.ExitOnError)
 	modelsFlags.Usage = func() {
@@ -149,6 +348,77 @@ func main() {
 	modelsDownloadFlags.StringVar(&bucket, "bucket", os.Getenv("RC_TRAIN_BUCKET"), "AWS bucket where store data required, use RC_TRAIN_BUCKET if arg not set")
 	modelsDownloadFlags.StringVar(&modelPathBucket, "model", "", "S3 Model key into bucket (mandatory)")
 	modelsDownloadFlags.StringVar(&trainArchiveName, "output", os.Getenv("TRAIN_ARCHIVE_NAME"), "Zip archive file name, use TRAIN_ARCHIVE_NAME if args not set")
+
+	recordsFlags := flag.NewFlagSet("records", flag.ExitOnError)
+	recordsFlags.Usage = func() {
+		fmt.Printf("Usage of %s %s:\n", os.Args[0], recordsFlags.Name())
+		fmt.Printf("  merge\n  \tCopy record sets into a new one\n")
+		fmt.Printf("  split\n  \tMove records from a frame or timestamp into a new record set\n")
+		fmt.Printf("  trim\n  \tRemove leading/trailing records\n")
+		fmt.Printf("  rename\n  \tRename record set\n")
+		fmt.Printf("  synth\n  \tGenerate record set of synthetic track frames\n")
+		fmt.Printf("  view\n  \tBrowse record set frames with keyboard, exclude frames and correct steering\n")
+	}
+
+	var recordSetPath, recordSetOutput, recordSetName, splitTime string
+	var splitFrame, trimHead, trimTail int
+	recordsMergeFlags := flag.NewFlagSet("merge", flag.ExitOnError)
+	recordsMergeFlags.StringVar(&recordSetOutput, "output", "", "Record set directory where to copy records (required), record sets to merge are given as arguments")
+
+	recordsSplitFlags := flag.NewFlagSet("split", flag.ExitOnError)
+	recordsSplitFlags.StringVar(&recordSetPath, "record-set", "", "Record set directory to split (required)")
+	recordsSplitFlags.StringVar(&recordSetOutput, "output", "", "Record set directory where to move records after split point (required)")
+	recordsSplitFlags.IntVar(&splitFrame, "frame", 0, "Position of first frame to move")
+	recordsSplitFlags.StringVar(&splitTime, "time", "", "Timestamp of first frame to move, RFC3339 date or unix timestamp in milliseconds")
+
+	recordsTrimFlags := flag.NewFlagSet("trim", flag.ExitOnError)
+	recordsTrimFlags.StringVar(&recordSetPath, "record-set", "", "Record set directory to trim (required)")
+	recordsTrimFlags.IntVar(&trimHead, "head", 0, "Number of leading records to remove")
+	recordsTrimFlags.IntVar(&trimTail, "tail", 0, "Number of trailing records to remove")
+
+	recordsRenameFlags := flag.NewFlagSet("rename", flag.ExitOnError)
+	recordsRenameFlags.StringVar(&recordSetPath, "record-set", "", "Record set directory to rename (required)")
+	recordsRenameFlags.StringVar(&recordSetName, "name", "", "New record set name (required)")
+
+	var synthCount, synthWidth, synthHeight int
+	var synthSeed int64
+	var synthInterval time.Duration
+	var synthMaxCurvature, synthNoise, synthBrightness, synthBrightnessStep float64
+	recordsSynthFlags := flag.NewFlagSet("synth", flag.ExitOnError)
+	recordsSynthFlags.StringVar(&recordSetOutput, "output", "", "Record set directory where to write synthetic records (required)")
+	recordsSynthFlags.IntVar(&synthCount, "count", 100, "Number of frames to generate")
+	recordsSynthFlags.IntVar(&synthWidth, "image-width", 160, "Frame width")
+	recordsSynthFlags.IntVar(&synthHeight, "image-height", 120, "Frame height")
+	recordsSynthFlags.Int64Var(&synthSeed, "seed", 1, "Seed of random track, same seed generates same frames")
+	recordsSynthFlags.DurationVar(&synthInterval, "interval", 50*time.Millisecond, "Delay between frame timestamps")
+	recordsSynthFlags.Float64Var(&synthMaxCurvature, "max-curvature", 0.8, "Max track curvature, in [0, 1]")
+	recordsSynthFlags.Float64Var(&synthNoise, "noise", 4., "Standard deviation of pixel noise")
+	recordsSynthFlags.Float64Var(&synthBrightness, "brightness", 1., "Lighting of scenes, 1 is daylight")
+	recordsSynthFlags.Float64Var(&synthBrightnessStep, "brightness-step", 0., "Standard deviation of lighting change between frames")
+
+	var viewMarks string
+	var viewFps, viewJump, viewFrame int
+	var viewSpeed float64
+	recordsViewFlags := flag.NewFlagSet("view", flag.ExitOnError)
+	recordsViewFlags.StringVar(&recordSetPath, "record-set", "", "Record set directory to browse (required)")
+	recordsViewFlags.StringVar(&viewMarks, "marks", "", "File where to save marked frames, default to "+viewer.MarksFileName+" into record set directory")
+	recordsViewFlags.IntVar(&viewFps, "frame-per-second", 25, "Playback rate of frames without timestamp")
+	recordsViewFlags.Float64Var(&viewSpeed, "speed", 1., "Playback speed, 2 plays twice as fast")
+	recordsViewFlags.IntVar(&viewJump, "jump", 10, "Number of frames skipped by '.' and ',' keys")
+	recordsViewFlags.IntVar(&viewFrame, "frame", 0, "Position of first frame shown")
+
+	var exportOutput, exportFormat string
+	var exportSelection export.Selection
+	exportFlags := flag.NewFlagSet("export", flag.ExitOnError)
+	exportFlags.StringVar(&recordsPath, "record-path", os.Getenv("RECORD_PATH"), "Comma separated list of record sets, root directories, glob patterns or s3://bucket/prefix where records files are stored, use RECORD_PATH if args not set")
+	exportFlags.StringVar(&exportOutput, "output", "", "File where to write records (required)")
+	exportFlags.StringVar(&exportFormat, "format", export.FormatNpz.String(), "Output format: npz, csv or jsonl")
+	exportFlags.IntVar(&exportSelection.From, "from", 0, "Position of first record to export for each record set")
+	exportFlags.IntVar(&exportSelection.To, "to", 0, "Position of last record (excluded) to export for each record set, 0 to export until the end")
+	exportFlags.IntVar(&exportSelection.Step, "step", 1, "Export one record every step records")
+	exportFlags.IntVar(&trainImageWidth, "image-width", 0, "Resize image width (npz only)")
+	exportFlags.IntVar(&trainImageHeight, "image-height", 0, "Resize image height (npz only)")
+	exportFlags.IntVar(&horizon, "horizon", 0, "Upper zone image to crop (in pixels, npz only)")
 	flag.Parse()
 
 	config := zap.NewDevelopmentConfig()
@@ -188,7 +458,17 @@ func main() {
 			if err != nil {
 				zap.S().Fatalf("unable to connect to mqtt bus: %v", err)
 			}
-			runDisplayRecord(client, recordTopic)
+			runDisplayRecord(client, recordTopic, controlTopic, displayThrottleTopic, displayPilotSteeringTopic, displayDriveModeTopic, displayChartWindow, displayStaleAfter, displayMaxFps)
+		case displayCamerasFlags.Name():
+			if err := displayCamerasFlags.Parse(os.Args[3:]); err == flag.ErrHelp {
+				displayCamerasFlags.PrintDefaults()
+				os.Exit(0)
+			}
+			client, err := cli.Connect(mqttBroker, username, password, clientId)
+			if err != nil {
+				zap.S().Fatalf("unable to connect to mqtt bus: %v", err)
+			}
+			runDisplayCameras(client, parseList(displayFrameTopics), displayColumns, displayStaleAfter, displayMaxFps)
 		case displayCameraFlags.Name():
 			if err := displayCameraFlags.Parse(os.Args[3:]); err == flag.ErrHelp {
 				displayCameraFlags.PrintDefaults()
@@ -199,7 +479,7 @@ func main() {
 				zap.S().Fatalf("unable to connect to mqtt bus: %v", err)
 			}
 			defer client.Disconnect(50)
-			runDisplay(client, framePath, frameTopic, fps, objectsTopic, roadTopic, throttleFeedbackTopic, withObjects, withRoad, withThrottleFeedback)
+			runDisplay(client, framePath, cameraVideoFile, synthFrames, cameraWidth, cameraHeight, cameraLoop, frameTopic, fps, objectsTopic, roadTopic, throttleFeedbackTopic, controlTopic, controlAddr, streamAddr, streamQuality, streamFps, noWindow, syncDelay, overlayStyle, displayDriveModeTopic, displayStaleAfter, displayMaxFps, withObjects, withRoad, withThrottleFeedback)
 		default:
 			displayFlags.PrintDefaults()
 			os.Exit(0)
@@ -214,13 +494,116 @@ func main() {
 			log.Fatalf("unable to connect to mqtt bus: %v", err)
 		}
 		defer client.Disconnect(50)
-		runRecord(client, recordsPath, recordTopic)
+		runRecord(client, recordsPath, recordTopic, recordMainCamera)
+	case replayFlags.Name():
+		if err := replayFlags.Parse(os.Args[2:]); err == flag.ErrHelp {
+			replayFlags.PrintDefaults()
+			os.Exit(0)
+		}
+		client, err := cli.Connect(mqttBroker, username, password, clientId)
+		if err != nil {
+			zap.S().Fatalf("unable to connect to mqtt bus: %v", err)
+		}
+		defer client.Disconnect(50)
+		runReplay(client, replayRecordSet, frameTopic, steeringTopic, recordTopic, controlTopic, controlAddr, replaySpeed, fps, replayLoop)
+	case simFlags.Name():
+		if err := simFlags.Parse(os.Args[2:]); err == flag.ErrHelp {
+			simFlags.PrintDefaults()
+			os.Exit(0)
+		}
+		client, err := cli.Connect(mqttBroker, username, password, clientId)
+		if err != nil {
+			zap.S().Fatalf("unable to connect to mqtt bus: %v", err)
+		}
+		defer client.Disconnect(50)
+		runSim(client, simTrack, steeringTopic, simThrottleTopic, frameTopic, simEventsTopic, simWidth, simHeight, fps)
+	case dashboardFlags.Name():
+		if err := dashboardFlags.Parse(os.Args[2:]); err == flag.ErrHelp {
+			dashboardFlags.PrintDefaults()
+			os.Exit(0)
+		}
+		client, err := cli.Connect(mqttBroker, username, password, clientId)
+		if err != nil {
+			zap.S().Fatalf("unable to connect to mqtt bus: %v", err)
+		}
+		defer client.Disconnect(50)
+		runDashboard(client, dashboardAddr, frameTopic, steeringTopic, dashboardThrottleTopic, throttleFeedbackTopic, dashboardDriveModeTopic, objectsTopic, roadTopic, dashboardQuality, dashboardFps, dashboardTelemetryRate, overlayStyle)
+	case latencyFlags.Name():
+		if err := latencyFlags.Parse(os.Args[2:]); err == flag.ErrHelp {
+			latencyFlags.PrintDefaults()
+			os.Exit(0)
+		}
+		client, err := cli.Connect(mqttBroker, username, password, clientId)
+		if err != nil {
+			zap.S().Fatalf("unable to connect to mqtt bus: %v", err)
+		}
+		defer client.Disconnect(50)
+		runLatency(client, frameTopic, latencyStages, latencyTimeout, latencyInterval)
+	case bagFlags.Name():
+		if err := bagFlags.Parse(os.Args[2:]); err == flag.ErrHelp {
+			bagFlags.PrintDefaults()
+			os.Exit(0)
+		}
+		switch bagFlags.Arg(0) {
+		case bagRecordFlags.Name():
+			if err := bagRecordFlags.Parse(os.Args[3:]); err == flag.ErrHelp {
+				bagRecordFlags.PrintDefaults()
+				os.Exit(0)
+			}
+			client, err := cli.Connect(mqttBroker, username, password, clientId)
+			if err != nil {
+				zap.S().Fatalf("unable to connect to mqtt bus: %v", err)
+			}
+			defer client.Disconnect(50)
+			runBagRecord(client, bagFile, parseList(bagTopics))
+		case bagPlayFlags.Name():
+			if err := bagPlayFlags.Parse(os.Args[3:]); err == flag.ErrHelp {
+				bagPlayFlags.PrintDefaults()
+				os.Exit(0)
+			}
+			client, err := cli.Connect(mqttBroker, username, password, clientId)
+			if err != nil {
+				zap.S().Fatalf("unable to connect to mqtt bus: %v", err)
+			}
+			defer client.Disconnect(50)
+			runBagPlay(client, bagFile, bagRemap, controlTopic, controlAddr, replaySpeed, replayLoop)
+		case bagInfoFlags.Name():
+			if err := bagInfoFlags.Parse(os.Args[3:]); err == flag.ErrHelp {
+				bagInfoFlags.PrintDefaults()
+				os.Exit(0)
+			}
+			runBagInfo(bagFile)
+		default:
+			bagFlags.PrintDefaults()
+			os.Exit(0)
+		}
 	case impdkFlags.Name():
 		if err := impdkFlags.Parse(os.Args[2:]); err == flag.ErrHelp {
 			impdkFlags.PrintDefaults()
 			os.Exit(0)
 		}
-		runImportDonkeyRecords(basedir, destdir)
+		runImportDonkeyRecords(basedir, destdir, dryRun)
+	case impVideoFlags.Name():
+		if err := impVideoFlags.Parse(os.Args[2:]); err == flag.ErrHelp {
+			impVideoFlags.PrintDefaults()
+			os.Exit(0)
+		}
+		runImportVideo(videoFile, steeringLogFile, destdir, videoRecordSet, videoStart, videoOffset, videoMaxDelta)
+	case expVideoFlags.Name():
+		if err := expVideoFlags.Parse(os.Args[2:]); err == flag.ErrHelp {
+			expVideoFlags.PrintDefaults()
+			os.Exit(0)
+		}
+		if expVideoRecordSet != "" {
+			runExportRecordSetVideo(expVideoRecordSet, expVideoOutput, fps, overlayStyle)
+			break
+		}
+		client, err := cli.Connect(mqttBroker, username, password, clientId)
+		if err != nil {
+			zap.S().Fatalf("unable to connect to mqtt bus: %v", err)
+		}
+		defer client.Disconnect(50)
+		runExportLiveVideo(client, expVideoOutput, frameTopic, steeringTopic, expVideoThrottleTopic, objectsTopic, roadTopic, expVideoDriveModeTopic, fps, expVideoDuration, overlayStyle)
 	case trainingFlags.Name():
 		if err := trainingFlags.Parse(os.Args[2:]); err == flag.ErrHelp {
 			trainingFlags.PrintDefaults()
@@ -238,13 +621,13 @@ func main() {
 				trainingRunFlags.PrintDefaults()
 				os.Exit(0)
 			}
-			runTraining(bucket, ociImage, roleArn, trainJobName, recordsPath, train.ParseModelType(modelType), trainSliceSize, trainImageWidth, trainImageHeight, horizon, withFlipImage, modelPath, enableSpotTraining)
+			runTraining(bucket, ociImage, roleArn, trainJobName, data.ParseSources(recordsPath), train.ParseModelType(modelType), trainSliceSize, trainImageWidth, trainImageHeight, horizon, withFlipImage, steeringBins, data.ParseBinDistribution(steeringBinsDistribution), parseList(trainArchiveCameras), modelPath, enableSpotTraining)
 		case trainArchiveFlags.Name():
 			if err := trainArchiveFlags.Parse(os.Args[3:]); err == flag.ErrHelp {
 				trainArchiveFlags.PrintDefaults()
 				os.Exit(0)
 			}
-			runTrainArchive(recordsPath, trainArchiveName, trainSliceSize, trainImageWidth, trainImageHeight, horizon, withFlipImage)
+			runTrainArchive(data.ParseSources(recordsPath), trainArchiveName, trainSliceSize, trainImageWidth, trainImageHeight, horizon, withFlipImage, steeringBins, data.ParseBinDistribution(steeringBinsDistribution), parseList(trainArchiveCameras))
 		default:
 			trainingFlags.PrintDefaults()
 			os.Exit(0)
@@ -278,6 +661,63 @@ func main() {
 			modelsFlags.PrintDefaults()
 			os.Exit(0)
 		}
+	case exportFlags.Name():
+		if err := exportFlags.Parse(os.Args[2:]); err == flag.ErrHelp {
+			exportFlags.PrintDefaults()
+			os.Exit(0)
+		}
+		runExport(data.ParseSources(recordsPath), exportOutput, exportFormat, exportSelection, export.Geometry{Width: trainImageWidth, Height: trainImageHeight, Horizon: horizon})
+	case recordsFlags.Name():
+		if err := recordsFlags.Parse(os.Args[2:]); err == flag.ErrHelp {
+			recordsFlags.PrintDefaults()
+			os.Exit(0)
+		}
+		switch recordsFlags.Arg(0) {
+		case recordsMergeFlags.Name():
+			if err := recordsMergeFlags.Parse(os.Args[3:]); err == flag.ErrHelp {
+				recordsMergeFlags.PrintDefaults()
+				os.Exit(0)
+			}
+			runRecordsMerge(recordSetOutput, recordsMergeFlags.Args())
+		case recordsSplitFlags.Name():
+			if err := recordsSplitFlags.Parse(os.Args[3:]); err == flag.ErrHelp {
+				recordsSplitFlags.PrintDefaults()
+				os.Exit(0)
+			}
+			runRecordsSplit(recordSetPath, recordSetOutput, splitFrame, splitTime)
+		case recordsTrimFlags.Name():
+			if err := recordsTrimFlags.Parse(os.Args[3:]); err == flag.ErrHelp {
+				recordsTrimFlags.PrintDefaults()
+				os.Exit(0)
+			}
+			runRecordsTrim(recordSetPath, trimHead, trimTail)
+		case recordsRenameFlags.Name():
+			if err := recordsRenameFlags.Parse(os.Args[3:]); err == flag.ErrHelp {
+				recordsRenameFlags.PrintDefaults()
+				os.Exit(0)
+			}
+			runRecordsRename(recordSetPath, recordSetName)
+		case recordsSynthFlags.Name():
+			if err := recordsSynthFlags.Parse(os.Args[3:]); err == flag.ErrHelp {
+				recordsSynthFlags.PrintDefaults()
+				os.Exit(0)
+			}
+			g := synth.NewGenerator(synthWidth, synthHeight, synthSeed)
+			g.MaxCurvature = synthMaxCurvature
+			g.Noise = synthNoise
+			g.Brightness = synthBrightness
+			g.BrightnessStep = synthBrightnessStep
+			runRecordsSynth(recordSetOutput, g, synthCount, synthInterval)
+		case recordsViewFlags.Name():
+			if err := recordsViewFlags.Parse(os.Args[3:]); err == flag.ErrHelp {
+				recordsViewFlags.PrintDefaults()
+				os.Exit(0)
+			}
+			runRecordsView(recordSetPath, viewMarks, viewFps, viewSpeed, viewJump, viewFrame)
+		default:
+			recordsFlags.PrintDefaults()
+			os.Exit(0)
+		}
 
 	default:
 		flag.PrintDefaults()
@@ -286,9 +726,9 @@ func main() {
 
 }
 
-func runRecord(client mqtt.Client, recordsDir, recordTopic string) {
+func runRecord(client mqtt.Client, recordsDir, recordTopic, mainCamera string) {
 
-	r, err := record.New(client, recordsDir, recordTopic)
+	r, err := record.New(client, recordsDir, recordTopic, mainCamera)
 	if err != nil {
 		zap.S().Fatalf("unable to init record part: %v", err)
 	}
@@ -302,25 +742,309 @@ func runRecord(client mqtt.Client, recordsDir, recordTopic string) {
 	}
 }
 
-func runTrainArchive(basedir, archiveName string, sliceSize int, imgWidth, imgHeight int, horizon int, withFlipImage bool) {
+func runTrainArchive(sources []string, archiveName string, sliceSize int, imgWidth, imgHeight int, horizon int, withFlipImage bool, steeringBins int, binsDistribution data.BinDistribution, cameras []string) {
+	if len(sources) == 0 {
+		zap.S().Fatalf("no record path define, see help")
+	}
+	bins := mustSteeringBins(steeringBins, binsDistribution)
 
-	err := data.WriteArchive(basedir, archiveName, sliceSize, imgWidth, imgHeight, horizon, withFlipImage)
+	err := data.WriteArchive(context.Background(), sources, archiveName, sliceSize, imgWidth, imgHeight, horizon, withFlipImage, bins, cameras)
 	if err != nil {
 		zap.S().Fatalf("unable to build archive file %v: %v", archiveName, err)
 	}
 }
 
-func runImportDonkeyRecords(basedir, destdir string) {
+// parseList splits comma separated values, empty values are ignored
+func parseList(s string) []string {
+	values := make([]string, 0)
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+func runImportDonkeyRecords(basedir, destdir string, dryRun bool) {
 	if destdir == "" || basedir == "" {
 		zap.S().Fatal("invalid arg")
 	}
-	err := dkimpt.ImportDonkeyRecords(basedir, destdir)
+	summary, err := dkimpt.ImportDonkeyRecords(basedir, destdir, dryRun)
+	if summary != nil {
+		zap.S().Infof("import summary: %v", summary)
+	}
 	if err != nil {
 		zap.S().Fatalf("unable to import files from %v to %v: %v", basedir, destdir, err)
 	}
 }
-func runDisplayRecord(client mqtt.Client, recordTopic string) {
-	r := display.NewRecordDisplay(client, recordTopic)
+
+func runImportVideo(videoFile, steeringLog, destdir, recordSet, videoStart string, offset, maxDelta time.Duration) {
+	l := zap.S()
+	if videoFile == "" || steeringLog == "" || destdir == "" {
+		l.Fatal("video, steering log and destination are required, see help")
+	}
+	if recordSet == "" {
+		recordSet = strings.TrimSuffix(path.Base(videoFile), path.Ext(videoFile))
+	}
+	var start time.Time
+	if videoStart != "" {
+		var err error
+		start, err = time.Parse(time.RFC3339, videoStart)
+		if err != nil {
+			l.Fatalf("invalid video start '%v': %v", videoStart, err)
+		}
+	}
+	err := vidimpt.ImportVideo(videoFile, steeringLog, destdir, recordSet, start, offset, maxDelta)
+	if err != nil {
+		l.Fatalf("unable to import video %v: %v", videoFile, err)
+	}
+}
+
+func runExportRecordSetVideo(recordSet, output string, fps int, style *overlay.Style) {
+	l := zap.S()
+	if output == "" {
+		l.Fatal("no output video file, see help")
+	}
+	w, err := videxpt.NewWriter(output, fps, style)
+	if err != nil {
+		l.Fatalf("unable to export video %v: %v", output, err)
+	}
+	if err := videxpt.ReadRecordSet(recordSet, fps, w.Write); err != nil {
+		l.Fatalf("unable to export record set %v: %v", recordSet, err)
+	}
+	if err := w.Close(); err != nil {
+		l.Fatalf("unable to export video %v: %v", output, err)
+	}
+}
+
+func runExportLiveVideo(client mqtt.Client, output, frameTopic, steeringTopic, throttleTopic, objectsTopic, roadTopic, driveModeTopic string, fps int, duration time.Duration, style *overlay.Style) {
+	l := zap.S()
+	if output == "" || frameTopic == "" {
+		l.Fatal("output video file and frame topic are required, see help")
+	}
+	// Output format is checked before recording
+	w, err := videxpt.NewWriter(output, fps, style)
+	if err != nil {
+		l.Fatalf("unable to export video %v: %v", output, err)
+	}
+
+	c := videxpt.NewCollector(client, w, frameTopic, steeringTopic, throttleTopic, objectsTopic, roadTopic, driveModeTopic)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Start()
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	l.Infof("record live topics during %v, interrupt to stop before", duration)
+	select {
+	case <-time.After(duration):
+	case <-signals:
+	case err := <-done:
+		done <- err
+	}
+	c.Stop()
+
+	if err := <-done; err != nil {
+		l.Fatalf("unable to record live topics: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		l.Fatalf("unable to export video %v: %v", output, err)
+	}
+}
+
+func runReplay(client mqtt.Client, recordSet, frameTopic, steeringTopic, recordTopic, controlTopic, controlAddr string, speed float64, fps int, loop bool) {
+	if recordSet == "" {
+		zap.S().Fatal("no record set to replay, see help")
+	}
+	r, err := replay.New(client, recordSet, frameTopic, steeringTopic, recordTopic, speed, fps, loop)
+	if err != nil {
+		zap.S().Fatalf("unable to load record set %v: %v", recordSet, err)
+	}
+	defer r.Stop()
+	listenReplayCommands(client, r.Player(), controlTopic, controlAddr)
+
+	cli.HandleExit(r)
+	err = r.Start()
+	if err != nil {
+		zap.S().Fatalf("unable to replay record set %v: %v", recordSet, err)
+	}
+}
+
+func runSim(client mqtt.Client, trackFile, steeringTopic, throttleTopic, frameTopic, eventsTopic string, width, height, fps int) {
+	l := zap.S()
+	if steeringTopic == "" || throttleTopic == "" || frameTopic == "" {
+		l.Fatal("steering, throttle and frame topics are required, see help")
+	}
+	track := sim.DefaultTrack()
+	if trackFile != "" {
+		t, err := sim.LoadTrack(trackFile)
+		if err != nil {
+			l.Fatalf("unable to load track: %v", err)
+		}
+		track = t
+	}
+
+	s := sim.New(client, track, sim.NewCamera(width, height), steeringTopic, throttleTopic, frameTopic, eventsTopic, fps)
+	defer s.Stop()
+
+	cli.HandleExit(s)
+	err := s.Start()
+	if err != nil {
+		l.Fatalf("unable to start simulator: %v", err)
+	}
+}
+
+func runDashboard(client mqtt.Client, addr, frameTopic, steeringTopic, throttleTopic, throttleFeedbackTopic, driveModeTopic, objectsTopic, roadTopic string, quality, fps, telemetryRate int, style *overlay.Style) {
+	l := zap.S()
+	if frameTopic == "" {
+		l.Fatal("no frame topic, see help")
+	}
+	d := dashboard.New(client, frameTopic, steeringTopic, throttleTopic, throttleFeedbackTopic, driveModeTopic, objectsTopic, roadTopic,
+		stream.NewMJPEG(quality, fps), telemetryRate, style)
+	defer d.Stop()
+
+	go func() {
+		l.Infof("serve dashboard on http://%v", addr)
+		if err := http.ListenAndServe(addr, d.Handler()); err != nil {
+			l.Fatalf("unable to serve dashboard: %v", err)
+		}
+	}()
+
+	cli.HandleExit(d)
+	if err := d.Start(); err != nil {
+		l.Fatalf("unable to start dashboard: %v", err)
+	}
+}
+
+func runLatency(client mqtt.Client, frameTopic, stagesDef string, timeout, interval time.Duration) {
+	l := zap.S()
+	if frameTopic == "" {
+		l.Fatal("no frame topic, see help")
+	}
+	if timeout <= 0 || interval <= 0 {
+		l.Fatalf("invalid timeout %v or report interval %v, must be greater than 0", timeout, interval)
+	}
+	stages, err := latency.ParseStages(stagesDef)
+	if err != nil {
+		l.Fatalf("invalid stages: %v", err)
+	}
+	if len(stages) == 0 {
+		l.Fatal("no stage to measure, see help")
+	}
+	for _, s := range stages {
+		if s.Topic == frameTopic {
+			l.Fatalf("stage %v can't use frame topic", s.Name)
+		}
+	}
+	p := latency.New(client, frameTopic, stages, timeout, interval, os.Stdout)
+	defer p.Stop()
+
+	cli.HandleExit(p)
+	if err := p.Start(); err != nil {
+		l.Fatalf("unable to measure latency: %v", err)
+	}
+}
+
+func runBagRecord(client mqtt.Client, output string, topics []string) {
+	l := zap.S()
+	if output == "" {
+		l.Fatal("no bag file, see help")
+	}
+	if len(topics) == 0 {
+		l.Fatal("no topic to record, see help")
+	}
+	w, err := bag.Create(output)
+	if err != nil {
+		l.Fatalf("unable to create bag: %v", err)
+	}
+	r := bag.NewRecorder(client, w, topics...)
+	defer r.Stop()
+
+	cli.HandleExit(r)
+	if err := r.Start(); err != nil {
+		l.Fatalf("unable to record bag: %v", err)
+	}
+}
+
+func runBagPlay(client mqtt.Client, bagFile, remapDef, controlTopic, controlAddr string, speed float64, loop bool) {
+	l := zap.S()
+	if bagFile == "" {
+		l.Fatal("no bag to play, see help")
+	}
+	remap, err := bag.ParseRemap(remapDef)
+	if err != nil {
+		l.Fatalf("invalid remap: %v", err)
+	}
+	b, err := bag.Open(bagFile)
+	if err != nil {
+		l.Fatalf("unable to open bag: %v", err)
+	}
+	defer b.Close()
+
+	p, err := bag.NewPlayer(client, b, remap, speed, loop)
+	if err != nil {
+		l.Fatalf("unable to play bag %v: %v", bagFile, err)
+	}
+	defer p.Stop()
+	listenReplayCommands(client, p.Player(), controlTopic, controlAddr)
+
+	cli.HandleExit(p)
+	if err := p.Start(); err != nil {
+		l.Fatalf("unable to play bag %v: %v", bagFile, err)
+	}
+}
+
+func runBagInfo(bagFile string) {
+	l := zap.S()
+	if bagFile == "" {
+		l.Fatal("no bag to describe, see help")
+	}
+	b, err := bag.Open(bagFile)
+	if err != nil {
+		l.Fatalf("unable to open bag: %v", err)
+	}
+	defer b.Close()
+
+	topics, err := b.Topics()
+	if err != nil {
+		l.Fatalf("unable to list topics of bag %v: %v", bagFile, err)
+	}
+	names := make([]string, 0, len(topics))
+	for t := range topics {
+		names = append(names, t)
+	}
+	sort.Strings(names)
+
+	duration := time.Duration(0)
+	if b.Len() > 0 {
+		duration = b.Offset(b.Len() - 1)
+	}
+	fmt.Printf("messages: %d\nduration: %v\n", b.Len(), duration)
+	for _, t := range names {
+		fmt.Printf("  %6d %s\n", topics[t], t)
+	}
+}
+
+// listenReplayCommands applies commands received on mqtt topic and http address to player
+func listenReplayCommands(client mqtt.Client, player *replay.Player, controlTopic, controlAddr string) {
+	if controlTopic != "" {
+		if err := player.Listen(client, controlTopic); err != nil {
+			zap.S().Fatalf("unable to listen replay commands: %v", err)
+		}
+	}
+	if controlAddr != "" {
+		go func() {
+			zap.S().Infof("listen replay commands on http://%v", controlAddr)
+			if err := http.ListenAndServe(controlAddr, player); err != nil {
+				zap.S().Fatalf("unable to serve replay commands: %v", err)
+			}
+		}()
+	}
+}
+
+func runDisplayRecord(client mqtt.Client, recordTopic, controlTopic, throttleTopic, pilotSteeringTopic, driveModeTopic string, chartWindow, staleAfter time.Duration, maxFps int) {
+	r := display.NewRecordDisplay(client, recordTopic, controlTopic, throttleTopic, pilotSteeringTopic, driveModeTopic, chartWindow, staleAfter, maxFps)
 	defer r.Stop()
 
 	cli.HandleExit(r)
@@ -329,23 +1053,83 @@ func runDisplayRecord(client mqtt.Client, recordTopic string) {
 		zap.S().Fatalf("unable to start service: %v", err)
 	}
 }
-func runDisplay(client mqtt.Client, framePath string, frameTopic string, fps int, objectsTopic, roadTopic, throttleFeedbackTopic string,
-	withObjects, withRoad, withThrottleFeedback bool) {
 
+func runDisplayCameras(client mqtt.Client, frameTopics []string, columns int, staleAfter time.Duration, maxFps int) {
+	if len(frameTopics) == 0 {
+		zap.S().Fatal("no frame topic, see help")
+	}
+	t := display.NewTiles(client, frameTopics, columns, staleAfter, maxFps)
+	defer t.Stop()
+
+	cli.HandleExit(t)
+	err := t.Start()
+	if err != nil {
+		zap.S().Fatalf("unable to start service: %v", err)
+	}
+}
+
+func runDisplay(client mqtt.Client, framePath, videoFile string, synthFrames int, videoWidth, videoHeight int, videoLoop bool, frameTopic string, fps int, objectsTopic, roadTopic, throttleFeedbackTopic, controlTopic, controlAddr string,
+	streamAddr string, streamQuality, streamFps int, noWindow bool, syncDelay time.Duration, style *overlay.Style, driveModeTopic string, staleAfter time.Duration, maxFps int, withObjects, withRoad, withThrottleFeedback bool) {
+
+	if (framePath != "" && videoFile != "") || (synthFrames > 0 && (framePath != "" || videoFile != "")) {
+		log.Fatalf("frame path, video file and synthetic frames can't be used together")
+	}
+	if noWindow && streamAddr == "" {
+		log.Fatalf("window can't be disabled without stream address")
+	}
+	var frameStream *stream.MJPEG
+	if streamAddr != "" {
+		frameStream = stream.NewMJPEG(streamQuality, streamFps)
+		go func() {
+			if err := frameStream.Start(); err != nil {
+				zap.S().Errorf("unable to encode stream: %v", err)
+			}
+		}()
+		defer frameStream.Stop()
+		go func() {
+			zap.S().Infof("serve frame stream on http://%v/stream", streamAddr)
+			if err := http.ListenAndServe(streamAddr, frameStream.Handler()); err != nil {
+				zap.S().Fatalf("unable to serve frame stream: %v", err)
+			}
+		}()
+	}
+	if synthFrames > 0 {
+		camera, err := video.NewCameraSynth(client, frameTopic, synth.NewGenerator(videoWidth, videoHeight, time.Now().UnixNano()), synthFrames, fps)
+		if err != nil {
+			log.Fatalf("unable to load synthetic camera: %v", err)
+		}
+		listenReplayCommands(client, camera.Player(), controlTopic, controlAddr)
+		if err = camera.Start(); err != nil {
+			log.Fatalf("unable to start synthetic camera: %v", err)
+		}
+		defer camera.Stop()
+	}
 	if framePath != "" {
 		camera, err := video.NewCameraFake(client, frameTopic, framePath, fps)
 		if err != nil {
 			log.Fatalf("unable to load fake camera: %v", err)
 		}
+		listenReplayCommands(client, camera.Player(), controlTopic, controlAddr)
 		if err = camera.Start(); err != nil {
 			log.Fatalf("unable to start fake camera: %v", err)
 		}
 		defer camera.Stop()
 	}
+	if videoFile != "" {
+		camera, err := video.NewVideoFileCamera(client, frameTopic, videoFile, videoWidth, videoHeight, fps, videoLoop)
+		if err != nil {
+			log.Fatalf("unable to load video file camera: %v", err)
+		}
+		listenReplayCommands(client, camera.Player(), controlTopic, controlAddr)
+		if err = camera.Start(); err != nil {
+			log.Fatalf("unable to start video file camera: %v", err)
+		}
+		defer camera.Stop()
+	}
 
 	p := part.NewPart(client, frameTopic,
-		objectsTopic, roadTopic, throttleFeedbackTopic,
-		withObjects, withRoad, withThrottleFeedback)
+		objectsTopic, roadTopic, throttleFeedbackTopic, driveModeTopic, controlTopic,
+		withObjects, withRoad, withThrottleFeedback, frameStream, !noWindow, syncDelay, style, staleAfter, maxFps)
 	defer p.Stop()
 
 	cli.HandleExit(p)
@@ -356,7 +1140,7 @@ func runDisplay(client mqtt.Client, framePath string, frameTopic string, fps int
 	}
 }
 
-func runTraining(bucketName, ociImage, roleArn, jobName, dataDir string, modelType train.ModelType, sliceSize, imgWidth, imgHeight int, horizon int, withFlipImage bool, outputModel string, enableSpotTraining bool) {
+func runTraining(bucketName, ociImage, roleArn, jobName string, sources []string, modelType train.ModelType, sliceSize, imgWidth, imgHeight int, horizon int, withFlipImage bool, steeringBins int, binsDistribution data.BinDistribution, cameras []string, outputModel string, enableSpotTraining bool) {
 
 	l := zap.S()
 	if bucketName == "" {
@@ -368,7 +1152,7 @@ func runTraining(bucketName, ociImage, roleArn, jobName, dataDir string, modelTy
 	if jobName == "" {
 		l.Fatalf("no job name define, see help")
 	}
-	if dataDir == "" {
+	if len(sources) == 0 {
 		l.Fatalf("no training data define, see help")
 	}
 	if outputModel == "" {
@@ -382,15 +1166,31 @@ func runTraining(bucketName, ociImage, roleArn, jobName, dataDir string, modelTy
 	if modelType == train.ModelTypeUnknown {
 		l.Fatalf("invalid model type: %v", modelType)
 	}
+	if steeringBins != 0 && modelType != train.ModelTypeCategorical {
+		l.Fatalf("steering bins are only available for %v model", train.ModelTypeCategorical)
+	}
+	bins := mustSteeringBins(steeringBins, binsDistribution)
 
 	training := train.New(bucketName, ociImage, roleArn)
-	err := training.TrainDir(context.Background(), jobName, dataDir, modelType, imgWidth, imgHeight, sliceSize, horizon, withFlipImage, outputModel, enableSpotTraining)
+	err := training.TrainDir(context.Background(), jobName, sources, modelType, imgWidth, imgHeight, sliceSize, horizon, withFlipImage, bins, cameras, outputModel, enableSpotTraining)
 
 	if err != nil {
 		l.Fatalf("unable to run training: %v", err)
 	}
 }
 
+// mustSteeringBins returns nil if bins are disabled
+func mustSteeringBins(count int, distribution data.BinDistribution) *data.SteeringBins {
+	if count == 0 {
+		return nil
+	}
+	bins, err := data.NewSteeringBins(count, distribution)
+	if err != nil {
+		zap.S().Fatalf("invalid steering bins: %v", err)
+	}
+	return bins
+}
+
 func runTrainList() {
 	err := train.ListJob(context.Background())
 	if err != nil {
@@ -412,3 +1212,148 @@ func runModelsDownload(bucketName, modelPath, output string) {
 		zap.S().Fatalf("unable to download model: %s", err)
 	}
 }
+
+func runRecordsMerge(output string, recordSets []string) {
+	if output == "" || len(recordSets) == 0 {
+		zap.S().Fatal("output and record sets to merge are required, see help")
+	}
+	err := recordset.Merge(output, recordSets...)
+	if err != nil {
+		zap.S().Fatalf("unable to merge record sets: %v", err)
+	}
+}
+
+func runRecordsSplit(recordSet, output string, frame int, at string) {
+	l := zap.S()
+	if recordSet == "" || output == "" {
+		l.Fatal("record set and output are required, see help")
+	}
+	if at == "" {
+		if err := recordset.Split(recordSet, frame, output); err != nil {
+			l.Fatalf("unable to split record set: %v", err)
+		}
+		return
+	}
+
+	t, err := time.Parse(time.RFC3339, at)
+	if err != nil {
+		ms, errInt := strconv.ParseInt(at, 10, 64)
+		if errInt != nil {
+			l.Fatalf("invalid time '%v', RFC3339 date or unix timestamp in milliseconds expected", at)
+		}
+		t = time.UnixMilli(ms)
+	}
+	if err := recordset.SplitAtTime(recordSet, t, output); err != nil {
+		l.Fatalf("unable to split record set: %v", err)
+	}
+}
+
+func runRecordsTrim(recordSet string, head, tail int) {
+	if recordSet == "" {
+		zap.S().Fatal("record set is required, see help")
+	}
+	err := recordset.Trim(recordSet, head, tail)
+	if err != nil {
+		zap.S().Fatalf("unable to trim record set: %v", err)
+	}
+}
+
+func runRecordsRename(recordSet, name string) {
+	if recordSet == "" || name == "" {
+		zap.S().Fatal("record set and name are required, see help")
+	}
+	err := recordset.Rename(recordSet, name)
+	if err != nil {
+		zap.S().Fatalf("unable to rename record set: %v", err)
+	}
+}
+
+func runRecordsSynth(output string, g *synth.Generator, count int, interval time.Duration) {
+	if output == "" {
+		zap.S().Fatal("output is required, see help")
+	}
+	err := synth.WriteRecordSet(output, g, count, time.Now(), interval)
+	if err != nil {
+		zap.S().Fatalf("unable to generate synthetic record set: %v", err)
+	}
+}
+
+func runRecordsView(recordSet, marksFile string, fps int, speed float64, jump, start int) {
+	if recordSet == "" {
+		zap.S().Fatal("record set is required, see help")
+	}
+	if marksFile == "" {
+		marksFile = path.Join(recordSet, viewer.MarksFileName)
+	}
+	b, err := viewer.NewBrowser(recordSet, fps, marksFile)
+	if err != nil {
+		zap.S().Fatalf("unable to load record set %v: %v", recordSet, err)
+	}
+	v := viewer.New(b, start, speed, jump)
+	defer v.Stop()
+
+	cli.HandleExit(v)
+	err = v.Start()
+	if err != nil {
+		zap.S().Fatalf("unable to browse record set %v: %v", recordSet, err)
+	}
+}
+
+// initOverlayFlagSet registers flags configuring how detected objects and road are drawn over frames
+func initOverlayFlagSet(flags *flag.FlagSet, style *overlay.Style) {
+	flags.Float64Var(&style.MinConfidence, "overlay-min-confidence", style.MinConfidence, "Hide detected objects with a lower confidence")
+	flags.BoolVar(&style.ObjectLabels, "overlay-labels", style.ObjectLabels, "Write type and confidence over detected objects")
+	flags.Func("overlay-object-thickness", fmt.Sprintf("Thickness of detected objects boxes, must be positive (default %d)", style.ObjectThickness), func(value string) error {
+		thickness, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid thickness: %w", err)
+		}
+		if thickness <= 0 {
+			return fmt.Errorf("thickness must be positive: %v", thickness)
+		}
+		style.ObjectThickness = thickness
+		return nil
+	})
+	flags.Func("overlay-object-colors", fmt.Sprintf("Colors of detected objects by type as type=#rrggbb[aa] list, unlisted types keep their color (default %v)", overlay.FormatObjectColors(style.ObjectColors)), func(value string) error {
+		colors, err := overlay.ParseObjectColors(value)
+		if err != nil {
+			return err
+		}
+		for t, c := range colors {
+			style.ObjectColors[t] = c
+		}
+		return nil
+	})
+	flags.Func("overlay-road-color", fmt.Sprintf("Fill color of road as #rrggbb or #rrggbbaa, alpha sets fill transparency (default %v)", overlay.FormatColor(style.RoadColor)), func(value string) error {
+		c, err := overlay.ParseColor(value)
+		if err != nil {
+			return err
+		}
+		style.RoadColor = c
+		return nil
+	})
+	flags.BoolVar(&style.Ellipse, "overlay-road-ellipse", style.Ellipse, "Draw road ellipse with its heading arrow")
+	flags.Func("overlay-road-ellipse-color", fmt.Sprintf("Color of road ellipse as #rrggbb or #rrggbbaa (default %v)", overlay.FormatColor(style.EllipseColor)), func(value string) error {
+		c, err := overlay.ParseColor(value)
+		if err != nil {
+			return err
+		}
+		style.EllipseColor = c
+		return nil
+	})
+}
+
+func runExport(sources []string, output string, formatName string, selection export.Selection, geometry export.Geometry) {
+	l := zap.S()
+	if len(sources) == 0 || output == "" {
+		l.Fatal("record path and output are required, see help")
+	}
+	format := export.ParseFormat(formatName)
+	if format == export.FormatUnknown {
+		l.Fatalf("invalid export format: %v", formatName)
+	}
+	err := export.Export(context.Background(), sources, output, format, selection, geometry)
+	if err != nil {
+		l.Fatalf("unable to export records: %v", err)
+	}
+}
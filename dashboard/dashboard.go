@@ -0,0 +1,345 @@
+package dashboard
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"github.com/cyrilix/robocar-base/service"
+	"github.com/cyrilix/robocar-protobuf/go/events"
+	"github.com/cyrilix/robocar-tools/pkg/overlay"
+	"github.com/cyrilix/robocar-tools/pkg/stream"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/golang/protobuf/proto"
+	"go.uber.org/zap"
+	"image"
+	_ "image/jpeg"
+	"net/http"
+	"sync"
+	"time"
+)
+
+//go:embed static/index.html
+var indexHTML []byte
+
+// rateWindow is the period used to compute topic message rates
+const rateWindow = time.Second
+
+// Telemetry is the last state of the car sent to browsers as json
+type Telemetry struct {
+	Time             time.Time `json:"time"`
+	Steering         *float32  `json:"steering,omitempty"`
+	Throttle         *float32  `json:"throttle,omitempty"`
+	ThrottleFeedback *float32  `json:"throttle_feedback,omitempty"`
+	DriveMode        string    `json:"drive_mode,omitempty"`
+	// Ages is the delay in seconds since reception of steering, throttle, throttle_feedback and drive_mode values, a
+	// value that isn't refreshed anymore comes from a dead topic
+	Ages map[string]float64 `json:"ages"`
+	// Rates is the number of messages received per second for each topic
+	Rates map[string]float64 `json:"rates"`
+}
+
+// Dashboard serves a web page with annotated camera frames and telemetry bridged from mqtt topics over websocket
+type Dashboard struct {
+	client                                   mqtt.Client
+	frameTopic, steeringTopic, throttleTopic string
+	throttleFeedbackTopic, driveModeTopic    string
+	objectsTopic, roadTopic                  string
+	interval                                 time.Duration
+	frameStream                              *stream.MJPEG
+	hub                                      *hub
+
+	muState          sync.Mutex
+	overlay          overlay.Overlay
+	throttleFeedback *events.ThrottleMessage
+	// received is the reception date of each telemetry value
+	received   map[string]time.Time
+	counts     map[string]int
+	rates      map[string]float64
+	ratesStart time.Time
+	// frame is the last frame not rendered yet, frames replaced before rendering are dropped
+	frame *events.FrameMessage
+	// frameReady is notified when a frame is received
+	frameReady chan struct{}
+
+	cancel   chan interface{}
+	stopOnce sync.Once
+}
+
+// Names of telemetry values
+const (
+	valueSteering         = "steering"
+	valueThrottle         = "throttle"
+	valueThrottleFeedback = "throttle_feedback"
+	valueDriveMode        = "drive_mode"
+)
+
+// New builds dashboard sending telemetry telemetryRate times per second, topics are ignored if empty. Frames overlays
+// are drawn with style, or default style if nil.
+func New(client mqtt.Client, frameTopic, steeringTopic, throttleTopic, throttleFeedbackTopic, driveModeTopic, objectsTopic, roadTopic string,
+	frameStream *stream.MJPEG, telemetryRate int, style *overlay.Style) *Dashboard {
+	if telemetryRate <= 0 {
+		telemetryRate = 1
+	}
+	return &Dashboard{
+		client:                client,
+		frameTopic:            frameTopic,
+		steeringTopic:         steeringTopic,
+		throttleTopic:         throttleTopic,
+		throttleFeedbackTopic: throttleFeedbackTopic,
+		driveModeTopic:        driveModeTopic,
+		objectsTopic:          objectsTopic,
+		roadTopic:             roadTopic,
+		interval:              time.Second / time.Duration(telemetryRate),
+		frameStream:           frameStream,
+		hub:                   newHub(),
+		overlay:               overlay.Overlay{Style: style},
+		received:              make(map[string]time.Time),
+		counts:                make(map[string]int),
+		rates:                 make(map[string]float64),
+		ratesStart:            time.Now(),
+		frameReady:            make(chan struct{}, 1),
+		cancel:                make(chan interface{}),
+	}
+}
+
+func (d *Dashboard) Start() error {
+	for topic, callback := range d.callbacks() {
+		if err := service.RegisterCallback(d.client, topic, callback); err != nil {
+			return fmt.Errorf("unable to start dashboard: %v", err)
+		}
+	}
+	go func() {
+		if err := d.frameStream.Start(); err != nil {
+			zap.S().Errorf("unable to encode frame stream: %v", err)
+		}
+	}()
+
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			d.sendTelemetry(time.Now())
+		case <-d.frameReady:
+			d.renderFrame()
+		case <-d.cancel:
+			return nil
+		}
+	}
+}
+
+// Stop may be called several times
+func (d *Dashboard) Stop() {
+	d.stopOnce.Do(d.stop)
+}
+
+func (d *Dashboard) stop() {
+	close(d.cancel)
+	d.frameStream.Stop()
+	d.hub.close()
+	topics := make([]string, 0, 7)
+	for topic := range d.callbacks() {
+		topics = append(topics, topic)
+	}
+	service.StopService("dashboard", d.client, topics...)
+}
+
+func (d *Dashboard) callbacks() map[string]mqtt.MessageHandler {
+	callbacks := make(map[string]mqtt.MessageHandler)
+	for topic, callback := range map[string]mqtt.MessageHandler{
+		d.frameTopic:            d.onFrame,
+		d.steeringTopic:         d.onSteering,
+		d.throttleTopic:         d.onThrottle,
+		d.throttleFeedbackTopic: d.onThrottleFeedback,
+		d.driveModeTopic:        d.onDriveMode,
+		d.objectsTopic:          d.onObjects,
+		d.roadTopic:             d.onRoad,
+	} {
+		if topic != "" {
+			callbacks[topic] = callback
+		}
+	}
+	return callbacks
+}
+
+// Handler serves web page on /, telemetry websocket on /ws and annotated frames on /stream and /snapshot
+func (d *Dashboard) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if _, err := w.Write(indexHTML); err != nil {
+			zap.S().Debugf("unable to write dashboard page: %v", err)
+		}
+	})
+	mux.Handle("/ws", d.hub)
+	mux.Handle("/stream", d.frameStream)
+	mux.HandleFunc("/snapshot", d.frameStream.ServeSnapshot)
+	return mux
+}
+
+// sendTelemetry broadcasts last state to websocket clients, message rates are refreshed every rateWindow
+func (d *Dashboard) sendTelemetry(now time.Time) {
+	d.muState.Lock()
+	if elapsed := now.Sub(d.ratesStart); elapsed >= rateWindow {
+		// Topics without message during window have a null rate
+		rates := make(map[string]float64, len(d.counts))
+		for topic := range d.callbacks() {
+			rates[topic] = 0.
+		}
+		for topic, count := range d.counts {
+			rates[topic] = float64(count) / elapsed.Seconds()
+		}
+		d.rates = rates
+		d.counts = make(map[string]int)
+		d.ratesStart = now
+	}
+	t := Telemetry{Time: now, Rates: d.rates, Ages: make(map[string]float64, len(d.received))}
+	for name, received := range d.received {
+		t.Ages[name] = now.Sub(received).Seconds()
+	}
+	if d.overlay.Steering != nil {
+		v := d.overlay.Steering.GetSteering()
+		t.Steering = &v
+	}
+	if d.overlay.Throttle != nil {
+		v := d.overlay.Throttle.GetThrottle()
+		t.Throttle = &v
+	}
+	if d.throttleFeedback != nil {
+		v := d.throttleFeedback.GetThrottle()
+		t.ThrottleFeedback = &v
+	}
+	if d.overlay.DriveMode != nil {
+		t.DriveMode = d.overlay.DriveMode.GetDriveMode().String()
+	}
+	d.muState.Unlock()
+
+	payload, err := json.Marshal(&t)
+	if err != nil {
+		zap.S().Errorf("unable to marshal telemetry: %v", err)
+		return
+	}
+	d.hub.broadcast(payload)
+}
+
+// count records a message received on topic, it must be called with muState locked
+func (d *Dashboard) count(topic string) {
+	d.counts[topic] += 1
+}
+
+func (d *Dashboard) onFrame(_ mqtt.Client, message mqtt.Message) {
+	var msg events.FrameMessage
+	if err := proto.Unmarshal(message.Payload(), &msg); err != nil {
+		zap.S().Errorf("unable to unmarshal protobuf %T: %v", &msg, err)
+		return
+	}
+	d.muState.Lock()
+	d.count(message.Topic())
+	d.frame = &msg
+	d.muState.Unlock()
+
+	select {
+	case d.frameReady <- struct{}{}:
+	default:
+	}
+}
+
+// renderFrame draws overlay over last received frame and publishes it on frame stream
+func (d *Dashboard) renderFrame() {
+	d.muState.Lock()
+	msg := d.frame
+	d.frame = nil
+	o := d.overlay
+	d.muState.Unlock()
+	if msg == nil {
+		return
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(msg.GetFrame()))
+	if err != nil {
+		zap.S().Errorf("unable to decode frame: %v", err)
+		return
+	}
+	d.frameStream.Publish(overlay.Render(img, &o))
+}
+
+func (d *Dashboard) onSteering(_ mqtt.Client, message mqtt.Message) {
+	var msg events.SteeringMessage
+	if err := proto.Unmarshal(message.Payload(), &msg); err != nil {
+		zap.S().Errorf("unable to unmarshal protobuf %T: %v", &msg, err)
+		return
+	}
+	d.muState.Lock()
+	defer d.muState.Unlock()
+	d.count(message.Topic())
+	d.overlay.Steering = &msg
+	d.received[valueSteering] = time.Now()
+}
+
+func (d *Dashboard) onThrottle(_ mqtt.Client, message mqtt.Message) {
+	var msg events.ThrottleMessage
+	if err := proto.Unmarshal(message.Payload(), &msg); err != nil {
+		zap.S().Errorf("unable to unmarshal protobuf %T: %v", &msg, err)
+		return
+	}
+	d.muState.Lock()
+	defer d.muState.Unlock()
+	d.count(message.Topic())
+	d.overlay.Throttle = &msg
+	d.received[valueThrottle] = time.Now()
+}
+
+func (d *Dashboard) onThrottleFeedback(_ mqtt.Client, message mqtt.Message) {
+	var msg events.ThrottleMessage
+	if err := proto.Unmarshal(message.Payload(), &msg); err != nil {
+		zap.S().Errorf("unable to unmarshal protobuf %T: %v", &msg, err)
+		return
+	}
+	d.muState.Lock()
+	defer d.muState.Unlock()
+	d.count(message.Topic())
+	d.throttleFeedback = &msg
+	d.received[valueThrottleFeedback] = time.Now()
+}
+
+func (d *Dashboard) onDriveMode(_ mqtt.Client, message mqtt.Message) {
+	var msg events.DriveModeMessage
+	if err := proto.Unmarshal(message.Payload(), &msg); err != nil {
+		zap.S().Errorf("unable to unmarshal protobuf %T: %v", &msg, err)
+		return
+	}
+	d.muState.Lock()
+	defer d.muState.Unlock()
+	d.count(message.Topic())
+	d.overlay.DriveMode = &msg
+	d.received[valueDriveMode] = time.Now()
+}
+
+func (d *Dashboard) onObjects(_ mqtt.Client, message mqtt.Message) {
+	var msg events.ObjectsMessage
+	if err := proto.Unmarshal(message.Payload(), &msg); err != nil {
+		zap.S().Errorf("unable to unmarshal protobuf %T: %v", &msg, err)
+		return
+	}
+	d.muState.Lock()
+	defer d.muState.Unlock()
+	d.count(message.Topic())
+	d.overlay.Objects = &msg
+}
+
+func (d *Dashboard) onRoad(_ mqtt.Client, message mqtt.Message) {
+	var msg events.RoadMessage
+	if err := proto.Unmarshal(message.Payload(), &msg); err != nil {
+		zap.S().Errorf("unable to unmarshal protobuf %T: %v", &msg, err)
+		return
+	}
+	d.muState.Lock()
+	defer d.muState.Unlock()
+	d.count(message.Topic())
+	d.overlay.Road = &msg
+}
@@ -0,0 +1,210 @@
+package dashboard
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/cyrilix/robocar-protobuf/go/events"
+	"github.com/cyrilix/robocar-tools/pkg/stream"
+	"github.com/cyrilix/robocar-tools/pkg/testutil"
+	"github.com/golang/protobuf/proto"
+	"github.com/gorilla/websocket"
+	"image"
+	"image/jpeg"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func marshal(t *testing.T, topic string, msg proto.Message) *testutil.FakeMessage {
+	payload, err := proto.Marshal(msg)
+	if err != nil {
+		t.Fatalf("unable to marshal %T: %v", msg, err)
+	}
+	return testutil.NewMessage(topic, payload)
+}
+
+func newTestDashboard() *Dashboard {
+	return New(nil, "frame", "steering", "throttle", "throttle-feedback", "mode", "", "", stream.NewMJPEG(80, 100), 10, nil)
+}
+
+func dial(t *testing.T, server *httptest.Server) *websocket.Conn {
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatalf("unable to connect websocket: %v", err)
+	}
+	return conn
+}
+
+func readTelemetry(t *testing.T, conn *websocket.Conn) *Telemetry {
+	if err := conn.SetReadDeadline(time.Now().Add(2 * time.Second)); err != nil {
+		t.Fatalf("unable to set deadline: %v", err)
+	}
+	_, msg, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("unable to read telemetry: %v", err)
+	}
+	var telemetry Telemetry
+	if err := json.Unmarshal(msg, &telemetry); err != nil {
+		t.Fatalf("unable to unmarshal telemetry %s: %v", msg, err)
+	}
+	return &telemetry
+}
+
+// waitClients waits for websocket clients to be registered
+func waitClients(t *testing.T, d *Dashboard, count int) {
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		d.hub.muClients.Lock()
+		n := len(d.hub.clients)
+		d.hub.muClients.Unlock()
+		if n == count {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("websocket clients not registered")
+}
+
+func TestDashboard_Telemetry(t *testing.T) {
+	d := newTestDashboard()
+	server := httptest.NewServer(d.Handler())
+	defer server.Close()
+	defer d.hub.close()
+
+	clients := []*websocket.Conn{dial(t, server), dial(t, server)}
+	for _, c := range clients {
+		defer c.Close()
+	}
+	waitClients(t, d, 2)
+
+	start := d.ratesStart
+	d.onSteering(nil, marshal(t, "steering", &events.SteeringMessage{Steering: -0.5}))
+	d.onThrottle(nil, marshal(t, "throttle", &events.ThrottleMessage{Throttle: 0.3}))
+	d.onThrottle(nil, marshal(t, "throttle", &events.ThrottleMessage{Throttle: 0.4}))
+	d.onDriveMode(nil, marshal(t, "mode", &events.DriveModeMessage{DriveMode: events.DriveMode_USER}))
+	d.sendTelemetry(start.Add(2 * time.Second))
+
+	for _, c := range clients {
+		telemetry := readTelemetry(t, c)
+		if telemetry.Steering == nil || *telemetry.Steering != -0.5 {
+			t.Errorf("bad steering: %v", telemetry.Steering)
+		}
+		if telemetry.Throttle == nil || *telemetry.Throttle != 0.4 {
+			t.Errorf("bad throttle: %v", telemetry.Throttle)
+		}
+		if telemetry.ThrottleFeedback != nil {
+			t.Errorf("throttle feedback must not be set: %v", *telemetry.ThrottleFeedback)
+		}
+		if telemetry.DriveMode != "USER" {
+			t.Errorf("bad drive mode: %v", telemetry.DriveMode)
+		}
+		if telemetry.Rates["throttle"] != 1. || telemetry.Rates["steering"] != 0.5 {
+			t.Errorf("bad rates: %v", telemetry.Rates)
+		}
+		if rate, ok := telemetry.Rates["throttle-feedback"]; !ok || rate != 0. {
+			t.Errorf("topic without message must have a null rate: %v", telemetry.Rates)
+		}
+		if _, ok := telemetry.Rates[""]; ok || len(telemetry.Rates) != 5 {
+			t.Errorf("only subscribed topics must have a rate: %v", telemetry.Rates)
+		}
+		if age, ok := telemetry.Ages["steering"]; !ok || age < 1.5 {
+			t.Errorf("bad steering age: %v", telemetry.Ages)
+		}
+		if _, ok := telemetry.Ages["throttle_feedback"]; ok {
+			t.Errorf("throttle feedback never received must not have an age: %v", telemetry.Ages)
+		}
+	}
+
+	// Rates are kept until next window
+	d.onSteering(nil, marshal(t, "steering", &events.SteeringMessage{Steering: 0.1}))
+	d.sendTelemetry(start.Add(2*time.Second + 100*time.Millisecond))
+	if telemetry := readTelemetry(t, clients[0]); telemetry.Rates["throttle"] != 1. || *telemetry.Steering != 0.1 {
+		t.Errorf("bad telemetry: %v", telemetry)
+	}
+}
+
+func TestDashboard_Frame(t *testing.T) {
+	d := newTestDashboard()
+	go d.frameStream.Start()
+	defer d.frameStream.Stop()
+	server := httptest.NewServer(d.Handler())
+	defer server.Close()
+
+	buf := bytes.Buffer{}
+	if err := jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 32, 24)), nil); err != nil {
+		t.Fatalf("unable to encode frame: %v", err)
+	}
+	d.onFrame(nil, marshal(t, "frame", &events.FrameMessage{Id: &events.FrameRef{Id: "1"}, Frame: buf.Bytes()}))
+	select {
+	case <-d.frameReady:
+	default:
+		t.Fatalf("frame reception must be notified")
+	}
+	d.renderFrame()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if frame, _ := d.frameStream.Frame(); frame != nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("frame not published on stream")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	resp, err := http.Get(server.URL + "/snapshot")
+	if err != nil {
+		t.Fatalf("unable to get snapshot: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("bad snapshot status: %v", resp.Status)
+	}
+	d.muState.Lock()
+	defer d.muState.Unlock()
+	if d.counts["frame"] != 1 {
+		t.Errorf("frame must be counted: %v", d.counts)
+	}
+}
+
+func TestDashboard_Index(t *testing.T) {
+	d := newTestDashboard()
+	server := httptest.NewServer(d.Handler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/")
+	if err != nil {
+		t.Fatalf("unable to get index: %v", err)
+	}
+	defer resp.Body.Close()
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("unable to read index: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(content), "WebSocket") {
+		t.Errorf("bad index page: %v", resp.Status)
+	}
+
+	resp, err = http.Get(server.URL + "/unknown")
+	if err != nil {
+		t.Fatalf("unable to get page: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unknown page must not be found: %v", resp.Status)
+	}
+}
+
+func TestDashboard_Callbacks(t *testing.T) {
+	d := newTestDashboard()
+	callbacks := d.callbacks()
+	if len(callbacks) != 5 {
+		t.Errorf("empty topics must be ignored: %v", len(callbacks))
+	}
+	if _, ok := callbacks[""]; ok {
+		t.Errorf("empty topic must not be registered")
+	}
+}
@@ -0,0 +1,103 @@
+package dashboard
+
+import (
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// clientBuffer is the number of messages queued for a client, messages are dropped for slower clients
+	clientBuffer = 32
+	writeTimeout = 5 * time.Second
+)
+
+type wsClient struct {
+	conn *websocket.Conn
+	send chan []byte
+}
+
+// hub broadcasts messages to websocket clients
+type hub struct {
+	upgrader  websocket.Upgrader
+	muClients sync.Mutex
+	clients   map[*wsClient]bool
+}
+
+func newHub() *hub {
+	return &hub{
+		clients: make(map[*wsClient]bool),
+	}
+}
+
+func (h *hub) broadcast(msg []byte) {
+	h.muClients.Lock()
+	defer h.muClients.Unlock()
+	for c := range h.clients {
+		select {
+		case c.send <- msg:
+		default:
+			zap.S().Debugf("websocket client %v too slow, drop message", c.conn.RemoteAddr())
+		}
+	}
+}
+
+func (h *hub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		zap.S().Errorf("unable to upgrade websocket connection: %v", err)
+		return
+	}
+	c := &wsClient{conn: conn, send: make(chan []byte, clientBuffer)}
+	h.muClients.Lock()
+	h.clients[c] = true
+	h.muClients.Unlock()
+	zap.S().Infof("new dashboard client %v", conn.RemoteAddr())
+
+	go c.writeLoop()
+	// Client messages are ignored, read until connection is closed
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			break
+		}
+	}
+	h.remove(c)
+	zap.S().Infof("dashboard client %v disconnected", conn.RemoteAddr())
+}
+
+func (h *hub) remove(c *wsClient) {
+	h.muClients.Lock()
+	defer h.muClients.Unlock()
+	if h.clients[c] {
+		delete(h.clients, c)
+		close(c.send)
+	}
+}
+
+func (h *hub) close() {
+	h.muClients.Lock()
+	clients := make([]*wsClient, 0, len(h.clients))
+	for c := range h.clients {
+		clients = append(clients, c)
+	}
+	h.muClients.Unlock()
+	for _, c := range clients {
+		h.remove(c)
+	}
+}
+
+func (c *wsClient) writeLoop() {
+	defer c.conn.Close()
+	for msg := range c.send {
+		if err := c.conn.SetWriteDeadline(time.Now().Add(writeTimeout)); err != nil {
+			return
+		}
+		if err := c.conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+			zap.S().Debugf("unable to write to websocket client %v: %v", c.conn.RemoteAddr(), err)
+			return
+		}
+	}
+	_ = c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+}
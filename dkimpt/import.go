@@ -1,15 +1,19 @@
 package dkimpt
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"github.com/cyrilix/robocar-tools/record"
 	"go.uber.org/zap"
+	"io"
 	"io/ioutil"
 	"log"
 	"os"
 	"path"
 	"regexp"
+	"strings"
 )
 
 /* donkey import*/
@@ -20,48 +24,80 @@ var (
 	recordIndexRegexp *regexp.Regexp
 )
 
-func ImportDonkeyRecords(basedir string, destDir string) error {
+// Summary reports what an import did, or would do on dry-run
+type Summary struct {
+	RecordSets int
+	// SkippedSets are record sets already imported according to journal
+	SkippedSets int
+	Copied      int
+	Unchanged   int
+	FailedSets  []string
+}
+
+func (s *Summary) String() string {
+	return fmt.Sprintf("%d record sets: %d already imported, %d failed %v, %d files copied, %d files unchanged",
+		s.RecordSets, s.SkippedSets, len(s.FailedSets), s.FailedSets, s.Copied, s.Unchanged)
+}
+
+// ImportDonkeyRecords copies each record set of basedir into destDir.
+//
+// Files already present in destDir with the same checksum are skipped and record sets imported by a previous run are
+// skipped according to journal stored into destDir. A record set is written only if all its files have been copied,
+// a failed record set leaves destDir unchanged. On dry-run, planned copies are logged and nothing is written.
+func ImportDonkeyRecords(basedir string, destDir string, dryRun bool) (*Summary, error) {
+	l := zap.S()
 	dirItems, err := ioutil.ReadDir(basedir)
 	if err != nil {
-		return fmt.Errorf("unable to list directory in %v dir: %v", basedir, err)
+		return nil, fmt.Errorf("unable to list directory in %v dir: %v", basedir, err)
 	}
 
-	imgCams := make([]string, 0)
-	records := make([]string, 0)
+	jrnl, err := openJournal(destDir, dryRun)
+	if err != nil {
+		return nil, err
+	}
+	defer jrnl.Close()
 
+	summary := Summary{FailedSets: make([]string, 0)}
 	for _, dirItem := range dirItems {
-		zap.S().Debugf("process %v directory", dirItem)
-		camDir := path.Join(destDir, dirItem.Name(), camSubDir)
-
-		err := os.MkdirAll(camDir, os.FileMode(0755))
-		if err != nil {
-			return fmt.Errorf("unable to make dest directories %v: %v", camDir, err)
+		if !dirItem.IsDir() {
+			continue
 		}
+		zap.S().Debugf("process %v directory", dirItem.Name())
+		summary.RecordSets += 1
 
-		imgDir := path.Join(basedir, dirItem.Name(), camSubDir)
-		imgs, err := ioutil.ReadDir(imgDir)
+		fp, err := fingerprint(path.Join(basedir, dirItem.Name()))
 		if err != nil {
-			return fmt.Errorf("unable to list cam images in directory %v: %v", imgDir, err)
+			l.Warnf("unable to read record set %v: %v", dirItem.Name(), err)
+			summary.FailedSets = append(summary.FailedSets, dirItem.Name())
+			continue
 		}
-
-		for _, img := range imgs {
-			idx, err := indexFromFile(camIndexRegexp, img.Name())
-			if err != nil {
-				return fmt.Errorf("unable to find index in cam image name %v: %v", img.Name(), err)
-			}
-			zap.S().Debugf("found image with index %v", idx)
-			records = append(records, path.Join(basedir, dirItem.Name(), fmt.Sprintf(record.FileNameFormat, idx)))
-			imgCams = append(imgCams, path.Join(basedir, dirItem.Name(), camSubDir, img.Name()))
+		if jrnl.isDone(dirItem.Name(), fp) {
+			l.Infof("record set %v already imported, skip it", dirItem.Name())
+			summary.SkippedSets += 1
+			continue
+		}
+		if jrnl.isStarted(dirItem.Name()) {
+			l.Infof("resume interrupted import of record set %v", dirItem.Name())
 		}
 
-		err = copyToDestdir(destDir, dirItem.Name(), &imgCams, &records)
+		copied, unchanged, err := importRecordSet(basedir, destDir, dirItem.Name(), dryRun, jrnl)
 		if err != nil {
-			zap.S().Warnf("unable to copy files from %v to %v: %v", path.Join(basedir, dirItem.Name()), destDir, err)
+			l.Warnf("unable to import record set %v, rollback: %v", dirItem.Name(), err)
+			summary.FailedSets = append(summary.FailedSets, dirItem.Name())
 			continue
 		}
+		summary.Copied += copied
+		summary.Unchanged += unchanged
+
+		if err = jrnl.markDone(dirItem.Name(), fp); err != nil {
+			return &summary, err
+		}
 	}
 
-	return nil
+	if len(summary.FailedSets) > 0 {
+		return &summary, fmt.Errorf("unable to import record sets %v", summary.FailedSets)
+	}
+	return &summary, nil
 }
 
 func init() {
@@ -96,47 +132,112 @@ func findNamedMatches(regex *regexp.Regexp, str string) map[string]string {
 	return results
 }
 
-func copyToDestdir(destdir, dirItem string, imgFiles *[]string, recordFiles *[]string) error {
-	err := copyJsonFiles(destdir, dirItem, recordFiles)
-	if err != nil {
-		return fmt.Errorf("unable to copy json files in %v directory: %v", destdir, err)
+// copyAction is a file to write into destination record set, from a source file or a generated content
+type copyAction struct {
+	// dest is the file path relative to record set directory
+	dest    string
+	src     string
+	content []byte
+}
+
+func (a *copyAction) checksum() ([]byte, error) {
+	if a.content != nil {
+		sum := sha256.Sum256(a.content)
+		return sum[:], nil
 	}
+	return fileChecksum(a.src)
+}
 
-	err = copyCamImages(destdir, dirItem, imgFiles)
+func (a *copyAction) write(file string) error {
+	content := a.content
+	if content == nil {
+		var err error
+		content, err = ioutil.ReadFile(a.src)
+		if err != nil {
+			return fmt.Errorf("unable to read %v: %v", a.src, err)
+		}
+	}
+	err := ioutil.WriteFile(file, content, os.FileMode(0755))
 	if err != nil {
-		return fmt.Errorf("unable to copy cam files in %v director: %v", destdir, err)
+		return fmt.Errorf("unable to write %v: %v", file, err)
 	}
-
 	return nil
 }
 
-func copyCamImages(destdir, dirItem string, imgFiles *[]string) error {
-	for _, img := range *imgFiles {
-		imgContent, err := ioutil.ReadFile(img)
+func importRecordSet(basedir, destDir, dirItem string, dryRun bool, jrnl *journal) (copied int, unchanged int, err error) {
+	l := zap.S().With("record_set", dirItem)
+
+	imgDir := path.Join(basedir, dirItem, camSubDir)
+	imgs, err := ioutil.ReadDir(imgDir)
+	if err != nil {
+		return 0, 0, fmt.Errorf("unable to list cam images in directory %v: %v", imgDir, err)
+	}
+
+	imgCams := make([]string, 0, len(imgs))
+	records := make([]string, 0, len(imgs))
+	for _, img := range imgs {
+		idx, err := indexFromFile(camIndexRegexp, img.Name())
 		if err != nil {
-			return fmt.Errorf("unable to read img: %v", err)
+			return 0, 0, fmt.Errorf("unable to find index in cam image name %v: %v", img.Name(), err)
 		}
+		zap.S().Debugf("found image with index %v", idx)
+		records = append(records, path.Join(basedir, dirItem, fmt.Sprintf(record.FileNameFormat, idx)))
+		imgCams = append(imgCams, path.Join(basedir, dirItem, camSubDir, img.Name()))
+	}
 
-		idx, err := indexFromFile(camIndexRegexp, img)
+	actions, err := planCopy(dirItem, imgCams, records)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	setDir := path.Join(destDir, dirItem)
+	pending := make([]copyAction, 0, len(actions))
+	for _, a := range actions {
+		same, err := sameContent(&a, path.Join(setDir, a.dest))
 		if err != nil {
-			zap.S().Warnf("unable to extract idx from filename %v: %v", img, err)
+			return 0, 0, err
+		}
+		if same {
+			l.Debugf("%v unchanged, skip it", path.Join(setDir, a.dest))
+			unchanged += 1
 			continue
 		}
-		imgName := path.Join(destdir, dirItem, camSubDir, fmt.Sprintf("image_array_%s_%s.jpg", dirItem, idx))
+		pending = append(pending, a)
+	}
 
-		err = ioutil.WriteFile(imgName, imgContent, os.FileMode(0755))
-		if err != nil {
-			return fmt.Errorf("unable to write image %v: %v", imgName, err)
+	if dryRun {
+		for _, a := range pending {
+			src := a.src
+			if a.content != nil {
+				src = "rewritten record"
+			}
+			l.Infof("[dry-run] copy %v to %v", src, path.Join(setDir, a.dest))
 		}
+		l.Infof("[dry-run] %d files to copy, %d unchanged", len(pending), unchanged)
+		return len(pending), unchanged, nil
 	}
-	return nil
+
+	if len(pending) == 0 {
+		return 0, unchanged, nil
+	}
+	if err = jrnl.markStarted(dirItem); err != nil {
+		return 0, 0, err
+	}
+	err = copyToDestdir(destDir, dirItem, pending)
+	if err != nil {
+		return 0, 0, err
+	}
+	return len(pending), unchanged, nil
 }
 
-func copyJsonFiles(destdir, dirItem string, recordFiles *[]string) error {
-	for _, r := range *recordFiles {
+// planCopy lists files to write into destination record set, records are rewritten to reference new image names
+func planCopy(dirItem string, imgFiles []string, recordFiles []string) ([]copyAction, error) {
+	actions := make([]copyAction, 0, len(imgFiles)+len(recordFiles))
+
+	for _, r := range recordFiles {
 		content, err := ioutil.ReadFile(r)
 		if err != nil {
-			return fmt.Errorf("unable to read json content: %v", err)
+			return nil, fmt.Errorf("unable to read json content: %v", err)
 		}
 		idx, err := indexFromFile(recordIndexRegexp, r)
 		if err != nil {
@@ -147,21 +248,185 @@ func copyJsonFiles(destdir, dirItem string, recordFiles *[]string) error {
 		var rcd record.Record
 		err = json.Unmarshal(content, &rcd)
 		if err != nil {
-			return fmt.Errorf("unable to unmarshal record: %v", err)
+			return nil, fmt.Errorf("unable to unmarshal record: %v", err)
 		}
 		camName := fmt.Sprintf("image_array_%s_%s.jpg", dirItem, idx)
 		rcd.CamImageArray = path.Join(camSubDir, camName)
 
 		recordBytes, err := json.Marshal(&rcd)
 		if err != nil {
-			return fmt.Errorf("unable to marshal %v record: %v", rcd, err)
+			return nil, fmt.Errorf("unable to marshal %v record: %v", rcd, err)
 		}
+		actions = append(actions, copyAction{
+			dest:    fmt.Sprintf("record_%s_%s.json", dirItem, idx),
+			content: recordBytes,
+		})
+	}
 
-		recordFileName := path.Join(destdir, dirItem, fmt.Sprintf("record_%s_%s.json", dirItem, idx))
-		err = ioutil.WriteFile(recordFileName, recordBytes, os.FileMode(0755))
+	for _, img := range imgFiles {
+		idx, err := indexFromFile(camIndexRegexp, img)
 		if err != nil {
-			return fmt.Errorf("unable to write json record %v: %v", recordFileName, err)
+			zap.S().Warnf("unable to extract idx from filename %v: %v", img, err)
+			continue
 		}
+		actions = append(actions, copyAction{
+			dest: path.Join(camSubDir, fmt.Sprintf("image_array_%s_%s.jpg", dirItem, idx)),
+			src:  img,
+		})
+	}
+	return actions, nil
+}
+
+// copyToDestdir writes files into a staging directory then moves them to record set directory. A new record set is
+// moved into place in one step, files of an existing record set are moved one by one and restored on failure so that
+// record set directory is never partially written.
+func copyToDestdir(destdir, dirItem string, actions []copyAction) error {
+	staging := stagingDir(destdir, dirItem)
+	err := os.RemoveAll(staging)
+	if err != nil {
+		return fmt.Errorf("unable to clean staging directory %v: %v", staging, err)
+	}
+	defer func() {
+		if err := os.RemoveAll(staging); err != nil {
+			zap.S().Warnf("unable to remove staging directory %v: %v", staging, err)
+		}
+	}()
+
+	err = os.MkdirAll(path.Join(staging, camSubDir), os.FileMode(0755))
+	if err != nil {
+		return fmt.Errorf("unable to make staging directory %v: %v", staging, err)
+	}
+	for _, a := range actions {
+		err = a.write(path.Join(staging, a.dest))
+		if err != nil {
+			return fmt.Errorf("unable to copy files in %v directory: %v", destdir, err)
+		}
+	}
+
+	setDir := path.Join(destdir, dirItem)
+	if _, err := os.Stat(setDir); os.IsNotExist(err) {
+		if err := rename(staging, setDir); err != nil {
+			return fmt.Errorf("unable to move record set to %v directory: %v", destdir, err)
+		}
+		return nil
+	}
+	return moveFiles(staging, setDir, actions)
+}
+
+// movedFile is a file moved into record set directory, backup is the replaced file if any
+type movedFile struct {
+	dest   string
+	backup string
+}
+
+// moveFiles moves staged files into existing record set directory, replaced files are kept into staging directory
+// until all files are moved
+func moveFiles(staging, setDir string, actions []copyAction) (err error) {
+	l := zap.S()
+	backupDir := path.Join(staging, ".backup")
+	camDir := path.Join(setDir, camSubDir)
+	_, statErr := os.Stat(camDir)
+	camCreated := os.IsNotExist(statErr)
+	for _, dir := range []string{path.Join(backupDir, camSubDir), camDir} {
+		if err := os.MkdirAll(dir, os.FileMode(0755)); err != nil {
+			return fmt.Errorf("unable to make directory %v: %v", dir, err)
+		}
+	}
+
+	moved := make([]movedFile, 0, len(actions))
+	defer func() {
+		if err == nil {
+			return
+		}
+		for i := len(moved) - 1; i >= 0; i-- {
+			m := moved[i]
+			if m.backup == "" {
+				if err := os.Remove(m.dest); err != nil {
+					l.Warnf("unable to remove %v on rollback: %v", m.dest, err)
+				}
+				continue
+			}
+			if err := rename(m.backup, m.dest); err != nil {
+				l.Warnf("unable to restore %v on rollback: %v", m.dest, err)
+			}
+		}
+		if camCreated {
+			if err := os.Remove(camDir); err != nil {
+				l.Warnf("unable to remove %v on rollback: %v", camDir, err)
+			}
+		}
+	}()
+
+	for _, a := range actions {
+		m := movedFile{dest: path.Join(setDir, a.dest)}
+		if _, err := os.Stat(m.dest); err == nil {
+			m.backup = path.Join(backupDir, a.dest)
+			if err := rename(m.dest, m.backup); err != nil {
+				return fmt.Errorf("unable to backup %v: %v", m.dest, err)
+			}
+			// Restore backup if move fails
+			moved = append(moved, movedFile{dest: m.dest, backup: m.backup})
+			if err := rename(path.Join(staging, a.dest), m.dest); err != nil {
+				return fmt.Errorf("unable to move %v to %v directory: %v", a.dest, setDir, err)
+			}
+			continue
+		}
+		if err := rename(path.Join(staging, a.dest), m.dest); err != nil {
+			return fmt.Errorf("unable to move %v to %v directory: %v", a.dest, setDir, err)
+		}
+		moved = append(moved, m)
 	}
 	return nil
 }
+
+var rename = os.Rename
+
+func stagingDir(destdir, dirItem string) string {
+	return path.Join(destdir, fmt.Sprintf(".%s.import", dirItem))
+}
+
+func sameContent(a *copyAction, destFile string) (bool, error) {
+	if _, err := os.Stat(destFile); os.IsNotExist(err) {
+		return false, nil
+	}
+	destSum, err := fileChecksum(destFile)
+	if err != nil {
+		return false, err
+	}
+	srcSum, err := a.checksum()
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(srcSum, destSum), nil
+}
+
+func fileChecksum(file string) ([]byte, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open %v: %v", file, err)
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, fmt.Errorf("unable to compute checksum of %v: %v", file, err)
+	}
+	return h.Sum(nil), nil
+}
+
+// fingerprint identifies content of a source record set from names, sizes and modification times of its files
+func fingerprint(dir string) (string, error) {
+	h := sha256.New()
+	for _, d := range []string{dir, path.Join(dir, camSubDir)} {
+		items, err := ioutil.ReadDir(d)
+		if err != nil {
+			return "", fmt.Errorf("unable to list directory %v: %v", d, err)
+		}
+		for _, item := range items {
+			if item.IsDir() {
+				continue
+			}
+			_, _ = fmt.Fprintf(h, "%s/%s:%d:%d\n", strings.TrimPrefix(d, dir), item.Name(), item.Size(), item.ModTime().UnixNano())
+		}
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
@@ -2,11 +2,14 @@ package dkimpt
 
 import (
 	"encoding/json"
+	"fmt"
+	"github.com/cyrilix/robocar-tools/pkg/testutil"
 	record2 "github.com/cyrilix/robocar-tools/record"
 	"go.uber.org/zap"
 	"io/ioutil"
 	"os"
 	"path"
+	"strings"
 	"testing"
 )
 
@@ -20,7 +23,7 @@ func TestImportDonkeyRecords(t *testing.T) {
 		zap.S().Errorf("unable to delete tmpdir %v: %v", destDir, err)
 	}()
 
-	err = ImportDonkeyRecords("testdata", destDir)
+	_, err = ImportDonkeyRecords("testdata", destDir, false)
 	if err != nil {
 		t.Errorf("unable to import files: %v", err)
 	}
@@ -85,3 +88,166 @@ func TestImportDonkeyRecords(t *testing.T) {
 		}
 	}
 }
+
+func TestImportDonkeyRecords_DryRun(t *testing.T) {
+	destDir := path.Join(t.TempDir(), "dest")
+
+	summary, err := ImportDonkeyRecords("testdata", destDir, true)
+	if err != nil {
+		t.Fatalf("unable to import files: %v", err)
+	}
+	if summary.RecordSets != 2 || summary.Copied != 30 || summary.Unchanged != 0 {
+		t.Errorf("bad summary: %v", summary)
+	}
+	if _, err := os.Stat(destDir); !os.IsNotExist(err) {
+		t.Errorf("dry-run must not write into %v", destDir)
+	}
+}
+
+func TestImportDonkeyRecords_Incremental(t *testing.T) {
+	destDir := t.TempDir()
+
+	summary, err := ImportDonkeyRecords("testdata", destDir, false)
+	if err != nil {
+		t.Fatalf("unable to import files: %v", err)
+	}
+	if summary.Copied != 30 || summary.SkippedSets != 0 {
+		t.Errorf("bad summary for first import: %v", summary)
+	}
+
+	summary, err = ImportDonkeyRecords("testdata", destDir, false)
+	if err != nil {
+		t.Fatalf("unable to import files: %v", err)
+	}
+	if summary.Copied != 0 || summary.SkippedSets != 2 {
+		t.Errorf("record sets must be skipped according to journal: %v", summary)
+	}
+
+	// Without journal, files are compared by checksum
+	if err := os.Remove(path.Join(destDir, journalFileName)); err != nil {
+		t.Fatalf("unable to remove journal: %v", err)
+	}
+	if err := os.Remove(path.Join(destDir, "20191012_111416", "cam", "image_array_20191012_111416_000000002.jpg")); err != nil {
+		t.Fatalf("unable to remove image: %v", err)
+	}
+	summary, err = ImportDonkeyRecords("testdata", destDir, false)
+	if err != nil {
+		t.Fatalf("unable to import files: %v", err)
+	}
+	if summary.Copied != 1 || summary.Unchanged != 29 || summary.SkippedSets != 0 {
+		t.Errorf("only missing files must be copied: %v", summary)
+	}
+}
+
+func TestImportDonkeyRecords_Rollback(t *testing.T) {
+	srcDir := t.TempDir()
+	testutil.CopyDir(t, "testdata", srcDir)
+	destDir := t.TempDir()
+
+	err := ioutil.WriteFile(path.Join(srcDir, "20191012_122633", "record_000000004.json"), []byte("{invalid"), os.FileMode(0644))
+	if err != nil {
+		t.Fatalf("unable to corrupt record: %v", err)
+	}
+
+	summary, err := ImportDonkeyRecords(srcDir, destDir, false)
+	if err == nil {
+		t.Errorf("an error is expected when a record set fails")
+	}
+	if len(summary.FailedSets) != 1 || summary.FailedSets[0] != "20191012_122633" {
+		t.Errorf("bad failed sets: %v", summary.FailedSets)
+	}
+	if _, err := os.Stat(path.Join(destDir, "20191012_111416", "cam")); err != nil {
+		t.Errorf("valid record set must be imported: %v", err)
+	}
+
+	files, err := ioutil.ReadDir(destDir)
+	if err != nil {
+		t.Fatalf("unable to list %v: %v", destDir, err)
+	}
+	for _, f := range files {
+		if f.Name() != "20191012_111416" && f.Name() != journalFileName {
+			t.Errorf("unexpected file %v after rollback", f.Name())
+		}
+	}
+}
+
+// failRename makes file moves fail for sources matching fail
+func failRename(t *testing.T, fail func(src string) bool) {
+	oldRename := rename
+	t.Cleanup(func() {
+		rename = oldRename
+	})
+	rename = func(src, dest string) error {
+		if fail(src) {
+			return fmt.Errorf("rename failure")
+		}
+		return oldRename(src, dest)
+	}
+}
+
+func TestImportDonkeyRecords_RollbackNewSet(t *testing.T) {
+	destDir := t.TempDir()
+	failRename(t, func(src string) bool { return strings.Contains(src, "20191012_122633") })
+
+	summary, err := ImportDonkeyRecords("testdata", destDir, false)
+	if err == nil {
+		t.Errorf("an error is expected when a record set can't be moved")
+	}
+	if len(summary.FailedSets) != 1 || summary.FailedSets[0] != "20191012_122633" {
+		t.Errorf("bad failed sets: %v", summary.FailedSets)
+	}
+	files, err := ioutil.ReadDir(destDir)
+	if err != nil {
+		t.Fatalf("unable to list %v: %v", destDir, err)
+	}
+	for _, f := range files {
+		if f.Name() != "20191012_111416" && f.Name() != journalFileName {
+			t.Errorf("unexpected file %v after rollback", f.Name())
+		}
+	}
+}
+
+func TestImportDonkeyRecords_RollbackExistingSet(t *testing.T) {
+	destDir := t.TempDir()
+	if _, err := ImportDonkeyRecords("testdata", destDir, false); err != nil {
+		t.Fatalf("unable to import files: %v", err)
+	}
+
+	// Without journal, changed and missing files are copied again
+	if err := os.Remove(path.Join(destDir, journalFileName)); err != nil {
+		t.Fatalf("unable to remove journal: %v", err)
+	}
+	setDir := path.Join(destDir, "20191012_111416")
+	changedRecord := path.Join(setDir, "record_20191012_111416_000000002.json")
+	if err := ioutil.WriteFile(changedRecord, []byte("{}"), os.FileMode(0644)); err != nil {
+		t.Fatalf("unable to change record: %v", err)
+	}
+	missingImage := path.Join(setDir, "cam", "image_array_20191012_111416_000000002.jpg")
+	if err := os.Remove(missingImage); err != nil {
+		t.Fatalf("unable to remove image: %v", err)
+	}
+
+	// Record is replaced before image move fails
+	failRename(t, func(src string) bool { return strings.Contains(src, "image_array_") })
+	summary, err := ImportDonkeyRecords("testdata", destDir, false)
+	if err == nil {
+		t.Errorf("an error is expected when a file can't be moved")
+	}
+	if len(summary.FailedSets) != 1 || summary.FailedSets[0] != "20191012_111416" {
+		t.Errorf("bad failed sets: %v", summary.FailedSets)
+	}
+	content, err := ioutil.ReadFile(changedRecord)
+	if err != nil || string(content) != "{}" {
+		t.Errorf("replaced record must be restored: %s, %v", content, err)
+	}
+	if _, err := os.Stat(missingImage); !os.IsNotExist(err) {
+		t.Errorf("missing image must not be copied: %v", err)
+	}
+	files, err := ioutil.ReadDir(setDir)
+	if err != nil {
+		t.Fatalf("unable to list %v: %v", setDir, err)
+	}
+	if len(files) != 8 {
+		t.Errorf("bad number of files after rollback: %v, wants %v", len(files), 8)
+	}
+}
@@ -0,0 +1,118 @@
+package dkimpt
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"go.uber.org/zap"
+	"os"
+	"path"
+	"time"
+)
+
+const journalFileName = ".import-journal.jsonl"
+
+const (
+	statusStarted = "started"
+	statusDone    = "done"
+)
+
+type journalEntry struct {
+	RecordSet   string    `json:"record_set"`
+	Status      string    `json:"status"`
+	Fingerprint string    `json:"fingerprint,omitempty"`
+	Time        time.Time `json:"time"`
+}
+
+// journal tracks imported record sets into destination directory so that an interrupted import can be resumed
+type journal struct {
+	f      *os.File
+	dryRun bool
+	// last entry for each record set
+	entries map[string]journalEntry
+}
+
+func openJournal(destDir string, dryRun bool) (*journal, error) {
+	j := journal{dryRun: dryRun, entries: make(map[string]journalEntry)}
+	journalFile := path.Join(destDir, journalFileName)
+
+	if f, err := os.Open(journalFile); err == nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var e journalEntry
+			if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+				zap.S().Warnf("ignore invalid journal entry '%v': %v", scanner.Text(), err)
+				continue
+			}
+			j.entries[e.RecordSet] = e
+		}
+		_ = f.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("unable to read journal %v: %v", journalFile, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("unable to open journal %v: %v", journalFile, err)
+	}
+
+	if dryRun {
+		return &j, nil
+	}
+
+	err := os.MkdirAll(destDir, os.FileMode(0755))
+	if err != nil {
+		return nil, fmt.Errorf("unable to make dest directory %v: %v", destDir, err)
+	}
+	j.f, err = os.OpenFile(journalFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, os.FileMode(0644))
+	if err != nil {
+		return nil, fmt.Errorf("unable to open journal %v: %v", journalFile, err)
+	}
+	return &j, nil
+}
+
+func (j *journal) Close() {
+	if j.f == nil {
+		return
+	}
+	if err := j.f.Close(); err != nil {
+		zap.S().Warnf("unable to close import journal: %v", err)
+	}
+}
+
+// isDone returns true if record set has been fully imported and source hasn't changed since
+func (j *journal) isDone(recordSet, fingerprint string) bool {
+	e, ok := j.entries[recordSet]
+	return ok && e.Status == statusDone && e.Fingerprint == fingerprint
+}
+
+// isStarted returns true if a previous import of record set has been interrupted
+func (j *journal) isStarted(recordSet string) bool {
+	e, ok := j.entries[recordSet]
+	return ok && e.Status == statusStarted
+}
+
+func (j *journal) markStarted(recordSet string) error {
+	return j.append(journalEntry{RecordSet: recordSet, Status: statusStarted})
+}
+
+func (j *journal) markDone(recordSet, fingerprint string) error {
+	return j.append(journalEntry{RecordSet: recordSet, Status: statusDone, Fingerprint: fingerprint})
+}
+
+func (j *journal) append(e journalEntry) error {
+	if j.dryRun {
+		return nil
+	}
+	e.Time = time.Now()
+	content, err := json.Marshal(&e)
+	if err != nil {
+		return fmt.Errorf("unable to marshal journal entry: %v", err)
+	}
+	if _, err = j.f.Write(append(content, '\n')); err != nil {
+		return fmt.Errorf("unable to write journal entry: %v", err)
+	}
+	if err = j.f.Sync(); err != nil {
+		return fmt.Errorf("unable to sync journal: %v", err)
+	}
+	j.entries[e.RecordSet] = e
+	return nil
+}
@@ -0,0 +1,134 @@
+package latency
+
+import (
+	"fmt"
+	"github.com/cyrilix/robocar-base/service"
+	"github.com/cyrilix/robocar-protobuf/go/events"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/golang/protobuf/proto"
+	"go.uber.org/zap"
+	"io"
+	"sync"
+	"time"
+)
+
+// New builds part that measures latency of stages responses to frames of frameTopic. Stats of last interval are logged
+// every interval and a summary is written to out on stop.
+func New(client mqtt.Client, frameTopic string, stages []Stage, timeout, interval time.Duration, out io.Writer) *Part {
+	names := make([]string, 0, len(stages))
+	for _, s := range stages {
+		names = append(names, s.Name)
+	}
+	return &Part{
+		client:     client,
+		frameTopic: frameTopic,
+		stages:     stages,
+		tracker:    NewTracker(timeout, names...),
+		interval:   interval,
+		out:        out,
+		cancel:     make(chan interface{}),
+	}
+}
+
+type Part struct {
+	client     mqtt.Client
+	frameTopic string
+	stages     []Stage
+	tracker    *Tracker
+	interval   time.Duration
+	out        io.Writer
+
+	cancel   chan interface{}
+	stopOnce sync.Once
+}
+
+func (p *Part) Start() error {
+	if err := p.registerCallbacks(); err != nil {
+		return fmt.Errorf("unable to start service: %v", err)
+	}
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			p.tracker.Expire(now)
+			for _, s := range p.tracker.Report() {
+				zap.S().Infof("latency %v", s)
+			}
+		case <-p.cancel:
+			return nil
+		}
+	}
+}
+
+// Stop writes summary, it may be called several times but summary is only written once
+func (p *Part) Stop() {
+	p.stopOnce.Do(p.stop)
+}
+
+func (p *Part) stop() {
+	close(p.cancel)
+
+	topics := []string{p.frameTopic}
+	for _, s := range p.stages {
+		topics = append(topics, s.Topic)
+	}
+	token := p.client.Unsubscribe(topics...)
+	token.Wait()
+	if token.Error() != nil {
+		zap.S().Errorf("unable to unsubscribe service: %v", token.Error())
+	}
+
+	p.tracker.Expire(time.Now())
+	if err := WriteSummary(p.out, p.tracker.Summary()); err != nil {
+		zap.S().Errorf("unable to write summary: %v", err)
+	}
+}
+
+func (p *Part) onFrame(_ mqtt.Client, message mqtt.Message) {
+	var msg events.FrameMessage
+	err := proto.Unmarshal(message.Payload(), &msg)
+	if err != nil {
+		zap.S().Errorf("unable to unmarshal protobuf FrameMessage: %v", err)
+		return
+	}
+	p.tracker.AddFrame(msg.GetId(), time.Now())
+}
+
+// onStages returns handler of messages of a topic shared by stages
+func (p *Part) onStages(stages []Stage) mqtt.MessageHandler {
+	return func(_ mqtt.Client, message mqtt.Message) {
+		now := time.Now()
+		for _, stage := range stages {
+			ref, err := stage.Type.frameRef(message.Payload())
+			if err != nil {
+				zap.S().Errorf("invalid message on stage %v: %v", stage.Name, err)
+				continue
+			}
+			p.tracker.AddResponse(stage.Name, ref, now)
+		}
+	}
+}
+
+// registerCallbacks subscribes to frame and stages topics, a single handler is registered by topic since mqtt client
+// keeps only one handler by topic
+func (p *Part) registerCallbacks() error {
+	if err := service.RegisterCallback(p.client, p.frameTopic, p.onFrame); err != nil {
+		return err
+	}
+	topics := make([]string, 0, len(p.stages))
+	byTopic := make(map[string][]Stage)
+	for _, s := range p.stages {
+		if _, ok := byTopic[s.Topic]; !ok {
+			topics = append(topics, s.Topic)
+		}
+		byTopic[s.Topic] = append(byTopic[s.Topic], s)
+	}
+	for _, topic := range topics {
+		if err := service.RegisterCallback(p.client, topic, p.onStages(byTopic[topic])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package latency
+
+import (
+	"bytes"
+	"github.com/cyrilix/robocar-protobuf/go/events"
+	"github.com/cyrilix/robocar-tools/pkg/testutil"
+	"github.com/golang/protobuf/proto"
+	"testing"
+	"time"
+)
+
+func TestPart_OnStages(t *testing.T) {
+	stages, err := ParseStages("pilot=steering:car/steering,copy=steering:car/steering")
+	if err != nil {
+		t.Fatalf("unable to parse stages: %v", err)
+	}
+	p := New(nil, "car/frame", stages, time.Second, time.Second, &bytes.Buffer{})
+
+	ref := &events.FrameRef{Name: "camera", Id: "1"}
+	p.tracker.AddFrame(ref, time.Now())
+	payload, err := proto.Marshal(&events.SteeringMessage{Steering: 0.2, FrameRef: ref})
+	if err != nil {
+		t.Fatalf("unable to marshal message: %v", err)
+	}
+	// Stages sharing a topic receive all its messages
+	p.onStages(stages)(nil, testutil.NewMessage("car/steering", payload))
+
+	for _, s := range p.tracker.Summary()[1:] {
+		if s.Count != 1 {
+			t.Errorf("bad number of responses for stage %v: %v, wants %v", s.Stage, s.Count, 1)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package latency
+
+import (
+	"fmt"
+	"github.com/cyrilix/robocar-protobuf/go/events"
+	"github.com/golang/protobuf/proto"
+	"strings"
+)
+
+// MessageType is the type of protobuf messages published on a stage topic
+type MessageType string
+
+const (
+	MessageSteering MessageType = "steering"
+	MessageThrottle MessageType = "throttle"
+	MessageObjects  MessageType = "objects"
+	MessageRoad     MessageType = "road"
+)
+
+// frameRef decodes payload and returns reference of frame used to compute message
+func (t MessageType) frameRef(payload []byte) (*events.FrameRef, error) {
+	var msg interface {
+		proto.Message
+		GetFrameRef() *events.FrameRef
+	}
+	switch t {
+	case MessageSteering:
+		msg = &events.SteeringMessage{}
+	case MessageThrottle:
+		msg = &events.ThrottleMessage{}
+	case MessageObjects:
+		msg = &events.ObjectsMessage{}
+	case MessageRoad:
+		msg = &events.RoadMessage{}
+	default:
+		return nil, fmt.Errorf("unknown message type '%v'", t)
+	}
+	if err := proto.Unmarshal(payload, msg); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal protobuf %T: %v", msg, err)
+	}
+	return msg.GetFrameRef(), nil
+}
+
+// Stage is a topic of messages computed from frames
+type Stage struct {
+	Name  string
+	Type  MessageType
+	Topic string
+}
+
+func (s Stage) String() string {
+	return fmt.Sprintf("%s=%s:%s", s.Name, s.Type, s.Topic)
+}
+
+// ParseStages parses comma separated list of stages defined as [name=]type:topic, type is one of steering, throttle,
+// objects or road. Stage name is its type if not set, several stages may share a topic.
+func ParseStages(s string) ([]Stage, error) {
+	stages := make([]Stage, 0)
+	names := make(map[string]bool)
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		var st Stage
+		if i := strings.Index(item, "="); i >= 0 {
+			st.Name, item = item[:i], item[i+1:]
+		}
+		parts := strings.SplitN(item, ":", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			return nil, fmt.Errorf("invalid stage '%v', [name=]type:topic expected", item)
+		}
+		st.Type, st.Topic = MessageType(parts[0]), parts[1]
+		switch st.Type {
+		case MessageSteering, MessageThrottle, MessageObjects, MessageRoad:
+		default:
+			return nil, fmt.Errorf("invalid stage '%v', unknown message type '%v'", item, st.Type)
+		}
+		if st.Name == "" {
+			st.Name = string(st.Type)
+		}
+		if names[st.Name] || st.Name == FrameStage {
+			return nil, fmt.Errorf("duplicated stage name '%v'", st.Name)
+		}
+		names[st.Name] = true
+		stages = append(stages, st)
+	}
+	return stages, nil
+}
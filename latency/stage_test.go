@@ -0,0 +1,69 @@
+package latency
+
+import (
+	"github.com/cyrilix/robocar-protobuf/go/events"
+	"github.com/golang/protobuf/proto"
+	"reflect"
+	"testing"
+)
+
+func TestParseStages(t *testing.T) {
+	cases := []struct {
+		name     string
+		value    string
+		expected []Stage
+		err      bool
+	}{
+		{"empty", "", []Stage{}, false},
+		{"default name", "steering:car/steering", []Stage{{Name: "steering", Type: MessageSteering, Topic: "car/steering"}}, false},
+		{"named", "pilot=steering:car/pilot/steering, road:car/road", []Stage{
+			{Name: "pilot", Type: MessageSteering, Topic: "car/pilot/steering"},
+			{Name: "road", Type: MessageRoad, Topic: "car/road"},
+		}, false},
+		{"unknown type", "frame:car/frame", nil, true},
+		{"missing topic", "steering", nil, true},
+		{"duplicated name", "steering:car/a,steering:car/b", nil, true},
+		{"reserved name", "frame=road:car/road", nil, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			stages, err := ParseStages(c.value)
+			if (err != nil) != c.err {
+				t.Fatalf("bad error: %v", err)
+			}
+			if !c.err && !reflect.DeepEqual(stages, c.expected) {
+				t.Errorf("bad stages: %v, wants %v", stages, c.expected)
+			}
+		})
+	}
+}
+
+func TestMessageType_FrameRef(t *testing.T) {
+	ref := &events.FrameRef{Name: "camera", Id: "42"}
+	cases := []struct {
+		msgType MessageType
+		msg     proto.Message
+	}{
+		{MessageSteering, &events.SteeringMessage{Steering: 0.3, FrameRef: ref}},
+		{MessageThrottle, &events.ThrottleMessage{Throttle: 0.5, FrameRef: ref}},
+		{MessageObjects, &events.ObjectsMessage{FrameRef: ref}},
+		{MessageRoad, &events.RoadMessage{FrameRef: ref}},
+	}
+	for _, c := range cases {
+		payload, err := proto.Marshal(c.msg)
+		if err != nil {
+			t.Fatalf("unable to marshal %T: %v", c.msg, err)
+		}
+		result, err := c.msgType.frameRef(payload)
+		if err != nil {
+			t.Errorf("%v: unable to decode message: %v", c.msgType, err)
+			continue
+		}
+		if result.GetId() != "42" {
+			t.Errorf("%v: bad frame ref %v", c.msgType, result)
+		}
+	}
+	if _, err := MessageType("frame").frameRef(nil); err == nil {
+		t.Errorf("unknown type should fail")
+	}
+}
@@ -0,0 +1,252 @@
+package latency
+
+import (
+	"fmt"
+	"github.com/cyrilix/robocar-protobuf/go/events"
+	"io"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// FrameStage is the name of stage measuring delay between frame creation and its reception
+const FrameStage = "frame"
+
+// Tracker matches stage responses with frames by frame id. Latency of a response is the delay between frame creation
+// and response reception, frames without creation date are dated at reception. Stages without response after timeout
+// are counted as missing, their late responses are ignored during another timeout.
+type Tracker struct {
+	timeout time.Duration
+	stages  []string
+
+	muTracker sync.Mutex
+	frames    map[string]*pendingFrame
+	// order lists pending frame ids by reception
+	order []string
+	// expired are ids of frames expired since less than timeout, by expiration date, ordered as expiredOrder
+	expired      map[string]time.Time
+	expiredOrder []string
+	// live are stats since last report, total since tracker creation
+	live, total map[string]*accumulator
+}
+
+type pendingFrame struct {
+	createdAt  time.Time
+	receivedAt time.Time
+	responded  map[string]bool
+}
+
+func NewTracker(timeout time.Duration, stages ...string) *Tracker {
+	t := Tracker{
+		timeout: timeout,
+		stages:  append([]string{FrameStage}, stages...),
+		frames:  make(map[string]*pendingFrame),
+		order:   make([]string, 0),
+		expired: make(map[string]time.Time),
+	}
+	t.live = t.newAccumulators()
+	t.total = t.newAccumulators()
+	return &t
+}
+
+func (t *Tracker) newAccumulators() map[string]*accumulator {
+	acc := make(map[string]*accumulator, len(t.stages))
+	for _, s := range t.stages {
+		acc[s] = &accumulator{latencies: make([]time.Duration, 0)}
+	}
+	return acc
+}
+
+// AddFrame records frame received at now
+func (t *Tracker) AddFrame(ref *events.FrameRef, now time.Time) {
+	t.muTracker.Lock()
+	defer t.muTracker.Unlock()
+
+	id := ref.GetId()
+	if _, ok := t.frames[id]; ok {
+		return
+	}
+	createdAt := now
+	if ref.GetCreatedAt() != nil {
+		createdAt = ref.GetCreatedAt().AsTime()
+	}
+	t.frames[id] = &pendingFrame{createdAt: createdAt, receivedAt: now, responded: make(map[string]bool)}
+	t.order = append(t.order, id)
+	t.addLatency(FrameStage, now.Sub(createdAt))
+}
+
+// AddResponse records response of stage to frame ref received at now, only first response to a frame is measured
+func (t *Tracker) AddResponse(stage string, ref *events.FrameRef, now time.Time) {
+	t.muTracker.Lock()
+	defer t.muTracker.Unlock()
+
+	if _, ok := t.total[stage]; !ok {
+		return
+	}
+	f, ok := t.frames[ref.GetId()]
+	if _, expired := t.expired[ref.GetId()]; !ok && expired {
+		// Already counted as missing
+		return
+	}
+	if !ok {
+		t.live[stage].unmatched += 1
+		t.total[stage].unmatched += 1
+		return
+	}
+	if f.responded[stage] {
+		return
+	}
+	f.responded[stage] = true
+	t.addLatency(stage, now.Sub(f.createdAt))
+}
+
+func (t *Tracker) addLatency(stage string, d time.Duration) {
+	t.live[stage].add(d)
+	t.total[stage].add(d)
+}
+
+// Expire forgets frames received since timeout, stages that haven't responded are counted as missing
+func (t *Tracker) Expire(now time.Time) {
+	t.muTracker.Lock()
+	defer t.muTracker.Unlock()
+
+	first := 0
+	for ; first < len(t.order); first++ {
+		id := t.order[first]
+		f := t.frames[id]
+		if now.Sub(f.receivedAt) < t.timeout {
+			break
+		}
+		for _, s := range t.stages[1:] {
+			if !f.responded[s] {
+				t.live[s].missing += 1
+				t.total[s].missing += 1
+			}
+		}
+		delete(t.frames, id)
+		t.expired[id] = now
+		t.expiredOrder = append(t.expiredOrder, id)
+	}
+	t.order = t.order[first:]
+
+	first = 0
+	for ; first < len(t.expiredOrder); first++ {
+		id := t.expiredOrder[first]
+		if now.Sub(t.expired[id]) < t.timeout {
+			break
+		}
+		delete(t.expired, id)
+	}
+	t.expiredOrder = t.expiredOrder[first:]
+}
+
+// Report returns stats of each stage since last report
+func (t *Tracker) Report() []Stats {
+	t.muTracker.Lock()
+	defer t.muTracker.Unlock()
+	stats := t.stats(t.live)
+	t.live = t.newAccumulators()
+	return stats
+}
+
+// Summary returns stats of each stage since tracker creation
+func (t *Tracker) Summary() []Stats {
+	t.muTracker.Lock()
+	defer t.muTracker.Unlock()
+	return t.stats(t.total)
+}
+
+func (t *Tracker) stats(acc map[string]*accumulator) []Stats {
+	stats := make([]Stats, 0, len(t.stages))
+	for _, s := range t.stages {
+		stats = append(stats, acc[s].stats(s))
+	}
+	return stats
+}
+
+// Stats are latency percentiles of a stage. Jitter is the mean difference between latencies of consecutive responses.
+// Missing responses are frames without response before timeout, unmatched responses refer to unknown frames. Responses
+// received after timeout are only counted as missing.
+type Stats struct {
+	Stage              string
+	Count              int
+	Missing, Unmatched int
+	P50, P90, P99, Max time.Duration
+	Jitter             time.Duration
+}
+
+func (s Stats) String() string {
+	if s.Count == 0 {
+		return fmt.Sprintf("%s: no response, missing=%d unmatched=%d", s.Stage, s.Missing, s.Unmatched)
+	}
+	return fmt.Sprintf("%s: p50=%v p90=%v p99=%v max=%v jitter=%v count=%d missing=%d unmatched=%d", s.Stage,
+		round(s.P50), round(s.P90), round(s.P99), round(s.Max), round(s.Jitter), s.Count, s.Missing, s.Unmatched)
+}
+
+// WriteSummary writes stats as a table
+func WriteSummary(w io.Writer, stats []Stats) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	_, err := fmt.Fprintln(tw, "stage\tcount\tp50\tp90\tp99\tmax\tjitter\tmissing\tunmatched\t")
+	if err != nil {
+		return fmt.Errorf("unable to write latency summary: %w", err)
+	}
+	for _, s := range stats {
+		_, err := fmt.Fprintf(tw, "%s\t%d\t%v\t%v\t%v\t%v\t%v\t%d\t%d\t\n", s.Stage, s.Count,
+			round(s.P50), round(s.P90), round(s.P99), round(s.Max), round(s.Jitter), s.Missing, s.Unmatched)
+		if err != nil {
+			return fmt.Errorf("unable to write latency summary: %w", err)
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("unable to write latency summary: %w", err)
+	}
+	return nil
+}
+
+func round(d time.Duration) time.Duration {
+	return d.Round(100 * time.Microsecond)
+}
+
+type accumulator struct {
+	latencies          []time.Duration
+	jitterSum          time.Duration
+	missing, unmatched int
+}
+
+func (a *accumulator) add(d time.Duration) {
+	if n := len(a.latencies); n > 0 {
+		diff := d - a.latencies[n-1]
+		if diff < 0 {
+			diff = -diff
+		}
+		a.jitterSum += diff
+	}
+	a.latencies = append(a.latencies, d)
+}
+
+func (a *accumulator) stats(stage string) Stats {
+	s := Stats{Stage: stage, Count: len(a.latencies), Missing: a.missing, Unmatched: a.unmatched}
+	if s.Count == 0 {
+		return s
+	}
+	sorted := append([]time.Duration{}, a.latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	s.P50 = percentile(sorted, 50)
+	s.P90 = percentile(sorted, 90)
+	s.P99 = percentile(sorted, 99)
+	s.Max = sorted[len(sorted)-1]
+	if s.Count > 1 {
+		s.Jitter = a.jitterSum / time.Duration(s.Count-1)
+	}
+	return s
+}
+
+// percentile returns nearest rank percentile p of sorted latencies
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
@@ -0,0 +1,117 @@
+package latency
+
+import (
+	"bytes"
+	"github.com/cyrilix/robocar-protobuf/go/events"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"strings"
+	"testing"
+	"time"
+)
+
+var t0 = time.UnixMilli(1600000000000)
+
+func ref(id string, createdAt time.Time) *events.FrameRef {
+	return &events.FrameRef{
+		Name: "camera",
+		Id:   id,
+		CreatedAt: &timestamp.Timestamp{
+			Seconds: createdAt.Unix(),
+			Nanos:   int32(createdAt.Nanosecond()),
+		},
+	}
+}
+
+func ms(n int) time.Duration {
+	return time.Duration(n) * time.Millisecond
+}
+
+func TestTracker(t *testing.T) {
+	tracker := NewTracker(ms(500), "steering", "road")
+
+	// 10 frames every 50ms received after 5ms, steering responds after 20, 30, ... 110ms, road only to even frames
+	for i := 0; i < 10; i++ {
+		created := t0.Add(ms(50 * i))
+		id := created.Format("150405.000")
+		tracker.AddFrame(ref(id, created), created.Add(ms(5)))
+		tracker.AddResponse("steering", ref(id, created), created.Add(ms(20+10*i)))
+		tracker.AddResponse("steering", ref(id, created), created.Add(ms(200)))
+		if i%2 == 0 {
+			tracker.AddResponse("road", ref(id, created), created.Add(ms(40)))
+		}
+	}
+	tracker.AddResponse("road", ref("unknown", t0), t0)
+	tracker.AddResponse("unknown", ref("unknown", t0), t0)
+
+	// Only 6 first frames have expired
+	tracker.Expire(t0.Add(ms(255 + 500)))
+
+	stats := tracker.Report()
+	if len(stats) != 3 {
+		t.Fatalf("bad number of stages: %v", stats)
+	}
+	expected := []Stats{
+		{Stage: FrameStage, Count: 10, P50: ms(5), P90: ms(5), P99: ms(5), Max: ms(5)},
+		{Stage: "steering", Count: 10, P50: ms(60), P90: ms(100), P99: ms(110), Max: ms(110), Jitter: ms(10)},
+		{Stage: "road", Count: 5, Missing: 3, Unmatched: 1, P50: ms(40), P90: ms(40), P99: ms(40), Max: ms(40)},
+	}
+	for i, s := range stats {
+		if s != expected[i] {
+			t.Errorf("bad stats: %v, wants %v", s, expected[i])
+		}
+	}
+
+	// Live stats are reset by report, not summary
+	if s := tracker.Report()[1]; s.Count != 0 {
+		t.Errorf("live stats should be reset: %v", s)
+	}
+	tracker.Expire(t0.Add(ms(2000)))
+	if s := tracker.Report()[2]; s.Missing != 2 || s.Count != 0 {
+		t.Errorf("bad live stats: %v", s)
+	}
+	if s := tracker.Summary()[2]; s.Missing != 5 || s.Count != 5 {
+		t.Errorf("bad summary: %v", s)
+	}
+
+	// Late responses to frames expired since less than timeout are already counted as missing
+	late := t0.Add(ms(50 * 6))
+	tracker.AddResponse("road", ref(late.Format("150405.000"), late), t0.Add(ms(2100)))
+	if s := tracker.Summary()[2]; s.Missing != 5 || s.Unmatched != 1 || s.Count != 5 {
+		t.Errorf("late response must be ignored: %v", s)
+	}
+
+	// Responses to frames expired since timeout are unmatched
+	tracker.AddResponse("steering", ref(t0.Format("150405.000"), t0), t0.Add(ms(2000)))
+	if s := tracker.Summary()[1]; s.Unmatched != 1 || s.Count != 10 {
+		t.Errorf("bad summary: %v", s)
+	}
+}
+
+func TestTracker_WithoutCreationDate(t *testing.T) {
+	tracker := NewTracker(ms(500), "steering")
+	tracker.AddFrame(&events.FrameRef{Id: "1"}, t0)
+	tracker.AddResponse("steering", &events.FrameRef{Id: "1"}, t0.Add(ms(30)))
+
+	stats := tracker.Summary()
+	if stats[0].Max != 0 || stats[1].Max != ms(30) {
+		t.Errorf("latency should be measured from frame reception: %v", stats)
+	}
+}
+
+func TestWriteSummary(t *testing.T) {
+	buf := bytes.Buffer{}
+	err := WriteSummary(&buf, []Stats{
+		{Stage: "steering", Count: 10, P50: ms(60), P90: ms(100), P99: ms(110), Max: ms(110), Jitter: ms(10), Missing: 2},
+		{Stage: "road"},
+	})
+	if err != nil {
+		t.Fatalf("unable to write summary: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("bad number of lines: %q", buf.String())
+	}
+	if strings.Join(strings.Fields(lines[1]), " ") != "steering 10 60ms 100ms 110ms 110ms 10ms 2 0" {
+		t.Errorf("bad summary line: %q", lines[1])
+	}
+}
@@ -1,35 +1,59 @@
 package part
 
 import (
+	"bytes"
 	"fmt"
 	"github.com/cyrilix/robocar-base/service"
 	"github.com/cyrilix/robocar-protobuf/go/events"
+	"github.com/cyrilix/robocar-tools/pkg/framesync"
+	"github.com/cyrilix/robocar-tools/pkg/monitor"
+	"github.com/cyrilix/robocar-tools/pkg/overlay"
+	"github.com/cyrilix/robocar-tools/pkg/stream"
+	"github.com/cyrilix/robocar-tools/replay"
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 	"github.com/golang/protobuf/proto"
 	"go.uber.org/zap"
 	"gocv.io/x/gocv"
 	"image"
-	"image/color"
+	_ "image/jpeg"
+	_ "image/png"
 	"log"
+	"sync"
 	"time"
 )
 
-func NewPart(client mqtt.Client, frameTopic, objectsTopic, roadTopic, throttleFeedbackTopic string,
-	withObjects, withRoad, withThrottleFeedback bool) *FramePart {
+// NewPart builds frame display, keystrokes are published as replay commands on controlTopic if set.
+// Annotated frames are also published to frameStream if not nil, window isn't opened if withWindow is false.
+// Frames are displayed with their objects, road and throttle messages, or after syncDelay with missing or stale results.
+// Drive mode is displayed if driveModeTopic is set, topics without message since staleAfter are highlighted.
+// Frames are rendered at most maxFps times per second, older ready frames are dropped.
+func NewPart(client mqtt.Client, frameTopic, objectsTopic, roadTopic, throttleFeedbackTopic, driveModeTopic, controlTopic string,
+	withObjects, withRoad, withThrottleFeedback bool, frameStream *stream.MJPEG, withWindow bool, syncDelay time.Duration,
+	style *overlay.Style, staleAfter time.Duration, maxFps int) *FramePart {
+	if maxFps <= 0 {
+		maxFps = 1
+	}
+	var window *gocv.Window
+	if withWindow {
+		window = gocv.NewWindow("frameTopic")
+	}
 	return &FramePart{
 		client:                client,
 		frameTopic:            frameTopic,
 		objectsTopic:          objectsTopic,
 		roadTopic:             roadTopic,
 		throttleFeedbackTopic: throttleFeedbackTopic,
-		window:                gocv.NewWindow("frameTopic"),
+		driveModeTopic:        driveModeTopic,
+		controlTopic:          controlTopic,
+		window:                window,
+		frameStream:           frameStream,
 		withObjects:           withObjects,
 		withRoad:              withRoad,
 		withThrottleFeedback:  withThrottleFeedback,
-		imgChan:               make(chan gocv.Mat),
-		objectsChan:           make(chan events.ObjectsMessage),
-		roadChan:              make(chan events.RoadMessage),
-		throttleFeedbackChan:  make(chan events.ThrottleMessage),
+		style:                 style,
+		buffer:                framesync.NewBuffer(syncDelay, withObjects, withRoad, withThrottleFeedback),
+		monitor:               newMonitor(staleAfter, driveModeTopic, withObjects, withRoad, withThrottleFeedback),
+		interval:              time.Second / time.Duration(maxFps),
 		cancel:                make(chan interface{}),
 	}
 
@@ -38,17 +62,53 @@ func NewPart(client mqtt.Client, frameTopic, objectsTopic, roadTopic, throttleFe
 type FramePart struct {
 	client                                                     mqtt.Client
 	frameTopic, objectsTopic, roadTopic, throttleFeedbackTopic string
+	driveModeTopic, controlTopic                               string
+	// paused is true when replay has been paused from window, last frame is kept on screen
+	paused bool
 
+	// window is nil on headless display
 	window               *gocv.Window
+	frameStream          *stream.MJPEG
 	withObjects          bool
 	withRoad             bool
 	withThrottleFeedback bool
 
-	imgChan              chan gocv.Mat
-	objectsChan          chan events.ObjectsMessage
-	roadChan             chan events.RoadMessage
-	throttleFeedbackChan chan events.ThrottleMessage
-	cancel               chan interface{}
+	style   *overlay.Style
+	buffer  *framesync.Buffer
+	monitor *monitor.Monitor
+	// interval is the min delay between two rendered frames
+	interval time.Duration
+
+	muDriveMode sync.Mutex
+	driveMode   *events.DriveModeMessage
+
+	cancel chan interface{}
+}
+
+// Names of monitored topics in status bar
+const (
+	statusFrame    = "frame"
+	statusObjects  = "objects"
+	statusRoad     = "road"
+	statusThrottle = "throttle"
+	statusMode     = "mode"
+)
+
+func newMonitor(staleAfter time.Duration, driveModeTopic string, withObjects, withRoad, withThrottleFeedback bool) *monitor.Monitor {
+	names := []string{statusFrame}
+	if withObjects {
+		names = append(names, statusObjects)
+	}
+	if withRoad {
+		names = append(names, statusRoad)
+	}
+	if withThrottleFeedback {
+		names = append(names, statusThrottle)
+	}
+	if driveModeTopic != "" {
+		names = append(names, statusMode)
+	}
+	return monitor.New(staleAfter, names...)
 }
 
 func (p *FramePart) Start() error {
@@ -56,40 +116,82 @@ func (p *FramePart) Start() error {
 		return fmt.Errorf("unable to start service: %v", err)
 	}
 
-	var img = gocv.NewMat()
-	var objectsMsg events.ObjectsMessage
-	var roadMsg events.RoadMessage
-	var throttleFeedbackMsg events.ThrottleMessage
+	var img image.Image = blankFrame()
+	o := overlay.Overlay{}
 
+	var lastDraw time.Time
 	ticker := time.NewTicker(1 * time.Second)
+	syncTicker := time.NewTicker(20 * time.Millisecond)
+	defer syncTicker.Stop()
+	// keystrokes are polled only when a window is displayed
+	var keyTick <-chan time.Time
+	if p.window != nil {
+		keyTicker := time.NewTicker(100 * time.Millisecond)
+		defer keyTicker.Stop()
+		keyTick = keyTicker.C
+	}
 	for {
 		select {
+		case <-keyTick:
+			// Poll keystrokes even if no frame is received
+			p.onKey(p.window.WaitKey(1))
+			continue
 		case <-ticker.C:
-			img = gocv.NewMatWithSize(120, 120, gocv.MatTypeCV8S)
-		case newImg := <-p.imgChan:
-			img.Close()
+			if p.paused {
+				continue
+			}
+			img = blankFrame()
+			o = overlay.Overlay{}
+		case now := <-syncTicker.C:
+			if now.Sub(lastDraw) < p.interval {
+				// Ready frames are kept in buffer until next rendering slot
+				continue
+			}
+			entries := p.buffer.Ready(now)
+			if len(entries) == 0 {
+				continue
+			}
+			// Only last ready frame is displayed
+			p.monitor.Dropped(len(entries) - 1)
+			entry := entries[len(entries)-1]
+			newImg, _, err := image.Decode(bytes.NewReader(entry.Frame.GetFrame()))
+			if err != nil {
+				zap.S().Errorf("unable to decode image: %v", err)
+				continue
+			}
 			img = newImg
-		case objects := <-p.objectsChan:
-			objectsMsg = objects
-		case road := <-p.roadChan:
-			roadMsg = road
-		case throttleFeedback := <-p.throttleFeedbackChan:
-			throttleFeedbackMsg = throttleFeedback
+			o = entry.Overlay()
 		case <-p.cancel:
-			img.Close()
 			return nil
 		}
-		p.drawFrame(&img, &objectsMsg, &roadMsg, &throttleFeedbackMsg)
+		p.drawFrame(img, &o)
+		lastDraw = time.Now()
 		ticker.Reset(1 * time.Second)
 	}
 }
 
 func (p *FramePart) Stop() {
-	defer p.window.Close()
+	if p.window != nil {
+		defer p.window.Close()
+	}
 
 	close(p.cancel)
+	zap.S().Infof("%d frames dropped by display", p.monitor.DroppedCount())
 
-	StopService("frame-display", p.client, p.frameTopic, p.roadTopic)
+	topics := []string{p.frameTopic}
+	if p.withObjects {
+		topics = append(topics, p.objectsTopic)
+	}
+	if p.withRoad {
+		topics = append(topics, p.roadTopic)
+	}
+	if p.withThrottleFeedback {
+		topics = append(topics, p.throttleFeedbackTopic)
+	}
+	if p.driveModeTopic != "" {
+		topics = append(topics, p.driveModeTopic)
+	}
+	StopService("frame-display", p.client, topics...)
 }
 
 func (p *FramePart) onFrame(_ mqtt.Client, message mqtt.Message) {
@@ -101,13 +203,9 @@ func (p *FramePart) onFrame(_ mqtt.Client, message mqtt.Message) {
 	}
 
 	zap.S().Infow("new frame", zap.String("topic", message.Topic()), zap.String("frameId", msg.GetId().GetId()))
-
-	img, err := gocv.IMDecode(msg.Frame, gocv.IMReadUnchanged)
-	if err != nil {
-		zap.S().Errorf("unable to decode image: %v", err)
-		return
-	}
-	p.imgChan <- img
+	now := time.Now()
+	p.monitor.Received(statusFrame, now)
+	p.buffer.AddFrame(&msg, now)
 }
 
 func (p *FramePart) onObjects(_ mqtt.Client, message mqtt.Message) {
@@ -119,8 +217,10 @@ func (p *FramePart) onObjects(_ mqtt.Client, message mqtt.Message) {
 		return
 	}
 
-	zap.S().Infow("new objects", zap.String("topic", message.Topic()), zap.String("object", msg.Objects[0].String()))
-	p.objectsChan <- msg
+	zap.S().Infow("new objects", zap.String("topic", message.Topic()), zap.String("frameId", msg.GetFrameRef().GetId()))
+	now := time.Now()
+	p.monitor.Received(statusObjects, now)
+	p.buffer.AddObjects(&msg, now)
 }
 
 func (p *FramePart) onRoad(_ mqtt.Client, message mqtt.Message) {
@@ -132,7 +232,9 @@ func (p *FramePart) onRoad(_ mqtt.Client, message mqtt.Message) {
 		return
 	}
 
-	p.roadChan <- msg
+	now := time.Now()
+	p.monitor.Received(statusRoad, now)
+	p.buffer.AddRoad(&msg, now)
 }
 
 func (p *FramePart) onThrottleFeedback(_ mqtt.Client, message mqtt.Message) {
@@ -144,7 +246,24 @@ func (p *FramePart) onThrottleFeedback(_ mqtt.Client, message mqtt.Message) {
 		return
 	}
 
-	p.throttleFeedbackChan <- msg
+	now := time.Now()
+	p.monitor.Received(statusThrottle, now)
+	p.buffer.AddThrottle(&msg, now)
+}
+
+func (p *FramePart) onDriveMode(_ mqtt.Client, message mqtt.Message) {
+	var msg events.DriveModeMessage
+
+	err := proto.Unmarshal(message.Payload(), &msg)
+	if err != nil {
+		zap.S().Errorf("unable to unmarshal msg %T: %v", msg, err)
+		return
+	}
+
+	p.monitor.Received(statusMode, time.Now())
+	p.muDriveMode.Lock()
+	defer p.muDriveMode.Unlock()
+	p.driveMode = &msg
 }
 
 func (p *FramePart) registerCallbacks() error {
@@ -172,91 +291,64 @@ func (p *FramePart) registerCallbacks() error {
 			return err
 		}
 	}
+	if p.driveModeTopic != "" {
+		err := service.RegisterCallback(p.client, p.driveModeTopic, p.onDriveMode)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func (p *FramePart) drawFrame(img *gocv.Mat, objects *events.ObjectsMessage, road *events.RoadMessage, tf *events.ThrottleMessage) {
-
-	if p.withObjects {
-		p.drawObjects(img, objects)
+func (p *FramePart) drawFrame(img image.Image, o *overlay.Overlay) {
+	now := time.Now()
+	o.Style = p.style
+	p.muDriveMode.Lock()
+	o.DriveMode = p.driveMode
+	p.muDriveMode.Unlock()
+	o.StatusBar = p.monitor.Status(now)
+	p.monitor.Displayed(now)
+	rendered := overlay.Render(img, o)
+	if p.frameStream != nil {
+		p.frameStream.Publish(rendered)
 	}
-	if p.withRoad {
-		p.drawRoad(img, road)
+	if p.window == nil {
+		return
 	}
-	if p.withThrottleFeedback {
-		p.drawThrottleFeedbackText(img, tf)
+
+	mat, err := gocv.ImageToMatRGB(rendered)
+	if err != nil {
+		zap.S().Errorf("unable to convert image: %v", err)
+		return
 	}
+	defer mat.Close()
 
-	p.window.IMShow(*img)
-	p.window.WaitKey(1)
+	p.window.IMShow(mat)
+	p.onKey(p.window.WaitKey(1))
 }
 
-func (p *FramePart) drawObjects(img *gocv.Mat, objects *events.ObjectsMessage) {
-	zap.S().Debugf("draw object %v", objects)
-	for _, obj := range objects.GetObjects() {
-		gocv.Rectangle(
-			img,
-			image.Rect(
-				int(obj.GetLeft()*float32(img.Cols())),
-				int(obj.GetTop()*float32(img.Rows())),
-				int(obj.GetRight()*float32(img.Cols())),
-				int(obj.GetBottom()*float32(img.Rows())),
-			),
-			color.RGBA{R: 0, G: 255, B: 0, A: 0},
-			2)
+func (p *FramePart) onKey(key int) {
+	if p.controlTopic == "" {
+		return
 	}
-}
-
-func (p *FramePart) drawRoad(img *gocv.Mat, road *events.RoadMessage) {
-	cntr := make([]image.Point, 0, len(road.GetContour()))
-	if road.GetContour() == nil || len(road.GetContour()) < 3 {
+	cmd, ok := replay.CommandForKey(key)
+	if !ok {
 		return
 	}
-	for _, pt := range road.GetContour() {
-		cntr = append(cntr, image.Point{X: int(pt.GetX()), Y: int(pt.GetY())})
+	switch cmd.Type {
+	case replay.CommandToggle:
+		p.paused = !p.paused
+	case replay.CommandStep, replay.CommandBack:
+		p.paused = true
+	}
+	if err := replay.PublishCommand(p.client, p.controlTopic, cmd); err != nil {
+		zap.S().Errorf("unable to send replay command: %v", err)
 	}
-
-	gocv.DrawContours(
-		img,
-		gocv.NewPointsVectorFromPoints([][]image.Point{cntr}),
-		0,
-		color.RGBA{R: 255, G: 0, B: 0, A: 128},
-		-1)
-
-	p.drawRoadText(img, road)
-
-}
-func (p *FramePart) drawRoadText(img *gocv.Mat, road *events.RoadMessage) {
-	gocv.PutText(
-		img,
-		fmt.Sprintf("Confidence: %.3f", road.Ellipse.Confidence),
-		image.Point{X: 20, Y: 20},
-		gocv.FontHersheyPlain,
-		1.,
-		color.RGBA{R: 0, G: 255, B: 0, A: 255},
-		1,
-	)
-	gocv.PutText(
-		img,
-		fmt.Sprintf("Angle ellipse: %.3f", road.Ellipse.Angle),
-		image.Point{X: 20, Y: 40},
-		gocv.FontHersheyPlain,
-		1.,
-		color.RGBA{R: 0, G: 255, B: 0, A: 255},
-		1,
-	)
 }
 
-func (p *FramePart) drawThrottleFeedbackText(img *gocv.Mat, tf *events.ThrottleMessage) {
-	gocv.PutText(
-		img,
-		fmt.Sprintf("Throttle feedback: %.3f", tf.Throttle),
-		image.Point{X: 5, Y: 20},
-		gocv.FontHersheyPlain,
-		0.6,
-		color.RGBA{R: 0, G: 255, B: 255, A: 255},
-		1,
-	)
+// blankFrame is displayed when no frame has been received for a while
+func blankFrame() image.Image {
+	return image.NewRGBA(image.Rect(0, 0, 120, 120))
 }
 
 func StopService(name string, client mqtt.Client, topics ...string) {
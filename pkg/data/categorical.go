@@ -0,0 +1,118 @@
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SteeringBinsFileName is the archive entry that describes categorical steering bins
+const SteeringBinsFileName = "steering_bins.json"
+
+type BinDistribution int
+
+func ParseBinDistribution(s string) BinDistribution {
+	switch strings.ToLower(s) {
+	case "linear":
+		return BinDistributionLinear
+	case "nonlinear":
+		return BinDistributionNonLinear
+	default:
+		return BinDistributionUnknown
+	}
+}
+
+func (d BinDistribution) String() string {
+	switch d {
+	case BinDistributionLinear:
+		return "linear"
+	case BinDistributionNonLinear:
+		return "nonlinear"
+	default:
+		return "unknown"
+	}
+}
+
+const (
+	BinDistributionUnknown BinDistribution = iota
+	// BinDistributionLinear splits [-1, 1] steering range in bins of same width
+	BinDistributionLinear
+	// BinDistributionNonLinear uses narrower bins around straight line, edges follow a quadratic curve
+	BinDistributionNonLinear
+)
+
+// SteeringBins splits steering range [-1, 1] into categories
+type SteeringBins struct {
+	Count        int       `json:"count"`
+	Distribution string    `json:"distribution"`
+	Edges        []float64 `json:"edges"`
+}
+
+func NewSteeringBins(count int, distribution BinDistribution) (*SteeringBins, error) {
+	if count < 2 {
+		return nil, fmt.Errorf("invalid bins count %d, at least 2 bins are required", count)
+	}
+
+	edges := make([]float64, 0, count+1)
+	for i := 0; i <= count; i++ {
+		x := -1. + 2.*float64(i)/float64(count)
+		switch distribution {
+		case BinDistributionLinear:
+		case BinDistributionNonLinear:
+			x = math.Copysign(x*x, x)
+		default:
+			return nil, fmt.Errorf("invalid bins distribution: %v", distribution)
+		}
+		// Round to avoid float noise into archive and hyperparameters
+		edges = append(edges, math.Round(x*1e6)/1e6)
+	}
+	return &SteeringBins{
+		Count:        count,
+		Distribution: distribution.String(),
+		Edges:        edges,
+	}, nil
+}
+
+// Bin returns category of steering value, values outside [-1, 1] belong to first or last bin
+func (b *SteeringBins) Bin(steering float32) int {
+	// Number of inner edges lower or equal to steering
+	idx := sort.SearchFloat64s(b.Edges[1:b.Count], float64(steering))
+	if idx < b.Count-1 && b.Edges[idx+1] == float64(steering) {
+		idx += 1
+	}
+	return idx
+}
+
+// Value returns steering value at the center of bin
+func (b *SteeringBins) Value(bin int) float32 {
+	if bin < 0 {
+		bin = 0
+	} else if bin >= b.Count {
+		bin = b.Count - 1
+	}
+	return float32((b.Edges[bin] + b.Edges[bin+1]) / 2.)
+}
+
+// HyperParameters returns training parameters that describe bins
+func (b *SteeringBins) HyperParameters() map[string]string {
+	edges := make([]string, 0, len(b.Edges))
+	for _, e := range b.Edges {
+		edges = append(edges, strconv.FormatFloat(e, 'f', -1, 64))
+	}
+	return map[string]string{
+		"steering_bins":              strconv.Itoa(b.Count),
+		"steering_bins_distribution": b.Distribution,
+		"steering_bins_edges":        strings.Join(edges, ","),
+	}
+}
+
+func (b *SteeringBins) marshal() ([]byte, error) {
+	content, err := json.Marshal(b)
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal steering bins: %w", err)
+	}
+	return content, nil
+}
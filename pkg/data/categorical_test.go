@@ -0,0 +1,85 @@
+package data
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestNewSteeringBins(t *testing.T) {
+	cases := []struct {
+		name          string
+		count         int
+		distribution  BinDistribution
+		expectedEdges []float64
+		wantsErr      bool
+	}{
+		{"linear", 4, BinDistributionLinear, []float64{-1, -0.5, 0, 0.5, 1}, false},
+		{"nonlinear", 4, BinDistributionNonLinear, []float64{-1, -0.25, 0, 0.25, 1}, false},
+		{"not enough bins", 1, BinDistributionLinear, nil, true},
+		{"unknown distribution", 4, BinDistributionUnknown, nil, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			bins, err := NewSteeringBins(c.count, c.distribution)
+			if (err != nil) != c.wantsErr {
+				t.Fatalf("unexpected error value: %v", err)
+			}
+			if c.wantsErr {
+				return
+			}
+			if !reflect.DeepEqual(bins.Edges, c.expectedEdges) {
+				t.Errorf("bad edges: %v, wants %v", bins.Edges, c.expectedEdges)
+			}
+		})
+	}
+}
+
+func TestSteeringBins_Bin(t *testing.T) {
+	bins, err := NewSteeringBins(5, BinDistributionLinear)
+	if err != nil {
+		t.Fatalf("unable to init bins: %v", err)
+	}
+	cases := []struct {
+		steering float32
+		expected int
+	}{
+		{-1.5, 0}, {-1., 0}, {-0.61, 0}, {-0.59, 1}, {-0.1, 2}, {0., 2}, {0.19, 2}, {0.2, 3}, {0.99, 4}, {1., 4}, {2., 4},
+	}
+	for _, c := range cases {
+		if bin := bins.Bin(c.steering); bin != c.expected {
+			t.Errorf("Bin(%v): %v, wants %v", c.steering, bin, c.expected)
+		}
+	}
+}
+
+func TestSteeringBins_Value(t *testing.T) {
+	bins, err := NewSteeringBins(4, BinDistributionLinear)
+	if err != nil {
+		t.Fatalf("unable to init bins: %v", err)
+	}
+	expected := []float32{-0.75, -0.25, 0.25, 0.75}
+	for bin, e := range expected {
+		if v := bins.Value(bin); math.Abs(float64(v-e)) > 1e-6 {
+			t.Errorf("Value(%v): %v, wants %v", bin, v, e)
+		}
+		if b := bins.Bin(bins.Value(bin)); b != bin {
+			t.Errorf("Bin(Value(%v)): %v, wants %v", bin, b, bin)
+		}
+	}
+}
+
+func TestSteeringBins_HyperParameters(t *testing.T) {
+	bins, err := NewSteeringBins(4, BinDistributionNonLinear)
+	if err != nil {
+		t.Fatalf("unable to init bins: %v", err)
+	}
+	expected := map[string]string{
+		"steering_bins":              "4",
+		"steering_bins_distribution": "nonlinear",
+		"steering_bins_edges":        "-1,-0.25,0,0.25,1",
+	}
+	if hp := bins.HyperParameters(); !reflect.DeepEqual(hp, expected) {
+		t.Errorf("bad hyperparameters: %v, wants %v", hp, expected)
+	}
+}
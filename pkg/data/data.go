@@ -3,12 +3,15 @@ package data
 import (
 	"archive/zip"
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"github.com/cyrilix/robocar-tools/pkg/recordset"
 	"github.com/cyrilix/robocar-tools/record"
 	"github.com/disintegration/imaging"
 	"go.uber.org/zap"
 	"image"
+	"image/color"
 	"image/jpeg"
 	"io/ioutil"
 	"os"
@@ -17,13 +20,10 @@ import (
 	"strings"
 )
 
-var camSubDir = "cam"
+var camSubDir = record.CamSubDir(record.MainCamera)
 
-func WriteArchive(basedir string, archiveName string, sliceSize int, imgWidth, imgHeight int, horizon int, flipImages bool) error {
-	content, err := BuildArchive(basedir, sliceSize, imgWidth, imgHeight, horizon, flipImages)
-	if err != nil {
-		return fmt.Errorf("unable to build archive: %w", err)
-	}
+func WriteArchive(ctx context.Context, sources []string, archiveName string, sliceSize int, imgWidth, imgHeight int, horizon int, flipImages bool, bins *SteeringBins, cameras []string) error {
+	content, err := BuildArchive(ctx, sources, sliceSize, imgWidth, imgHeight, horizon, flipImages, bins, cameras)
 	if err != nil {
 		return fmt.Errorf("unable to build archive: %w", err)
 	}
@@ -34,38 +34,55 @@ func WriteArchive(basedir string, archiveName string, sliceSize int, imgWidth, i
 	return nil
 }
 
-func BuildArchive(basedir string, sliceSize int, imgWidth, imgHeight int, horizon int, flipImages bool) ([]byte, error) {
+// BuildArchive builds a zip archive from record sets found in sources, see ResolveRecordSets for supported sources.
+// If bins isn't nil, categorical steering labels are computed for each record and bins definition is added to archive.
+// Edits saved into record sets are applied: excluded frames are skipped and corrected steering replaces user steering.
+// Images of main camera are used if cameras is empty, images of a single camera replace them, images of several cameras
+// are stacked vertically in cameras order. Records without image for each camera are skipped.
+func BuildArchive(ctx context.Context, sources []string, sliceSize int, imgWidth, imgHeight int, horizon int, flipImages bool, bins *SteeringBins, cameras []string) ([]byte, error) {
 	l := zap.S()
-	l.Infof("build zip archive from %s\n", basedir)
-	dirItems, err := ioutil.ReadDir(basedir)
+	l.Infof("build zip archive from %s\n", strings.Join(sources, ", "))
+	recordSets, err := ResolveRecordSets(ctx, sources)
 	if err != nil {
-		return nil, fmt.Errorf("unable to list directory in %v dir: %w", basedir, err)
+		return nil, fmt.Errorf("unable to find record sets: %w", err)
 	}
 
 	imgCams := make([]string, 0)
 	records := make([]string, 0)
+	steering := make(map[string]float32)
+	cameraImages := make(map[string][]string)
 
-	for _, dirItem := range dirItems {
-		l.Infof("process %v directory", dirItem.Name())
-		imgDir := path.Join(basedir, dirItem.Name(), camSubDir)
-		imgs, err := ioutil.ReadDir(imgDir)
+	for _, recordSet := range recordSets {
+		l.Infof("process %v directory", recordSet)
+		imgs, recs, err := listRecordSet(recordSet)
 		if err != nil {
-			return nil, fmt.Errorf("unable to list cam images in directory %v: %w", imgDir, err)
+			return nil, err
+		}
+		excluded, err := loadCorrections(recordSet, imgs, recs, steering)
+		if err != nil {
+			return nil, err
 		}
 
-		for _, img := range imgs {
-			idx, err := indexFromFile(img.Name())
-			if err != nil {
-				return nil, fmt.Errorf("unable to find index in cam image name %v: %w", img.Name(), err)
+		// Shift is applied per record set, records of a session must not be paired with images of another one
+		if sliceSize > 0 {
+			if len(imgs) <= sliceSize {
+				l.Warnf("record set %v has not enough records to apply slice of size %d, skip it", recordSet, sliceSize)
+				continue
 			}
-			l.Debugf("found image with index %v", idx)
-			records = append(records, path.Join(basedir, dirItem.Name(), fmt.Sprintf(record.FileNameFormat, idx)))
-			imgCams = append(imgCams, path.Join(basedir, dirItem.Name(), camSubDir, img.Name()))
+			imgs, recs, err = applySlice(imgs, recs, sliceSize)
 		}
+		imgs, recs = excludeFiles(imgs, recs, excluded)
+		imgs, recs, err = matchCameras(recordSet, imgs, recs, cameras, cameraImages)
+		if err != nil {
+			return nil, err
+		}
+		imgCams = append(imgCams, imgs...)
+		records = append(records, recs...)
 	}
 
-	if sliceSize > 0 {
-		imgCams, records, err = applySlice(imgCams, records, sliceSize)
+	err = checkUniqueNames(imgCams, records)
+	if err != nil {
+		return nil, err
 	}
 
 	// Create a buffer to write our archive to.
@@ -73,16 +90,26 @@ func BuildArchive(basedir string, sliceSize int, imgWidth, imgHeight int, horizo
 	// Create a new zip archive.
 	w := zip.NewWriter(buf)
 
-	err = buildArchiveContent(w, imgCams, records, imgWidth, imgHeight, horizon, false)
+	err = buildArchiveContent(w, imgCams, records, imgWidth, imgHeight, horizon, false, bins, steering, cameraImages)
 	if err != nil {
 		return nil, fmt.Errorf("unable to build archive: %w", err)
 	}
 	if flipImages {
-		err = buildArchiveContent(w, imgCams, records, imgWidth, imgHeight, horizon, true)
+		err = buildArchiveContent(w, imgCams, records, imgWidth, imgHeight, horizon, true, bins, steering, cameraImages)
 		if err != nil {
 			return nil, fmt.Errorf("unable to build archive: %w", err)
 		}
 	}
+	if bins != nil {
+		binsContent, err := bins.marshal()
+		if err != nil {
+			return nil, err
+		}
+		err = addToArchive(w, SteeringBinsFileName, binsContent)
+		if err != nil {
+			return nil, fmt.Errorf("unable to add steering bins to archive: %w", err)
+		}
+	}
 
 	err = w.Close()
 	if err != nil {
@@ -96,6 +123,135 @@ func BuildArchive(basedir string, sliceSize int, imgWidth, imgHeight int, horizo
 	return content, nil
 }
 
+func listRecordSet(recordSet string) ([]string, []string, error) {
+	imgDir := path.Join(recordSet, camSubDir)
+	imgs, err := ioutil.ReadDir(imgDir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to list cam images in directory %v: %w", imgDir, err)
+	}
+
+	imgCams := make([]string, 0, len(imgs))
+	records := make([]string, 0, len(imgs))
+	for _, img := range imgs {
+		idx, err := indexFromFile(img.Name())
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to find index in cam image name %v: %w", img.Name(), err)
+		}
+		zap.S().Debugf("found image with index %v", idx)
+		records = append(records, path.Join(recordSet, fmt.Sprintf(record.FileNameFormat, idx)))
+		imgCams = append(imgCams, path.Join(recordSet, camSubDir, img.Name()))
+	}
+	return imgCams, records, nil
+}
+
+// checkUniqueNames ensures files from distinct record sets don't override each other into the flat archive
+func checkUniqueNames(imgCams []string, records []string) error {
+	for _, files := range [][]string{imgCams, records} {
+		names := make(map[string]string, len(files))
+		for _, f := range files {
+			_, name := path.Split(f)
+			if other, ok := names[name]; ok {
+				return fmt.Errorf("files %v and %v have the same name into archive", other, f)
+			}
+			names[name] = f
+		}
+	}
+	return nil
+}
+
+// loadCorrections reads edits of record set, excluded image and record files are returned and corrected steering are
+// added to steering by record file
+func loadCorrections(recordSet string, imgCams []string, records []string, steering map[string]float32) (map[string]bool, error) {
+	indexes := make([]string, 0, len(imgCams))
+	for _, img := range imgCams {
+		idx, err := indexFromFile(img)
+		if err != nil {
+			return nil, fmt.Errorf("unable to find index in cam image name %v: %w", img, err)
+		}
+		indexes = append(indexes, idx)
+	}
+	corrections, err := recordset.LoadCorrections(recordSet, indexes)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load edits of record set %v: %w", recordSet, err)
+	}
+
+	excluded := make(map[string]bool)
+	for i, idx := range indexes {
+		if corrections.Excluded[idx] {
+			excluded[imgCams[i]] = true
+			excluded[records[i]] = true
+		}
+		if v, ok := corrections.Steering[idx]; ok {
+			steering[records[i]] = v
+		}
+	}
+	if len(corrections.Excluded) > 0 || len(corrections.Steering) > 0 {
+		zap.S().Infof("record set %v: %d frames excluded, %d steering corrected", recordSet, len(corrections.Excluded), len(corrections.Steering))
+	}
+	return excluded, nil
+}
+
+// excludeFiles removes pairs of image and record where one of them is excluded
+func excludeFiles(imgCams []string, records []string, excluded map[string]bool) ([]string, []string) {
+	if len(excluded) == 0 {
+		return imgCams, records
+	}
+	imgs := make([]string, 0, len(imgCams))
+	recs := make([]string, 0, len(records))
+	for i := range imgCams {
+		if excluded[imgCams[i]] || excluded[records[i]] {
+			continue
+		}
+		imgs = append(imgs, imgCams[i])
+		recs = append(recs, records[i])
+	}
+	return imgs, recs
+}
+
+// cameraMaxGap is the max distance between frame indexes, in milliseconds, of images of distinct cameras of a sample
+const cameraMaxGap = 50
+
+// matchCameras adds to cameraImages images of cameras matching each main camera image. Images without match for every
+// camera are removed with their records. Nothing is done if only main camera is used.
+func matchCameras(recordSet string, imgCams []string, records []string, cameras []string, cameraImages map[string][]string) ([]string, []string, error) {
+	if len(cameras) == 0 || len(cameras) == 1 && cameras[0] == record.MainCamera {
+		return imgCams, records, nil
+	}
+	camImgs := make([]*recordset.CameraImages, 0, len(cameras))
+	for _, c := range cameras {
+		ci, err := recordset.OpenCamera(recordSet, c)
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to read images of camera %v: %w", c, err)
+		}
+		camImgs = append(camImgs, ci)
+	}
+
+	imgs := make([]string, 0, len(imgCams))
+	recs := make([]string, 0, len(records))
+	for i, img := range imgCams {
+		idx, err := indexFromFile(img)
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to find index in cam image name %v: %w", img, err)
+		}
+		matches := make([]string, 0, len(camImgs))
+		for _, ci := range camImgs {
+			if p, ok := ci.Nearest(idx, cameraMaxGap); ok {
+				matches = append(matches, p)
+			}
+		}
+		if len(matches) != len(camImgs) {
+			continue
+		}
+		cameraImages[img] = matches
+		imgs = append(imgs, img)
+		recs = append(recs, records[i])
+	}
+	if skipped := len(imgCams) - len(imgs); skipped > 0 {
+		zap.S().Warnf("record set %v: %d records skipped without image of each camera %v", recordSet, skipped, strings.Join(cameras, ", "))
+	}
+	return imgs, recs, nil
+}
+
 func applySlice(imgCams []string, records []string, sliceSize int) ([]string, []string, error) {
 	// Add sliceSize images shift
 	i := imgCams[:len(imgCams)-sliceSize]
@@ -132,13 +288,13 @@ func findNamedMatches(regex *regexp.Regexp, str string) map[string]string {
 	return results
 }
 
-func buildArchiveContent(w *zip.Writer, imgFiles []string, recordFiles []string, imgWidth, imgHeight int, horizon int, withFlipImages bool) error {
-	err := addJsonFiles(recordFiles, imgFiles, withFlipImages, w)
+func buildArchiveContent(w *zip.Writer, imgFiles []string, recordFiles []string, imgWidth, imgHeight int, horizon int, withFlipImages bool, bins *SteeringBins, steering map[string]float32, cameraImages map[string][]string) error {
+	err := addJsonFiles(recordFiles, imgFiles, withFlipImages, bins, steering, w)
 	if err != nil {
 		return fmt.Errorf("unable to write json files in zip archive: %w", err)
 	}
 
-	err = addCamImages(imgFiles, withFlipImages, w, imgWidth, imgHeight, horizon)
+	err = addCamImages(imgFiles, cameraImages, withFlipImages, w, imgWidth, imgHeight, horizon)
 	if err != nil {
 		return fmt.Errorf("unable to cam files in zip archive: %w", err)
 	}
@@ -146,34 +302,39 @@ func buildArchiveContent(w *zip.Writer, imgFiles []string, recordFiles []string,
 	return err
 }
 
-func addCamImages(imgFiles []string, flipImage bool, w *zip.Writer, imgWidth, imgHeight int, horizon int) error {
+// addCamImages adds images to archive, content of images of other cameras replaces image content if any
+func addCamImages(imgFiles []string, cameraImages map[string][]string, flipImage bool, w *zip.Writer, imgWidth, imgHeight int, horizon int) error {
 	for _, im := range imgFiles {
+		_, imgName := path.Split(im)
+		if srcs, ok := cameraImages[im]; ok {
+			if flipImage {
+				imgName = fmt.Sprintf("flip_%s", imgName)
+			}
+			imgContent, err := stackImages(srcs, flipImage, imgWidth, imgHeight, horizon)
+			if err != nil {
+				return err
+			}
+			if err := addToArchive(w, imgName, imgContent); err != nil {
+				return fmt.Errorf("unable to create new img entry in archive: %w", err)
+			}
+			continue
+		}
+
 		imgContent, err := ioutil.ReadFile(im)
 		if err != nil {
 			return fmt.Errorf("unable to read img: %w", err)
 		}
 
-		_, imgName := path.Split(im)
 		if flipImage || imgWidth > 0 && imgHeight > 0 || horizon > 0 {
 			img, _, err := image.Decode(bytes.NewReader(imgContent))
 			if err != nil {
 				zap.S().Fatalf("unable to decode jpeg image: %v", err)
 			}
 
-			if imgWidth > 0 && imgHeight > 0 {
-				bounds := img.Bounds()
-				if bounds.Dx() != imgWidth || bounds.Dy() != imgWidth {
-					zap.S().Debugf("resize image %v from %dx%d to %dx%d", im, bounds.Dx(), bounds.Dy(), imgWidth, imgHeight)
-					img = imaging.Resize(img, imgWidth, imgHeight, imaging.NearestNeighbor)
-				}
-			}
+			img = TransformImage(img, imgWidth, imgHeight, horizon, flipImage)
 			if flipImage {
-				img = imaging.FlipH(img)
 				imgName = fmt.Sprintf("flip_%s", imgName)
 			}
-			if horizon > 0 {
-				img = imaging.Crop(img, image.Rect(0, horizon, img.Bounds().Dx(), img.Bounds().Dy()))
-			}
 			var bytesBuff bytes.Buffer
 			err = jpeg.Encode(&bytesBuff, img, nil)
 			imgContent = bytesBuff.Bytes()
@@ -187,7 +348,61 @@ func addCamImages(imgFiles []string, flipImage bool, w *zip.Writer, imgWidth, im
 	return nil
 }
 
-func addJsonFiles(recordFiles []string, imgCam []string, flipImage bool, w *zip.Writer) error {
+// stackImages transforms images and stacks them vertically into a jpeg image
+func stackImages(imgFiles []string, flipImage bool, imgWidth, imgHeight int, horizon int) ([]byte, error) {
+	imgs := make([]image.Image, 0, len(imgFiles))
+	width, height := 0, 0
+	for _, f := range imgFiles {
+		content, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read img: %w", err)
+		}
+		img, _, err := image.Decode(bytes.NewReader(content))
+		if err != nil {
+			return nil, fmt.Errorf("unable to decode image %v: %w", f, err)
+		}
+		img = TransformImage(img, imgWidth, imgHeight, horizon, flipImage)
+		if img.Bounds().Dx() > width {
+			width = img.Bounds().Dx()
+		}
+		height += img.Bounds().Dy()
+		imgs = append(imgs, img)
+	}
+
+	stacked := imaging.New(width, height, color.Black)
+	top := 0
+	for _, img := range imgs {
+		stacked = imaging.Paste(stacked, img, image.Pt(0, top))
+		top += img.Bounds().Dy()
+	}
+	var bytesBuff bytes.Buffer
+	if err := jpeg.Encode(&bytesBuff, stacked, nil); err != nil {
+		return nil, fmt.Errorf("unable to encode stacked image: %w", err)
+	}
+	return bytesBuff.Bytes(), nil
+}
+
+// TransformImage applies archive geometry to img: resize to imgWidth x imgHeight, horizontal flip and crop of
+// upper zone above horizon. Zero values disable transformations.
+func TransformImage(img image.Image, imgWidth, imgHeight int, horizon int, flipImage bool) image.Image {
+	if imgWidth > 0 && imgHeight > 0 {
+		bounds := img.Bounds()
+		if bounds.Dx() != imgWidth || bounds.Dy() != imgHeight {
+			zap.S().Debugf("resize image from %dx%d to %dx%d", bounds.Dx(), bounds.Dy(), imgWidth, imgHeight)
+			img = imaging.Resize(img, imgWidth, imgHeight, imaging.NearestNeighbor)
+		}
+	}
+	if flipImage {
+		img = imaging.FlipH(img)
+	}
+	if horizon > 0 {
+		img = imaging.Crop(img, image.Rect(0, horizon, img.Bounds().Dx(), img.Bounds().Dy()))
+	}
+	return img
+}
+
+// addJsonFiles adds records to archive, user steering is replaced by corrected steering of record file if any
+func addJsonFiles(recordFiles []string, imgCam []string, flipImage bool, bins *SteeringBins, steering map[string]float32, w *zip.Writer) error {
 	for idx, r := range recordFiles {
 		content, err := ioutil.ReadFile(r)
 		if err != nil {
@@ -198,6 +413,9 @@ func addJsonFiles(recordFiles []string, imgCam []string, flipImage bool, w *zip.
 		if err != nil {
 			return fmt.Errorf("unable to unmarshal record: %w", err)
 		}
+		if v, ok := steering[r]; ok {
+			rcd.UserAngle = v
+		}
 		_, camName := path.Split((imgCam)[idx])
 
 		if flipImage {
@@ -206,6 +424,10 @@ func addJsonFiles(recordFiles []string, imgCam []string, flipImage bool, w *zip.
 		} else {
 			rcd.CamImageArray = camName
 		}
+		if bins != nil {
+			bin := bins.Bin(rcd.UserAngle)
+			rcd.UserAngleBin = &bin
+		}
 
 		recordBytes, err := json.Marshal(&rcd)
 		if err != nil {
@@ -2,15 +2,23 @@ package data
 
 import (
 	"archive/zip"
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"github.com/cyrilix/robocar-tools/pkg/recordset"
+	"github.com/cyrilix/robocar-tools/pkg/synth"
 	"github.com/cyrilix/robocar-tools/record"
 	"go.uber.org/zap"
+	"image"
 	"io/ioutil"
+	"math"
 	"os"
 	"path"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestBuildArchive(t *testing.T) {
@@ -29,7 +37,7 @@ func TestBuildArchive(t *testing.T) {
 
 	expectedRecordFiles, expectedImgFiles := expectedFiles()
 
-	err = WriteArchive("testdata", archive, 0, 160, 120, 0, false)
+	err = WriteArchive(context.Background(), []string{"testdata"}, archive, 0, 160, 120, 0, false, nil, nil)
 	if err != nil {
 		t.Errorf("unable to build archive: %v", err)
 	}
@@ -65,6 +73,216 @@ func TestBuildArchive(t *testing.T) {
 	checkAllFilesAreFoundInArchive(expectedRecordFiles, t, expectedImgFiles)
 }
 
+func TestBuildArchive_WithSteeringBins(t *testing.T) {
+	bins, err := NewSteeringBins(15, BinDistributionLinear)
+	if err != nil {
+		t.Fatalf("unable to init steering bins: %v", err)
+	}
+	content, err := BuildArchive(context.Background(), []string{"testdata"}, 0, 0, 0, 0, true, bins, nil)
+	if err != nil {
+		t.Fatalf("unable to build archive: %v", err)
+	}
+
+	r, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		t.Fatalf("unable to read archive, %v", err)
+	}
+
+	binsFound := false
+	for _, f := range r.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("unable to read file content of %v: %v", f.Name, err)
+		}
+		fileContent, err := ioutil.ReadAll(rc)
+		_ = rc.Close()
+		if err != nil {
+			t.Fatalf("unable to read file content of %v: %v", f.Name, err)
+		}
+
+		if f.Name == SteeringBinsFileName {
+			binsFound = true
+			var archiveBins SteeringBins
+			if err := json.Unmarshal(fileContent, &archiveBins); err != nil {
+				t.Errorf("invalid steering bins content: %v", err)
+			}
+			if !reflect.DeepEqual(&archiveBins, bins) {
+				t.Errorf("bad steering bins into archive: %v, wants %v", archiveBins, bins)
+			}
+			continue
+		}
+		if !strings.HasSuffix(f.Name, "json") {
+			continue
+		}
+		var rcd record.Record
+		if err := json.Unmarshal(fileContent, &rcd); err != nil {
+			t.Errorf("unable to unmarshal json content of %v: %v", f.Name, err)
+			continue
+		}
+		if rcd.UserAngleBin == nil {
+			t.Errorf("record %v: steering bin not set", f.Name)
+		} else if *rcd.UserAngleBin != bins.Bin(rcd.UserAngle) {
+			t.Errorf("record %v: bad steering bin %v for steering %v, wants %v", f.Name, *rcd.UserAngleBin, rcd.UserAngle, bins.Bin(rcd.UserAngle))
+		}
+	}
+	if !binsFound {
+		t.Errorf("%v not found in archive", SteeringBinsFileName)
+	}
+}
+
+func TestBuildArchive_SyntheticRecords(t *testing.T) {
+	dir := path.Join(t.TempDir(), "synth")
+	err := synth.WriteRecordSet(dir, synth.NewGenerator(160, 120, 1), 20, time.UnixMilli(1581992400000), 50*time.Millisecond)
+	if err != nil {
+		t.Fatalf("unable to generate record set: %v", err)
+	}
+
+	content, err := BuildArchive(context.Background(), []string{dir}, 2, 80, 60, 20, true, nil, nil)
+	if err != nil {
+		t.Fatalf("unable to build archive: %v", err)
+	}
+	r, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		t.Fatalf("unable to read archive, %v", err)
+	}
+	// 18 records with slice of 2 images, flipped images doubles records
+	if len(r.File) != 18*2*2 {
+		t.Errorf("bad number of files in archive: %v, wants %v", len(r.File), 18*2*2)
+	}
+}
+
+func TestBuildArchive_WithEdits(t *testing.T) {
+	dir := path.Join(t.TempDir(), "synth")
+	err := synth.WriteRecordSet(dir, synth.NewGenerator(160, 120, 1), 6, time.UnixMilli(1581992400000), 100*time.Millisecond)
+	if err != nil {
+		t.Fatalf("unable to generate record set: %v", err)
+	}
+	edits, err := recordset.LoadEdits(dir)
+	if err != nil {
+		t.Fatalf("unable to load edits: %v", err)
+	}
+	_ = edits.Add(recordset.Edit{Type: recordset.EditExclude, From: "1581992400100", To: "1581992400200"})
+	_ = edits.Add(recordset.Edit{Type: recordset.EditSteering, From: "1581992400300", To: "1581992400500", Steering: 0.2, ToSteering: 0.6})
+	if err := edits.Save(); err != nil {
+		t.Fatalf("unable to save edits: %v", err)
+	}
+
+	content, err := BuildArchive(context.Background(), []string{dir}, 0, 0, 0, 0, false, nil, nil)
+	if err != nil {
+		t.Fatalf("unable to build archive: %v", err)
+	}
+	r, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		t.Fatalf("unable to read archive, %v", err)
+	}
+	if len(r.File) != 4*2 {
+		t.Errorf("bad number of files in archive: %v, wants %v", len(r.File), 4*2)
+	}
+
+	expected := map[string]float32{"record_1581992400300.json": 0.2, "record_1581992400400.json": 0.4, "record_1581992400500.json": 0.6}
+	for _, f := range r.File {
+		if strings.Contains(f.Name, "1581992400100") || strings.Contains(f.Name, "1581992400200") {
+			t.Errorf("excluded file in archive: %v", f.Name)
+		}
+		steering, ok := expected[f.Name]
+		if !ok {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("unable to read file content of %v: %v", f.Name, err)
+		}
+		var rcd record.Record
+		err = json.NewDecoder(rc).Decode(&rcd)
+		_ = rc.Close()
+		if err != nil {
+			t.Fatalf("unable to unmarshal %v: %v", f.Name, err)
+		}
+		if math.Abs(float64(rcd.UserAngle-steering)) > 1e-6 {
+			t.Errorf("%v: bad steering %v, wants %v", f.Name, rcd.UserAngle, steering)
+		}
+	}
+
+	// Original records aren't modified
+	rs, err := recordset.Open(dir)
+	if err != nil {
+		t.Fatalf("unable to open record set: %v", err)
+	}
+	if len(rs.Entries) != 6 {
+		t.Errorf("bad number of entries: %v", len(rs.Entries))
+	}
+}
+
+func TestBuildArchive_WithCameras(t *testing.T) {
+	dir := path.Join(t.TempDir(), "synth")
+	err := synth.WriteRecordSet(dir, synth.NewGenerator(160, 120, 1), 4, time.UnixMilli(1581992400000), 100*time.Millisecond)
+	if err != nil {
+		t.Fatalf("unable to generate record set: %v", err)
+	}
+	// Rear camera frames are recorded 10ms after main camera ones, without the last one
+	rearDir := path.Join(dir, record.CamSubDir("rear"))
+	if err := os.MkdirAll(rearDir, os.FileMode(0755)); err != nil {
+		t.Fatalf("unable to make camera directory: %v", err)
+	}
+	g := synth.NewGenerator(80, 60, 2)
+	for i := 0; i < 3; i++ {
+		content, err := g.Next().JPEG()
+		if err != nil {
+			t.Fatalf("unable to encode image: %v", err)
+		}
+		name := fmt.Sprintf("cam-image_array_%d.jpg", 1581992400010+100*i)
+		if err := ioutil.WriteFile(path.Join(rearDir, name), content, os.FileMode(0644)); err != nil {
+			t.Fatalf("unable to write image: %v", err)
+		}
+	}
+
+	cases := []struct {
+		name           string
+		cameras        []string
+		expectedCount  int
+		expectedHeight int
+	}{
+		{"main camera", []string{record.MainCamera}, 4, 120},
+		{"other camera", []string{"rear"}, 3, 60},
+		{"stacked cameras", []string{record.MainCamera, "rear"}, 3, 180},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			content, err := BuildArchive(context.Background(), []string{dir}, 0, 0, 0, 0, false, nil, c.cameras)
+			if err != nil {
+				t.Fatalf("unable to build archive: %v", err)
+			}
+			r, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+			if err != nil {
+				t.Fatalf("unable to read archive, %v", err)
+			}
+			if len(r.File) != c.expectedCount*2 {
+				t.Errorf("bad number of files in archive: %v, wants %v", len(r.File), c.expectedCount*2)
+			}
+			for _, f := range r.File {
+				if !strings.HasSuffix(f.Name, ".jpg") {
+					continue
+				}
+				if !strings.HasPrefix(f.Name, "cam-image_array_15819924") || !strings.HasSuffix(f.Name, "00.jpg") {
+					t.Errorf("images should be named as main camera ones: %v", f.Name)
+				}
+				rc, err := f.Open()
+				if err != nil {
+					t.Fatalf("unable to open %v: %v", f.Name, err)
+				}
+				img, _, err := image.Decode(rc)
+				_ = rc.Close()
+				if err != nil {
+					t.Fatalf("unable to decode %v: %v", f.Name, err)
+				}
+				if img.Bounds().Dy() != c.expectedHeight {
+					t.Errorf("%v: bad image height %v, wants %v", f.Name, img.Bounds().Dy(), c.expectedHeight)
+				}
+			}
+		})
+	}
+}
+
 func checkAllFilesAreFoundInArchive(expectedRecordFiles map[string]bool, t *testing.T, expectedImgFiles map[string]bool) {
 	for f, found := range expectedRecordFiles {
 		if !found {
@@ -0,0 +1,247 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/cyrilix/robocar-tools/pkg/awsutils"
+	"go.uber.org/zap"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const s3Scheme = "s3://"
+
+// CacheDir is the local directory where records downloaded from s3 are stored
+var CacheDir = defaultCacheDir()
+
+func defaultCacheDir() string {
+	if d := os.Getenv("RC_CACHE_DIR"); d != "" {
+		return d
+	}
+	d, err := os.UserCacheDir()
+	if err != nil {
+		d = os.TempDir()
+	}
+	return path.Join(d, "robocar-tools")
+}
+
+// ParseSources split a comma separated list of record sources
+func ParseSources(s string) []string {
+	sources := make([]string, 0)
+	for _, src := range strings.Split(s, ",") {
+		src = strings.TrimSpace(src)
+		if src == "" {
+			continue
+		}
+		sources = append(sources, src)
+	}
+	return sources
+}
+
+// ResolveRecordSets expands sources into record set directories.
+//
+// A source may be a record set directory (a directory with a cam subdirectory), a root directory where each child
+// is a record set, a glob pattern or a s3://bucket/prefix uri. s3 objects are downloaded into CacheDir on demand.
+func ResolveRecordSets(ctx context.Context, sources []string) ([]string, error) {
+	recordSets := make([]string, 0)
+	known := make(map[string]bool)
+	for _, src := range sources {
+		dirs, err := resolveSource(ctx, src)
+		if err != nil {
+			return nil, fmt.Errorf("unable to resolve records source '%v': %w", src, err)
+		}
+		for _, d := range dirs {
+			if known[d] {
+				continue
+			}
+			known[d] = true
+			recordSets = append(recordSets, d)
+		}
+	}
+	if len(recordSets) == 0 {
+		return nil, fmt.Errorf("no record set found in %v", sources)
+	}
+	return recordSets, nil
+}
+
+func resolveSource(ctx context.Context, src string) ([]string, error) {
+	if strings.HasPrefix(src, s3Scheme) {
+		localDir, err := downloadS3Prefix(ctx, src)
+		if err != nil {
+			return nil, err
+		}
+		return recordSetsFromDir(localDir)
+	}
+
+	if !strings.ContainsAny(src, "*?[") {
+		return recordSetsFromDir(src)
+	}
+
+	matches, err := filepath.Glob(src)
+	if err != nil {
+		return nil, fmt.Errorf("invalid glob pattern: %w", err)
+	}
+	recordSets := make([]string, 0, len(matches))
+	for _, m := range matches {
+		if fi, err := os.Stat(m); err != nil || !fi.IsDir() {
+			continue
+		}
+		dirs, err := recordSetsFromDir(m)
+		if err != nil {
+			return nil, err
+		}
+		recordSets = append(recordSets, dirs...)
+	}
+	return recordSets, nil
+}
+
+// recordSetsFromDir returns dir if it is a record set, else each child directory
+func recordSetsFromDir(dir string) ([]string, error) {
+	if isRecordSet(dir) {
+		return []string{dir}, nil
+	}
+
+	dirItems, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list directory in %v dir: %w", dir, err)
+	}
+	recordSets := make([]string, 0, len(dirItems))
+	for _, dirItem := range dirItems {
+		if !dirItem.IsDir() {
+			zap.S().Debugf("ignore %v, not a directory", path.Join(dir, dirItem.Name()))
+			continue
+		}
+		recordSets = append(recordSets, path.Join(dir, dirItem.Name()))
+	}
+	return recordSets, nil
+}
+
+func isRecordSet(dir string) bool {
+	fi, err := os.Stat(path.Join(dir, camSubDir))
+	return err == nil && fi.IsDir()
+}
+
+func parseS3Uri(uri string) (bucket string, prefix string, err error) {
+	s := strings.TrimPrefix(uri, s3Scheme)
+	parts := strings.SplitN(s, "/", 2)
+	if parts[0] == "" {
+		return "", "", fmt.Errorf("no bucket in uri '%v'", uri)
+	}
+	if len(parts) == 1 {
+		return parts[0], "", nil
+	}
+	return parts[0], parts[1], nil
+}
+
+// downloadS3Prefix copies all objects under the uri prefix into CacheDir and returns the local directory
+func downloadS3Prefix(ctx context.Context, uri string) (string, error) {
+	l := zap.S().With("uri", uri)
+	bucket, prefix, err := parseS3Uri(uri)
+	if err != nil {
+		return "", err
+	}
+	localDir, err := cachePath(bucket, prefix)
+	if err != nil {
+		return "", err
+	}
+
+	client := s3.NewFromConfig(awsutils.MustLoadConfig())
+	paginator := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	})
+
+	keys := make([]string, 0)
+	sizes := make(map[string]int64)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return "", fmt.Errorf("unable to list objects in bucket %v: %w", bucket, err)
+		}
+		for _, obj := range page.Contents {
+			key := aws.ToString(obj.Key)
+			if strings.HasSuffix(key, "/") {
+				continue
+			}
+			keys = append(keys, key)
+			sizes[key] = obj.Size
+		}
+	}
+	if len(keys) == 0 {
+		return "", fmt.Errorf("no object found in bucket %v with prefix '%v'", bucket, prefix)
+	}
+	sort.Strings(keys)
+
+	l.Infof("sync %d objects to %v", len(keys), localDir)
+	downloaded := 0
+	for _, key := range keys {
+		localFile, err := cachePath(bucket, key)
+		if err != nil {
+			return "", err
+		}
+		if fi, err := os.Stat(localFile); err == nil && fi.Size() == sizes[key] {
+			l.Debugf("%v already in cache", key)
+			continue
+		}
+		err = downloadS3Object(ctx, client, bucket, key, localFile)
+		if err != nil {
+			return "", err
+		}
+		downloaded += 1
+	}
+	l.Infof("%d objects downloaded", downloaded)
+	return localDir, nil
+}
+
+// cachePath returns the local path of a s3 object, keys with '..' must not escape cache directory of bucket
+func cachePath(bucket, key string) (string, error) {
+	root := path.Join(path.Clean(CacheDir), "s3")
+	if bucket == "" || bucket == "." || bucket == ".." || strings.Contains(bucket, "/") {
+		return "", fmt.Errorf("invalid bucket name '%v'", bucket)
+	}
+	bucketDir := path.Join(root, bucket)
+	p := path.Join(bucketDir, key)
+	if p != bucketDir && !strings.HasPrefix(p, bucketDir+"/") {
+		return "", fmt.Errorf("object '%v/%v' is outside of cache directory %v", bucket, key, bucketDir)
+	}
+	return p, nil
+}
+
+func downloadS3Object(ctx context.Context, client *s3.Client, bucket, key, localFile string) error {
+	err := os.MkdirAll(path.Dir(localFile), os.FileMode(0755))
+	if err != nil {
+		return fmt.Errorf("unable to create cache directory for %v: %w", localFile, err)
+	}
+
+	obj, err := client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("unable to download object '%v/%v': %w", bucket, key, err)
+	}
+	defer obj.Body.Close()
+
+	// Write to a temporary file first, an interrupted download must not be taken for a cached object
+	tmpFile := localFile + ".part"
+	f, err := os.Create(tmpFile)
+	if err != nil {
+		return fmt.Errorf("unable to create file %v: %w", tmpFile, err)
+	}
+	_, err = io.Copy(f, obj.Body)
+	if errClose := f.Close(); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		_ = os.Remove(tmpFile)
+		return fmt.Errorf("unable to write object '%v/%v' to %v: %w", bucket, key, localFile, err)
+	}
+	return os.Rename(tmpFile, localFile)
+}
@@ -0,0 +1,111 @@
+package data
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestParseSources(t *testing.T) {
+	cases := []struct {
+		name     string
+		value    string
+		expected []string
+	}{
+		{"empty", "", []string{}},
+		{"single", "testdata", []string{"testdata"}},
+		{"multiple", "testdata/2020021819-3, s3://bucket/records,,testdata/*", []string{"testdata/2020021819-3", "s3://bucket/records", "testdata/*"}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			sources := ParseSources(c.value)
+			if !reflect.DeepEqual(sources, c.expected) {
+				t.Errorf("ParseSources(%v): %v, wants %v", c.value, sources, c.expected)
+			}
+		})
+	}
+}
+
+func TestResolveRecordSets(t *testing.T) {
+	cases := []struct {
+		name     string
+		sources  []string
+		expected []string
+	}{
+		{"root dir", []string{"testdata"}, []string{"testdata/2020021819-3", "testdata/2020021819-4"}},
+		{"record set", []string{"testdata/2020021819-4"}, []string{"testdata/2020021819-4"}},
+		{"glob", []string{"testdata/*-3"}, []string{"testdata/2020021819-3"}},
+		{"duplicates", []string{"testdata/2020021819-4", "testdata"}, []string{"testdata/2020021819-4", "testdata/2020021819-3"}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			recordSets, err := ResolveRecordSets(context.Background(), c.sources)
+			if err != nil {
+				t.Fatalf("unable to resolve record sets: %v", err)
+			}
+			if !reflect.DeepEqual(recordSets, c.expected) {
+				t.Errorf("bad record sets: %v, wants %v", recordSets, c.expected)
+			}
+		})
+	}
+}
+
+func TestResolveRecordSets_NoRecords(t *testing.T) {
+	_, err := ResolveRecordSets(context.Background(), []string{"testdata/unknown-*"})
+	if err == nil {
+		t.Errorf("an error is expected when no record set is found")
+	}
+}
+
+func TestParseS3Uri(t *testing.T) {
+	cases := []struct {
+		uri            string
+		bucket, prefix string
+		wantsErr       bool
+	}{
+		{"s3://bucket/input/records", "bucket", "input/records", false},
+		{"s3://bucket", "bucket", "", false},
+		{"s3:///records", "", "", true},
+	}
+	for _, c := range cases {
+		bucket, prefix, err := parseS3Uri(c.uri)
+		if (err != nil) != c.wantsErr {
+			t.Errorf("parseS3Uri(%v): unexpected error value: %v", c.uri, err)
+			continue
+		}
+		if bucket != c.bucket || prefix != c.prefix {
+			t.Errorf("parseS3Uri(%v): %v, %v, wants %v, %v", c.uri, bucket, prefix, c.bucket, c.prefix)
+		}
+	}
+}
+
+func TestCachePath(t *testing.T) {
+	oldCacheDir := CacheDir
+	t.Cleanup(func() { CacheDir = oldCacheDir })
+	CacheDir = "/tmp/cache/"
+
+	cases := []struct {
+		bucket, key string
+		expected    string
+		wantsErr    bool
+	}{
+		{"bucket", "input/records/cam/1.jpg", "/tmp/cache/s3/bucket/input/records/cam/1.jpg", false},
+		{"bucket", "", "/tmp/cache/s3/bucket", false},
+		{"bucket", "input/../records", "/tmp/cache/s3/bucket/records", false},
+		{"bucket", "../../../etc/passwd", "", true},
+		{"bucket", "../otherbucket/x", "", true},
+		{"bucket", "..", "", true},
+		{"bucket/../otherbucket", "x", "", true},
+		{"..", "", "", true},
+	}
+	for _, c := range cases {
+		p, err := cachePath(c.bucket, c.key)
+		if (err != nil) != c.wantsErr {
+			t.Errorf("cachePath(%v, %v): unexpected error value: %v", c.bucket, c.key, err)
+			continue
+		}
+		if p != c.expected {
+			t.Errorf("cachePath(%v, %v): %v, wants %v", c.bucket, c.key, p, c.expected)
+		}
+	}
+}
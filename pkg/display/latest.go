@@ -0,0 +1,41 @@
+package display
+
+import (
+	"github.com/cyrilix/robocar-protobuf/go/events"
+	"sync"
+)
+
+// latestRecord keeps last received record until it's rendered, a record replaced before rendering is dropped
+type latestRecord struct {
+	muRecord sync.Mutex
+	record   *events.RecordMessage
+	// ready is notified when a record is waiting for rendering
+	ready chan struct{}
+}
+
+func newLatestRecord() *latestRecord {
+	return &latestRecord{ready: make(chan struct{}, 1)}
+}
+
+// Set replaces pending record without blocking, it returns true if a pending record has been dropped
+func (l *latestRecord) Set(rec *events.RecordMessage) bool {
+	l.muRecord.Lock()
+	dropped := l.record != nil
+	l.record = rec
+	l.muRecord.Unlock()
+
+	select {
+	case l.ready <- struct{}{}:
+	default:
+	}
+	return dropped
+}
+
+// Take returns pending record, or nil if none
+func (l *latestRecord) Take() *events.RecordMessage {
+	l.muRecord.Lock()
+	defer l.muRecord.Unlock()
+	rec := l.record
+	l.record = nil
+	return rec
+}
@@ -0,0 +1,33 @@
+package display
+
+import (
+	"github.com/cyrilix/robocar-protobuf/go/events"
+	"testing"
+)
+
+func TestLatestRecord(t *testing.T) {
+	l := newLatestRecord()
+	if l.Take() != nil {
+		t.Errorf("no record must be pending")
+	}
+
+	first, second := &events.RecordMessage{RecordSet: "1"}, &events.RecordMessage{RecordSet: "2"}
+	if l.Set(first) {
+		t.Errorf("no record must be dropped")
+	}
+	// Set never blocks, even if ready notification isn't consumed
+	if !l.Set(second) {
+		t.Errorf("first record must be dropped")
+	}
+	select {
+	case <-l.ready:
+	default:
+		t.Errorf("ready must be notified")
+	}
+	if rec := l.Take(); rec != second {
+		t.Errorf("bad record: %v, wants last one", rec)
+	}
+	if l.Take() != nil {
+		t.Errorf("record must be taken only once")
+	}
+}
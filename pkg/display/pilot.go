@@ -0,0 +1,58 @@
+package display
+
+import (
+	"github.com/cyrilix/robocar-protobuf/go/events"
+	"sync"
+	"time"
+)
+
+// pilotSteerings keeps pilot steering messages by frame id during staleAfter, to compare them with user steering of
+// the record of the same frame. Messages without frame ref are used as latest value during staleAfter.
+type pilotSteerings struct {
+	staleAfter time.Duration
+
+	muPilot sync.Mutex
+	byFrame map[string]receivedSteering
+	latest  receivedSteering
+}
+
+type receivedSteering struct {
+	msg      *events.SteeringMessage
+	received time.Time
+}
+
+func newPilotSteerings(staleAfter time.Duration) *pilotSteerings {
+	return &pilotSteerings{staleAfter: staleAfter, byFrame: make(map[string]receivedSteering)}
+}
+
+// Add keeps msg received at now and forgets messages older than staleAfter
+func (p *pilotSteerings) Add(msg *events.SteeringMessage, now time.Time) {
+	p.muPilot.Lock()
+	defer p.muPilot.Unlock()
+
+	if id := msg.GetFrameRef().GetId(); id != "" {
+		p.byFrame[id] = receivedSteering{msg: msg, received: now}
+	} else {
+		p.latest = receivedSteering{msg: msg, received: now}
+	}
+	for id, s := range p.byFrame {
+		if now.Sub(s.received) > p.staleAfter {
+			delete(p.byFrame, id)
+		}
+	}
+}
+
+// For returns pilot steering computed from frame, or latest value without frame ref if it isn't stale. It returns nil
+// if there isn't any.
+func (p *pilotSteerings) For(frame string, now time.Time) *events.SteeringMessage {
+	p.muPilot.Lock()
+	defer p.muPilot.Unlock()
+
+	if s, ok := p.byFrame[frame]; ok && frame != "" {
+		return s.msg
+	}
+	if p.latest.msg != nil && now.Sub(p.latest.received) <= p.staleAfter {
+		return p.latest.msg
+	}
+	return nil
+}
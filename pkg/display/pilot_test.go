@@ -0,0 +1,39 @@
+package display
+
+import (
+	"github.com/cyrilix/robocar-protobuf/go/events"
+	"testing"
+	"time"
+)
+
+func TestPilotSteerings(t *testing.T) {
+	p := newPilotSteerings(time.Second)
+	now := time.UnixMilli(1600000000000)
+	if p.For("1", now) != nil {
+		t.Errorf("no pilot steering expected")
+	}
+
+	first := &events.SteeringMessage{Steering: 0.1, FrameRef: &events.FrameRef{Id: "1"}}
+	second := &events.SteeringMessage{Steering: 0.2, FrameRef: &events.FrameRef{Id: "2"}}
+	p.Add(first, now)
+	p.Add(second, now.Add(100*time.Millisecond))
+	if msg := p.For("1", now.Add(200*time.Millisecond)); msg != first {
+		t.Errorf("pilot steering must be matched by frame: %v", msg)
+	}
+	if msg := p.For("3", now.Add(200*time.Millisecond)); msg != nil {
+		t.Errorf("pilot steering of another frame must not be used: %v", msg)
+	}
+
+	// Messages without frame ref are latest values until stale
+	latest := &events.SteeringMessage{Steering: 0.3}
+	p.Add(latest, now.Add(2*time.Second))
+	if msg := p.For("3", now.Add(2500*time.Millisecond)); msg != latest {
+		t.Errorf("latest pilot steering must be used: %v", msg)
+	}
+	if msg := p.For("3", now.Add(4*time.Second)); msg != nil {
+		t.Errorf("stale pilot steering must not be used: %v", msg)
+	}
+	if msg := p.For("1", now.Add(2500*time.Millisecond)); msg != latest {
+		t.Errorf("pilot steering older than stale delay must be forgotten: %v", msg)
+	}
+}
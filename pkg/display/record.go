@@ -1,35 +1,90 @@
 package display
 
 import (
+	"bytes"
 	"fmt"
 	"github.com/cyrilix/robocar-protobuf/go/events"
+	"github.com/cyrilix/robocar-tools/pkg/monitor"
+	"github.com/cyrilix/robocar-tools/pkg/overlay"
+	"github.com/cyrilix/robocar-tools/replay"
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 	"github.com/golang/protobuf/proto"
 	"go.uber.org/zap"
 	"gocv.io/x/gocv"
 	"image"
-	"image/color"
+	_ "image/jpeg"
+	"sync"
+	"time"
 )
 
-func NewRecordDisplay(client mqtt.Client, recordTopic string) *Record {
+// NewRecordDisplay builds record display, keystrokes are published as replay commands on controlTopic if set.
+// Steering and throttle are drawn as gauges with a chart of last chartWindow duration. Last throttle of throttleTopic
+// and pilot steering of pilotSteeringTopic are also drawn if topics are set, as drive mode of driveModeTopic. Pilot
+// steering is matched with records by frame, or used as latest value during staleAfter if it has no frame ref.
+// Topics without message since staleAfter are highlighted in status bar. Records are rendered at most maxFps times
+// per second, only last record is rendered when display is slower than records.
+func NewRecordDisplay(client mqtt.Client, recordTopic, controlTopic, throttleTopic, pilotSteeringTopic, driveModeTopic string, chartWindow, staleAfter time.Duration,
+	maxFps int) *Record {
+	if maxFps <= 0 {
+		maxFps = 1
+	}
+	m := monitor.New(staleAfter, statusRecords,
+		statusName(throttleTopic, statusThrottle), statusName(pilotSteeringTopic, statusPilot), statusName(driveModeTopic, statusMode))
 	return &Record{
-		client:      client,
-		recordTopic: recordTopic,
-		window:      gocv.NewWindow("recordTopic"),
-		recordChan:  make(chan *events.RecordMessage),
-		cancel:      make(chan interface{}),
+		client:             client,
+		recordTopic:        recordTopic,
+		controlTopic:       controlTopic,
+		throttleTopic:      throttleTopic,
+		pilotSteeringTopic: pilotSteeringTopic,
+		driveModeTopic:     driveModeTopic,
+		window:             gocv.NewWindow("recordTopic"),
+		chart:              overlay.NewChart(chartWindow),
+		monitor:            m,
+		interval:           time.Second / time.Duration(maxFps),
+		latest:             newLatestRecord(),
+		pilotSteerings:     newPilotSteerings(staleAfter),
+		cancel:             make(chan interface{}),
 	}
 
 }
 
+// Names of monitored topics in status bar
+const (
+	statusRecords  = "records"
+	statusThrottle = "throttle"
+	statusPilot    = "pilot"
+	statusMode     = "mode"
+)
+
+// statusName returns name of topic in status bar, or empty name if topic isn't set
+func statusName(topic, name string) string {
+	if topic == "" {
+		return ""
+	}
+	return name
+}
+
 type Record struct {
-	client      mqtt.Client
-	recordTopic string
+	client                            mqtt.Client
+	recordTopic                       string
+	controlTopic                      string
+	throttleTopic, pilotSteeringTopic string
+	driveModeTopic                    string
+
+	// window is only used by rendering loop
+	window  *gocv.Window
+	chart   *overlay.Chart
+	monitor *monitor.Monitor
+	// interval is the min delay between two rendered records
+	interval time.Duration
 
-	window *gocv.Window
+	muState        sync.Mutex
+	throttle       *events.ThrottleMessage
+	driveMode      *events.DriveModeMessage
+	pilotSteerings *pilotSteerings
 
-	recordChan chan *events.RecordMessage
-	cancel     chan interface{}
+	latest *latestRecord
+	cancel chan interface{}
 }
 
 func (r *Record) Start() error {
@@ -37,18 +92,32 @@ func (r *Record) Start() error {
 		return fmt.Errorf("unable to start service: %v", err)
 	}
 
-	var rec *events.RecordMessage
-	var objectsMsg events.ObjectsMessage
-	var roadMsg events.RoadMessage
-
+	var lastDraw time.Time
+	keyTicker := time.NewTicker(100 * time.Millisecond)
+	defer keyTicker.Stop()
 	for {
 		select {
-		case newRecord := <-r.recordChan:
-			rec = newRecord
+		case <-keyTicker.C:
+			// Poll keystrokes even if no record is received
+			r.onKey(r.window.WaitKey(1))
+		case <-r.latest.ready:
+			// Wait next rendering slot, records received meanwhile replace pending one
+			if wait := r.interval - time.Since(lastDraw); wait > 0 {
+				select {
+				case <-time.After(wait):
+				case <-r.cancel:
+					return nil
+				}
+			}
+			rec := r.latest.Take()
+			if rec == nil {
+				continue
+			}
+			r.drawRecord(rec, r.nextOverlay(rec, time.Now()))
+			lastDraw = time.Now()
 		case <-r.cancel:
 			return nil
 		}
-		go r.drawRecord(rec, &objectsMsg, &roadMsg)
 	}
 }
 
@@ -56,8 +125,15 @@ func (r *Record) Stop() {
 	defer r.window.Close()
 
 	close(r.cancel)
+	zap.S().Infof("%d records dropped by display", r.monitor.DroppedCount())
 
-	StopService("record-display", r.client, r.recordTopic)
+	topics := []string{r.recordTopic}
+	for _, topic := range []string{r.throttleTopic, r.pilotSteeringTopic, r.driveModeTopic} {
+		if topic != "" {
+			topics = append(topics, topic)
+		}
+	}
+	StopService("record-display", r.client, topics...)
 }
 
 func (r *Record) onRecord(_ mqtt.Client, message mqtt.Message) {
@@ -68,7 +144,52 @@ func (r *Record) onRecord(_ mqtt.Client, message mqtt.Message) {
 		return
 	}
 	message.Ack()
-	r.recordChan <- &msg
+	now := time.Now()
+	r.monitor.Received(statusRecords, now)
+	r.addSample(&msg, now)
+	if r.latest.Set(&msg) {
+		r.monitor.Dropped(1)
+	}
+}
+
+func (r *Record) onThrottle(_ mqtt.Client, message mqtt.Message) {
+	var msg events.ThrottleMessage
+	err := proto.Unmarshal(message.Payload(), &msg)
+	if err != nil {
+		zap.S().Errorf("unable to unmarshal protobuf %T: %v", &msg, err)
+		return
+	}
+	r.monitor.Received(statusThrottle, time.Now())
+	r.muState.Lock()
+	defer r.muState.Unlock()
+	r.throttle = &msg
+}
+
+func (r *Record) onPilotSteering(_ mqtt.Client, message mqtt.Message) {
+	var msg events.SteeringMessage
+	err := proto.Unmarshal(message.Payload(), &msg)
+	if err != nil {
+		zap.S().Errorf("unable to unmarshal protobuf %T: %v", &msg, err)
+		return
+	}
+	now := time.Now()
+	r.monitor.Received(statusPilot, now)
+	r.pilotSteerings.Add(&msg, now)
+	// Record of frame may have been received before its pilot steering
+	r.chart.SetPilotSteering(msg.GetFrameRef().GetId(), msg.GetSteering())
+}
+
+func (r *Record) onDriveMode(_ mqtt.Client, message mqtt.Message) {
+	var msg events.DriveModeMessage
+	err := proto.Unmarshal(message.Payload(), &msg)
+	if err != nil {
+		zap.S().Errorf("unable to unmarshal protobuf %T: %v", &msg, err)
+		return
+	}
+	r.monitor.Received(statusMode, time.Now())
+	r.muState.Lock()
+	defer r.muState.Unlock()
+	r.driveMode = &msg
 }
 
 func (r *Record) registerCallbacks() error {
@@ -76,36 +197,92 @@ func (r *Record) registerCallbacks() error {
 	if err != nil {
 		return err
 	}
+	if r.throttleTopic != "" {
+		if err := RegisterCallback(r.client, r.throttleTopic, r.onThrottle); err != nil {
+			return err
+		}
+	}
+	if r.pilotSteeringTopic != "" {
+		if err := RegisterCallback(r.client, r.pilotSteeringTopic, r.onPilotSteering); err != nil {
+			return err
+		}
+	}
+	if r.driveModeTopic != "" {
+		if err := RegisterCallback(r.client, r.driveModeTopic, r.onDriveMode); err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
 
-func (r *Record) drawRecord(rec *events.RecordMessage, objects *events.ObjectsMessage, road *events.RoadMessage) {
+// addSample adds values of every received record to chart, even if record isn't rendered
+func (r *Record) addSample(rec *events.RecordMessage, now time.Time) {
+	s := overlay.Sample{Time: now, Frame: rec.GetFrame().GetId().GetId()}
+	if rec.GetSteering() != nil {
+		v := rec.GetSteering().GetSteering()
+		s.Steering = &v
+	}
+	if pilot := r.pilotSteerings.For(s.Frame, now); pilot != nil {
+		v := pilot.GetSteering()
+		s.PilotSteering = &v
+	}
+	r.muState.Lock()
+	if r.throttle != nil {
+		v := r.throttle.GetThrottle()
+		s.Throttle = &v
+	}
+	r.muState.Unlock()
+	r.chart.Add(s)
+}
 
-	img, err := gocv.IMDecode(rec.GetFrame().GetFrame(), gocv.IMReadUnchanged)
+// nextOverlay returns record values with last throttle, pilot steering of record frame, drive mode and status
+func (r *Record) nextOverlay(rec *events.RecordMessage, now time.Time) *overlay.Overlay {
+	pilot := r.pilotSteerings.For(rec.GetFrame().GetId().GetId(), now)
+	r.muState.Lock()
+	defer r.muState.Unlock()
+	return &overlay.Overlay{
+		Steering:      rec.GetSteering(),
+		Throttle:      r.throttle,
+		PilotSteering: pilot,
+		DriveMode:     r.driveMode,
+		Gauges:        true,
+		Chart:         r.chart,
+		StatusBar:     r.monitor.Status(now),
+	}
+}
+
+func (r *Record) drawRecord(rec *events.RecordMessage, o *overlay.Overlay) {
+
+	img, _, err := image.Decode(bytes.NewReader(rec.GetFrame().GetFrame()))
 	if err != nil {
 		zap.S().Errorf("unable to decode image: %v", err)
 		return
 	}
-	defer img.Close()
 
-	steering := rec.GetSteering().GetSteering()
-	r.drawSteering(&img, steering)
+	r.monitor.Displayed(time.Now())
+	mat, err := gocv.ImageToMatRGB(overlay.Render(img, o))
+	if err != nil {
+		zap.S().Errorf("unable to convert image: %v", err)
+		return
+	}
+	defer mat.Close()
 
-	r.window.IMShow(img)
-	r.window.WaitKey(1)
+	r.window.IMShow(mat)
+	r.onKey(r.window.WaitKey(1))
 }
 
-func (r *Record) drawSteering(img *gocv.Mat, steering float32) {
-	gocv.PutText(
-		img,
-		fmt.Sprintf("Steering: %.3f", steering),
-		image.Point{X: 20, Y: 20},
-		gocv.FontHersheyPlain,
-		1.,
-		color.RGBA{R: 0, G: 255, B: 0, A: 255},
-		1,
-	)
+func (r *Record) onKey(key int) {
+	if r.controlTopic == "" {
+		return
+	}
+	cmd, ok := replay.CommandForKey(key)
+	if !ok {
+		return
+	}
+	if err := replay.PublishCommand(r.client, r.controlTopic, cmd); err != nil {
+		zap.S().Errorf("unable to send replay command: %v", err)
+	}
 }
 
 func StopService(name string, client mqtt.Client, topics ...string) {
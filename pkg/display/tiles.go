@@ -0,0 +1,169 @@
+package display
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/cyrilix/robocar-protobuf/go/events"
+	"github.com/cyrilix/robocar-tools/pkg/monitor"
+	"github.com/cyrilix/robocar-tools/pkg/overlay"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/golang/protobuf/proto"
+	"go.uber.org/zap"
+	"gocv.io/x/gocv"
+	"image"
+	_ "image/jpeg"
+	"sync"
+	"time"
+)
+
+// NewTiles builds display of last frames of each frameTopic tiled into a single window, see overlay.RenderTiles for
+// columns. Tiles are labeled by camera name of frames. Frames are rendered at most maxFps times per second, topics without
+// frame since staleAfter are highlighted in status bar.
+func NewTiles(client mqtt.Client, frameTopics []string, columns int, staleAfter time.Duration, maxFps int) *Tiles {
+	if maxFps <= 0 {
+		maxFps = 1
+	}
+	return &Tiles{
+		client:   client,
+		topics:   frameTopics,
+		columns:  columns,
+		window:   gocv.NewWindow("frameTopics"),
+		monitor:  monitor.New(staleAfter, frameTopics...),
+		interval: time.Second / time.Duration(maxFps),
+		frames:   make(map[string]*events.FrameMessage),
+		pending:  make(map[string]bool),
+		updated:  make(chan struct{}, 1),
+		cancel:   make(chan interface{}),
+	}
+}
+
+type Tiles struct {
+	client  mqtt.Client
+	topics  []string
+	columns int
+
+	// window is only used by rendering loop
+	window  *gocv.Window
+	monitor *monitor.Monitor
+	// interval is the min delay between two rendered images
+	interval time.Duration
+
+	muFrames sync.Mutex
+	frames   map[string]*events.FrameMessage
+	// pending is true for topics whose last frame hasn't been drawn yet
+	pending map[string]bool
+
+	// updated is notified when a frame is received
+	updated chan struct{}
+	cancel  chan interface{}
+}
+
+func (t *Tiles) Start() error {
+	for _, topic := range t.topics {
+		if err := RegisterCallback(t.client, topic, t.onFrame(topic)); err != nil {
+			return fmt.Errorf("unable to start service: %v", err)
+		}
+	}
+
+	var lastDraw time.Time
+	keyTicker := time.NewTicker(100 * time.Millisecond)
+	defer keyTicker.Stop()
+	for {
+		select {
+		case <-keyTicker.C:
+			// Window events are only processed while waiting keys
+			t.window.WaitKey(1)
+		case <-t.updated:
+			// Frames received until next rendering slot replace previous ones
+			if wait := t.interval - time.Since(lastDraw); wait > 0 {
+				select {
+				case <-time.After(wait):
+				case <-t.cancel:
+					return nil
+				}
+			}
+			t.draw()
+			lastDraw = time.Now()
+		case <-t.cancel:
+			return nil
+		}
+	}
+}
+
+func (t *Tiles) Stop() {
+	defer t.window.Close()
+
+	close(t.cancel)
+	StopService("tiles-display", t.client, t.topics...)
+}
+
+func (t *Tiles) onFrame(topic string) mqtt.MessageHandler {
+	return func(_ mqtt.Client, message mqtt.Message) {
+		var msg events.FrameMessage
+		err := proto.Unmarshal(message.Payload(), &msg)
+		if err != nil {
+			zap.S().Errorf("unable to unmarshal protobuf FrameMessage: %v", err)
+			return
+		}
+		t.monitor.Received(topic, time.Now())
+
+		t.muFrames.Lock()
+		dropped := t.pending[topic]
+		t.frames[topic] = &msg
+		t.pending[topic] = true
+		t.muFrames.Unlock()
+		if dropped {
+			t.monitor.Dropped(1)
+		}
+
+		select {
+		case t.updated <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// tiles returns last frame of each topic, labeled by camera name or topic if frames aren't named
+func (t *Tiles) tiles() []overlay.Tile {
+	// Frames are decoded without lock to not block frame reception
+	t.muFrames.Lock()
+	frames := make(map[string]*events.FrameMessage, len(t.frames))
+	for topic, msg := range t.frames {
+		frames[topic] = msg
+		t.pending[topic] = false
+	}
+	t.muFrames.Unlock()
+
+	tiles := make([]overlay.Tile, 0, len(t.topics))
+	for _, topic := range t.topics {
+		tile := overlay.Tile{Label: topic}
+		msg, ok := frames[topic]
+		if ok {
+			if name := msg.GetId().GetName(); name != "" {
+				tile.Label = name
+			}
+			img, _, err := image.Decode(bytes.NewReader(msg.GetFrame()))
+			if err != nil {
+				zap.S().Errorf("unable to decode image of topic %v: %v", topic, err)
+			} else {
+				tile.Image = img
+			}
+		}
+		tiles = append(tiles, tile)
+	}
+	return tiles
+}
+
+func (t *Tiles) draw() {
+	now := time.Now()
+	img := overlay.Render(overlay.RenderTiles(t.tiles(), t.columns), &overlay.Overlay{StatusBar: t.monitor.Status(now)})
+	t.monitor.Displayed(now)
+
+	mat, err := gocv.ImageToMatRGB(img)
+	if err != nil {
+		zap.S().Errorf("unable to convert image: %v", err)
+		return
+	}
+	defer mat.Close()
+	t.window.IMShow(mat)
+}
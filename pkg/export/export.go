@@ -0,0 +1,308 @@
+package export
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/cyrilix/robocar-tools/pkg/data"
+	"github.com/cyrilix/robocar-tools/pkg/recordset"
+	"go.uber.org/zap"
+	"image"
+	_ "image/jpeg"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+type Format int
+
+func ParseFormat(s string) Format {
+	switch strings.ToLower(s) {
+	case "npz":
+		return FormatNpz
+	case "csv":
+		return FormatCsv
+	case "jsonl":
+		return FormatJsonl
+	default:
+		return FormatUnknown
+	}
+}
+
+func (f Format) String() string {
+	switch f {
+	case FormatNpz:
+		return "npz"
+	case FormatCsv:
+		return "csv"
+	case FormatJsonl:
+		return "jsonl"
+	default:
+		return "unknown"
+	}
+}
+
+const (
+	FormatUnknown Format = iota
+	FormatNpz
+	FormatCsv
+	FormatJsonl
+)
+
+// Selection filters entries of each record set: entries from position From to To (excluded, 0 means end of
+// record set), one entry every Step
+type Selection struct {
+	From, To, Step int
+}
+
+func (s Selection) apply(entries []recordset.Entry) []recordset.Entry {
+	to := s.To
+	if to <= 0 || to > len(entries) {
+		to = len(entries)
+	}
+	from := s.From
+	if from < 0 {
+		from = 0
+	}
+	step := s.Step
+	if step <= 0 {
+		step = 1
+	}
+
+	selected := make([]recordset.Entry, 0, len(entries))
+	for i := from; i < to; i += step {
+		selected = append(selected, entries[i])
+	}
+	return selected
+}
+
+// Sample is an exported record
+type Sample struct {
+	RecordSet string  `json:"record_set"`
+	Frame     string  `json:"frame"`
+	Image     string  `json:"image"`
+	Steering  float32 `json:"steering"`
+}
+
+// Geometry describes image transformations applied to npz images tensor, see data.TransformImage
+type Geometry struct {
+	Width, Height, Horizon int
+}
+
+// Export writes selected records from sources to output file
+func Export(ctx context.Context, sources []string, output string, format Format, selection Selection, geometry Geometry) error {
+	samples, err := LoadSamples(ctx, sources, selection)
+	if err != nil {
+		return err
+	}
+	zap.S().Infof("export %d records to %v", len(samples), output)
+
+	f, err := os.Create(output)
+	if err != nil {
+		return fmt.Errorf("unable to create %v: %w", output, err)
+	}
+
+	switch format {
+	case FormatNpz:
+		err = WriteNpz(f, samples, geometry)
+	case FormatCsv:
+		err = WriteCsv(f, samples)
+	case FormatJsonl:
+		err = WriteJsonl(f, samples)
+	default:
+		err = fmt.Errorf("unsupported format %v", format)
+	}
+	if errClose := f.Close(); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		return fmt.Errorf("unable to export records to %v: %w", output, err)
+	}
+	return nil
+}
+
+// LoadSamples reads selected records of all record sets found in sources, record set edits are applied
+func LoadSamples(ctx context.Context, sources []string, selection Selection) ([]Sample, error) {
+	recordSets, err := data.ResolveRecordSets(ctx, sources)
+	if err != nil {
+		return nil, fmt.Errorf("unable to find record sets: %w", err)
+	}
+
+	samples := make([]Sample, 0)
+	for _, dir := range recordSets {
+		rs, err := recordset.Open(dir)
+		if err != nil {
+			return nil, fmt.Errorf("unable to open record set %v: %w", dir, err)
+		}
+		corrections, err := recordset.LoadCorrections(dir, rs.Indexes())
+		if err != nil {
+			return nil, fmt.Errorf("unable to load edits of record set %v: %w", dir, err)
+		}
+		for _, e := range selection.apply(rs.Entries) {
+			if corrections.Excluded[e.Index] {
+				continue
+			}
+			rcd, err := e.Record()
+			if err != nil {
+				return nil, err
+			}
+			steering := rcd.UserAngle
+			if v, ok := corrections.Steering[e.Index]; ok {
+				steering = v
+			}
+			samples = append(samples, Sample{
+				RecordSet: rs.Name(),
+				Frame:     e.Index,
+				Image:     e.ImagePath,
+				Steering:  steering,
+			})
+		}
+	}
+	return samples, nil
+}
+
+// WriteNpz writes samples as numpy npz archive with arrays:
+//   - images: uint8 tensor of shape (n, height, width, 3), RGB order
+//   - steering: float32 array of shape (n,)
+//   - record_sets, frames: unicode arrays of shape (n,)
+func WriteNpz(w io.Writer, samples []Sample, geometry Geometry) error {
+	zw := zip.NewWriter(w)
+
+	err := writeNpzImages(zw, samples, geometry)
+	if err != nil {
+		return err
+	}
+
+	steering := make([]float32, 0, len(samples))
+	recordSets := make([]string, 0, len(samples))
+	frames := make([]string, 0, len(samples))
+	for _, s := range samples {
+		steering = append(steering, s.Steering)
+		recordSets = append(recordSets, s.RecordSet)
+		frames = append(frames, s.Frame)
+	}
+
+	entry, err := zw.Create("steering.npy")
+	if err != nil {
+		return fmt.Errorf("unable to create steering entry: %w", err)
+	}
+	if err = writeNpyFloat32(entry, steering); err != nil {
+		return err
+	}
+	entry, err = zw.Create("record_sets.npy")
+	if err != nil {
+		return fmt.Errorf("unable to create record_sets entry: %w", err)
+	}
+	if err = writeNpyStrings(entry, recordSets); err != nil {
+		return err
+	}
+	entry, err = zw.Create("frames.npy")
+	if err != nil {
+		return fmt.Errorf("unable to create frames entry: %w", err)
+	}
+	if err = writeNpyStrings(entry, frames); err != nil {
+		return err
+	}
+
+	if err = zw.Close(); err != nil {
+		return fmt.Errorf("unable to close npz archive: %w", err)
+	}
+	return nil
+}
+
+func writeNpzImages(zw *zip.Writer, samples []Sample, geometry Geometry) error {
+	var entry io.Writer
+	var width, height int
+	for idx, s := range samples {
+		img, err := readImage(s.Image)
+		if err != nil {
+			return err
+		}
+		img = data.TransformImage(img, geometry.Width, geometry.Height, geometry.Horizon, false)
+
+		bounds := img.Bounds()
+		if idx == 0 {
+			// Tensor shape is known once first image is transformed
+			width, height = bounds.Dx(), bounds.Dy()
+			entry, err = zw.Create("images.npy")
+			if err != nil {
+				return fmt.Errorf("unable to create images entry: %w", err)
+			}
+			if err = writeNpyHeader(entry, "|u1", len(samples), height, width, 3); err != nil {
+				return err
+			}
+		} else if bounds.Dx() != width || bounds.Dy() != height {
+			return fmt.Errorf("image %v has size %dx%d, wants %dx%d, use image geometry options to resize images",
+				s.Image, bounds.Dx(), bounds.Dy(), width, height)
+		}
+
+		if _, err = entry.Write(rgbBytes(img)); err != nil {
+			return fmt.Errorf("unable to write image %v: %w", s.Image, err)
+		}
+	}
+	if len(samples) == 0 {
+		entry, err := zw.Create("images.npy")
+		if err != nil {
+			return fmt.Errorf("unable to create images entry: %w", err)
+		}
+		return writeNpyHeader(entry, "|u1", 0, 0, 0, 3)
+	}
+	return nil
+}
+
+func readImage(imgPath string) (image.Image, error) {
+	f, err := os.Open(imgPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read img: %w", err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode image %v: %w", imgPath, err)
+	}
+	return img, nil
+}
+
+// rgbBytes returns pixels of img in row major order, 3 bytes per pixel
+func rgbBytes(img image.Image) []byte {
+	bounds := img.Bounds()
+	pixels := make([]byte, 0, bounds.Dx()*bounds.Dy()*3)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, _ := img.At(x, y).RGBA()
+			pixels = append(pixels, byte(r>>8), byte(g>>8), byte(b>>8))
+		}
+	}
+	return pixels
+}
+
+// WriteCsv writes samples labels with image paths as csv with header
+func WriteCsv(w io.Writer, samples []Sample) error {
+	cw := csv.NewWriter(w)
+	err := cw.Write([]string{"record_set", "frame", "image", "steering"})
+	if err != nil {
+		return fmt.Errorf("unable to write csv header: %w", err)
+	}
+	for _, s := range samples {
+		err = cw.Write([]string{s.RecordSet, s.Frame, s.Image, strconv.FormatFloat(float64(s.Steering), 'f', -1, 32)})
+		if err != nil {
+			return fmt.Errorf("unable to write csv line: %w", err)
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteJsonl writes one json object per sample
+func WriteJsonl(w io.Writer, samples []Sample) error {
+	enc := json.NewEncoder(w)
+	for _, s := range samples {
+		if err := enc.Encode(&s); err != nil {
+			return fmt.Errorf("unable to write json line: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package export
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"path"
+	"strings"
+	"testing"
+)
+
+// testRecordSet is shared with data package tests
+const testRecordSet = "../data/testdata/2020021819-4"
+
+func TestWriteNpyHeader(t *testing.T) {
+	cases := []struct {
+		name          string
+		descr         string
+		shape         []int
+		expectedShape string
+	}{
+		{"1 dimension", "<f4", []int{14}, "(14,)"},
+		{"4 dimensions", "|u1", []int{14, 120, 160, 3}, "(14, 120, 160, 3)"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			buf := bytes.Buffer{}
+			if err := writeNpyHeader(&buf, c.descr, c.shape...); err != nil {
+				t.Fatalf("unable to write header: %v", err)
+			}
+			content := buf.Bytes()
+			if !bytes.HasPrefix(content, npyMagic) {
+				t.Errorf("bad magic: %v", content[:8])
+			}
+			if len(content)%64 != 0 {
+				t.Errorf("header isn't 64 bytes aligned: %v", len(content))
+			}
+			headerLen := binary.LittleEndian.Uint16(content[8:10])
+			if int(headerLen) != len(content)-10 {
+				t.Errorf("bad header length: %v, wants %v", headerLen, len(content)-10)
+			}
+			header := string(content[10:])
+			if !strings.HasSuffix(header, "\n") {
+				t.Errorf("header must end with new line: %q", header)
+			}
+			if !strings.Contains(header, "'descr': '"+c.descr+"'") {
+				t.Errorf("bad descr: %q", header)
+			}
+			if !strings.Contains(header, "'shape': "+c.expectedShape) {
+				t.Errorf("bad shape: %q, wants %v", header, c.expectedShape)
+			}
+		})
+	}
+}
+
+func TestSelection(t *testing.T) {
+	samples, err := LoadSamples(context.Background(), []string{testRecordSet}, Selection{From: 1, To: 5, Step: 2})
+	if err != nil {
+		t.Fatalf("unable to load samples: %v", err)
+	}
+	if len(samples) != 2 {
+		t.Fatalf("bad number of samples: %v, wants %v", len(samples), 2)
+	}
+	if samples[0].Frame != "0000102" || samples[1].Frame != "0000104" {
+		t.Errorf("bad samples selected: %v", samples)
+	}
+	if samples[0].RecordSet != "2020021819-4" {
+		t.Errorf("bad record set: %v", samples[0].RecordSet)
+	}
+}
+
+func TestWriteNpz(t *testing.T) {
+	samples, err := LoadSamples(context.Background(), []string{testRecordSet}, Selection{})
+	if err != nil {
+		t.Fatalf("unable to load samples: %v", err)
+	}
+
+	buf := bytes.Buffer{}
+	err = WriteNpz(&buf, samples, Geometry{Width: 32, Height: 24, Horizon: 4})
+	if err != nil {
+		t.Fatalf("unable to write npz: %v", err)
+	}
+
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("unable to read npz archive: %v", err)
+	}
+	arrays := make(map[string][]byte)
+	for _, f := range r.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("unable to open %v: %v", f.Name, err)
+		}
+		content, err := ioutil.ReadAll(rc)
+		if err != nil {
+			t.Fatalf("unable to read %v: %v", f.Name, err)
+		}
+		_ = rc.Close()
+		arrays[f.Name] = content
+	}
+
+	checkNpyArray(t, arrays, "images.npy", "(6, 20, 32, 3)", 6*20*32*3)
+	checkNpyArray(t, arrays, "steering.npy", "(6,)", 6*4)
+	checkNpyArray(t, arrays, "frames.npy", "(6,)", 6*7*4)
+	checkNpyArray(t, arrays, "record_sets.npy", "(6,)", 6*12*4)
+
+	steering := arrays["steering.npy"][len(arrays["steering.npy"])-6*4:]
+	value := math.Float32frombits(binary.LittleEndian.Uint32(steering[0:4]))
+	if value != samples[0].Steering {
+		t.Errorf("bad steering value: %v, wants %v", value, samples[0].Steering)
+	}
+}
+
+func checkNpyArray(t *testing.T, arrays map[string][]byte, name string, shape string, dataLen int) {
+	content, ok := arrays[name]
+	if !ok {
+		t.Errorf("%v not found in npz archive", name)
+		return
+	}
+	headerLen := int(binary.LittleEndian.Uint16(content[8:10]))
+	header := string(content[10 : 10+headerLen])
+	if !strings.Contains(header, "'shape': "+shape) {
+		t.Errorf("%v: bad shape %q, wants %v", name, header, shape)
+	}
+	if len(content)-10-headerLen != dataLen {
+		t.Errorf("%v: bad data length %v, wants %v", name, len(content)-10-headerLen, dataLen)
+	}
+}
+
+func TestWriteCsv(t *testing.T) {
+	samples, err := LoadSamples(context.Background(), []string{testRecordSet}, Selection{})
+	if err != nil {
+		t.Fatalf("unable to load samples: %v", err)
+	}
+	buf := bytes.Buffer{}
+	if err := WriteCsv(&buf, samples); err != nil {
+		t.Fatalf("unable to write csv: %v", err)
+	}
+
+	lines, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("invalid csv content: %v", err)
+	}
+	if len(lines) != len(samples)+1 {
+		t.Fatalf("bad number of lines: %v, wants %v", len(lines), len(samples)+1)
+	}
+	if lines[1][2] != path.Join(testRecordSet, "cam", "cam-image_array_0000101.jpg") {
+		t.Errorf("bad image path: %v", lines[1][2])
+	}
+	if lines[1][3] != "0.04117644" {
+		t.Errorf("bad steering: %v", lines[1][3])
+	}
+}
+
+func TestWriteJsonl(t *testing.T) {
+	samples, err := LoadSamples(context.Background(), []string{testRecordSet}, Selection{})
+	if err != nil {
+		t.Fatalf("unable to load samples: %v", err)
+	}
+	buf := bytes.Buffer{}
+	if err := WriteJsonl(&buf, samples); err != nil {
+		t.Fatalf("unable to write jsonl: %v", err)
+	}
+
+	scanner := bufio.NewScanner(&buf)
+	nb := 0
+	for scanner.Scan() {
+		var s Sample
+		if err := json.Unmarshal(scanner.Bytes(), &s); err != nil {
+			t.Errorf("invalid json line %v: %v", scanner.Text(), err)
+			continue
+		}
+		if s != samples[nb] {
+			t.Errorf("bad sample: %v, wants %v", s, samples[nb])
+		}
+		nb += 1
+	}
+	if nb != len(samples) {
+		t.Errorf("bad number of lines: %v, wants %v", nb, len(samples))
+	}
+}
@@ -0,0 +1,86 @@
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// npy format version 1.0, see https://numpy.org/doc/stable/reference/generated/numpy.lib.format.html
+var npyMagic = []byte("\x93NUMPY\x01\x00")
+
+// writeNpyHeader writes header of a C ordered array, data must follow header
+func writeNpyHeader(w io.Writer, descr string, shape ...int) error {
+	dims := make([]string, 0, len(shape))
+	for _, d := range shape {
+		dims = append(dims, fmt.Sprintf("%d", d))
+	}
+	shapeStr := strings.Join(dims, ", ")
+	if len(shape) == 1 {
+		shapeStr += ","
+	}
+	header := fmt.Sprintf("{'descr': '%s', 'fortran_order': False, 'shape': (%s), }", descr, shapeStr)
+
+	// Header is padded with spaces and terminated by '\n' so that data is 64 bytes aligned
+	total := len(npyMagic) + 2 + len(header) + 1
+	if pad := total % 64; pad != 0 {
+		header += strings.Repeat(" ", 64-pad)
+	}
+	header += "\n"
+
+	buf := bytes.Buffer{}
+	buf.Write(npyMagic)
+	err := binary.Write(&buf, binary.LittleEndian, uint16(len(header)))
+	if err != nil {
+		return fmt.Errorf("unable to write npy header length: %w", err)
+	}
+	buf.WriteString(header)
+	_, err = w.Write(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("unable to write npy header: %w", err)
+	}
+	return nil
+}
+
+// writeNpyFloat32 writes a 1-dimensional float32 array
+func writeNpyFloat32(w io.Writer, values []float32) error {
+	if err := writeNpyHeader(w, "<f4", len(values)); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.LittleEndian, values); err != nil {
+		return fmt.Errorf("unable to write npy float32 values: %w", err)
+	}
+	return nil
+}
+
+// writeNpyStrings writes a 1-dimensional unicode array, numpy stores each item as fixed length utf-32
+func writeNpyStrings(w io.Writer, values []string) error {
+	maxLen := 1
+	for _, v := range values {
+		if n := utf8.RuneCountInString(v); n > maxLen {
+			maxLen = n
+		}
+	}
+	if err := writeNpyHeader(w, fmt.Sprintf("<U%d", maxLen), len(values)); err != nil {
+		return err
+	}
+
+	item := make([]uint32, maxLen)
+	for _, v := range values {
+		for i := range item {
+			item[i] = 0
+		}
+		i := 0
+		for _, r := range v {
+			item[i] = uint32(r)
+			i += 1
+		}
+		if err := binary.Write(w, binary.LittleEndian, item); err != nil {
+			return fmt.Errorf("unable to write npy string values: %w", err)
+		}
+	}
+	return nil
+}
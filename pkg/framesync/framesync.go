@@ -0,0 +1,316 @@
+package framesync
+
+import (
+	"fmt"
+	"github.com/cyrilix/robocar-protobuf/go/events"
+	"github.com/cyrilix/robocar-tools/pkg/overlay"
+	"sync"
+	"time"
+)
+
+type Status int
+
+const (
+	StatusMissing Status = iota
+	StatusMatched
+	StatusStale
+	// StatusLatest is used for results published without frame ref, like throttle feedback
+	StatusLatest
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusMatched:
+		return "matched"
+	case StatusStale:
+		return "stale"
+	case StatusLatest:
+		return "latest"
+	default:
+		return "missing"
+	}
+}
+
+// Result describes how a frame result has been found
+type Result struct {
+	Status Status
+	// Age is the delay between frame and result reception for matched results, and the time elapsed between the
+	// frame the result was computed from and the displayed frame for stale results. For latest results, it's the
+	// time elapsed since result reception when frame is released
+	Age time.Duration
+}
+
+func (r Result) String() string {
+	switch r.Status {
+	case StatusMatched:
+		return fmt.Sprintf("%dms", r.Age.Milliseconds())
+	case StatusStale:
+		return fmt.Sprintf("stale %dms", r.Age.Milliseconds())
+	case StatusLatest:
+		return fmt.Sprintf("latest %dms", r.Age.Milliseconds())
+	default:
+		return "missing"
+	}
+}
+
+// Entry is a frame with results computed from it
+type Entry struct {
+	Frame    *events.FrameMessage
+	Received time.Time
+
+	Objects        *events.ObjectsMessage
+	ObjectsResult  Result
+	Road           *events.RoadMessage
+	RoadResult     Result
+	Throttle       *events.ThrottleMessage
+	ThrottleResult Result
+
+	expected [kindCount]bool
+}
+
+type kind int
+
+const (
+	kindObjects kind = iota
+	kindRoad
+	kindThrottle
+	kindCount
+)
+
+var kindNames = [kindCount]string{"objects", "road", "throttle"}
+
+type slot struct {
+	msg      interface{}
+	received time.Time
+	// frameReceived is the reception time of the frame the result was computed from
+	frameReceived time.Time
+	ok            bool
+}
+
+type pendingFrame struct {
+	frame    *events.FrameMessage
+	received time.Time
+	results  [kindCount]slot
+}
+
+type earlyResults struct {
+	received time.Time
+	results  [kindCount]slot
+}
+
+// Buffer matches frames with their objects, road and throttle messages by frame id. A frame is ready when all
+// expected results are received or when it's older than delay.
+type Buffer struct {
+	delay    time.Duration
+	expected [kindCount]bool
+
+	muBuffer sync.Mutex
+	frames   []*pendingFrame
+	byId     map[string]*pendingFrame
+	// early keeps results received before their frame
+	early map[string]*earlyResults
+	// released keeps reception time of frames already released, to use their late results as stale results
+	released map[string]time.Time
+	last     [kindCount]slot
+	// unreferenced is true for kinds of results published without frame ref, like throttle feedback, they are used as
+	// latest values and frames don't wait for them
+	unreferenced [kindCount]bool
+}
+
+func NewBuffer(delay time.Duration, withObjects, withRoad, withThrottle bool) *Buffer {
+	return &Buffer{
+		delay:    delay,
+		expected: [kindCount]bool{withObjects, withRoad, withThrottle},
+		frames:   make([]*pendingFrame, 0),
+		byId:     make(map[string]*pendingFrame),
+		early:    make(map[string]*earlyResults),
+		released: make(map[string]time.Time),
+	}
+}
+
+func (b *Buffer) AddFrame(msg *events.FrameMessage, now time.Time) {
+	b.muBuffer.Lock()
+	defer b.muBuffer.Unlock()
+
+	id := msg.GetId().GetId()
+	pf := &pendingFrame{frame: msg, received: now}
+	if e, ok := b.early[id]; ok {
+		for k := range e.results {
+			if e.results[k].ok {
+				pf.results[k] = e.results[k]
+				pf.results[k].frameReceived = now
+			}
+		}
+		delete(b.early, id)
+	}
+	b.frames = append(b.frames, pf)
+	b.byId[id] = pf
+}
+
+func (b *Buffer) AddObjects(msg *events.ObjectsMessage, now time.Time) {
+	b.addResult(kindObjects, msg.GetFrameRef().GetId(), msg, now)
+}
+
+func (b *Buffer) AddRoad(msg *events.RoadMessage, now time.Time) {
+	b.addResult(kindRoad, msg.GetFrameRef().GetId(), msg, now)
+}
+
+func (b *Buffer) AddThrottle(msg *events.ThrottleMessage, now time.Time) {
+	b.addResult(kindThrottle, msg.GetFrameRef().GetId(), msg, now)
+}
+
+func (b *Buffer) addResult(k kind, id string, msg interface{}, now time.Time) {
+	b.muBuffer.Lock()
+	defer b.muBuffer.Unlock()
+
+	s := slot{msg: msg, received: now, ok: true}
+	if id == "" {
+		s.frameReceived = now
+		b.unreferenced[k] = true
+		b.setLast(k, s)
+		return
+	}
+	if pf, ok := b.byId[id]; ok {
+		s.frameReceived = pf.received
+		pf.results[k] = s
+		return
+	}
+	if frameReceived, ok := b.released[id]; ok {
+		// Frame already displayed, result is kept for next frames
+		s.frameReceived = frameReceived
+		b.setLast(k, s)
+		return
+	}
+	e, ok := b.early[id]
+	if !ok {
+		e = &earlyResults{received: now}
+		b.early[id] = e
+	}
+	e.results[k] = s
+}
+
+func (b *Buffer) setLast(k kind, s slot) {
+	if !b.last[k].ok || !s.frameReceived.Before(b.last[k].frameReceived) {
+		b.last[k] = s
+	}
+}
+
+func (b *Buffer) complete(pf *pendingFrame) bool {
+	for k := kind(0); k < kindCount; k++ {
+		if b.expected[k] && !b.unreferenced[k] && !pf.results[k].ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Ready returns frames, in reception order, with all their results or older than delay
+func (b *Buffer) Ready(now time.Time) []*Entry {
+	b.muBuffer.Lock()
+	defer b.muBuffer.Unlock()
+
+	entries := make([]*Entry, 0)
+	for len(b.frames) > 0 {
+		pf := b.frames[0]
+		if !b.complete(pf) && now.Sub(pf.received) < b.delay {
+			break
+		}
+		b.frames = b.frames[1:]
+		id := pf.frame.GetId().GetId()
+		delete(b.byId, id)
+		b.released[id] = pf.received
+		entries = append(entries, b.release(pf, now))
+	}
+	b.purge(now)
+	return entries
+}
+
+func (b *Buffer) release(pf *pendingFrame, now time.Time) *Entry {
+	var msgs [kindCount]interface{}
+	var results [kindCount]Result
+	for k := kind(0); k < kindCount; k++ {
+		if !b.expected[k] {
+			continue
+		}
+		s := pf.results[k]
+		switch {
+		case s.ok:
+			msgs[k] = s.msg
+			age := s.received.Sub(pf.received)
+			if age < 0 {
+				// Result received before its frame
+				age = 0
+			}
+			results[k] = Result{Status: StatusMatched, Age: age}
+			b.setLast(k, s)
+		case b.last[k].ok && b.unreferenced[k]:
+			msgs[k] = b.last[k].msg
+			results[k] = Result{Status: StatusLatest, Age: now.Sub(b.last[k].received)}
+		case b.last[k].ok:
+			msgs[k] = b.last[k].msg
+			age := pf.received.Sub(b.last[k].frameReceived)
+			if age < 0 {
+				// Latest value received after frame
+				age = 0
+			}
+			results[k] = Result{Status: StatusStale, Age: age}
+		}
+	}
+
+	e := Entry{
+		Frame:          pf.frame,
+		Received:       pf.received,
+		ObjectsResult:  results[kindObjects],
+		RoadResult:     results[kindRoad],
+		ThrottleResult: results[kindThrottle],
+		expected:       b.expected,
+	}
+	if msg, ok := msgs[kindObjects].(*events.ObjectsMessage); ok {
+		e.Objects = msg
+	}
+	if msg, ok := msgs[kindRoad].(*events.RoadMessage); ok {
+		e.Road = msg
+	}
+	if msg, ok := msgs[kindThrottle].(*events.ThrottleMessage); ok {
+		e.Throttle = msg
+	}
+	return &e
+}
+
+// purge forgets early results and released frames that can't be matched anymore
+func (b *Buffer) purge(now time.Time) {
+	maxAge := 10 * b.delay
+	if maxAge < time.Second {
+		maxAge = time.Second
+	}
+	for id, e := range b.early {
+		if now.Sub(e.received) > maxAge {
+			delete(b.early, id)
+		}
+	}
+	for id, received := range b.released {
+		if now.Sub(received) > maxAge {
+			delete(b.released, id)
+		}
+	}
+}
+
+// Overlay returns events to draw over frame, with a status line for each expected result
+func (e *Entry) Overlay() overlay.Overlay {
+	o := overlay.Overlay{
+		Objects:  e.Objects,
+		Road:     e.Road,
+		Throttle: e.Throttle,
+		// Throttle of frames is the throttle feedback measured on car
+		ThrottleFeedback: true,
+		StaleObjects:     e.ObjectsResult.Status == StatusStale,
+		StaleRoad:        e.RoadResult.Status == StatusStale,
+	}
+	results := [kindCount]Result{e.ObjectsResult, e.RoadResult, e.ThrottleResult}
+	for k := kind(0); k < kindCount; k++ {
+		if e.expected[k] {
+			o.Status = append(o.Status, fmt.Sprintf("%s: %v", kindNames[k], results[k]))
+		}
+	}
+	return o
+}
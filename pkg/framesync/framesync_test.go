@@ -0,0 +1,167 @@
+package framesync
+
+import (
+	"github.com/cyrilix/robocar-protobuf/go/events"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var t0 = time.UnixMilli(1600000000000)
+
+func at(ms int) time.Time {
+	return t0.Add(time.Duration(ms) * time.Millisecond)
+}
+
+func frame(id string) *events.FrameMessage {
+	return &events.FrameMessage{Id: &events.FrameRef{Name: "camera", Id: id}}
+}
+
+func ref(id string) *events.FrameRef {
+	return &events.FrameRef{Name: "camera", Id: id}
+}
+
+func ids(entries []*Entry) []string {
+	result := make([]string, 0, len(entries))
+	for _, e := range entries {
+		result = append(result, e.Frame.GetId().GetId())
+	}
+	return result
+}
+
+func TestBuffer_Matched(t *testing.T) {
+	b := NewBuffer(100*time.Millisecond, true, true, false)
+
+	b.AddFrame(frame("1"), at(0))
+	b.AddFrame(frame("2"), at(10))
+	objects2 := &events.ObjectsMessage{FrameRef: ref("2")}
+	b.AddObjects(objects2, at(20))
+	b.AddObjects(&events.ObjectsMessage{FrameRef: ref("1")}, at(30))
+	if r := b.Ready(at(30)); len(r) != 0 {
+		t.Errorf("frames without road must wait: %v", ids(r))
+	}
+
+	b.AddRoad(&events.RoadMessage{FrameRef: ref("2")}, at(40))
+	if r := b.Ready(at(40)); len(r) != 0 {
+		t.Errorf("frames must be released in order: %v", ids(r))
+	}
+	b.AddRoad(&events.RoadMessage{FrameRef: ref("1")}, at(50))
+	r := b.Ready(at(50))
+	if !reflect.DeepEqual(ids(r), []string{"1", "2"}) {
+		t.Fatalf("complete frames must be released: %v", ids(r))
+	}
+	e := r[1]
+	if e.Objects != objects2 || e.ObjectsResult != (Result{Status: StatusMatched, Age: 10 * time.Millisecond}) {
+		t.Errorf("bad objects for frame 2: %v", e.ObjectsResult)
+	}
+	if e.RoadResult != (Result{Status: StatusMatched, Age: 30 * time.Millisecond}) {
+		t.Errorf("bad road for frame 2: %v", e.RoadResult)
+	}
+}
+
+func TestBuffer_StaleAndMissing(t *testing.T) {
+	b := NewBuffer(100*time.Millisecond, true, false, true)
+
+	b.AddFrame(frame("1"), at(0))
+	r := b.Ready(at(100))
+	if len(r) != 1 {
+		t.Fatalf("frame must be released after delay: %v", ids(r))
+	}
+	if r[0].ObjectsResult.Status != StatusMissing || r[0].Objects != nil || r[0].ThrottleResult.Status != StatusMissing {
+		t.Errorf("results must be missing: %v %v", r[0].ObjectsResult, r[0].ThrottleResult)
+	}
+
+	// Late result of released frame is used for next frames
+	objects1 := &events.ObjectsMessage{FrameRef: ref("1")}
+	b.AddObjects(objects1, at(120))
+	b.AddFrame(frame("2"), at(150))
+	b.AddThrottle(&events.ThrottleMessage{FrameRef: ref("2")}, at(160))
+	r = b.Ready(at(250))
+	if len(r) != 1 {
+		t.Fatalf("frame must be released after delay: %v", ids(r))
+	}
+	if r[0].Objects != objects1 || r[0].ObjectsResult != (Result{Status: StatusStale, Age: 150 * time.Millisecond}) {
+		t.Errorf("objects must be stale: %v", r[0].ObjectsResult)
+	}
+	if r[0].ThrottleResult.Status != StatusMatched || r[0].RoadResult.Status != StatusMissing {
+		t.Errorf("bad results: %v %v", r[0].ThrottleResult, r[0].RoadResult)
+	}
+
+	o := r[0].Overlay()
+	if !o.StaleObjects || o.Objects != objects1 || o.Throttle == nil || !o.ThrottleFeedback {
+		t.Errorf("bad overlay: %v", o)
+	}
+	if !reflect.DeepEqual(o.Status, []string{"objects: stale 150ms", "throttle: 10ms"}) {
+		t.Errorf("bad status: %v", o.Status)
+	}
+}
+
+func TestBuffer_EarlyResult(t *testing.T) {
+	b := NewBuffer(100*time.Millisecond, true, false, false)
+
+	b.AddObjects(&events.ObjectsMessage{FrameRef: ref("1")}, at(0))
+	b.AddFrame(frame("1"), at(10))
+	r := b.Ready(at(10))
+	if len(r) != 1 || r[0].ObjectsResult != (Result{Status: StatusMatched}) {
+		t.Fatalf("result received before frame must be matched: %v", r)
+	}
+}
+
+func TestBuffer_WithoutFrameRef(t *testing.T) {
+	b := NewBuffer(100*time.Millisecond, false, false, true)
+
+	// Throttle feedback isn't computed from frames, it is used as latest value
+	throttle := &events.ThrottleMessage{Throttle: 0.3}
+	b.AddThrottle(throttle, at(0))
+	b.AddFrame(frame("1"), at(20))
+	r := b.Ready(at(20))
+	if len(r) != 1 {
+		t.Fatalf("frame must not wait for results without frame ref: %v", ids(r))
+	}
+	if r[0].Throttle != throttle || r[0].ThrottleResult != (Result{Status: StatusLatest, Age: 20 * time.Millisecond}) {
+		t.Errorf("bad throttle: %v", r[0].ThrottleResult)
+	}
+	if len(b.early) != 0 {
+		t.Errorf("results without frame ref must not be kept as early results: %v", b.early)
+	}
+
+	b.AddFrame(frame("2"), at(40))
+	throttle2 := &events.ThrottleMessage{Throttle: 0.4}
+	b.AddThrottle(throttle2, at(50))
+	r = b.Ready(at(50))
+	if len(r) != 1 || r[0].Throttle != throttle2 || r[0].ThrottleResult != (Result{Status: StatusLatest}) {
+		t.Errorf("last throttle must be used: %v", r)
+	}
+	if o := r[0].Overlay(); !reflect.DeepEqual(o.Status, []string{"throttle: latest 0ms"}) {
+		t.Errorf("bad status: %v", o.Status)
+	}
+}
+
+func TestBuffer_Purge(t *testing.T) {
+	b := NewBuffer(10*time.Millisecond, true, false, false)
+
+	b.AddObjects(&events.ObjectsMessage{FrameRef: ref("unknown")}, at(0))
+	b.AddFrame(frame("1"), at(0))
+	b.Ready(at(20))
+	if len(b.early) != 1 || len(b.released) != 1 {
+		t.Fatalf("recent results must be kept: %v %v", b.early, b.released)
+	}
+	b.Ready(at(2000))
+	if len(b.early) != 0 || len(b.released) != 0 {
+		t.Errorf("old results must be purged: %v %v", b.early, b.released)
+	}
+}
+
+func TestResult_String(t *testing.T) {
+	cases := map[Result]string{
+		{Status: StatusMatched, Age: 42 * time.Millisecond}: "42ms",
+		{Status: StatusStale, Age: time.Second}:             "stale 1000ms",
+		{Status: StatusLatest, Age: 120 * time.Millisecond}: "latest 120ms",
+		{}: "missing",
+	}
+	for r, expected := range cases {
+		if r.String() != expected {
+			t.Errorf("bad string: %v, wants %v", r.String(), expected)
+		}
+	}
+}
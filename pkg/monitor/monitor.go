@@ -0,0 +1,106 @@
+package monitor
+
+import (
+	"fmt"
+	"github.com/cyrilix/robocar-tools/pkg/overlay"
+	"sync"
+	"time"
+)
+
+// fpsWindow is the period used to compute displayed frame rate
+const fpsWindow = time.Second
+
+// Monitor tracks message reception of named topics, displayed frame rate and dropped frames to build a status bar.
+// Topics without message since staleAfter are reported as alerts.
+type Monitor struct {
+	staleAfter time.Duration
+
+	muMonitor sync.Mutex
+	names     []string
+	last      map[string]time.Time
+	displayed []time.Time
+	dropped   int
+}
+
+// New builds monitor of topics names, empty names are ignored
+func New(staleAfter time.Duration, names ...string) *Monitor {
+	m := Monitor{
+		staleAfter: staleAfter,
+		names:      make([]string, 0, len(names)),
+		last:       make(map[string]time.Time),
+		displayed:  make([]time.Time, 0),
+	}
+	for _, n := range names {
+		if n != "" {
+			m.names = append(m.names, n)
+		}
+	}
+	return &m
+}
+
+// Received records a message of topic name
+func (m *Monitor) Received(name string, now time.Time) {
+	m.muMonitor.Lock()
+	defer m.muMonitor.Unlock()
+	m.last[name] = now
+}
+
+// Displayed records a displayed frame
+func (m *Monitor) Displayed(now time.Time) {
+	m.muMonitor.Lock()
+	defer m.muMonitor.Unlock()
+	m.displayed = append(m.displayed, now)
+	m.trim(now)
+}
+
+// Dropped records frames received but never displayed
+func (m *Monitor) Dropped(count int) {
+	m.muMonitor.Lock()
+	defer m.muMonitor.Unlock()
+	m.dropped += count
+}
+
+// DroppedCount is the number of frames dropped since start
+func (m *Monitor) DroppedCount() int {
+	m.muMonitor.Lock()
+	defer m.muMonitor.Unlock()
+	return m.dropped
+}
+
+func (m *Monitor) trim(now time.Time) {
+	first := 0
+	for first < len(m.displayed) && now.Sub(m.displayed[first]) >= fpsWindow {
+		first += 1
+	}
+	m.displayed = m.displayed[first:]
+}
+
+// Status returns message age of each topic, frame rate and dropped frames count
+func (m *Monitor) Status(now time.Time) []overlay.StatusItem {
+	m.muMonitor.Lock()
+	defer m.muMonitor.Unlock()
+
+	items := make([]overlay.StatusItem, 0, len(m.names)+2)
+	for _, n := range m.names {
+		last, ok := m.last[n]
+		if !ok {
+			items = append(items, overlay.StatusItem{Text: n + " -", Alert: true})
+			continue
+		}
+		age := now.Sub(last)
+		items = append(items, overlay.StatusItem{Text: n + " " + formatAge(age), Alert: age > m.staleAfter})
+	}
+	m.trim(now)
+	items = append(items,
+		overlay.StatusItem{Text: fmt.Sprintf("fps %d", len(m.displayed))},
+		overlay.StatusItem{Text: fmt.Sprintf("drop %d", m.dropped)},
+	)
+	return items
+}
+
+func formatAge(age time.Duration) string {
+	if age < time.Second {
+		return fmt.Sprintf("%dms", age.Milliseconds())
+	}
+	return fmt.Sprintf("%.1fs", age.Seconds())
+}
@@ -0,0 +1,37 @@
+package monitor
+
+import (
+	"github.com/cyrilix/robocar-tools/pkg/overlay"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMonitor_Status(t *testing.T) {
+	start := time.UnixMilli(1600000000000)
+	at := func(ms int) time.Time { return start.Add(time.Duration(ms) * time.Millisecond) }
+
+	m := New(time.Second, "frame", "", "road", "mode")
+	m.Received("frame", at(0))
+	m.Received("frame", at(1200))
+	m.Received("road", at(0))
+	for i := 0; i < 5; i++ {
+		m.Displayed(at(i * 300))
+	}
+	m.Dropped(2)
+	m.Dropped(1)
+
+	expected := []overlay.StatusItem{
+		{Text: "frame 100ms"},
+		{Text: "road 1.3s", Alert: true},
+		{Text: "mode -", Alert: true},
+		{Text: "fps 3"},
+		{Text: "drop 3"},
+	}
+	if status := m.Status(at(1300)); !reflect.DeepEqual(status, expected) {
+		t.Errorf("bad status: %v, wants %v", status, expected)
+	}
+	if m.DroppedCount() != 3 {
+		t.Errorf("bad dropped count: %v", m.DroppedCount())
+	}
+}
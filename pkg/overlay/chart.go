@@ -0,0 +1,182 @@
+package overlay
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"sync"
+	"time"
+)
+
+var (
+	pilotColor      = color.RGBA{R: 255, G: 0, B: 255, A: 255}
+	gaugeBackground = color.RGBA{R: 0, G: 0, B: 0, A: 128}
+	gaugeAxisColor  = color.RGBA{R: 160, G: 160, B: 160, A: 255}
+)
+
+const (
+	chartHeight    = 30
+	gaugeThickness = 4
+)
+
+// Sample is steering and throttle values at a time, nil values are unknown. Frame is the id of frame values are
+// computed from, if known.
+type Sample struct {
+	Time          time.Time
+	Frame         string
+	Steering      *float32
+	PilotSteering *float32
+	Throttle      *float32
+}
+
+// Chart keeps samples of last window duration to draw them as scrolling curves
+type Chart struct {
+	window time.Duration
+
+	muSamples sync.Mutex
+	samples   []Sample
+}
+
+func NewChart(window time.Duration) *Chart {
+	return &Chart{
+		window:  window,
+		samples: make([]Sample, 0),
+	}
+}
+
+// Add appends sample and drops samples older than window
+func (c *Chart) Add(s Sample) {
+	c.muSamples.Lock()
+	defer c.muSamples.Unlock()
+
+	c.samples = append(c.samples, s)
+	first := 0
+	for first < len(c.samples) && s.Time.Sub(c.samples[first].Time) > c.window {
+		first += 1
+	}
+	c.samples = c.samples[first:]
+}
+
+// SetPilotSteering sets pilot steering of last sample of frame, ok is false if frame has no sample into window
+func (c *Chart) SetPilotSteering(frame string, v float32) (ok bool) {
+	if frame == "" {
+		return false
+	}
+	c.muSamples.Lock()
+	defer c.muSamples.Unlock()
+
+	for i := len(c.samples) - 1; i >= 0; i-- {
+		if c.samples[i].Frame == frame {
+			c.samples[i].PilotSteering = &v
+			return true
+		}
+	}
+	return false
+}
+
+// Error returns mean absolute error between user and pilot steering over window, ok is false if no sample has both
+// values
+func (c *Chart) Error() (mean float64, ok bool) {
+	c.muSamples.Lock()
+	defer c.muSamples.Unlock()
+
+	sum, count := 0., 0
+	for _, s := range c.samples {
+		if s.Steering == nil || s.PilotSteering == nil {
+			continue
+		}
+		sum += math.Abs(float64(*s.Steering - *s.PilotSteering))
+		count += 1
+	}
+	if count == 0 {
+		return 0, false
+	}
+	return sum / float64(count), true
+}
+
+func (c *Chart) snapshot() []Sample {
+	c.muSamples.Lock()
+	defer c.muSamples.Unlock()
+	return append([]Sample{}, c.samples...)
+}
+
+// drawChart draws steering, pilot steering and throttle curves at the bottom of image, values are in [-1, 1]
+func drawChart(img *image.RGBA, c *Chart) {
+	samples := c.snapshot()
+	b := img.Bounds()
+	area := image.Rect(b.Min.X+textMargin, b.Max.Y-textMargin-chartHeight, b.Max.X-textMargin, b.Max.Y-textMargin)
+	fillRect(img, area, gaugeBackground)
+	zero := (area.Min.Y + area.Max.Y) / 2
+	drawLine(img, image.Point{X: area.Min.X, Y: zero}, image.Point{X: area.Max.X - 1, Y: zero}, gaugeAxisColor)
+	if len(samples) == 0 {
+		return
+	}
+
+	end := samples[len(samples)-1].Time
+	point := func(t time.Time, v float32) image.Point {
+		x := float64(area.Max.X-1) - float64(end.Sub(t))/float64(c.window)*float64(area.Dx()-1)
+		y := float64(zero) - clamp(float64(v))*float64(area.Dy()/2-1)
+		return image.Point{X: int(math.Round(x)), Y: int(math.Round(y))}
+	}
+	curve := func(value func(s Sample) *float32, col color.RGBA) {
+		var prev *image.Point
+		for _, s := range samples {
+			v := value(s)
+			if v == nil {
+				prev = nil
+				continue
+			}
+			p := point(s.Time, *v)
+			if prev != nil {
+				drawLine(img, *prev, p, col)
+			}
+			prev = &p
+		}
+	}
+	curve(func(s Sample) *float32 { return s.Throttle }, throttleColor)
+	curve(func(s Sample) *float32 { return s.PilotSteering }, pilotColor)
+	curve(func(s Sample) *float32 { return s.Steering }, textColor)
+}
+
+// drawSteeringGauge draws horizontal bar with a marker for user and pilot steering, above chart if any
+func drawSteeringGauge(img *image.RGBA, steering, pilot *float32, withChart bool) {
+	b := img.Bounds()
+	bottom := b.Max.Y - textMargin
+	if withChart {
+		bottom -= chartHeight + 2
+	}
+	area := image.Rect(b.Min.X+textMargin, bottom-gaugeThickness, b.Max.X-textMargin, bottom)
+	fillRect(img, area, gaugeBackground)
+	center := (area.Min.X + area.Max.X) / 2
+	fillRect(img, image.Rect(center, area.Min.Y-1, center+1, area.Max.Y+1), gaugeAxisColor)
+
+	marker := func(v float32, c color.RGBA) {
+		x := center + int(math.Round(clamp(float64(v))*float64(area.Dx()/2-1)))
+		fillRect(img, image.Rect(x-1, area.Min.Y, x+2, area.Max.Y), c)
+	}
+	if pilot != nil {
+		marker(*pilot, pilotColor)
+	}
+	if steering != nil {
+		marker(*steering, textColor)
+	}
+}
+
+// drawThrottleGauge draws vertical bar on the right of image below top, filled from its middle to throttle value
+func drawThrottleGauge(img *image.RGBA, throttle float32, top int) {
+	b := img.Bounds()
+	area := image.Rect(b.Max.X-textMargin-gaugeThickness, b.Min.Y+top+textMargin, b.Max.X-textMargin, b.Min.Y+top+textMargin+b.Dy()/2)
+	fillRect(img, area, gaugeBackground)
+	zero := (area.Min.Y + area.Max.Y) / 2
+	y := zero - int(math.Round(clamp(float64(throttle))*float64(area.Dy()/2)))
+	if y < zero {
+		fillRect(img, image.Rect(area.Min.X, y, area.Max.X, zero), throttleColor)
+	} else {
+		fillRect(img, image.Rect(area.Min.X, zero, area.Max.X, y), throttleColor)
+	}
+	fillRect(img, image.Rect(area.Min.X-1, zero, area.Max.X+1, zero+1), gaugeAxisColor)
+}
+
+func clamp(v float64) float64 {
+	return math.Max(-1, math.Min(1, v))
+}
@@ -0,0 +1,59 @@
+package overlay
+
+import (
+	"testing"
+	"time"
+)
+
+func value(v float32) *float32 {
+	return &v
+}
+
+func TestChart_Add(t *testing.T) {
+	c := NewChart(time.Second)
+	start := time.UnixMilli(1600000000000)
+	for i := 0; i < 5; i++ {
+		c.Add(Sample{Time: start.Add(time.Duration(i) * 400 * time.Millisecond)})
+	}
+	samples := c.snapshot()
+	if len(samples) != 3 {
+		t.Fatalf("samples older than window must be dropped: %v", len(samples))
+	}
+	if !samples[0].Time.Equal(start.Add(800 * time.Millisecond)) {
+		t.Errorf("bad first sample: %v", samples[0].Time)
+	}
+}
+
+func TestChart_Error(t *testing.T) {
+	c := NewChart(time.Second)
+	if _, ok := c.Error(); ok {
+		t.Errorf("error must not be available without samples")
+	}
+
+	start := time.UnixMilli(1600000000000)
+	c.Add(Sample{Time: start, Steering: value(0.5), PilotSteering: value(0.25)})
+	c.Add(Sample{Time: start.Add(100 * time.Millisecond), Steering: value(-0.5)})
+	c.Add(Sample{Time: start.Add(200 * time.Millisecond), Steering: value(-0.5), PilotSteering: value(0.25)})
+	mean, ok := c.Error()
+	if !ok || mean != 0.5 {
+		t.Errorf("bad mean error: %v, wants 0.5", mean)
+	}
+}
+
+func TestChart_SetPilotSteering(t *testing.T) {
+	c := NewChart(time.Second)
+	start := time.UnixMilli(1600000000000)
+	c.Add(Sample{Time: start, Frame: "1", Steering: value(0.5)})
+	c.Add(Sample{Time: start.Add(100 * time.Millisecond), Frame: "2", Steering: value(-0.5)})
+
+	if !c.SetPilotSteering("1", 0.25) {
+		t.Errorf("pilot steering must be set on sample of frame")
+	}
+	if c.SetPilotSteering("3", 0.25) || c.SetPilotSteering("", 0.25) {
+		t.Errorf("pilot steering of unknown frame must be ignored")
+	}
+	mean, ok := c.Error()
+	if !ok || mean != 0.25 {
+		t.Errorf("bad mean error: %v, wants 0.25", mean)
+	}
+}
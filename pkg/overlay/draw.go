@@ -0,0 +1,123 @@
+package overlay
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"sort"
+)
+
+// blend mixes c over img pixel, alpha of c is used as opacity
+func blend(img *image.RGBA, x, y int, c color.RGBA) {
+	if !(image.Point{X: x, Y: y}.In(img.Bounds())) {
+		return
+	}
+	if c.A == 255 {
+		img.SetRGBA(x, y, c)
+		return
+	}
+	dst := img.RGBAAt(x, y)
+	mix := func(src, dst uint8) uint8 {
+		return uint8((uint32(src)*uint32(c.A) + uint32(dst)*(255-uint32(c.A)) + 127) / 255)
+	}
+	img.SetRGBA(x, y, color.RGBA{R: mix(c.R, dst.R), G: mix(c.G, dst.G), B: mix(c.B, dst.B), A: 255})
+}
+
+func fillRect(img *image.RGBA, r image.Rectangle, c color.RGBA) {
+	r = r.Intersect(img.Bounds())
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			blend(img, x, y, c)
+		}
+	}
+}
+
+// drawRect draws rectangle outline inside r
+func drawRect(img *image.RGBA, r image.Rectangle, c color.RGBA, thickness int) {
+	r = r.Canon()
+	fillRect(img, image.Rect(r.Min.X, r.Min.Y, r.Max.X, r.Min.Y+thickness), c)
+	fillRect(img, image.Rect(r.Min.X, r.Max.Y-thickness, r.Max.X, r.Max.Y), c)
+	fillRect(img, image.Rect(r.Min.X, r.Min.Y+thickness, r.Min.X+thickness, r.Max.Y-thickness), c)
+	fillRect(img, image.Rect(r.Max.X-thickness, r.Min.Y+thickness, r.Max.X, r.Max.Y-thickness), c)
+}
+
+// fillPolygon fills polygon with even-odd rule, pixels are inside when their center is inside
+func fillPolygon(img *image.RGBA, pts []image.Point, c color.RGBA) {
+	if len(pts) < 3 {
+		return
+	}
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		cy := float64(y) + 0.5
+		xs := make([]float64, 0, 4)
+		for i := range pts {
+			a, n := pts[i], pts[(i+1)%len(pts)]
+			ay, ny := float64(a.Y), float64(n.Y)
+			if (ay <= cy && ny > cy) || (ny <= cy && ay > cy) {
+				xs = append(xs, float64(a.X)+(cy-ay)*float64(n.X-a.X)/(ny-ay))
+			}
+		}
+		sort.Float64s(xs)
+		for i := 0; i+1 < len(xs); i += 2 {
+			for x := int(math.Ceil(xs[i] - 0.5)); float64(x)+0.5 <= xs[i+1]; x++ {
+				if x >= b.Min.X && x < b.Max.X {
+					blend(img, x, y, c)
+				}
+			}
+		}
+	}
+}
+
+// drawLine draws a one pixel wide segment from a to b
+func drawLine(img *image.RGBA, a, b image.Point, c color.RGBA) {
+	dx, dy := abs(b.X-a.X), -abs(b.Y-a.Y)
+	sx, sy := 1, 1
+	if a.X > b.X {
+		sx = -1
+	}
+	if a.Y > b.Y {
+		sy = -1
+	}
+	e := dx + dy
+	for {
+		blend(img, a.X, a.Y, c)
+		if a == b {
+			return
+		}
+		e2 := 2 * e
+		if e2 >= dy {
+			e += dy
+			a.X += sx
+		}
+		if e2 <= dx {
+			e += dx
+			a.Y += sy
+		}
+	}
+}
+
+// drawEllipse draws ellipse outline, rx and ry are semi-axes before rotation of angle radians around center
+func drawEllipse(img *image.RGBA, cx, cy, rx, ry, angle float64, c color.RGBA) {
+	const steps = 64
+	cos, sin := math.Cos(angle), math.Sin(angle)
+	point := func(i int) image.Point {
+		t := 2 * math.Pi * float64(i) / steps
+		x, y := rx*math.Cos(t), ry*math.Sin(t)
+		return image.Point{X: int(math.Round(cx + x*cos - y*sin)), Y: int(math.Round(cy + x*sin + y*cos))}
+	}
+	prev := point(0)
+	for i := 1; i <= steps; i++ {
+		p := point(i)
+		if p != prev {
+			drawLine(img, prev, p, c)
+		}
+		prev = p
+	}
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,241 @@
+package overlay
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/cyrilix/robocar-protobuf/go/events"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"math"
+)
+
+var (
+	objectColor   = color.RGBA{R: 0, G: 255, B: 0, A: 255}
+	roadColor     = color.RGBA{R: 255, G: 0, B: 0, A: 255}
+	textColor     = color.RGBA{R: 0, G: 255, B: 0, A: 255}
+	throttleColor = color.RGBA{R: 0, G: 255, B: 255, A: 255}
+	statusColor   = color.RGBA{R: 255, G: 255, B: 0, A: 255}
+	// staleObjectColor and staleRoadColor are used for results computed from an older frame
+	staleObjectColor = color.RGBA{R: 160, G: 160, B: 160, A: 255}
+	staleRoadColor   = color.RGBA{R: 160, G: 160, B: 160, A: 255}
+)
+
+const (
+	textMargin     = 5
+	textLineHeight = 10
+)
+
+// Overlay groups events drawn over a frame, nil fields aren't drawn
+type Overlay struct {
+	Objects   *events.ObjectsMessage
+	Road      *events.RoadMessage
+	Steering  *events.SteeringMessage
+	Throttle  *events.ThrottleMessage
+	DriveMode *events.DriveModeMessage
+	// ThrottleFeedback labels Throttle as throttle feedback measured on car instead of throttle command
+	ThrottleFeedback bool
+
+	// StaleObjects and StaleRoad draw objects and road with dimmed colors
+	StaleObjects bool
+	StaleRoad    bool
+	// Status lines are written after events values
+	Status []string
+	// Style of objects and road, DefaultStyle is used if nil
+	Style *Style
+
+	// PilotSteering is the autopilot prediction compared to Steering
+	PilotSteering *events.SteeringMessage
+	// Gauges draws steering and throttle as bars
+	Gauges bool
+	// Chart draws last values as scrolling curves with the mean steering error
+	Chart *Chart
+	// StatusBar items are written at the top of image
+	StatusBar []StatusItem
+}
+
+// Render draws overlay on a copy of frame
+func Render(frame image.Image, o *Overlay) *image.RGBA {
+	b := frame.Bounds()
+	img := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(img, img.Bounds(), frame, b.Min, draw.Src)
+	if o == nil {
+		return img
+	}
+
+	style := o.Style
+	if style == nil {
+		style = DefaultStyle()
+	}
+	if o.Road != nil {
+		drawRoad(img, o.Road, style, o.StaleRoad)
+	}
+	if o.Objects != nil {
+		drawObjects(img, o.Objects, style, o.StaleObjects)
+	}
+
+	top := statusBarHeight(img, o.StatusBar)
+	if o.DriveMode != nil {
+		drawRect(img, img.Bounds(), driveModeColor(o.DriveMode.GetDriveMode()), driveModeThickness)
+	}
+	if o.Chart != nil {
+		drawChart(img, o.Chart)
+	}
+	if o.Gauges {
+		if o.Steering != nil || o.PilotSteering != nil {
+			drawSteeringGauge(img, steeringValue(o.Steering), steeringValue(o.PilotSteering), o.Chart != nil)
+		}
+		if o.Throttle != nil {
+			drawThrottleGauge(img, o.Throttle.GetThrottle(), top)
+		}
+	}
+
+	line := 0
+	text := func(s string, c color.RGBA) {
+		line += 1
+		DrawText(img, s, image.Point{X: textMargin, Y: top + textMargin + line*textLineHeight - 3}, c, 1)
+	}
+	if o.Steering != nil {
+		text(fmt.Sprintf("Steering: %.3f", o.Steering.GetSteering()), textColor)
+	}
+	if o.PilotSteering != nil {
+		text(fmt.Sprintf("Pilot: %.3f", o.PilotSteering.GetSteering()), pilotColor)
+		if o.Steering != nil {
+			text(fmt.Sprintf("Error: %.3f", math.Abs(float64(o.Steering.GetSteering()-o.PilotSteering.GetSteering()))), pilotColor)
+		}
+	}
+	if o.Chart != nil {
+		if mean, ok := o.Chart.Error(); ok {
+			text(fmt.Sprintf("Mean error: %.3f", mean), pilotColor)
+		}
+	}
+	if o.Throttle != nil {
+		label := "Throttle"
+		if o.ThrottleFeedback {
+			label = "Throttle feedback"
+		}
+		text(fmt.Sprintf("%s: %.3f", label, o.Throttle.GetThrottle()), throttleColor)
+	}
+	if o.DriveMode != nil {
+		text(fmt.Sprintf("Mode: %v", o.DriveMode.GetDriveMode()), driveModeColor(o.DriveMode.GetDriveMode()))
+	}
+	if o.Road != nil {
+		text(fmt.Sprintf("Confidence: %.3f", o.Road.GetEllipse().GetConfidence()), textColor)
+		text(fmt.Sprintf("Angle ellipse: %.3f", o.Road.GetEllipse().GetAngle()), textColor)
+	}
+	for _, s := range o.Status {
+		text(s, statusColor)
+	}
+	drawStatusBar(img, o.StatusBar)
+	return img
+}
+
+func steeringValue(msg *events.SteeringMessage) *float32 {
+	if msg == nil {
+		return nil
+	}
+	v := msg.GetSteering()
+	return &v
+}
+
+// RenderJPEG decodes jpeg frame, draws overlay and encodes result as jpeg
+func RenderJPEG(frame []byte, o *Overlay) ([]byte, error) {
+	img, err := jpeg.Decode(bytes.NewReader(frame))
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode frame: %w", err)
+	}
+	buf := bytes.Buffer{}
+	if err := jpeg.Encode(&buf, Render(img, o), &jpeg.Options{Quality: 90}); err != nil {
+		return nil, fmt.Errorf("unable to encode frame: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// drawObjects draws bounding boxes colored by object type, objects coordinates are relative to image size.
+// Stale objects are drawn with staleObjectColor.
+func drawObjects(img *image.RGBA, objects *events.ObjectsMessage, style *Style, stale bool) {
+	w, h := float32(img.Bounds().Dx()), float32(img.Bounds().Dy())
+	for _, obj := range objects.GetObjects() {
+		if float64(obj.GetConfidence()) < style.MinConfidence {
+			continue
+		}
+		c := style.objectColor(obj.GetType())
+		if stale {
+			c = staleObjectColor
+		}
+		r := image.Rect(
+			int(obj.GetLeft()*w),
+			int(obj.GetTop()*h),
+			int(obj.GetRight()*w),
+			int(obj.GetBottom()*h),
+		)
+		drawRect(img, r, c, style.ObjectThickness)
+		if style.ObjectLabels {
+			drawLabel(img, objectLabel(obj), r, c, style.ObjectThickness)
+		}
+	}
+}
+
+// drawLabel writes text above box r, or inside box when there is no space above
+func drawLabel(img *image.RGBA, text string, r image.Rectangle, c color.RGBA, thickness int) {
+	origin := image.Point{X: r.Min.X, Y: r.Min.Y - 2}
+	if origin.Y-glyphHeight < img.Bounds().Min.Y {
+		origin.Y = r.Min.Y + thickness + glyphHeight + 1
+		origin.X += thickness + 1
+	}
+	DrawText(img, text, origin, c, 1)
+}
+
+// drawRoad fills road contour and draws its ellipse, coordinates are in pixels. Stale road is drawn with
+// staleRoadColor.
+func drawRoad(img *image.RGBA, road *events.RoadMessage, style *Style, stale bool) {
+	c := style.RoadColor
+	if stale {
+		c = staleRoadColor
+	}
+	if len(road.GetContour()) >= 3 {
+		cntr := make([]image.Point, 0, len(road.GetContour()))
+		for _, pt := range road.GetContour() {
+			cntr = append(cntr, image.Point{X: int(pt.GetX()), Y: int(pt.GetY())})
+		}
+		fillPolygon(img, cntr, c)
+	}
+	if style.Ellipse {
+		ellipseColor := style.EllipseColor
+		if stale {
+			ellipseColor = staleObjectColor
+		}
+		drawRoadEllipse(img, road.GetEllipse(), ellipseColor)
+	}
+}
+
+// drawRoadEllipse draws ellipse and an arrow along its major axis, pointing to the top of the image. Ellipse
+// follows opencv RotatedRect convention: width and height are full axes lengths, angle is the clockwise
+// rotation of width axis in degrees.
+func drawRoadEllipse(img *image.RGBA, ellipse *events.Ellipse, c color.RGBA) {
+	if ellipse.GetCenter() == nil || ellipse.GetWidth() <= 0 || ellipse.GetHeight() <= 0 {
+		return
+	}
+	cx, cy := float64(ellipse.GetCenter().GetX()), float64(ellipse.GetCenter().GetY())
+	rx, ry := float64(ellipse.GetWidth())/2, float64(ellipse.GetHeight())/2
+	angle := float64(ellipse.GetAngle()) * math.Pi / 180
+	drawEllipse(img, cx, cy, rx, ry, angle, c)
+
+	// Heading is the direction of major axis, arrow goes out of ellipse to stay visible
+	hx, hy, length := math.Cos(angle), math.Sin(angle), 1.5*rx
+	if ry > rx {
+		hx, hy, length = -math.Sin(angle), math.Cos(angle), 1.5*ry
+	}
+	if hy > 0 {
+		hx, hy = -hx, -hy
+	}
+	center := image.Point{X: int(math.Round(cx)), Y: int(math.Round(cy))}
+	tip := image.Point{X: int(math.Round(cx + hx*length)), Y: int(math.Round(cy + hy*length))}
+	drawLine(img, center, tip, c)
+	head := math.Max(3, length/5)
+	for _, side := range []float64{-1, 1} {
+		a := math.Atan2(hy, hx) + math.Pi + side*math.Pi/6
+		drawLine(img, tip, image.Point{X: int(math.Round(float64(tip.X) + head*math.Cos(a))), Y: int(math.Round(float64(tip.Y) + head*math.Sin(a)))}, c)
+	}
+}
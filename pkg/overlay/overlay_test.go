@@ -0,0 +1,233 @@
+package overlay
+
+import (
+	"bytes"
+	"flag"
+	"github.com/cyrilix/robocar-protobuf/go/events"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"math"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "update golden images")
+
+func loadFrame(t *testing.T) image.Image {
+	f, err := os.Open("testdata/frame.jpg")
+	if err != nil {
+		t.Fatalf("unable to open frame: %v", err)
+	}
+	defer f.Close()
+	img, err := jpeg.Decode(f)
+	if err != nil {
+		t.Fatalf("unable to decode frame: %v", err)
+	}
+	return img
+}
+
+func checkGolden(t *testing.T, name string, img *image.RGBA) {
+	goldenPath := path.Join("testdata", "golden", name+".png")
+	if *update {
+		if err := os.MkdirAll(path.Dir(goldenPath), os.FileMode(0755)); err != nil {
+			t.Fatalf("unable to create golden directory: %v", err)
+		}
+		f, err := os.Create(goldenPath)
+		if err != nil {
+			t.Fatalf("unable to create golden image: %v", err)
+		}
+		defer f.Close()
+		if err := png.Encode(f, img); err != nil {
+			t.Fatalf("unable to write golden image: %v", err)
+		}
+		return
+	}
+
+	f, err := os.Open(goldenPath)
+	if err != nil {
+		t.Fatalf("unable to open golden image: %v", err)
+	}
+	defer f.Close()
+	golden, err := png.Decode(f)
+	if err != nil {
+		t.Fatalf("unable to decode golden image: %v", err)
+	}
+	if golden.Bounds() != img.Bounds() {
+		t.Fatalf("bad image size: %v, wants %v", img.Bounds(), golden.Bounds())
+	}
+	diff := 0
+	for y := img.Bounds().Min.Y; y < img.Bounds().Max.Y; y++ {
+		for x := img.Bounds().Min.X; x < img.Bounds().Max.X; x++ {
+			if color.RGBAModel.Convert(golden.At(x, y)) != img.RGBAAt(x, y) {
+				diff += 1
+			}
+		}
+	}
+	if diff > 0 {
+		t.Errorf("%v pixels differ from golden image %v, run tests with -update to regenerate it", diff, goldenPath)
+	}
+}
+
+func TestRender(t *testing.T) {
+	frame := loadFrame(t)
+	cases := []struct {
+		name    string
+		overlay *Overlay
+	}{
+		{"empty", &Overlay{}},
+		{"objects", &Overlay{
+			Objects: &events.ObjectsMessage{Objects: []*events.Object{
+				{Type: events.TypeObject_CAR, Left: 0.1, Top: 0.2, Right: 0.4, Bottom: 0.6, Confidence: 0.9},
+				{Type: events.TypeObject_BUMP, Left: 0.6, Top: 0.5, Right: 0.9, Bottom: 0.95, Confidence: 0.7},
+				{Type: events.TypeObject_PLOT, Left: 0.5, Top: 0., Right: 0.7, Bottom: 0.3, Confidence: 0.55},
+			}},
+		}},
+		{"style", &Overlay{
+			Objects: &events.ObjectsMessage{Objects: []*events.Object{
+				{Type: events.TypeObject_CAR, Left: 0.1, Top: 0.2, Right: 0.4, Bottom: 0.6, Confidence: 0.9},
+				{Type: events.TypeObject_BUMP, Left: 0.6, Top: 0.5, Right: 0.9, Bottom: 0.95, Confidence: 0.3},
+			}},
+			Road: &events.RoadMessage{
+				Contour: []*events.Point{{X: 0, Y: 119}, {X: 50, Y: 60}, {X: 110, Y: 60}, {X: 159, Y: 119}},
+				Ellipse: &events.Ellipse{Center: &events.Point{X: 80, Y: 90}, Width: 60, Height: 30, Angle: 12.5, Confidence: 0.8},
+			},
+			Style: &Style{
+				ObjectColors:    map[events.TypeObject]color.RGBA{events.TypeObject_CAR: {R: 255, A: 255}},
+				ObjectThickness: 1,
+				MinConfidence:   0.5,
+				RoadColor:       color.RGBA{B: 255, A: 96},
+			},
+		}},
+		{"road", &Overlay{
+			Road: &events.RoadMessage{
+				Contour: []*events.Point{{X: 0, Y: 119}, {X: 50, Y: 60}, {X: 110, Y: 60}, {X: 159, Y: 119}},
+				Ellipse: &events.Ellipse{Center: &events.Point{X: 80, Y: 85}, Width: 24, Height: 50, Angle: 20, Confidence: 0.8},
+			},
+		}},
+		{"all", &Overlay{
+			Objects: &events.ObjectsMessage{Objects: []*events.Object{
+				{Type: events.TypeObject_ANY, Left: 0.4, Top: 0.4, Right: 0.6, Bottom: 0.7, Confidence: 0.9},
+			}},
+			Road: &events.RoadMessage{
+				Contour: []*events.Point{{X: 0, Y: 119}, {X: 60, Y: 70}, {X: 100, Y: 70}, {X: 159, Y: 119}},
+				Ellipse: &events.Ellipse{Angle: -3.2, Confidence: 0.5},
+			},
+			Steering:  &events.SteeringMessage{Steering: -0.25, Confidence: 1},
+			Throttle:  &events.ThrottleMessage{Throttle: 0.4, Confidence: 1},
+			DriveMode: &events.DriveModeMessage{DriveMode: events.DriveMode_PILOT},
+		}},
+		{"stale", &Overlay{
+			Objects: &events.ObjectsMessage{Objects: []*events.Object{
+				{Type: events.TypeObject_ANY, Left: 0.1, Top: 0.5, Right: 0.3, Bottom: 0.8, Confidence: 0.9},
+			}},
+			Road: &events.RoadMessage{
+				Contour: []*events.Point{{X: 40, Y: 127}, {X: 70, Y: 80}, {X: 90, Y: 80}, {X: 120, Y: 127}},
+			},
+			Throttle:         &events.ThrottleMessage{Throttle: 0.35},
+			ThrottleFeedback: true,
+			StaleObjects:     true,
+			StaleRoad:        true,
+			Status:           []string{"objects: stale 120ms", "road: stale 80ms", "throttle: latest 40ms"},
+		}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			checkGolden(t, c.name, Render(frame, c.overlay))
+		})
+	}
+}
+
+func TestRender_Gauges(t *testing.T) {
+	frame := loadFrame(t)
+	chart := NewChart(5 * time.Second)
+	start := time.UnixMilli(1600000000000)
+	for i := 0; i <= 50; i++ {
+		x := float64(i) / 50
+		steering, pilot, throttle := float32(math.Sin(x*2*math.Pi)*0.8), float32(math.Sin(x*2*math.Pi+0.4)*0.7), float32(0.2+x*0.4)
+		s := Sample{Time: start.Add(time.Duration(i) * 100 * time.Millisecond), Steering: &steering, Throttle: &throttle}
+		if i < 20 || i > 30 {
+			// Pilot prediction is missing in the middle
+			s.PilotSteering = &pilot
+		}
+		chart.Add(s)
+	}
+	cases := []struct {
+		name    string
+		overlay *Overlay
+	}{
+		{"gauges", &Overlay{
+			Steering:      &events.SteeringMessage{Steering: 0.3},
+			PilotSteering: &events.SteeringMessage{Steering: -0.2},
+			Throttle:      &events.ThrottleMessage{Throttle: 0.6},
+			Gauges:        true,
+			Chart:         chart,
+		}},
+		{"status", &Overlay{
+			Steering:  &events.SteeringMessage{Steering: 0.1},
+			Throttle:  &events.ThrottleMessage{Throttle: 0.5},
+			DriveMode: &events.DriveModeMessage{DriveMode: events.DriveMode_USER},
+			Gauges:    true,
+			StatusBar: []StatusItem{
+				{Text: "frame 40ms"}, {Text: "road 2.3s", Alert: true}, {Text: "mode -", Alert: true},
+				{Text: "fps 24"}, {Text: "drop 3"},
+			},
+		}},
+		{"gauges-no-chart", &Overlay{
+			Steering: &events.SteeringMessage{Steering: -0.7},
+			Throttle: &events.ThrottleMessage{Throttle: -0.3},
+			Gauges:   true,
+		}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			checkGolden(t, c.name, Render(frame, c.overlay))
+		})
+	}
+}
+
+func TestRender_KeepFrame(t *testing.T) {
+	frame := image.NewRGBA(image.Rect(0, 0, 20, 20))
+	img := Render(frame, &Overlay{Objects: &events.ObjectsMessage{Objects: []*events.Object{{Left: 0, Top: 0, Right: 1, Bottom: 1}}}})
+	if img.RGBAAt(0, 0) != objectColor {
+		t.Errorf("object must be drawn: %v", img.RGBAAt(0, 0))
+	}
+	if frame.RGBAAt(0, 0) != (color.RGBA{}) {
+		t.Errorf("frame must not be modified: %v", frame.RGBAAt(0, 0))
+	}
+}
+
+func TestRenderJPEG(t *testing.T) {
+	content, err := ioutil.ReadFile("testdata/frame.jpg")
+	if err != nil {
+		t.Fatalf("unable to read frame: %v", err)
+	}
+	result, err := RenderJPEG(content, &Overlay{Steering: &events.SteeringMessage{Steering: 0.5}})
+	if err != nil {
+		t.Fatalf("unable to render frame: %v", err)
+	}
+	img, err := jpeg.Decode(bytes.NewReader(result))
+	if err != nil {
+		t.Fatalf("invalid jpeg result: %v", err)
+	}
+	if img.Bounds() != loadFrame(t).Bounds() {
+		t.Errorf("bad image size: %v", img.Bounds())
+	}
+
+	if _, err := RenderJPEG([]byte("invalid"), nil); err == nil {
+		t.Errorf("invalid frame must return an error")
+	}
+}
+
+func TestTextSize(t *testing.T) {
+	if s := TextSize("", 1); s != (image.Point{}) {
+		t.Errorf("bad size for empty text: %v", s)
+	}
+	if s := TextSize("ab", 2); s != (image.Point{X: 22, Y: 14}) {
+		t.Errorf("bad text size: %v", s)
+	}
+}
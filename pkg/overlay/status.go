@@ -0,0 +1,81 @@
+package overlay
+
+import (
+	"github.com/cyrilix/robocar-protobuf/go/events"
+	"image"
+	"image/color"
+)
+
+var (
+	userModeColor    = color.RGBA{R: 0, G: 200, B: 0, A: 255}
+	pilotModeColor   = pilotColor
+	unknownModeColor = color.RGBA{R: 160, G: 160, B: 160, A: 255}
+
+	statusBarBackground = color.RGBA{R: 0, G: 0, B: 0, A: 160}
+	statusBarTextColor  = color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	alertBackground     = color.RGBA{R: 220, G: 0, B: 0, A: 255}
+)
+
+const (
+	driveModeThickness = 3
+	// statusItemPadding is the space around status items text
+	statusItemPadding = 2
+)
+
+// StatusItem is a short text of status bar, alert items are highlighted
+type StatusItem struct {
+	Text  string
+	Alert bool
+}
+
+func driveModeColor(mode events.DriveMode) color.RGBA {
+	switch mode {
+	case events.DriveMode_USER:
+		return userModeColor
+	case events.DriveMode_PILOT:
+		return pilotModeColor
+	default:
+		return unknownModeColor
+	}
+}
+
+// layoutStatusBar returns rectangle of each item, items are wrapped on several rows when too wide for image
+func layoutStatusBar(img *image.RGBA, items []StatusItem) []image.Rectangle {
+	b := img.Bounds()
+	rowHeight := glyphHeight + 2*statusItemPadding
+	rects := make([]image.Rectangle, 0, len(items))
+	x, y := b.Min.X, b.Min.Y
+	for _, item := range items {
+		w := TextSize(item.Text, 1).X + 2*statusItemPadding
+		if x > b.Min.X && x+w > b.Max.X {
+			x, y = b.Min.X, y+rowHeight
+		}
+		rects = append(rects, image.Rect(x, y, x+w, y+rowHeight))
+		x += w + statusItemPadding
+	}
+	return rects
+}
+
+// statusBarHeight is the height used by status bar at the top of image
+func statusBarHeight(img *image.RGBA, items []StatusItem) int {
+	rects := layoutStatusBar(img, items)
+	if len(rects) == 0 {
+		return 0
+	}
+	return rects[len(rects)-1].Max.Y - img.Bounds().Min.Y
+}
+
+func drawStatusBar(img *image.RGBA, items []StatusItem) {
+	h := statusBarHeight(img, items)
+	if h == 0 {
+		return
+	}
+	b := img.Bounds()
+	fillRect(img, image.Rect(b.Min.X, b.Min.Y, b.Max.X, b.Min.Y+h), statusBarBackground)
+	for i, r := range layoutStatusBar(img, items) {
+		if items[i].Alert {
+			fillRect(img, r, alertBackground)
+		}
+		DrawText(img, items[i].Text, image.Point{X: r.Min.X + statusItemPadding, Y: r.Max.Y - statusItemPadding}, statusBarTextColor, 1)
+	}
+}
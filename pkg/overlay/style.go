@@ -0,0 +1,113 @@
+package overlay
+
+import (
+	"encoding/hex"
+	"fmt"
+	"github.com/cyrilix/robocar-protobuf/go/events"
+	"image/color"
+	"sort"
+	"strings"
+)
+
+// Style configures how objects and road are drawn
+type Style struct {
+	// ObjectColors gives box color for each object type, objectColor is used for types without color
+	ObjectColors    map[events.TypeObject]color.RGBA
+	ObjectThickness int
+	// ObjectLabels writes object type and confidence over boxes
+	ObjectLabels bool
+	// MinConfidence hides objects with a lower confidence
+	MinConfidence float64
+
+	RoadColor color.RGBA
+	// Ellipse draws road ellipse with heading arrow
+	Ellipse      bool
+	EllipseColor color.RGBA
+}
+
+// DefaultStyle is used to render overlays without style
+func DefaultStyle() *Style {
+	return &Style{
+		ObjectColors: map[events.TypeObject]color.RGBA{
+			events.TypeObject_ANY:  objectColor,
+			events.TypeObject_CAR:  {R: 255, G: 0, B: 255, A: 255},
+			events.TypeObject_BUMP: {R: 255, G: 140, B: 0, A: 255},
+			events.TypeObject_PLOT: {R: 0, G: 128, B: 255, A: 255},
+		},
+		ObjectThickness: 2,
+		ObjectLabels:    true,
+		MinConfidence:   0.,
+		RoadColor:       roadColor,
+		Ellipse:         true,
+		EllipseColor:    color.RGBA{R: 255, G: 255, B: 255, A: 255},
+	}
+}
+
+func (s *Style) objectColor(t events.TypeObject) color.RGBA {
+	if c, ok := s.ObjectColors[t]; ok {
+		return c
+	}
+	return objectColor
+}
+
+// objectLabel is the text written over an object box, like "car 0.87"
+func objectLabel(obj *events.Object) string {
+	return fmt.Sprintf("%s %.2f", strings.ToLower(obj.GetType().String()), obj.GetConfidence())
+}
+
+// ParseColor parses a color written as #rrggbb or #rrggbbaa, color is opaque without alpha
+func ParseColor(s string) (color.RGBA, error) {
+	b, err := hex.DecodeString(strings.TrimPrefix(s, "#"))
+	if err != nil || !strings.HasPrefix(s, "#") || (len(b) != 3 && len(b) != 4) {
+		return color.RGBA{}, fmt.Errorf("invalid color %#v, expected #rrggbb or #rrggbbaa", s)
+	}
+	c := color.RGBA{R: b[0], G: b[1], B: b[2], A: 255}
+	if len(b) == 4 {
+		c.A = b[3]
+	}
+	return c, nil
+}
+
+// FormatColor writes c as #rrggbb, or #rrggbbaa if c isn't opaque
+func FormatColor(c color.RGBA) string {
+	if c.A == 255 {
+		return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+	}
+	return fmt.Sprintf("#%02x%02x%02x%02x", c.R, c.G, c.B, c.A)
+}
+
+// ParseObjectColors parses colors of object types written as a comma separated list of type=color, like
+// "car=#ff00ff,bump=#ff8c00"
+func ParseObjectColors(s string) (map[events.TypeObject]color.RGBA, error) {
+	colors := make(map[events.TypeObject]color.RGBA)
+	for _, item := range strings.Split(s, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(item), "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid object color %#v, expected type=color", item)
+		}
+		t, ok := events.TypeObject_value[strings.ToUpper(name)]
+		if !ok {
+			return nil, fmt.Errorf("invalid object type %#v", name)
+		}
+		c, err := ParseColor(value)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse color of %v: %w", name, err)
+		}
+		colors[events.TypeObject(t)] = c
+	}
+	return colors, nil
+}
+
+// FormatObjectColors writes colors as parsed by ParseObjectColors, sorted by object type
+func FormatObjectColors(colors map[events.TypeObject]color.RGBA) string {
+	types := make([]events.TypeObject, 0, len(colors))
+	for t := range colors {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	items := make([]string, 0, len(types))
+	for _, t := range types {
+		items = append(items, fmt.Sprintf("%s=%s", strings.ToLower(t.String()), FormatColor(colors[t])))
+	}
+	return strings.Join(items, ",")
+}
@@ -0,0 +1,58 @@
+package overlay
+
+import (
+	"github.com/cyrilix/robocar-protobuf/go/events"
+	"image/color"
+	"reflect"
+	"testing"
+)
+
+func TestParseColor(t *testing.T) {
+	cases := []struct {
+		value   string
+		want    color.RGBA
+		wantErr bool
+	}{
+		{"#ff8c00", color.RGBA{R: 255, G: 140, A: 255}, false},
+		{"#0000ff80", color.RGBA{B: 255, A: 128}, false},
+		{"ff8c00", color.RGBA{}, true},
+		{"#ff8c", color.RGBA{}, true},
+		{"#zz8c00", color.RGBA{}, true},
+	}
+	for _, c := range cases {
+		got, err := ParseColor(c.value)
+		if (err != nil) != c.wantErr {
+			t.Errorf("ParseColor(%#v) error = %v, wantErr %v", c.value, err, c.wantErr)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("ParseColor(%#v) = %v, want %v", c.value, got, c.want)
+		}
+		if !c.wantErr && FormatColor(got) != c.value {
+			t.Errorf("FormatColor(%v) = %v, want %v", got, FormatColor(got), c.value)
+		}
+	}
+}
+
+func TestParseObjectColors(t *testing.T) {
+	got, err := ParseObjectColors("car=#ff0000, Bump=#00ff0080")
+	if err != nil {
+		t.Fatalf("unable to parse object colors: %v", err)
+	}
+	want := map[events.TypeObject]color.RGBA{
+		events.TypeObject_CAR:  {R: 255, A: 255},
+		events.TypeObject_BUMP: {G: 255, A: 128},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseObjectColors() = %v, want %v", got, want)
+	}
+	if s := FormatObjectColors(got); s != "car=#ff0000,bump=#00ff0080" {
+		t.Errorf("FormatObjectColors() = %v", s)
+	}
+
+	for _, value := range []string{"car", "truck=#ff0000", "car=red"} {
+		if _, err := ParseObjectColors(value); err == nil {
+			t.Errorf("ParseObjectColors(%#v) should fail", value)
+		}
+	}
+}
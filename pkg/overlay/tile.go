@@ -0,0 +1,62 @@
+package overlay
+
+import (
+	"image"
+	"image/draw"
+	"math"
+)
+
+// Tile is a frame of a tiled display, a nil image is drawn as an empty cell
+type Tile struct {
+	Label string
+	Image image.Image
+}
+
+// RenderTiles draws tiles on a grid of columns, columns are computed to build a square grid if columns isn't positive.
+// Cells have the size of the largest image, images are centered into their cell.
+func RenderTiles(tiles []Tile, columns int) *image.RGBA {
+	if len(tiles) == 0 {
+		return image.NewRGBA(image.Rect(0, 0, 0, 0))
+	}
+	if columns <= 0 {
+		columns = int(math.Ceil(math.Sqrt(float64(len(tiles)))))
+	}
+	if columns > len(tiles) {
+		columns = len(tiles)
+	}
+	rows := (len(tiles) + columns - 1) / columns
+
+	width, height := 0, 0
+	for _, t := range tiles {
+		if t.Image == nil {
+			continue
+		}
+		if t.Image.Bounds().Dx() > width {
+			width = t.Image.Bounds().Dx()
+		}
+		if t.Image.Bounds().Dy() > height {
+			height = t.Image.Bounds().Dy()
+		}
+	}
+	if width == 0 || height == 0 {
+		width, height = 160, 120
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width*columns, height*rows))
+	draw.Draw(img, img.Bounds(), image.Black, image.Point{}, draw.Src)
+	for i, t := range tiles {
+		cell := image.Rect(0, 0, width, height).Add(image.Pt(i%columns*width, i/columns*height))
+		if t.Image != nil {
+			b := t.Image.Bounds()
+			origin := cell.Min.Add(image.Pt((width-b.Dx())/2, (height-b.Dy())/2))
+			draw.Draw(img, image.Rectangle{Min: origin, Max: origin.Add(b.Size())}, t.Image, b.Min, draw.Src)
+		}
+		label := t.Label
+		if t.Image == nil {
+			label += " -"
+		}
+		DrawText(img, label, image.Pt(cell.Min.X+textMargin, cell.Max.Y-textMargin), statusColor, 1)
+		drawRect(img, cell, gaugeAxisColor, 1)
+	}
+	return img
+}
@@ -0,0 +1,28 @@
+package overlay
+
+import (
+	"image"
+	"testing"
+)
+
+func TestRenderTiles(t *testing.T) {
+	frame := loadFrame(t)
+	small := Render(frame, nil).SubImage(image.Rect(20, 10, 100, 70))
+
+	tiles := []Tile{
+		{Label: "front", Image: frame},
+		{Label: "rear", Image: small},
+		{Label: "left"},
+	}
+	img := RenderTiles(tiles, 0)
+	b := frame.Bounds()
+	if img.Bounds() != image.Rect(0, 0, 2*b.Dx(), 2*b.Dy()) {
+		t.Errorf("bad tiled image size: %v", img.Bounds())
+	}
+	checkGolden(t, "tiles", img)
+
+	img = RenderTiles(tiles, 5)
+	if img.Bounds() != image.Rect(0, 0, 3*b.Dx(), b.Dy()) {
+		t.Errorf("bad tiled image size with columns: %v", img.Bounds())
+	}
+}
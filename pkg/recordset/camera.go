@@ -0,0 +1,137 @@
+package recordset
+
+import (
+	"fmt"
+	"github.com/cyrilix/robocar-tools/record"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Cameras lists cameras of record set dir, main camera first then other cameras by name
+func Cameras(dir string) ([]string, error) {
+	items, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list record set directory %v: %w", dir, err)
+	}
+	cameras := make([]string, 0)
+	others := make([]string, 0)
+	prefix := record.CamSubDir(record.MainCamera) + "-"
+	for _, item := range items {
+		switch {
+		case !item.IsDir():
+		case item.Name() == record.CamSubDir(record.MainCamera):
+			cameras = append(cameras, record.MainCamera)
+		case strings.HasPrefix(item.Name(), prefix):
+			others = append(others, strings.TrimPrefix(item.Name(), prefix))
+		}
+	}
+	sort.Strings(others)
+	return append(cameras, others...), nil
+}
+
+// CameraImages are images of a camera ordered by frame index
+type CameraImages struct {
+	Camera  string
+	indexes []int64
+	paths   []string
+}
+
+// OpenCamera lists images of camera into record set dir, frame indexes must be numeric
+func OpenCamera(dir, camera string) (*CameraImages, error) {
+	entries, err := cameraEntries(dir, camera)
+	if err != nil {
+		return nil, err
+	}
+
+	c := CameraImages{Camera: camera, indexes: make([]int64, 0, len(entries)), paths: make([]string, 0, len(entries))}
+	for _, e := range entries {
+		idx, err := strconv.ParseInt(e.Index, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("frame index '%v' of camera %v is not numeric: %w", e.Index, camera, err)
+		}
+		c.indexes = append(c.indexes, idx)
+		c.paths = append(c.paths, e.ImagePath)
+	}
+	return &c, nil
+}
+
+// cameraEntries lists images of camera into record set dir ordered by index, entries have no record
+func cameraEntries(dir, camera string) ([]Entry, error) {
+	imgDir := path.Join(dir, record.CamSubDir(camera))
+	imgs, err := ioutil.ReadDir(imgDir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list images of camera %v in directory %v: %w", camera, imgDir, err)
+	}
+
+	entries := make([]Entry, 0, len(imgs))
+	for _, img := range imgs {
+		if img.IsDir() {
+			continue
+		}
+		idx, err := indexFromFile(img.Name())
+		if err != nil {
+			return nil, fmt.Errorf("unable to find index in cam image name %v: %w", img.Name(), err)
+		}
+		entries = append(entries, Entry{Index: idx, ImagePath: path.Join(imgDir, img.Name())})
+	}
+	sortEntries(entries)
+	return entries, nil
+}
+
+// otherCameraImages lists images of cameras other than main camera whose frame index is selected, by camera. These
+// images aren't referenced by records.
+func otherCameraImages(dir string, selected func(index string) bool) (map[string][]Entry, error) {
+	cameras, err := Cameras(dir)
+	if err != nil {
+		return nil, err
+	}
+	images := make(map[string][]Entry)
+	for _, camera := range cameras {
+		if camera == record.MainCamera {
+			continue
+		}
+		entries, err := cameraEntries(dir, camera)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if selected(e.Index) {
+				images[camera] = append(images[camera], e)
+			}
+		}
+	}
+	return images, nil
+}
+
+// Nearest returns path of image with the nearest index of frame index, ok is false if there isn't any image with an
+// index distant of at most maxGap. Indexes of recorded frames are timestamps in milliseconds.
+func (c *CameraImages) Nearest(index string, maxGap int64) (imgPath string, ok bool) {
+	idx, err := strconv.ParseInt(index, 10, 64)
+	if err != nil || len(c.indexes) == 0 {
+		return "", false
+	}
+	i := sort.Search(len(c.indexes), func(i int) bool { return c.indexes[i] >= idx })
+	best := -1
+	for _, candidate := range []int{i - 1, i} {
+		if candidate < 0 || candidate >= len(c.indexes) {
+			continue
+		}
+		if best < 0 || gap(c.indexes[candidate], idx) < gap(c.indexes[best], idx) {
+			best = candidate
+		}
+	}
+	if gap(c.indexes[best], idx) > maxGap {
+		return "", false
+	}
+	return c.paths[best], true
+}
+
+func gap(a, b int64) int64 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
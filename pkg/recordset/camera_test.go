@@ -0,0 +1,74 @@
+package recordset
+
+import (
+	"github.com/cyrilix/robocar-tools/record"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func addCameraImages(t *testing.T, dir, camera string, indexes ...string) {
+	camDir := path.Join(dir, record.CamSubDir(camera))
+	if err := os.MkdirAll(camDir, os.FileMode(0755)); err != nil {
+		t.Fatalf("unable to make camera directory: %v", err)
+	}
+	for _, idx := range indexes {
+		if err := ioutil.WriteFile(path.Join(camDir, "cam-image_array_"+idx+".jpg"), []byte("jpeg"), os.FileMode(0644)); err != nil {
+			t.Fatalf("unable to write image: %v", err)
+		}
+	}
+}
+
+func TestCameras(t *testing.T) {
+	dir := t.TempDir()
+	addCameraImages(t, dir, "rear")
+	addCameraImages(t, dir, record.MainCamera)
+	addCameraImages(t, dir, "front")
+	if err := ioutil.WriteFile(path.Join(dir, "cam-notes"), []byte{}, os.FileMode(0644)); err != nil {
+		t.Fatalf("unable to write file: %v", err)
+	}
+
+	cameras, err := Cameras(dir)
+	if err != nil {
+		t.Fatalf("unable to list cameras: %v", err)
+	}
+	if !reflect.DeepEqual(cameras, []string{record.MainCamera, "front", "rear"}) {
+		t.Errorf("bad cameras: %v", cameras)
+	}
+}
+
+func TestCameraImages_Nearest(t *testing.T) {
+	dir := t.TempDir()
+	addCameraImages(t, dir, "rear", "1600000000095", "1600000000010", "1600000000150")
+
+	c, err := OpenCamera(dir, "rear")
+	if err != nil {
+		t.Fatalf("unable to open camera: %v", err)
+	}
+	cases := []struct {
+		index    string
+		expected string
+	}{
+		{"1600000000000", "1600000000010"},
+		{"1600000000060", "1600000000095"},
+		{"1600000000130", "1600000000150"},
+		{"1600000000201", ""},
+		{"abc", ""},
+	}
+	for _, cs := range cases {
+		p, ok := c.Nearest(cs.index, 50)
+		if ok != (cs.expected != "") {
+			t.Errorf("%v: bad match %v", cs.index, p)
+			continue
+		}
+		if ok && p != path.Join(dir, "cam-rear", "cam-image_array_"+cs.expected+".jpg") {
+			t.Errorf("%v: bad image %v, wants %v", cs.index, p, cs.expected)
+		}
+	}
+
+	if _, err := OpenCamera(dir, "front"); err == nil {
+		t.Errorf("unknown camera should fail")
+	}
+}
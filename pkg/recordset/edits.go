@@ -0,0 +1,217 @@
+package recordset
+
+import (
+	"encoding/json"
+	"fmt"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"os"
+	"path"
+)
+
+// EditsFileName is the name of sidecar file, into record set directory, where label corrections are saved. Records
+// and images are never modified by edits.
+const EditsFileName = "edits.json"
+
+type EditType string
+
+const (
+	// EditExclude removes frames from training data
+	EditExclude EditType = "exclude"
+	// EditInclude restores excluded frames
+	EditInclude EditType = "include"
+	// EditSteering overrides user steering of frames
+	EditSteering EditType = "steering"
+)
+
+// Edit changes frames from From to To indexes, bounds included. Steering edits set steering linearly interpolated from
+// Steering at From to ToSteering at To.
+type Edit struct {
+	Type       EditType `json:"type"`
+	From       string   `json:"from"`
+	To         string   `json:"to"`
+	Steering   float32  `json:"steering,omitempty"`
+	ToSteering float32  `json:"to_steering,omitempty"`
+}
+
+func (e Edit) String() string {
+	if e.Type == EditSteering {
+		return fmt.Sprintf("%v %v-%v %.2f..%.2f", e.Type, e.From, e.To, e.Steering, e.ToSteering)
+	}
+	return fmt.Sprintf("%v %v-%v", e.Type, e.From, e.To)
+}
+
+// Edits is the ordered list of edits of a record set, later edits override earlier ones
+type Edits struct {
+	file  string
+	Edits []Edit `json:"edits"`
+}
+
+// LoadEdits reads edits of record set dir, a record set without sidecar file has no edit
+func LoadEdits(dir string) (*Edits, error) {
+	e := Edits{file: path.Join(dir, EditsFileName), Edits: make([]Edit, 0)}
+	content, err := ioutil.ReadFile(e.file)
+	if os.IsNotExist(err) {
+		return &e, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read edits file %v: %w", e.file, err)
+	}
+	if err := json.Unmarshal(content, &e); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal edits file %v: %w", e.file, err)
+	}
+	return &e, nil
+}
+
+// Add appends edit, edits are only written to disk by Save
+func (e *Edits) Add(edit Edit) error {
+	switch edit.Type {
+	case EditExclude, EditInclude, EditSteering:
+	default:
+		return fmt.Errorf("invalid edit type '%v'", edit.Type)
+	}
+	if edit.From == "" || edit.To == "" {
+		return fmt.Errorf("edit bounds are required")
+	}
+	e.Edits = append(e.Edits, edit)
+	return nil
+}
+
+// Undo removes last edit, ok is false if there isn't any
+func (e *Edits) Undo() (edit Edit, ok bool) {
+	if len(e.Edits) == 0 {
+		return Edit{}, false
+	}
+	edit = e.Edits[len(e.Edits)-1]
+	e.Edits = e.Edits[:len(e.Edits)-1]
+	return edit, true
+}
+
+// Save writes edits to sidecar file, file is removed when there is no more edit
+func (e *Edits) Save() error {
+	if len(e.Edits) == 0 {
+		if err := os.Remove(e.file); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("unable to remove edits file %v: %w", e.file, err)
+		}
+		return nil
+	}
+	content, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to marshal edits: %w", err)
+	}
+	if err := ioutil.WriteFile(e.file, content, os.FileMode(0644)); err != nil {
+		return fmt.Errorf("unable to write edits file %v: %w", e.file, err)
+	}
+	return nil
+}
+
+// Corrections are labels changes of frames, by frame index
+type Corrections struct {
+	Excluded map[string]bool
+	Steering map[string]float32
+}
+
+// Apply computes corrections of frames ordered as indexes. Edits with a bound that isn't into indexes are ignored.
+func (e *Edits) Apply(indexes []string) *Corrections {
+	c := Corrections{Excluded: make(map[string]bool), Steering: make(map[string]float32)}
+	positions := make(map[string]int, len(indexes))
+	for i, idx := range indexes {
+		positions[idx] = i
+	}
+
+	for _, edit := range e.Edits {
+		from, okFrom := positions[edit.From]
+		to, okTo := positions[edit.To]
+		if !okFrom || !okTo {
+			zap.S().Warnf("ignore edit '%v', frame not found into record set", edit)
+			continue
+		}
+		fromSteering, toSteering := edit.Steering, edit.ToSteering
+		if from > to {
+			from, to = to, from
+			fromSteering, toSteering = toSteering, fromSteering
+		}
+		for i := from; i <= to; i++ {
+			idx := indexes[i]
+			switch edit.Type {
+			case EditExclude:
+				c.Excluded[idx] = true
+			case EditInclude:
+				delete(c.Excluded, idx)
+			case EditSteering:
+				ratio := float32(0)
+				if to > from {
+					ratio = float32(i-from) / float32(to-from)
+				}
+				c.Steering[idx] = fromSteering + ratio*(toSteering-fromSteering)
+			}
+		}
+	}
+	return &c
+}
+
+// rebaseEdits rewrites edits of frames ordered as indexes for a record set whose frames are ordered as all. Frames of
+// indexes that aren't into all are dropped and other frames of all aren't edited: edit ranges are split around them.
+func rebaseEdits(edits []Edit, indexes []string, all []string) []Edit {
+	positions := make(map[string]int, len(indexes))
+	for i, idx := range indexes {
+		positions[idx] = i
+	}
+
+	rebased := make([]Edit, 0, len(edits))
+	for _, edit := range edits {
+		from, okFrom := positions[edit.From]
+		to, okTo := positions[edit.To]
+		if !okFrom || !okTo {
+			zap.S().Warnf("drop edit '%v', frame not found into record set", edit)
+			continue
+		}
+		fromSteering, toSteering := edit.Steering, edit.ToSteering
+		if from > to {
+			from, to = to, from
+			fromSteering, toSteering = toSteering, fromSteering
+		}
+		steering := func(pos int) float32 {
+			if to == from {
+				return fromSteering
+			}
+			return fromSteering + float32(pos-from)/float32(to-from)*(toSteering-fromSteering)
+		}
+
+		// Runs of consecutive frames of all covered by edit
+		start, end := -1, -1
+		flush := func() {
+			if start < 0 {
+				return
+			}
+			r := Edit{Type: edit.Type, From: indexes[start], To: indexes[end]}
+			if edit.Type == EditSteering {
+				r.Steering, r.ToSteering = steering(start), steering(end)
+			}
+			rebased = append(rebased, r)
+			start, end = -1, -1
+		}
+		for _, idx := range all {
+			pos, ok := positions[idx]
+			if !ok || pos < from || pos > to {
+				flush()
+				continue
+			}
+			if start < 0 {
+				start = pos
+			}
+			end = pos
+		}
+		flush()
+	}
+	return rebased
+}
+
+// LoadCorrections reads edits of record set dir and applies them to frames ordered as indexes
+func LoadCorrections(dir string, indexes []string) (*Corrections, error) {
+	edits, err := LoadEdits(dir)
+	if err != nil {
+		return nil, err
+	}
+	return edits.Apply(indexes), nil
+}
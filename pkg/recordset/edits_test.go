@@ -0,0 +1,166 @@
+package recordset
+
+import (
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestEdits_Apply(t *testing.T) {
+	indexes := []string{"01", "02", "03", "04", "05", "06"}
+	edits := Edits{Edits: []Edit{
+		{Type: EditExclude, From: "02", To: "05"},
+		{Type: EditInclude, From: "04", To: "04"},
+		{Type: EditSteering, From: "06", To: "02", Steering: 1., ToSteering: -1.},
+		{Type: EditSteering, From: "03", To: "03", Steering: 0.5},
+		{Type: EditExclude, From: "01", To: "99"},
+	}}
+
+	c := edits.Apply(indexes)
+	if !reflect.DeepEqual(c.Excluded, map[string]bool{"02": true, "03": true, "05": true}) {
+		t.Errorf("bad excluded frames: %v", c.Excluded)
+	}
+	expected := map[string]float32{"02": -1., "03": 0.5, "04": 0., "05": 0.5, "06": 1.}
+	if !reflect.DeepEqual(c.Steering, expected) {
+		t.Errorf("bad steering: %v, wants %v", c.Steering, expected)
+	}
+}
+
+func TestEdits_SaveAndUndo(t *testing.T) {
+	dir := t.TempDir()
+	edits, err := LoadEdits(dir)
+	if err != nil {
+		t.Fatalf("unable to load edits: %v", err)
+	}
+	if len(edits.Edits) != 0 {
+		t.Errorf("no edit expected: %v", edits.Edits)
+	}
+	if err := edits.Add(Edit{Type: "delete", From: "01", To: "02"}); err == nil {
+		t.Errorf("invalid edit type should fail")
+	}
+	_ = edits.Add(Edit{Type: EditExclude, From: "01", To: "02"})
+	_ = edits.Add(Edit{Type: EditSteering, From: "03", To: "04", Steering: 0.2, ToSteering: 0.4})
+	if err := edits.Save(); err != nil {
+		t.Fatalf("unable to save edits: %v", err)
+	}
+
+	loaded, err := LoadEdits(dir)
+	if err != nil {
+		t.Fatalf("unable to load edits: %v", err)
+	}
+	if !reflect.DeepEqual(loaded.Edits, edits.Edits) {
+		t.Errorf("bad edits read: %v, wants %v", loaded.Edits, edits.Edits)
+	}
+
+	for _, expected := range []EditType{EditSteering, EditExclude} {
+		edit, ok := loaded.Undo()
+		if !ok || edit.Type != expected {
+			t.Errorf("bad undone edit: %v, wants %v", edit, expected)
+		}
+	}
+	if _, ok := loaded.Undo(); ok {
+		t.Errorf("no more edit expected")
+	}
+	if err := loaded.Save(); err != nil {
+		t.Fatalf("unable to save edits: %v", err)
+	}
+	if _, err := os.Stat(path.Join(dir, EditsFileName)); !os.IsNotExist(err) {
+		t.Errorf("edits file should be removed without edit: %v", err)
+	}
+}
+
+func TestRebaseEdits(t *testing.T) {
+	indexes := []string{"01", "03", "05", "07", "09"}
+	edits := []Edit{
+		{Type: EditExclude, From: "01", To: "05"},
+		{Type: EditSteering, From: "09", To: "01", Steering: 1., ToSteering: 0.},
+		{Type: EditExclude, From: "01", To: "99"},
+	}
+
+	// Frame 04 of another record set is merged between 03 and 05, frame 09 is removed
+	rebased := rebaseEdits(edits, indexes, []string{"01", "03", "04", "05", "07"})
+	expected := []Edit{
+		{Type: EditExclude, From: "01", To: "03"},
+		{Type: EditExclude, From: "05", To: "05"},
+		{Type: EditSteering, From: "01", To: "03", Steering: 0., ToSteering: 0.25},
+		{Type: EditSteering, From: "05", To: "07", Steering: 0.5, ToSteering: 0.75},
+	}
+	if !reflect.DeepEqual(rebased, expected) {
+		t.Errorf("bad rebased edits: %v, wants %v", rebased, expected)
+	}
+}
+
+func checkEdits(t *testing.T, dir string, expected ...Edit) {
+	edits, err := LoadEdits(dir)
+	if err != nil {
+		t.Fatalf("unable to load edits of %v: %v", dir, err)
+	}
+	if !reflect.DeepEqual(edits.Edits, expected) {
+		t.Errorf("%v: bad edits: %v, wants %v", dir, edits.Edits, expected)
+	}
+}
+
+func saveEdits(t *testing.T, dir string, edits ...Edit) {
+	e, err := LoadEdits(dir)
+	if err != nil {
+		t.Fatalf("unable to load edits of %v: %v", dir, err)
+	}
+	e.Edits = edits
+	if err := e.Save(); err != nil {
+		t.Fatalf("unable to save edits of %v: %v", dir, err)
+	}
+}
+
+func TestSplit_Edits(t *testing.T) {
+	src := copyTestRecordSet(t, "src")
+	saveEdits(t, src,
+		Edit{Type: EditExclude, From: "0000103", To: "0000106"},
+		Edit{Type: EditSteering, From: "0000101", To: "0000102", Steering: 0.5, ToSteering: 0.5},
+	)
+	dest := path.Join(path.Dir(src), "split")
+
+	if err := Split(src, 4, dest); err != nil {
+		t.Fatalf("unable to split record set: %v", err)
+	}
+	checkEdits(t, src,
+		Edit{Type: EditExclude, From: "0000103", To: "0000104"},
+		Edit{Type: EditSteering, From: "0000101", To: "0000102", Steering: 0.5, ToSteering: 0.5},
+	)
+	checkEdits(t, dest, Edit{Type: EditExclude, From: "0000105", To: "0000106"})
+}
+
+func TestMerge_Edits(t *testing.T) {
+	src := copyTestRecordSet(t, "src")
+	other := path.Join(path.Dir(src), "other")
+	if err := Split(src, 3, other); err != nil {
+		t.Fatalf("unable to split record set: %v", err)
+	}
+	saveEdits(t, src, Edit{Type: EditExclude, From: "0000101", To: "0000102"})
+	saveEdits(t, other, Edit{Type: EditExclude, From: "0000106", To: "0000105"})
+
+	dest := path.Join(path.Dir(src), "merged")
+	if err := Merge(dest, src); err != nil {
+		t.Fatalf("unable to merge record set: %v", err)
+	}
+	if err := Merge(dest, other); err != nil {
+		t.Fatalf("unable to merge record set: %v", err)
+	}
+	checkEdits(t, dest,
+		Edit{Type: EditExclude, From: "0000101", To: "0000102"},
+		Edit{Type: EditExclude, From: "0000105", To: "0000106"},
+	)
+
+	rs, err := Open(dest)
+	if err != nil {
+		t.Fatalf("unable to open merged record set: %v", err)
+	}
+	c, err := LoadCorrections(dest, rs.Indexes())
+	if err != nil {
+		t.Fatalf("unable to load corrections: %v", err)
+	}
+	expected := map[string]bool{"0000101": true, "0000102": true, "0000105": true, "0000106": true}
+	if !reflect.DeepEqual(c.Excluded, expected) {
+		t.Errorf("bad excluded frames of merged record set: %v, wants %v", c.Excluded, expected)
+	}
+}
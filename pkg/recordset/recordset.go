@@ -0,0 +1,509 @@
+package recordset
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/cyrilix/robocar-tools/record"
+	"go.uber.org/zap"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ImageFileNameFormat is the name of cam images written by recorder
+const ImageFileNameFormat = "cam-image_array_%s.jpg"
+
+var (
+	camSubDir      = record.CamSubDir(record.MainCamera)
+	camIndexRegexp = regexp.MustCompile("image_array_(?P<idx>[0-9]+)\\.jpg$")
+)
+
+// Entry is a frame of a record set with its json record
+type Entry struct {
+	Index      string
+	ImagePath  string
+	RecordPath string
+}
+
+// ImageName returns the name of the image file
+func (e *Entry) ImageName() string {
+	return path.Base(e.ImagePath)
+}
+
+// Record reads json record of entry
+func (e *Entry) Record() (*record.Record, error) {
+	content, err := ioutil.ReadFile(e.RecordPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read json content: %w", err)
+	}
+	var rcd record.Record
+	err = json.Unmarshal(content, &rcd)
+	if err != nil {
+		return nil, fmt.Errorf("unable to unmarshal record %v: %w", e.RecordPath, err)
+	}
+	return &rcd, nil
+}
+
+// Time returns the frame timestamp, frame ids are unix timestamps in milliseconds
+func (e *Entry) Time() (time.Time, error) {
+	ms, err := strconv.ParseInt(e.Index, 10, 64)
+	if err != nil || len(e.Index) < 13 {
+		return time.Time{}, fmt.Errorf("frame index '%v' is not a timestamp", e.Index)
+	}
+	return time.UnixMilli(ms), nil
+}
+
+// RecordSet is a directory of json records with their images into a cam subdirectory
+type RecordSet struct {
+	Dir     string
+	Entries []Entry
+}
+
+// Name returns the record set name
+func (r *RecordSet) Name() string {
+	return path.Base(r.Dir)
+}
+
+// Indexes returns frame indexes of entries
+func (r *RecordSet) Indexes() []string {
+	indexes := make([]string, 0, len(r.Entries))
+	for _, e := range r.Entries {
+		indexes = append(indexes, e.Index)
+	}
+	return indexes
+}
+
+// Open lists entries of the record set stored into dir, ordered by index
+func Open(dir string) (*RecordSet, error) {
+	imgDir := path.Join(dir, camSubDir)
+	imgs, err := ioutil.ReadDir(imgDir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list cam images in directory %v: %w", imgDir, err)
+	}
+
+	entries := make([]Entry, 0, len(imgs))
+	for _, img := range imgs {
+		if img.IsDir() {
+			continue
+		}
+		idx, err := indexFromFile(img.Name())
+		if err != nil {
+			return nil, fmt.Errorf("unable to find index in cam image name %v: %w", img.Name(), err)
+		}
+		entries = append(entries, Entry{
+			Index:      idx,
+			ImagePath:  path.Join(imgDir, img.Name()),
+			RecordPath: path.Join(dir, fmt.Sprintf(record.FileNameFormat, idx)),
+		})
+	}
+	sortEntries(entries)
+	return &RecordSet{Dir: dir, Entries: entries}, nil
+}
+
+// IndexAt returns the position of the first entry recorded at or after t
+func (r *RecordSet) IndexAt(t time.Time) (int, error) {
+	for i := range r.Entries {
+		ts, err := r.Entries[i].Time()
+		if err != nil {
+			return 0, err
+		}
+		if !ts.Before(t) {
+			return i, nil
+		}
+	}
+	return len(r.Entries), nil
+}
+
+func indexFromFile(fileName string) (string, error) {
+	match := camIndexRegexp.FindStringSubmatch(fileName)
+	if match == nil {
+		return "", fmt.Errorf("no index in filename")
+	}
+	return match[camIndexRegexp.SubexpIndex("idx")], nil
+}
+
+// Merge copies entries of sources record sets into dest record set, dest is created if missing
+func Merge(dest string, sources ...string) error {
+	l := zap.S()
+	destSet, err := openExisting(dest)
+	if err != nil {
+		return err
+	}
+	existing := make(map[string]string)
+	for _, e := range destSet.Entries {
+		existing[e.ImageName()] = e.ImagePath
+	}
+	destEdits, err := LoadEdits(dest)
+	if err != nil {
+		return err
+	}
+
+	recordSets := make([]*RecordSet, 0, len(sources))
+	sourceEdits := make([]*Edits, 0, len(sources))
+	cameraImages := make([]map[string][]Entry, 0, len(sources))
+	for _, src := range sources {
+		rs, err := Open(src)
+		if err != nil {
+			return fmt.Errorf("unable to open record set %v: %w", src, err)
+		}
+		recordSets = append(recordSets, rs)
+		edits, err := LoadEdits(src)
+		if err != nil {
+			return err
+		}
+		sourceEdits = append(sourceEdits, edits)
+		for _, e := range rs.Entries {
+			if other, ok := existing[e.ImageName()]; ok {
+				return fmt.Errorf("image %v conflicts with %v into %v", e.ImagePath, other, dest)
+			}
+			existing[e.ImageName()] = e.ImagePath
+		}
+
+		images, err := otherCameraImages(src, func(string) bool { return true })
+		if err != nil {
+			return fmt.Errorf("unable to list images of other cameras of %v: %w", src, err)
+		}
+		cameraImages = append(cameraImages, images)
+		for camera, entries := range images {
+			for _, e := range entries {
+				name := path.Join(record.CamSubDir(camera), e.ImageName())
+				if other, ok := existing[name]; ok {
+					return fmt.Errorf("image %v conflicts with %v into %v", e.ImagePath, other, dest)
+				}
+				if _, err := os.Stat(path.Join(dest, name)); err == nil {
+					return fmt.Errorf("image %v conflicts with %v into %v", e.ImagePath, name, dest)
+				}
+				existing[name] = e.ImagePath
+			}
+		}
+	}
+
+	for n, rs := range recordSets {
+		l.Infof("merge %d records from %v into %v", len(rs.Entries), rs.Dir, dest)
+		for i := range rs.Entries {
+			if err := copyEntry(&rs.Entries[i], dest); err != nil {
+				return fmt.Errorf("unable to merge %v: %w", rs.Dir, err)
+			}
+		}
+		if err := transferCameraImages(cameraImages[n], dest, copyFile); err != nil {
+			return fmt.Errorf("unable to merge %v: %w", rs.Dir, err)
+		}
+	}
+
+	// Edits of each record set are kept for its frames, whatever the frames of other record sets
+	merged, err := Open(dest)
+	if err != nil {
+		return fmt.Errorf("unable to open record set %v: %w", dest, err)
+	}
+	all := merged.Indexes()
+	edits := rebaseEdits(destEdits.Edits, destSet.Indexes(), all)
+	for n, rs := range recordSets {
+		edits = append(edits, rebaseEdits(sourceEdits[n].Edits, rs.Indexes(), all)...)
+	}
+	destEdits.Edits = edits
+	if err := destEdits.Save(); err != nil {
+		return fmt.Errorf("unable to merge edits: %w", err)
+	}
+	return nil
+}
+
+// transferCameraImages copies or moves images of other cameras into dest record set
+func transferCameraImages(images map[string][]Entry, dest string, transfer func(src, dest string) error) error {
+	for camera, entries := range images {
+		camDir := path.Join(dest, record.CamSubDir(camera))
+		if err := os.MkdirAll(camDir, os.FileMode(0755)); err != nil {
+			return fmt.Errorf("unable to make dest directories %v: %w", camDir, err)
+		}
+		for _, e := range entries {
+			if err := transfer(e.ImagePath, path.Join(camDir, e.ImageName())); err != nil {
+				return fmt.Errorf("unable to transfer image %v of camera %v: %w", e.ImagePath, camera, err)
+			}
+		}
+	}
+	return nil
+}
+
+// openExisting opens record set dir, an absent record set has no entry
+func openExisting(dir string) (*RecordSet, error) {
+	if _, err := os.Stat(path.Join(dir, camSubDir)); os.IsNotExist(err) {
+		return &RecordSet{Dir: dir, Entries: make([]Entry, 0)}, nil
+	}
+	rs, err := Open(dir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open record set %v: %w", dir, err)
+	}
+	return rs, nil
+}
+
+// Split moves entries from position at to the end of record set into a new dest record set
+func Split(dir string, at int, dest string) error {
+	rs, err := Open(dir)
+	if err != nil {
+		return fmt.Errorf("unable to open record set %v: %w", dir, err)
+	}
+	if at <= 0 || at >= len(rs.Entries) {
+		return fmt.Errorf("invalid split position %d, record set %v has %d records", at, dir, len(rs.Entries))
+	}
+	if _, err := os.Stat(dest); err == nil {
+		return fmt.Errorf("destination record set %v already exists", dest)
+	}
+
+	edits, err := LoadEdits(dir)
+	if err != nil {
+		return err
+	}
+
+	// Images of other cameras are split by frame index, they may not have the same indexes as records
+	first := rs.Entries[at].Index
+	images, err := otherCameraImages(dir, func(index string) bool { return compareIndexes(index, first) >= 0 })
+	if err != nil {
+		return fmt.Errorf("unable to list images of other cameras of %v: %w", dir, err)
+	}
+
+	zap.S().Infof("move %d records from %v to %v", len(rs.Entries)-at, dir, dest)
+	for i := at; i < len(rs.Entries); i++ {
+		if err := moveEntry(&rs.Entries[i], dest); err != nil {
+			return fmt.Errorf("unable to split %v: %w", dir, err)
+		}
+	}
+	if err := transferCameraImages(images, dest, os.Rename); err != nil {
+		return fmt.Errorf("unable to split %v: %w", dir, err)
+	}
+
+	indexes := rs.Indexes()
+	destEdits := Edits{file: path.Join(dest, EditsFileName), Edits: rebaseEdits(edits.Edits, indexes, indexes[at:])}
+	if err := destEdits.Save(); err != nil {
+		return fmt.Errorf("unable to split edits: %w", err)
+	}
+	edits.Edits = rebaseEdits(edits.Edits, indexes, indexes[:at])
+	if err := edits.Save(); err != nil {
+		return fmt.Errorf("unable to split edits: %w", err)
+	}
+	return nil
+}
+
+// SplitAtTime moves entries recorded at or after t into a new dest record set
+func SplitAtTime(dir string, t time.Time, dest string) error {
+	rs, err := Open(dir)
+	if err != nil {
+		return fmt.Errorf("unable to open record set %v: %w", dir, err)
+	}
+	at, err := rs.IndexAt(t)
+	if err != nil {
+		return fmt.Errorf("unable to find records at %v: %w", t, err)
+	}
+	return Split(dir, at, dest)
+}
+
+// Trim removes head first entries and tail last entries of record set
+func Trim(dir string, head, tail int) error {
+	rs, err := Open(dir)
+	if err != nil {
+		return fmt.Errorf("unable to open record set %v: %w", dir, err)
+	}
+	if head < 0 || tail < 0 || head+tail > len(rs.Entries) {
+		return fmt.Errorf("unable to trim %d+%d records, record set %v has %d records", head, tail, dir, len(rs.Entries))
+	}
+
+	edits, err := LoadEdits(dir)
+	if err != nil {
+		return err
+	}
+
+	// Images of other cameras recorded before first or after last kept record are removed too
+	kept := rs.Entries[head : len(rs.Entries)-tail]
+	images, err := otherCameraImages(dir, func(index string) bool {
+		if len(kept) == 0 {
+			return true
+		}
+		return head > 0 && compareIndexes(index, kept[0].Index) < 0 ||
+			tail > 0 && compareIndexes(index, kept[len(kept)-1].Index) > 0
+	})
+	if err != nil {
+		return fmt.Errorf("unable to list images of other cameras of %v: %w", dir, err)
+	}
+
+	zap.S().Infof("remove %d first and %d last records from %v", head, tail, dir)
+	removed := append(rs.Entries[:head:head], rs.Entries[len(rs.Entries)-tail:]...)
+	for _, e := range removed {
+		if err := removeEntry(&e); err != nil {
+			return fmt.Errorf("unable to trim %v: %w", dir, err)
+		}
+	}
+	for camera, entries := range images {
+		for _, e := range entries {
+			if err := os.Remove(e.ImagePath); err != nil {
+				return fmt.Errorf("unable to trim image %v of camera %v: %w", e.ImagePath, camera, err)
+			}
+		}
+	}
+
+	indexes := rs.Indexes()
+	edits.Edits = rebaseEdits(edits.Edits, indexes, indexes[head:len(indexes)-tail])
+	if err := edits.Save(); err != nil {
+		return fmt.Errorf("unable to trim edits: %w", err)
+	}
+	return nil
+}
+
+// Rename renames record set directory to newName and updates image references of records
+func Rename(dir, newName string) error {
+	if newName == "" || path.Base(newName) != newName {
+		return fmt.Errorf("invalid record set name '%v'", newName)
+	}
+	dest := path.Join(path.Dir(dir), newName)
+	if _, err := os.Stat(dest); err == nil {
+		return fmt.Errorf("record set %v already exists", dest)
+	}
+
+	// Records are updated before rename to keep record set under its old name on error
+	rs, err := Open(dir)
+	if err != nil {
+		return fmt.Errorf("unable to open record set %v: %w", dir, err)
+	}
+	for i := range rs.Entries {
+		if err := writeRecord(&rs.Entries[i], rs.Entries[i].RecordPath); err != nil {
+			return fmt.Errorf("unable to update records of %v: %w", dir, err)
+		}
+	}
+
+	err = os.Rename(dir, dest)
+	if err != nil {
+		return fmt.Errorf("unable to rename %v to %v: %w", dir, dest, err)
+	}
+	return nil
+}
+
+// AddEntry writes a jpeg image and its json record into record set dir with the recorder naming convention
+func AddEntry(dir, index string, jpegContent []byte, rcd *record.Record) (*Entry, error) {
+	camDir := path.Join(dir, camSubDir)
+	err := os.MkdirAll(camDir, os.FileMode(0755))
+	if err != nil {
+		return nil, fmt.Errorf("unable to make dest directories %v: %w", camDir, err)
+	}
+	e := Entry{
+		Index:      index,
+		ImagePath:  path.Join(camDir, fmt.Sprintf(ImageFileNameFormat, index)),
+		RecordPath: path.Join(dir, fmt.Sprintf(record.FileNameFormat, index)),
+	}
+	err = ioutil.WriteFile(e.ImagePath, jpegContent, os.FileMode(0755))
+	if err != nil {
+		return nil, fmt.Errorf("unable to write img file %v: %w", e.ImagePath, err)
+	}
+
+	r := *rcd
+	r.CamImageArray = path.Join(camSubDir, e.ImageName())
+	recordBytes, err := json.Marshal(&r)
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal %v record: %w", r, err)
+	}
+	err = ioutil.WriteFile(e.RecordPath, recordBytes, os.FileMode(0755))
+	if err != nil {
+		return nil, fmt.Errorf("unable to write json record %v: %w", e.RecordPath, err)
+	}
+	return &e, nil
+}
+
+func copyEntry(e *Entry, dest string) error {
+	camDir := path.Join(dest, camSubDir)
+	err := os.MkdirAll(camDir, os.FileMode(0755))
+	if err != nil {
+		return fmt.Errorf("unable to make dest directories %v: %w", camDir, err)
+	}
+	err = copyFile(e.ImagePath, path.Join(camDir, e.ImageName()))
+	if err != nil {
+		return err
+	}
+	return writeRecord(e, path.Join(dest, path.Base(e.RecordPath)))
+}
+
+func moveEntry(e *Entry, dest string) error {
+	camDir := path.Join(dest, camSubDir)
+	err := os.MkdirAll(camDir, os.FileMode(0755))
+	if err != nil {
+		return fmt.Errorf("unable to make dest directories %v: %w", camDir, err)
+	}
+	err = os.Rename(e.ImagePath, path.Join(camDir, e.ImageName()))
+	if err != nil {
+		return fmt.Errorf("unable to move image %v: %w", e.ImagePath, err)
+	}
+	err = writeRecord(e, path.Join(dest, path.Base(e.RecordPath)))
+	if err != nil {
+		return err
+	}
+	return os.Remove(e.RecordPath)
+}
+
+func removeEntry(e *Entry) error {
+	if err := os.Remove(e.ImagePath); err != nil {
+		return fmt.Errorf("unable to remove image: %w", err)
+	}
+	if err := os.Remove(e.RecordPath); err != nil {
+		return fmt.Errorf("unable to remove record: %w", err)
+	}
+	return nil
+}
+
+// writeRecord writes json record of entry to recordFile with an image reference relative to its record set
+func writeRecord(e *Entry, recordFile string) error {
+	rcd, err := e.Record()
+	if err != nil {
+		return err
+	}
+	rcd.CamImageArray = path.Join(camSubDir, e.ImageName())
+
+	recordBytes, err := json.Marshal(rcd)
+	if err != nil {
+		return fmt.Errorf("unable to marshal %v record: %w", rcd, err)
+	}
+	err = ioutil.WriteFile(recordFile, recordBytes, os.FileMode(0755))
+	if err != nil {
+		return fmt.Errorf("unable to write json record %v: %w", recordFile, err)
+	}
+	return nil
+}
+
+func copyFile(src, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("unable to read %v: %w", src, err)
+	}
+	defer in.Close()
+
+	out, err := os.Create(dest)
+	if err != nil {
+		return fmt.Errorf("unable to create %v: %w", dest, err)
+	}
+	_, err = io.Copy(out, in)
+	if errClose := out.Close(); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		return fmt.Errorf("unable to copy %v to %v: %w", src, dest, err)
+	}
+	return nil
+}
+
+// sortEntries orders entries by numeric index, ids may not have the same length
+func sortEntries(entries []Entry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		return compareIndexes(entries[i].Index, entries[j].Index) < 0
+	})
+}
+
+// compareIndexes compares numeric frame indexes a and b, ids may not have the same length
+func compareIndexes(a, b string) int {
+	if len(a) != len(b) {
+		if len(a) < len(b) {
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(a, b)
+}
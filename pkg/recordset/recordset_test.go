@@ -0,0 +1,258 @@
+package recordset
+
+import (
+	"github.com/cyrilix/robocar-tools/pkg/testutil"
+	"github.com/cyrilix/robocar-tools/record"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// testRecordSet is shared with data package tests
+const testRecordSet = "../data/testdata/2020021819-4"
+
+func copyTestRecordSet(t *testing.T, name string) string {
+	dest := path.Join(t.TempDir(), name)
+	testutil.CopyDir(t, testRecordSet, dest)
+
+	// Fix image references of testdata records, written with an absolute path
+	rs, err := Open(dest)
+	if err != nil {
+		t.Fatalf("unable to open test record set: %v", err)
+	}
+	for i := range rs.Entries {
+		if err := writeRecord(&rs.Entries[i], rs.Entries[i].RecordPath); err != nil {
+			t.Fatalf("unable to fix test record: %v", err)
+		}
+	}
+	return dest
+}
+
+func checkRecordSet(t *testing.T, dir string, expectedIndexes ...string) {
+	rs, err := Open(dir)
+	if err != nil {
+		t.Fatalf("unable to open record set %v: %v", dir, err)
+	}
+	if len(rs.Entries) != len(expectedIndexes) {
+		t.Fatalf("%v: bad number of entries: %v, wants %v", dir, len(rs.Entries), len(expectedIndexes))
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("unable to list %v: %v", dir, err)
+	}
+	records := 0
+	for _, f := range files {
+		if !f.IsDir() && f.Name() != EditsFileName {
+			records++
+		}
+	}
+	if records != len(expectedIndexes) {
+		t.Errorf("%v: bad number of records: %v, wants %v", dir, records, len(expectedIndexes))
+	}
+
+	for i, e := range rs.Entries {
+		if e.Index != expectedIndexes[i] {
+			t.Errorf("%v: bad index for entry %d: %v, wants %v", dir, i, e.Index, expectedIndexes[i])
+		}
+		rcd, err := e.Record()
+		if err != nil {
+			t.Errorf("%v: unable to read record %v: %v", dir, e.RecordPath, err)
+			continue
+		}
+		if rcd.UserAngle == 0. {
+			t.Errorf("%v: user angle has not been initialised for %v", dir, e.RecordPath)
+		}
+		if _, err := os.Stat(path.Join(dir, rcd.CamImageArray)); err != nil {
+			t.Errorf("%v: bad image reference %v for record %v: %v", dir, rcd.CamImageArray, e.RecordPath, err)
+		}
+	}
+}
+
+func TestOpen(t *testing.T) {
+	rs, err := Open(testRecordSet)
+	if err != nil {
+		t.Fatalf("unable to open record set: %v", err)
+	}
+	if rs.Name() != "2020021819-4" {
+		t.Errorf("bad name: %v, wants %v", rs.Name(), "2020021819-4")
+	}
+	if len(rs.Entries) != 6 {
+		t.Fatalf("bad number of entries: %v, wants %v", len(rs.Entries), 6)
+	}
+	e := rs.Entries[0]
+	if e.Index != "0000101" {
+		t.Errorf("bad index: %v, wants %v", e.Index, "0000101")
+	}
+	if e.RecordPath != path.Join(testRecordSet, "record_0000101.json") {
+		t.Errorf("bad record path: %v", e.RecordPath)
+	}
+	if e.ImagePath != path.Join(testRecordSet, "cam", "cam-image_array_0000101.jpg") {
+		t.Errorf("bad image path: %v", e.ImagePath)
+	}
+}
+
+func TestAddEntry(t *testing.T) {
+	src := copyTestRecordSet(t, "src")
+	dest := path.Join(path.Dir(src), "new")
+
+	img, err := ioutil.ReadFile(path.Join(src, "cam", "cam-image_array_0000101.jpg"))
+	if err != nil {
+		t.Fatalf("unable to read test image: %v", err)
+	}
+	e, err := AddEntry(dest, "1581992400123", img, &record.Record{UserAngle: 0.5})
+	if err != nil {
+		t.Fatalf("unable to add entry: %v", err)
+	}
+	if e.ImagePath != path.Join(dest, "cam", "cam-image_array_1581992400123.jpg") {
+		t.Errorf("bad image path: %v", e.ImagePath)
+	}
+	checkRecordSet(t, dest, "1581992400123")
+
+	ts, err := e.Time()
+	if err != nil {
+		t.Errorf("unable to read entry timestamp: %v", err)
+	}
+	if ts.UnixMilli() != 1581992400123 {
+		t.Errorf("bad timestamp: %v", ts.UnixMilli())
+	}
+}
+
+func TestMerge(t *testing.T) {
+	src := copyTestRecordSet(t, "src")
+	dest := path.Join(path.Dir(src), "merged")
+
+	if err := Merge(dest, src); err != nil {
+		t.Fatalf("unable to merge record sets: %v", err)
+	}
+	checkRecordSet(t, dest, "0000101", "0000102", "0000103", "0000104", "0000105", "0000106")
+
+	if err := Merge(dest, src); err == nil {
+		t.Errorf("merge of conflicting images must fail")
+	}
+}
+
+func TestSplit(t *testing.T) {
+	src := copyTestRecordSet(t, "src")
+	dest := path.Join(path.Dir(src), "split")
+
+	if err := Split(src, 4, dest); err != nil {
+		t.Fatalf("unable to split record set: %v", err)
+	}
+	checkRecordSet(t, src, "0000101", "0000102", "0000103", "0000104")
+	checkRecordSet(t, dest, "0000105", "0000106")
+
+	if err := Split(src, 4, path.Join(path.Dir(src), "empty")); err == nil {
+		t.Errorf("split at the end of record set must fail")
+	}
+}
+
+func TestSplitAtTime(t *testing.T) {
+	src := copyTestRecordSet(t, "src")
+	if err := SplitAtTime(src, time.Now(), path.Join(path.Dir(src), "split")); err == nil {
+		t.Errorf("split at time must fail when frame ids aren't timestamps")
+	}
+
+	// Frame ids are timestamps in milliseconds, as for camera frames
+	timestamped := path.Join(t.TempDir(), "timestamped")
+	start := time.UnixMilli(1600000000000)
+	for i := 0; i < 5; i++ {
+		id := strconv.FormatInt(start.Add(time.Duration(i)*100*time.Millisecond).UnixMilli(), 10)
+		if _, err := AddEntry(timestamped, id, []byte("jpeg"), &record.Record{UserAngle: float32(i+1) / 10}); err != nil {
+			t.Fatalf("unable to write record: %v", err)
+		}
+	}
+	split := path.Join(path.Dir(timestamped), "split")
+	if err := SplitAtTime(timestamped, start.Add(250*time.Millisecond), split); err != nil {
+		t.Fatalf("unable to split record set at time: %v", err)
+	}
+	checkRecordSet(t, timestamped, "1600000000000", "1600000000100", "1600000000200")
+	checkRecordSet(t, split, "1600000000300", "1600000000400")
+}
+
+func TestTrim(t *testing.T) {
+	src := copyTestRecordSet(t, "src")
+
+	if err := Trim(src, 2, 1); err != nil {
+		t.Fatalf("unable to trim record set: %v", err)
+	}
+	checkRecordSet(t, src, "0000103", "0000104", "0000105")
+
+	if err := Trim(src, 2, 2); err == nil {
+		t.Errorf("trim of more records than available must fail")
+	}
+}
+
+func checkCameraImages(t *testing.T, dir, camera string, expectedIndexes ...string) {
+	entries, err := cameraEntries(dir, camera)
+	if err != nil {
+		t.Fatalf("unable to list images of camera %v: %v", camera, err)
+	}
+	indexes := make([]string, 0, len(entries))
+	for _, e := range entries {
+		indexes = append(indexes, e.Index)
+	}
+	if !reflect.DeepEqual(indexes, expectedIndexes) {
+		t.Errorf("%v: bad images of camera %v: %v, wants %v", dir, camera, indexes, expectedIndexes)
+	}
+}
+
+func TestOtherCameras(t *testing.T) {
+	src := copyTestRecordSet(t, "src")
+	addCameraImages(t, src, "rear", "0000100", "0000102", "0000104", "0000106", "0000107")
+
+	split := path.Join(path.Dir(src), "split")
+	if err := Split(src, 4, split); err != nil {
+		t.Fatalf("unable to split record set: %v", err)
+	}
+	checkCameraImages(t, src, "rear", "0000100", "0000102", "0000104")
+	checkCameraImages(t, split, "rear", "0000106", "0000107")
+
+	if err := Trim(src, 1, 1); err != nil {
+		t.Fatalf("unable to trim record set: %v", err)
+	}
+	checkRecordSet(t, src, "0000102", "0000103")
+	checkCameraImages(t, src, "rear", "0000102")
+
+	merged := path.Join(path.Dir(src), "merged")
+	if err := Merge(merged, src, split); err != nil {
+		t.Fatalf("unable to merge record sets: %v", err)
+	}
+	checkRecordSet(t, merged, "0000102", "0000103", "0000105", "0000106")
+	checkCameraImages(t, merged, "rear", "0000102", "0000106", "0000107")
+
+	if err := Merge(merged, split); err == nil {
+		t.Errorf("merge of conflicting images must fail")
+	}
+}
+
+func TestRename(t *testing.T) {
+	src := copyTestRecordSet(t, "src")
+
+	if err := Rename(src, "renamed"); err != nil {
+		t.Fatalf("unable to rename record set: %v", err)
+	}
+	if _, err := os.Stat(src); !os.IsNotExist(err) {
+		t.Errorf("old record set %v still exists", src)
+	}
+	checkRecordSet(t, path.Join(path.Dir(src), "renamed"), "0000101", "0000102", "0000103", "0000104", "0000105", "0000106")
+
+	if err := Rename(path.Join(path.Dir(src), "renamed"), "../other"); err == nil {
+		t.Errorf("rename with path must fail")
+	}
+
+	// Record set is left unchanged when its records can't be updated
+	broken := copyTestRecordSet(t, "broken")
+	if err := ioutil.WriteFile(path.Join(broken, "record_0000103.json"), []byte("{"), os.FileMode(0644)); err != nil {
+		t.Fatalf("unable to write record: %v", err)
+	}
+	if err := Rename(broken, "renamed-broken"); err == nil {
+		t.Errorf("rename of record set with invalid record must fail")
+	}
+	if _, err := os.Stat(broken); err != nil {
+		t.Errorf("record set must not be renamed on error: %v", err)
+	}
+}
@@ -0,0 +1,178 @@
+package stream
+
+import (
+	"bytes"
+	"fmt"
+	"go.uber.org/zap"
+	"image"
+	"image/jpeg"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const boundary = "frame"
+
+// MJPEG encodes published images and serves them as mjpeg stream and jpeg snapshots.
+// Images are encoded once whatever the number of viewers, slow viewers skip frames.
+type MJPEG struct {
+	quality  int
+	interval time.Duration
+
+	muImage sync.Mutex
+	img     image.Image
+	updated chan interface{}
+
+	muFrame sync.RWMutex
+	frame   []byte
+	// ready is closed and replaced when a new frame is encoded
+	ready chan interface{}
+
+	cancel    chan interface{}
+	closeOnce sync.Once
+}
+
+// NewMJPEG builds stream encoding at most fps frames per second with jpeg quality (1-100)
+func NewMJPEG(quality, fps int) *MJPEG {
+	if fps <= 0 {
+		fps = 1
+	}
+	return &MJPEG{
+		quality:  quality,
+		interval: time.Second / time.Duration(fps),
+		updated:  make(chan interface{}, 1),
+		ready:    make(chan interface{}),
+		cancel:   make(chan interface{}),
+	}
+}
+
+// Publish replaces image to stream, it never blocks
+func (m *MJPEG) Publish(img image.Image) {
+	m.muImage.Lock()
+	m.img = img
+	m.muImage.Unlock()
+	select {
+	case m.updated <- true:
+	default:
+	}
+}
+
+// Start encodes published images until Stop is called
+func (m *MJPEG) Start() error {
+	var last time.Time
+	for {
+		select {
+		case <-m.updated:
+		case <-m.cancel:
+			return nil
+		}
+		if wait := m.interval - time.Since(last); wait > 0 {
+			select {
+			case <-time.After(wait):
+			case <-m.cancel:
+				return nil
+			}
+		}
+		last = time.Now()
+
+		m.muImage.Lock()
+		img := m.img
+		m.muImage.Unlock()
+		if err := m.encode(img); err != nil {
+			zap.S().Errorf("unable to encode stream frame: %v", err)
+		}
+	}
+}
+
+func (m *MJPEG) Stop() {
+	m.closeOnce.Do(func() {
+		close(m.cancel)
+	})
+}
+
+func (m *MJPEG) encode(img image.Image) error {
+	buf := bytes.Buffer{}
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: m.quality}); err != nil {
+		return fmt.Errorf("unable to encode jpeg: %w", err)
+	}
+	m.muFrame.Lock()
+	defer m.muFrame.Unlock()
+	m.frame = buf.Bytes()
+	close(m.ready)
+	m.ready = make(chan interface{})
+	return nil
+}
+
+// Frame returns last encoded frame and a channel closed when next frame is available
+func (m *MJPEG) Frame() ([]byte, <-chan interface{}) {
+	m.muFrame.RLock()
+	defer m.muFrame.RUnlock()
+	return m.frame, m.ready
+}
+
+// Handler serves mjpeg stream on /stream and last frame on /snapshot
+func (m *MJPEG) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/stream", m)
+	mux.HandleFunc("/snapshot", m.ServeSnapshot)
+	return mux
+}
+
+// ServeHTTP writes frames as multipart response until client disconnects or stream is stopped
+func (m *MJPEG) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "multipart/x-mixed-replace; boundary="+boundary)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+
+	// Boundary is written after each frame, so viewers don't wait next frame to display it
+	if _, err := fmt.Fprintf(w, "--%s\r\n", boundary); err != nil {
+		return
+	}
+	frame, ready := m.Frame()
+	for {
+		if frame != nil {
+			if err := writePart(w, frame); err != nil {
+				zap.S().Debugf("stream viewer %v disconnected: %v", r.RemoteAddr, err)
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		select {
+		case <-ready:
+		case <-r.Context().Done():
+			return
+		case <-m.cancel:
+			return
+		}
+		frame, ready = m.Frame()
+	}
+}
+
+func writePart(w http.ResponseWriter, frame []byte) error {
+	if _, err := fmt.Fprintf(w, "Content-Type: image/jpeg\r\nContent-Length: %d\r\n\r\n", len(frame)); err != nil {
+		return err
+	}
+	if _, err := w.Write(frame); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "\r\n--%s\r\n", boundary)
+	return err
+}
+
+// ServeSnapshot writes last frame as jpeg image
+func (m *MJPEG) ServeSnapshot(w http.ResponseWriter, _ *http.Request) {
+	frame, _ := m.Frame()
+	if frame == nil {
+		http.Error(w, "no frame available", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(frame)))
+	if _, err := w.Write(frame); err != nil {
+		zap.S().Debugf("unable to write snapshot: %v", err)
+	}
+}
@@ -0,0 +1,171 @@
+package stream
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func testImage(c color.RGBA) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, 32, 24))
+	for y := 0; y < 24; y++ {
+		for x := 0; x < 32; x++ {
+			img.SetRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+func waitFrame(t *testing.T, m *MJPEG) {
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if frame, _ := m.Frame(); frame != nil {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("no frame encoded")
+}
+
+func TestMJPEG_Snapshot(t *testing.T) {
+	m := NewMJPEG(80, 100)
+	server := httptest.NewServer(m.Handler())
+	defer server.Close()
+	go m.Start()
+	defer m.Stop()
+
+	resp, err := http.Get(server.URL + "/snapshot")
+	if err != nil {
+		t.Fatalf("unable to get snapshot: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("snapshot without frame must be unavailable: %v", resp.Status)
+	}
+
+	m.Publish(testImage(color.RGBA{R: 255, A: 255}))
+	waitFrame(t, m)
+
+	resp, err = http.Get(server.URL + "/snapshot")
+	if err != nil {
+		t.Fatalf("unable to get snapshot: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "image/jpeg" {
+		t.Fatalf("bad snapshot response: %v %v", resp.Status, resp.Header.Get("Content-Type"))
+	}
+	img, err := jpeg.Decode(resp.Body)
+	if err != nil {
+		t.Fatalf("invalid snapshot: %v", err)
+	}
+	if r, _, _, _ := img.At(10, 10).RGBA(); r>>8 < 240 {
+		t.Errorf("bad snapshot content: %v", img.At(10, 10))
+	}
+}
+
+func TestMJPEG_Stream(t *testing.T) {
+	m := NewMJPEG(80, 100)
+	server := httptest.NewServer(m.Handler())
+	defer server.Close()
+	go m.Start()
+	defer m.Stop()
+
+	m.Publish(testImage(color.RGBA{R: 255, A: 255}))
+	waitFrame(t, m)
+
+	// Several viewers receive the same frames
+	readers := make([]*multipart.Reader, 0, 3)
+	for i := 0; i < 3; i++ {
+		resp, err := http.Get(server.URL + "/stream")
+		if err != nil {
+			t.Fatalf("unable to open stream: %v", err)
+		}
+		defer resp.Body.Close()
+		mediaType, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+		if err != nil || mediaType != "multipart/x-mixed-replace" {
+			t.Fatalf("bad content type: %v", resp.Header.Get("Content-Type"))
+		}
+		readers = append(readers, multipart.NewReader(resp.Body, params["boundary"]))
+	}
+
+	first := make([][]byte, 0, len(readers))
+	for _, r := range readers {
+		first = append(first, nextPart(t, r))
+	}
+
+	m.Publish(testImage(color.RGBA{B: 255, A: 255}))
+	for i, r := range readers {
+		second := nextPart(t, r)
+		if bytes.Equal(first[i], second) {
+			t.Errorf("viewer %d must receive new frame", i)
+		}
+		img, err := jpeg.Decode(bytes.NewReader(second))
+		if err != nil {
+			t.Fatalf("invalid frame: %v", err)
+		}
+		if _, _, b, _ := img.At(10, 10).RGBA(); b>>8 < 240 {
+			t.Errorf("bad frame content: %v", img.At(10, 10))
+		}
+	}
+}
+
+func nextPart(t *testing.T, r *multipart.Reader) []byte {
+	part, err := r.NextPart()
+	if err != nil {
+		t.Fatalf("unable to read stream part: %v", err)
+	}
+	if part.Header.Get("Content-Type") != "image/jpeg" {
+		t.Errorf("bad part content type: %v", part.Header.Get("Content-Type"))
+	}
+	content, err := ioutil.ReadAll(part)
+	if err != nil {
+		t.Fatalf("unable to read frame: %v", err)
+	}
+	return content
+}
+
+func TestMJPEG_PublishNeverBlocks(t *testing.T) {
+	// Encoder isn't started, publish must return anyway
+	m := NewMJPEG(80, 10)
+	done := make(chan interface{})
+	go func() {
+		for i := 0; i < 100; i++ {
+			m.Publish(testImage(color.RGBA{G: uint8(i), A: 255}))
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("publish is blocked")
+	}
+}
+
+func TestMJPEG_RateLimit(t *testing.T) {
+	m := NewMJPEG(80, 10)
+	go m.Start()
+	defer m.Stop()
+
+	m.Publish(testImage(color.RGBA{R: 255, A: 255}))
+	waitFrame(t, m)
+	_, ready := m.Frame()
+	m.Publish(testImage(color.RGBA{G: 255, A: 255}))
+	select {
+	case <-ready:
+		t.Errorf("frame must not be encoded before frame interval")
+	case <-time.After(50 * time.Millisecond):
+	}
+	select {
+	case <-ready:
+	case <-time.After(time.Second):
+		t.Errorf("frame must be encoded after frame interval")
+	}
+}
@@ -0,0 +1,184 @@
+package synth
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/cyrilix/robocar-tools/pkg/recordset"
+	"github.com/cyrilix/robocar-tools/record"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math"
+	"math/rand"
+	"strconv"
+	"time"
+)
+
+var (
+	skyColor    = color.RGBA{R: 150, G: 190, B: 230, A: 255}
+	groundColor = color.RGBA{R: 70, G: 120, B: 60, A: 255}
+	roadColor   = color.RGBA{R: 60, G: 60, B: 60, A: 255}
+	laneColor   = color.RGBA{R: 240, G: 240, B: 240, A: 255}
+	centerColor = color.RGBA{R: 230, G: 200, B: 40, A: 255}
+	jpegQuality = 90
+	// dashFrequency is the number of center line dashes per unit of distance to camera
+	dashFrequency = 0.5
+)
+
+// Scene describes a track frame seen from car camera
+type Scene struct {
+	Width  int
+	Height int
+	// Curvature of the road in [-1, 1], negative values turn left
+	Curvature float64
+	// Horizon is the fraction of image height above the road
+	Horizon float64
+	// LaneWidth is the road width at the bottom of image as fraction of image width
+	LaneWidth float64
+	// LineWidth is the lane lines width at the bottom of image as fraction of image width, no lines if 0
+	LineWidth float64
+	// Brightness multiplies all colors, 1 is daylight
+	Brightness float64
+	// Noise is the standard deviation of gaussian pixel noise, in color levels
+	Noise float64
+	// Phase shifts center line dashes to simulate movement, in [0, 1]
+	Phase float64
+	Seed  int64
+}
+
+// Steering returns ground-truth steering of scene
+func (s *Scene) Steering() float32 {
+	return float32(math.Max(-1., math.Min(1., s.Curvature)))
+}
+
+// Render draws road with perspective: road narrows and bends toward horizon
+func (s *Scene) Render() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, s.Width, s.Height))
+	rnd := rand.New(rand.NewSource(s.Seed))
+
+	horizonY := int(float64(s.Height) * s.Horizon)
+	w := float64(s.Width)
+	for y := 0; y < s.Height; y++ {
+		// depth is 0 at horizon and 1 at the bottom of image
+		depth := float64(y-horizonY) / float64(s.Height-horizonY)
+		center := w/2. + s.Curvature*w/2.*math.Pow(1.-depth, 2)
+		halfRoad := s.LaneWidth * w / 2. * depth
+		line := s.LineWidth * w * depth
+		// Distance to camera is inversely proportional to depth
+		dashed := math.Mod(dashFrequency/(depth+1e-3)+s.Phase, 1.) < 0.5
+
+		for x := 0; x < s.Width; x++ {
+			c := groundColor
+			dx := math.Abs(float64(x) + 0.5 - center)
+			switch {
+			case y < horizonY:
+				c = skyColor
+			case line > 0 && dx <= halfRoad && dx > halfRoad-line:
+				c = laneColor
+			case line > 0 && dashed && dx <= line/2.:
+				c = centerColor
+			case dx <= halfRoad:
+				c = roadColor
+			}
+			img.SetRGBA(x, y, s.light(c, rnd))
+		}
+	}
+	return img
+}
+
+func (s *Scene) light(c color.RGBA, rnd *rand.Rand) color.RGBA {
+	channel := func(v uint8) uint8 {
+		value := float64(v) * s.Brightness
+		if s.Noise > 0 {
+			value += rnd.NormFloat64() * s.Noise
+		}
+		return uint8(math.Max(0., math.Min(255., math.Round(value))))
+	}
+	return color.RGBA{R: channel(c.R), G: channel(c.G), B: channel(c.B), A: 255}
+}
+
+// JPEG renders scene as jpeg image
+func (s *Scene) JPEG() ([]byte, error) {
+	buf := bytes.Buffer{}
+	err := jpeg.Encode(&buf, s.Render(), &jpeg.Options{Quality: jpegQuality})
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode scene as jpeg: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Generator builds a sequence of scenes that simulates a car driving on a winding track
+type Generator struct {
+	Width  int
+	Height int
+	// MaxCurvature bounds track curvature
+	MaxCurvature float64
+	// CurvatureStep is the standard deviation of curvature change between two frames
+	CurvatureStep float64
+	Horizon       float64
+	LaneWidth     float64
+	LineWidth     float64
+	Brightness    float64
+	// BrightnessStep is the standard deviation of brightness change between two frames
+	BrightnessStep float64
+	Noise          float64
+
+	rnd       *rand.Rand
+	curvature float64
+	light     float64
+	phase     float64
+}
+
+// NewGenerator builds a generator with default track parameters, same seed generates same scenes
+func NewGenerator(width, height int, seed int64) *Generator {
+	return &Generator{
+		Width:          width,
+		Height:         height,
+		MaxCurvature:   0.8,
+		CurvatureStep:  0.05,
+		Horizon:        0.4,
+		LaneWidth:      0.9,
+		LineWidth:      0.03,
+		Brightness:     1.,
+		BrightnessStep: 0.,
+		Noise:          4.,
+		rnd:            rand.New(rand.NewSource(seed)),
+	}
+}
+
+// Next returns next scene of track
+func (g *Generator) Next() *Scene {
+	g.curvature = math.Max(-g.MaxCurvature, math.Min(g.MaxCurvature, g.curvature+g.rnd.NormFloat64()*g.CurvatureStep))
+	g.light = math.Max(-0.5, math.Min(0.5, g.light+g.rnd.NormFloat64()*g.BrightnessStep))
+	g.phase = math.Mod(g.phase+0.1, 1.)
+	return &Scene{
+		Width:      g.Width,
+		Height:     g.Height,
+		Curvature:  g.curvature,
+		Horizon:    g.Horizon,
+		LaneWidth:  g.LaneWidth,
+		LineWidth:  g.LineWidth,
+		Brightness: g.Brightness + g.light,
+		Noise:      g.Noise,
+		Phase:      g.phase,
+		Seed:       g.rnd.Int63(),
+	}
+}
+
+// WriteRecordSet generates count frames with their ground-truth steering into record set dir, frame ids are
+// timestamps starting at start
+func WriteRecordSet(dir string, g *Generator, count int, start time.Time, interval time.Duration) error {
+	for i := 0; i < count; i++ {
+		scene := g.Next()
+		content, err := scene.JPEG()
+		if err != nil {
+			return err
+		}
+		id := strconv.FormatInt(start.Add(time.Duration(i)*interval).UnixMilli(), 10)
+		_, err = recordset.AddEntry(dir, id, content, &record.Record{UserAngle: scene.Steering()})
+		if err != nil {
+			return fmt.Errorf("unable to write synthetic frame %v: %w", id, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package synth
+
+import (
+	"bytes"
+	"github.com/cyrilix/robocar-tools/pkg/recordset"
+	"image/jpeg"
+	"path"
+	"testing"
+	"time"
+)
+
+func roadCenter(t *testing.T, s *Scene, y int) int {
+	img := s.Render()
+	first, last := -1, -1
+	for x := 0; x < s.Width; x++ {
+		if img.RGBAAt(x, y) == roadColor {
+			if first < 0 {
+				first = x
+			}
+			last = x
+		}
+	}
+	if first < 0 {
+		t.Fatalf("no road at line %d", y)
+	}
+	return (first + last) / 2
+}
+
+func TestScene_Render(t *testing.T) {
+	s := Scene{Width: 160, Height: 120, Horizon: 0.4, LaneWidth: 0.9, LineWidth: 0.03, Brightness: 1.}
+	img := s.Render()
+
+	if img.Bounds().Dx() != 160 || img.Bounds().Dy() != 120 {
+		t.Errorf("bad image size: %v", img.Bounds())
+	}
+	if img.RGBAAt(80, 10) != skyColor {
+		t.Errorf("bad sky color: %v", img.RGBAAt(80, 10))
+	}
+	if img.RGBAAt(2, 119) != groundColor {
+		t.Errorf("bad ground color: %v", img.RGBAAt(2, 119))
+	}
+	if img.RGBAAt(9, 119) != laneColor {
+		t.Errorf("bad lane line color: %v", img.RGBAAt(9, 119))
+	}
+	if c := roadCenter(t, &s, 119); c < 78 || c > 81 {
+		t.Errorf("straight road must be centered: %v", c)
+	}
+}
+
+func TestScene_Curvature(t *testing.T) {
+	right := Scene{Width: 160, Height: 120, Horizon: 0.4, LaneWidth: 0.9, Brightness: 1., Curvature: 0.5}
+	left := right
+	left.Curvature = -0.5
+
+	if roadCenter(t, &right, 60) <= 80 {
+		t.Errorf("road must bend to the right: %v", roadCenter(t, &right, 60))
+	}
+	if roadCenter(t, &left, 60) >= 80 {
+		t.Errorf("road must bend to the left: %v", roadCenter(t, &left, 60))
+	}
+	if right.Steering() != 0.5 || left.Steering() != -0.5 {
+		t.Errorf("bad steering: %v, %v", right.Steering(), left.Steering())
+	}
+}
+
+func TestScene_Lighting(t *testing.T) {
+	s := Scene{Width: 16, Height: 12, Horizon: 0.4, LaneWidth: 0.9, Brightness: 0.5}
+	c := s.Render().RGBAAt(8, 1)
+	if c.R != skyColor.R/2 || c.B != skyColor.B/2 {
+		t.Errorf("bad sky color with brightness 0.5: %v", c)
+	}
+
+	s.Noise = 20.
+	s.Seed = 1
+	if s.Render().RGBAAt(8, 1) == c {
+		t.Errorf("noise not applied")
+	}
+}
+
+func TestGenerator_Next(t *testing.T) {
+	g1 := NewGenerator(160, 120, 42)
+	g2 := NewGenerator(160, 120, 42)
+	for i := 0; i < 100; i++ {
+		s1, s2 := g1.Next(), g2.Next()
+		if *s1 != *s2 {
+			t.Fatalf("same seed must generate same scenes: %v, %v", s1, s2)
+		}
+		if s1.Curvature > g1.MaxCurvature || s1.Curvature < -g1.MaxCurvature {
+			t.Errorf("curvature out of bounds: %v", s1.Curvature)
+		}
+	}
+}
+
+func TestWriteRecordSet(t *testing.T) {
+	dir := path.Join(t.TempDir(), "synth")
+	start := time.UnixMilli(1581992400000)
+
+	g := NewGenerator(32, 24, 1)
+	if err := WriteRecordSet(dir, g, 5, start, 50*time.Millisecond); err != nil {
+		t.Fatalf("unable to write record set: %v", err)
+	}
+
+	rs, err := recordset.Open(dir)
+	if err != nil {
+		t.Fatalf("unable to open record set: %v", err)
+	}
+	if len(rs.Entries) != 5 {
+		t.Fatalf("bad number of entries: %v, wants %v", len(rs.Entries), 5)
+	}
+	last, err := rs.Entries[4].Time()
+	if err != nil || last.Sub(start) != 200*time.Millisecond {
+		t.Errorf("bad frame timestamp: %v, %v", last, err)
+	}
+
+	other := NewGenerator(32, 24, 1)
+	for i := range rs.Entries {
+		rcd, err := rs.Entries[i].Record()
+		if err != nil {
+			t.Fatalf("unable to read record: %v", err)
+		}
+		if expected := other.Next().Steering(); rcd.UserAngle != expected {
+			t.Errorf("bad steering for entry %v: %v, wants %v", i, rcd.UserAngle, expected)
+		}
+	}
+
+	content, err := NewGenerator(32, 24, 1).Next().JPEG()
+	if err != nil {
+		t.Fatalf("unable to encode jpeg: %v", err)
+	}
+	img, err := jpeg.Decode(bytes.NewReader(content))
+	if err != nil || img.Bounds().Dx() != 32 {
+		t.Errorf("invalid jpeg content: %v", err)
+	}
+}
@@ -0,0 +1,26 @@
+package testutil
+
+import mqtt "github.com/eclipse/paho.mqtt.golang"
+
+// FakeMessage is a mqtt message given to message handlers under test
+type FakeMessage struct {
+	TopicName string
+	QoS       byte
+	Retain    bool
+	Content   []byte
+}
+
+// NewMessage builds a message of topic with payload, at qos 0 and not retained
+func NewMessage(topic string, payload []byte) *FakeMessage {
+	return &FakeMessage{TopicName: topic, Content: payload}
+}
+
+var _ mqtt.Message = (*FakeMessage)(nil)
+
+func (m *FakeMessage) Duplicate() bool   { return false }
+func (m *FakeMessage) Qos() byte         { return m.QoS }
+func (m *FakeMessage) Retained() bool    { return m.Retain }
+func (m *FakeMessage) Topic() string     { return m.TopicName }
+func (m *FakeMessage) MessageID() uint16 { return 0 }
+func (m *FakeMessage) Payload() []byte   { return m.Content }
+func (m *FakeMessage) Ack()              {}
@@ -0,0 +1,34 @@
+// Package testutil provides helpers shared by tests of other packages
+package testutil
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+// CopyDir copies src directory and its content into dest, used to modify testdata without altering it
+func CopyDir(t *testing.T, src, dest string) {
+	t.Helper()
+	files, err := ioutil.ReadDir(src)
+	if err != nil {
+		t.Fatalf("unable to list %v: %v", src, err)
+	}
+	if err := os.MkdirAll(dest, os.FileMode(0755)); err != nil {
+		t.Fatalf("unable to create directory %v: %v", dest, err)
+	}
+	for _, f := range files {
+		if f.IsDir() {
+			CopyDir(t, path.Join(src, f.Name()), path.Join(dest, f.Name()))
+			continue
+		}
+		content, err := ioutil.ReadFile(path.Join(src, f.Name()))
+		if err != nil {
+			t.Fatalf("unable to read %v: %v", f.Name(), err)
+		}
+		if err := ioutil.WriteFile(path.Join(dest, f.Name()), content, os.FileMode(0644)); err != nil {
+			t.Fatalf("unable to write %v: %v", f.Name(), err)
+		}
+	}
+}
@@ -66,10 +66,12 @@ type Training struct {
 	outputBucket string
 }
 
-func (t *Training) TrainDir(ctx context.Context, jobName, basedir string, modelType ModelType, imgWidth, imgHeight, sliceSize int, horizon int, withFlipImage bool, outputModelFile string, enableSpotTraining bool) error {
+// TrainDir builds training archive from images of cameras, see data.BuildArchive, and runs training job on it. Image
+// height of training job is the height of stacked images when several cameras are used.
+func (t *Training) TrainDir(ctx context.Context, jobName string, sources []string, modelType ModelType, imgWidth, imgHeight, sliceSize int, horizon int, withFlipImage bool, bins *data.SteeringBins, cameras []string, outputModelFile string, enableSpotTraining bool) error {
 	l := zap.S()
-	l.Infof("run training with data from %s", basedir)
-	archive, err := data.BuildArchive(basedir, sliceSize, imgWidth, imgHeight, horizon, withFlipImage)
+	l.Infof("run training with data from %s", strings.Join(sources, ", "))
+	archive, err := data.BuildArchive(ctx, sources, sliceSize, imgWidth, imgHeight, horizon, withFlipImage, bins, cameras)
 	if err != nil {
 		return fmt.Errorf("unable to build data archive: %w", err)
 	}
@@ -81,7 +83,7 @@ func (t *Training) TrainDir(ctx context.Context, jobName, basedir string, modelT
 	}
 	l.Info("")
 
-	err = t.runTraining(ctx, jobName, sliceSize, imgHeight, imgWidth, horizon, enableSpotTraining, modelType)
+	err = t.runTraining(ctx, jobName, sliceSize, stackedHeight(imgHeight, horizon, len(cameras)), imgWidth, horizon, enableSpotTraining, modelType, bins)
 	if err != nil {
 		return fmt.Errorf("unable to run training: %w", err)
 	}
@@ -93,6 +95,15 @@ func (t *Training) TrainDir(ctx context.Context, jobName, basedir string, modelT
 	return nil
 }
 
+// stackedHeight returns height of images of cameras stacked in archive, each image is cropped of horizon before
+// stacking and the training job crops horizon of stacked image
+func stackedHeight(imgHeight, horizon, cameras int) int {
+	if cameras <= 1 || imgHeight <= 0 {
+		return imgHeight
+	}
+	return cameras*(imgHeight-horizon) + horizon
+}
+
 func List(bucketName string) error {
 	l := zap.S()
 	pfxInput := prefixInput
@@ -119,7 +130,7 @@ func List(bucketName string) error {
 	return nil
 }
 
-func (t *Training) runTraining(ctx context.Context, jobName string, slideSize, imgHeight, imgWidth, horizon int, enableSpotTraining bool, modelType ModelType) error {
+func (t *Training) runTraining(ctx context.Context, jobName string, slideSize, imgHeight, imgWidth, horizon int, enableSpotTraining bool, modelType ModelType, bins *data.SteeringBins) error {
 	l := zap.S()
 	client := sagemaker.NewFromConfig(awsutils.MustLoadConfig())
 	l.Infof("Start training job '%s'", jobName)
@@ -169,6 +180,11 @@ func (t *Training) runTraining(ctx context.Context, jobName string, slideSize, i
 	if enableSpotTraining {
 		trainingJobInput.StoppingCondition.MaxWaitTimeInSeconds = aws.Int32(3600)
 	}
+	if bins != nil {
+		for k, v := range bins.HyperParameters() {
+			trainingJobInput.HyperParameters[k] = v
+		}
+	}
 
 	// TODO: check train data exist
 	jobOutput, err := client.CreateTrainingJob(
@@ -12,7 +12,8 @@ import (
 	"os"
 )
 
-func New(client mqtt.Client, recordsDir, recordTopic string) (*Recorder, error) {
+// New builds a recorder, only frames of mainCamera are labeled by records. All frames are labeled if mainCamera is empty.
+func New(client mqtt.Client, recordsDir, recordTopic, mainCamera string) (*Recorder, error) {
 	err := os.MkdirAll(recordsDir, os.FileMode(0755))
 	if err != nil {
 		return nil, fmt.Errorf("unable to create %v directory: %v", recordsDir, err)
@@ -21,6 +22,7 @@ func New(client mqtt.Client, recordsDir, recordTopic string) (*Recorder, error)
 		client:      client,
 		recordsDir:  recordsDir,
 		recordTopic: recordTopic,
+		mainCamera:  mainCamera,
 		cancel:      make(chan interface{}),
 	}, nil
 
@@ -30,11 +32,24 @@ type Recorder struct {
 	client      mqtt.Client
 	recordsDir  string
 	recordTopic string
+	mainCamera  string
 	cancel      chan interface{}
 }
 
 var FileNameFormat = "record_%s.json"
 
+// MainCamera is the name of camera whose images are stored into cam subdirectory
+const MainCamera = "camera"
+
+// CamSubDir returns subdirectory of record set where images of camera are stored: cam for main camera or frames
+// without camera name, cam-<name> for other cameras
+func CamSubDir(camera string) string {
+	if camera == "" || camera == MainCamera {
+		return "cam"
+	}
+	return "cam-" + camera
+}
+
 func (r *Recorder) Start() error {
 	err := service.RegisterCallback(r.client, r.recordTopic, r.onRecordMsg)
 	if err != nil {
@@ -61,7 +76,12 @@ func (r *Recorder) onRecordMsg(_ mqtt.Client, message mqtt.Message) {
 
 	recordDir := fmt.Sprintf("%s/%s", r.recordsDir, msg.GetRecordSet())
 
-	imgDir := fmt.Sprintf("%s/cam", recordDir)
+	camera := msg.GetFrame().GetId().GetName()
+	labeled := r.isMainCamera(camera)
+	if labeled {
+		camera = MainCamera
+	}
+	imgDir := fmt.Sprintf("%s/%s", recordDir, CamSubDir(camera))
 	imgName := fmt.Sprintf("%s/cam-image_array_%s.jpg", imgDir, msg.GetFrame().GetId().GetId())
 	err = os.MkdirAll(imgDir, os.FileMode(0755))
 	if err != nil {
@@ -73,6 +93,10 @@ func (r *Recorder) onRecordMsg(_ mqtt.Client, message mqtt.Message) {
 		l.Errorf("unable to write img file %v: %v", imgName, err)
 		return
 	}
+	if !labeled {
+		// Only frames of main camera are labeled, images of other cameras are matched by nearest frame index
+		return
+	}
 
 	jsonDir := fmt.Sprintf("%s/", recordDir)
 	recordName := fmt.Sprintf("%s/%s", jsonDir, fmt.Sprintf(FileNameFormat, msg.GetFrame().GetId().GetId()))
@@ -97,7 +121,16 @@ func (r *Recorder) onRecordMsg(_ mqtt.Client, message mqtt.Message) {
 
 }
 
+// isMainCamera returns true if frames of camera are labeled by records
+func (r *Recorder) isMainCamera(camera string) bool {
+	return r.mainCamera == "" || camera == "" || camera == r.mainCamera
+}
+
 type Record struct {
 	UserAngle     float32 `json:"user/angle,"`
 	CamImageArray string  `json:"cam/image_array,"`
+	// UserThrottle is the throttle written by donkeycar, missing in records of this tool
+	UserThrottle *float32 `json:"user/throttle,omitempty"`
+	// UserAngleBin is the categorical steering label, only set into training archives
+	UserAngleBin *int `json:"user/angle_bin,omitempty"`
 }
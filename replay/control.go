@@ -0,0 +1,178 @@
+package replay
+
+import (
+	"fmt"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type CommandType int
+
+func ParseCommandType(s string) CommandType {
+	switch strings.ToLower(s) {
+	case "pause":
+		return CommandPause
+	case "resume":
+		return CommandResume
+	case "toggle":
+		return CommandToggle
+	case "step":
+		return CommandStep
+	case "back":
+		return CommandBack
+	case "seek":
+		return CommandSeek
+	case "speed":
+		return CommandSpeed
+	case "faster":
+		return CommandFaster
+	case "slower":
+		return CommandSlower
+	default:
+		return CommandUnknown
+	}
+}
+
+func (c CommandType) String() string {
+	switch c {
+	case CommandPause:
+		return "pause"
+	case CommandResume:
+		return "resume"
+	case CommandToggle:
+		return "toggle"
+	case CommandStep:
+		return "step"
+	case CommandBack:
+		return "back"
+	case CommandSeek:
+		return "seek"
+	case CommandSpeed:
+		return "speed"
+	case CommandFaster:
+		return "faster"
+	case CommandSlower:
+		return "slower"
+	default:
+		return "unknown"
+	}
+}
+
+const (
+	CommandUnknown CommandType = iota
+	CommandPause
+	CommandResume
+	// CommandToggle pauses a running replay or resumes a paused one
+	CommandToggle
+	// CommandStep pauses replay and publishes next frame
+	CommandStep
+	// CommandBack pauses replay and publishes previous frame
+	CommandBack
+	// CommandSeek moves replay to a frame index, an offset since first frame or a date
+	CommandSeek
+	CommandSpeed
+	// CommandFaster doubles replay speed
+	CommandFaster
+	// CommandSlower halves replay speed
+	CommandSlower
+)
+
+// Command controls a replay session, commands are exchanged as text like 'pause', 'seek 120', 'seek 12.5s',
+// 'seek 2020-02-18T19:00:00Z' or 'speed 0.5'
+type Command struct {
+	Type CommandType
+	// Frame is the seek target when Offset and Time aren't set
+	Frame  int
+	Offset time.Duration
+	Time   time.Time
+	Speed  float64
+}
+
+func ParseCommand(s string) (*Command, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("empty command")
+	}
+	cmd := Command{Type: ParseCommandType(fields[0])}
+	switch cmd.Type {
+	case CommandUnknown:
+		return nil, fmt.Errorf("unknown command '%v'", fields[0])
+	case CommandSeek:
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("seek command requires a frame, an offset or a date: '%v'", s)
+		}
+		if frame, err := strconv.Atoi(fields[1]); err == nil {
+			cmd.Frame = frame
+		} else if offset, err := time.ParseDuration(fields[1]); err == nil {
+			cmd.Offset = offset
+		} else if t, err := time.Parse(time.RFC3339Nano, fields[1]); err == nil {
+			cmd.Time = t
+		} else {
+			return nil, fmt.Errorf("invalid seek target '%v'", fields[1])
+		}
+	case CommandSpeed:
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("speed command requires a value: '%v'", s)
+		}
+		speed, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil || speed <= 0 {
+			return nil, fmt.Errorf("invalid speed '%v'", fields[1])
+		}
+		cmd.Speed = speed
+	default:
+		if len(fields) != 1 {
+			return nil, fmt.Errorf("unexpected arguments for command '%v'", s)
+		}
+	}
+	return &cmd, nil
+}
+
+func (c Command) String() string {
+	switch c.Type {
+	case CommandSeek:
+		if !c.Time.IsZero() {
+			return fmt.Sprintf("%v %v", c.Type, c.Time.Format(time.RFC3339Nano))
+		}
+		if c.Offset != 0 {
+			return fmt.Sprintf("%v %v", c.Type, c.Offset)
+		}
+		return fmt.Sprintf("%v %d", c.Type, c.Frame)
+	case CommandSpeed:
+		return fmt.Sprintf("%v %v", c.Type, strconv.FormatFloat(c.Speed, 'f', -1, 64))
+	default:
+		return c.Type.String()
+	}
+}
+
+// CommandForKey maps display window keystrokes to commands: space toggles pause, 'n' and 'b' step forward and back,
+// 'r' restarts replay, '+' and '-' change speed
+func CommandForKey(key int) (*Command, bool) {
+	switch key {
+	case ' ':
+		return &Command{Type: CommandToggle}, true
+	case 'n':
+		return &Command{Type: CommandStep}, true
+	case 'b':
+		return &Command{Type: CommandBack}, true
+	case 'r':
+		return &Command{Type: CommandSeek, Frame: 0}, true
+	case '+':
+		return &Command{Type: CommandFaster}, true
+	case '-':
+		return &Command{Type: CommandSlower}, true
+	default:
+		return nil, false
+	}
+}
+
+// PublishCommand sends command to replay sessions that listen on topic
+func PublishCommand(client mqtt.Client, topic string, cmd *Command) error {
+	token := client.Publish(topic, 0, false, cmd.String())
+	token.Wait()
+	if token.Error() != nil {
+		return fmt.Errorf("unable to publish command '%v' on topic %v: %v", cmd, topic, token.Error())
+	}
+	return nil
+}
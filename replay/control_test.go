@@ -0,0 +1,59 @@
+package replay
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCommand(t *testing.T) {
+	cases := []struct {
+		text     string
+		expected Command
+	}{
+		{"pause", Command{Type: CommandPause}},
+		{"Resume", Command{Type: CommandResume}},
+		{"step", Command{Type: CommandStep}},
+		{"seek 120", Command{Type: CommandSeek, Frame: 120}},
+		{"seek 12.5s", Command{Type: CommandSeek, Offset: 12500 * time.Millisecond}},
+		{"seek 2020-02-18T19:00:00Z", Command{Type: CommandSeek, Time: time.Date(2020, 2, 18, 19, 0, 0, 0, time.UTC)}},
+		{"speed 0.5", Command{Type: CommandSpeed, Speed: 0.5}},
+	}
+	for _, c := range cases {
+		t.Run(c.text, func(t *testing.T) {
+			cmd, err := ParseCommand(c.text)
+			if err != nil {
+				t.Fatalf("unable to parse command: %v", err)
+			}
+			if *cmd != c.expected {
+				t.Errorf("bad command: %v, wants %v", cmd, c.expected)
+			}
+
+			// String must be parsable
+			other, err := ParseCommand(cmd.String())
+			if err != nil {
+				t.Fatalf("unable to parse command '%v': %v", cmd, err)
+			}
+			if *other != *cmd {
+				t.Errorf("bad command after String(): %v, wants %v", other, cmd)
+			}
+		})
+	}
+}
+
+func TestParseCommand_Invalid(t *testing.T) {
+	for _, text := range []string{"", "jump", "seek", "seek abc", "speed -1", "pause now"} {
+		if _, err := ParseCommand(text); err == nil {
+			t.Errorf("command '%v' must be rejected", text)
+		}
+	}
+}
+
+func TestCommandForKey(t *testing.T) {
+	cmd, ok := CommandForKey(' ')
+	if !ok || cmd.Type != CommandToggle {
+		t.Errorf("space must toggle pause: %v", cmd)
+	}
+	if _, ok := CommandForKey(-1); ok {
+		t.Errorf("no command expected without key pressed")
+	}
+}
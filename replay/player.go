@@ -0,0 +1,281 @@
+package replay
+
+import (
+	"fmt"
+	"github.com/cyrilix/robocar-base/service"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultFrameDelay = 40 * time.Millisecond
+
+// Source is a sequence of frames published by a Player
+type Source interface {
+	Len() int
+	// Offset returns delay between first frame and frame i at normal speed, offsets are sorted
+	Offset(i int) time.Duration
+	Publish(i int) error
+}
+
+// TimeIndexer is implemented by sources that can seek to a date
+type TimeIndexer interface {
+	IndexAt(t time.Time) (int, error)
+}
+
+// Player publishes frames of a source on time and applies control commands
+type Player struct {
+	src  Source
+	loop bool
+	// pauseAtEnd pauses player at the end of source instead of stopping it
+	pauseAtEnd bool
+
+	commands   chan Command
+	cancel     chan interface{}
+	cancelOnce sync.Once
+
+	client       mqtt.Client
+	controlTopic string
+
+	// Replay state, only updated by Run
+	speed  float64
+	paused bool
+	// pos is the next frame to publish
+	pos int
+	// Wall clock and source offset of last timing change
+	anchorWall   time.Time
+	anchorOffset time.Duration
+}
+
+func NewPlayer(src Source, speed float64, loop bool) *Player {
+	return &Player{
+		src:      src,
+		loop:     loop,
+		speed:    speed,
+		commands: make(chan Command, 10),
+		cancel:   make(chan interface{}),
+	}
+}
+
+// PauseAtEnd makes a player without loop wait for commands at the end of source, it must be called before Run
+func (p *Player) PauseAtEnd() {
+	p.pauseAtEnd = true
+}
+
+// Run publishes frames until the end of source, or until stopped in loop mode. A paused player waits for commands
+// even at the end of source.
+func (p *Player) Run() error {
+	n := p.src.Len()
+	p.anchor()
+	for {
+		if p.pos >= n && !p.paused {
+			if !p.loop && p.pauseAtEnd {
+				p.paused = true
+				continue
+			}
+			if !p.loop {
+				return nil
+			}
+			select {
+			case <-time.After(p.loopDelay()):
+			case <-p.cancel:
+				return nil
+			}
+			p.pos = 0
+			p.anchor()
+			continue
+		}
+
+		if p.paused {
+			select {
+			case cmd := <-p.commands:
+				p.apply(cmd)
+			case <-p.cancel:
+				return nil
+			}
+			continue
+		}
+
+		timer := time.NewTimer(time.Until(p.anchorWall.Add(p.scale(p.src.Offset(p.pos) - p.anchorOffset))))
+		select {
+		case <-timer.C:
+			p.publish(p.pos)
+			p.pos += 1
+		case cmd := <-p.commands:
+			timer.Stop()
+			p.apply(cmd)
+		case <-p.cancel:
+			timer.Stop()
+			return nil
+		}
+	}
+}
+
+func (p *Player) Stop() {
+	p.cancelOnce.Do(func() {
+		close(p.cancel)
+	})
+	if p.controlTopic != "" {
+		token := p.client.Unsubscribe(p.controlTopic)
+		token.Wait()
+		if token.Error() != nil {
+			zap.S().Errorf("unable to unsubscribe from control topic %v: %v", p.controlTopic, token.Error())
+		}
+	}
+}
+
+// Send queues command, commands are dropped when queue is full
+func (p *Player) Send(cmd Command) {
+	select {
+	case p.commands <- cmd:
+	default:
+		zap.S().Warnf("too many pending commands, drop '%v'", cmd)
+	}
+}
+
+// Listen applies commands published as text on topic
+func (p *Player) Listen(client mqtt.Client, topic string) error {
+	err := service.RegisterCallback(client, topic, func(_ mqtt.Client, message mqtt.Message) {
+		cmd, err := ParseCommand(string(message.Payload()))
+		if err != nil {
+			zap.S().Errorf("invalid replay command: %v", err)
+			return
+		}
+		p.Send(*cmd)
+	})
+	if err != nil {
+		return fmt.Errorf("unable to listen replay commands: %w", err)
+	}
+	p.client = client
+	p.controlTopic = topic
+	return nil
+}
+
+// ServeHTTP applies command read from 'cmd' query parameter or from request body
+func (p *Player) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	text := req.URL.Query().Get("cmd")
+	if text == "" && req.Method == http.MethodPost {
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("unable to read command: %v", err), http.StatusBadRequest)
+			return
+		}
+		text = strings.TrimSpace(string(body))
+	}
+	cmd, err := ParseCommand(text)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	p.Send(*cmd)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (p *Player) apply(cmd Command) {
+	l := zap.S()
+	l.Infof("apply replay command '%v'", cmd)
+	n := p.src.Len()
+	switch cmd.Type {
+	case CommandPause:
+		p.paused = true
+	case CommandResume:
+		p.paused = false
+		p.anchor()
+	case CommandToggle:
+		p.paused = !p.paused
+		p.anchor()
+	case CommandStep:
+		p.paused = true
+		if p.pos < n {
+			p.publish(p.pos)
+			p.pos += 1
+		}
+	case CommandBack:
+		p.paused = true
+		// Last published frame is pos-1
+		if p.pos >= 2 {
+			p.publish(p.pos - 2)
+			p.pos -= 1
+		}
+	case CommandSeek:
+		idx, err := p.seekIndex(cmd)
+		if err != nil {
+			l.Errorf("unable to seek: %v", err)
+			return
+		}
+		p.pos = idx
+		if p.paused {
+			p.publish(p.pos)
+			p.pos += 1
+		}
+		p.anchor()
+	case CommandSpeed:
+		p.speed = cmd.Speed
+		p.anchor()
+	case CommandFaster:
+		p.speed *= 2
+		p.anchor()
+	case CommandSlower:
+		p.speed /= 2
+		p.anchor()
+	}
+}
+
+func (p *Player) seekIndex(cmd Command) (int, error) {
+	n := p.src.Len()
+	var idx int
+	switch {
+	case !cmd.Time.IsZero():
+		indexer, ok := p.src.(TimeIndexer)
+		if !ok {
+			return 0, fmt.Errorf("source can't seek to a date")
+		}
+		i, err := indexer.IndexAt(cmd.Time)
+		if err != nil {
+			return 0, err
+		}
+		idx = i
+	case cmd.Offset != 0:
+		idx = sort.Search(n, func(i int) bool { return p.src.Offset(i) >= cmd.Offset })
+	default:
+		idx = cmd.Frame
+	}
+	if idx < 0 {
+		idx = 0
+	} else if idx >= n {
+		idx = n - 1
+	}
+	return idx, nil
+}
+
+func (p *Player) publish(i int) {
+	if err := p.src.Publish(i); err != nil {
+		zap.S().Errorf("unable to publish frame %v: %v", i, err)
+	}
+}
+
+// anchor restarts timing from current position
+func (p *Player) anchor() {
+	p.anchorWall = time.Now()
+	if p.pos < p.src.Len() {
+		p.anchorOffset = p.src.Offset(p.pos)
+	}
+}
+
+func (p *Player) scale(d time.Duration) time.Duration {
+	return time.Duration(float64(d) / p.speed)
+}
+
+// loopDelay is the mean delay between frames
+func (p *Player) loopDelay() time.Duration {
+	n := p.src.Len()
+	if n < 2 || p.src.Offset(n-1) <= 0 {
+		return p.scale(defaultFrameDelay)
+	}
+	return p.scale(p.src.Offset(n-1) / time.Duration(n-1))
+}
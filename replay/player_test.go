@@ -0,0 +1,145 @@
+package replay
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeSource struct {
+	mu        sync.Mutex
+	nb        int
+	interval  time.Duration
+	published []int
+}
+
+func (s *fakeSource) Len() int {
+	return s.nb
+}
+
+func (s *fakeSource) Offset(i int) time.Duration {
+	return time.Duration(i) * s.interval
+}
+
+func (s *fakeSource) Publish(i int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.published = append(s.published, i)
+	return nil
+}
+
+func (s *fakeSource) last() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.published) == 0 {
+		return -1
+	}
+	return s.published[len(s.published)-1]
+}
+
+func runPlayer(t *testing.T, p *Player) {
+	done := make(chan error)
+	go func() {
+		done <- p.Run()
+	}()
+	t.Cleanup(func() {
+		p.Stop()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Errorf("player hasn't been stopped")
+		}
+	})
+}
+
+// waitFor polls source until last published frame is expected
+func waitFor(t *testing.T, src *fakeSource, expected int) {
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if src.last() == expected {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("bad last frame published: %v, wants %v", src.last(), expected)
+}
+
+func TestPlayer_Controls(t *testing.T) {
+	src := fakeSource{nb: 100, interval: time.Hour}
+	p := NewPlayer(&src, 1., false)
+	runPlayer(t, p)
+
+	// First frame is published immediately, next one in an hour
+	waitFor(t, &src, 0)
+
+	p.Send(Command{Type: CommandStep})
+	waitFor(t, &src, 1)
+	p.Send(Command{Type: CommandStep})
+	waitFor(t, &src, 2)
+	p.Send(Command{Type: CommandBack})
+	waitFor(t, &src, 1)
+
+	p.Send(Command{Type: CommandSeek, Frame: 50})
+	waitFor(t, &src, 50)
+	p.Send(Command{Type: CommandSeek, Offset: 10 * time.Hour})
+	waitFor(t, &src, 10)
+	p.Send(Command{Type: CommandSeek, Frame: 500})
+	waitFor(t, &src, 99)
+
+	p.Send(Command{Type: CommandSeek, Frame: 20})
+	waitFor(t, &src, 20)
+	// Replay at 1 frame per millisecond
+	p.Send(Command{Type: CommandSpeed, Speed: float64(time.Hour / time.Millisecond)})
+	p.Send(Command{Type: CommandResume})
+	waitFor(t, &src, 99)
+}
+
+func TestPlayer_PauseAtEnd(t *testing.T) {
+	src := fakeSource{nb: 3, interval: time.Millisecond}
+	p := NewPlayer(&src, 1., false)
+	p.PauseAtEnd()
+	runPlayer(t, p)
+
+	waitFor(t, &src, 2)
+	// Paused player still applies commands
+	p.Send(Command{Type: CommandSeek, Frame: 1})
+	waitFor(t, &src, 1)
+}
+
+func TestPlayer_ServeHTTP(t *testing.T) {
+	src := fakeSource{nb: 10, interval: time.Hour}
+	p := NewPlayer(&src, 1., false)
+	runPlayer(t, p)
+	waitFor(t, &src, 0)
+
+	srv := httptest.NewServer(p)
+	defer srv.Close()
+
+	resp, err := http.Post(srv.URL, "text/plain", strings.NewReader("seek 5\n"))
+	if err != nil {
+		t.Fatalf("unable to send command: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Errorf("bad status: %v, wants %v", resp.StatusCode, http.StatusAccepted)
+	}
+	p.Send(Command{Type: CommandPause})
+	resp, err = http.Get(srv.URL + "?cmd=back")
+	if err != nil {
+		t.Fatalf("unable to send command: %v", err)
+	}
+	_ = resp.Body.Close()
+	waitFor(t, &src, 4)
+
+	resp, err = http.Get(srv.URL + "?cmd=jump")
+	if err != nil {
+		t.Fatalf("unable to send command: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("bad status for invalid command: %v, wants %v", resp.StatusCode, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,172 @@
+package replay
+
+import (
+	"fmt"
+	"github.com/cyrilix/robocar-protobuf/go/events"
+	"github.com/cyrilix/robocar-tools/pkg/recordset"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"time"
+)
+
+// Replayer publishes frames, steering and records of a record set with their original timing
+type Replayer struct {
+	client        mqtt.Client
+	recordSet     *recordset.RecordSet
+	frameTopic    string
+	steeringTopic string
+	recordTopic   string
+	// offsets are delays of each entry since first entry
+	offsets []time.Duration
+	player  *Player
+}
+
+// New loads record set from recordSetDir. Messages aren't published on empty topics, speed multiplies original
+// timing and fps is used when frame ids aren't timestamps.
+func New(client mqtt.Client, recordSetDir, frameTopic, steeringTopic, recordTopic string, speed float64, fps int, loop bool) (*Replayer, error) {
+	if speed <= 0 {
+		return nil, fmt.Errorf("invalid speed %v, must be greater than 0", speed)
+	}
+	if fps <= 0 {
+		return nil, fmt.Errorf("invalid frame per second %v, must be greater than 0", fps)
+	}
+	rs, err := recordset.Open(recordSetDir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open record set %v: %w", recordSetDir, err)
+	}
+	if len(rs.Entries) == 0 {
+		return nil, fmt.Errorf("no records in %v", recordSetDir)
+	}
+	r := Replayer{
+		client:        client,
+		recordSet:     rs,
+		frameTopic:    frameTopic,
+		steeringTopic: steeringTopic,
+		recordTopic:   recordTopic,
+		offsets:       computeOffsets(rs, time.Second/time.Duration(fps)),
+	}
+	r.player = NewPlayer(&r, speed, loop)
+	return &r, nil
+}
+
+// Start publishes record set and returns at the end of the replay, or when stopped in loop mode
+func (r *Replayer) Start() error {
+	return r.player.Run()
+}
+
+func (r *Replayer) Stop() {
+	r.player.Stop()
+}
+
+// Player returns the player that controls replay
+func (r *Replayer) Player() *Player {
+	return r.player
+}
+
+func (r *Replayer) Len() int {
+	return len(r.recordSet.Entries)
+}
+
+func (r *Replayer) Offset(i int) time.Duration {
+	return r.offsets[i]
+}
+
+func (r *Replayer) Publish(i int) error {
+	return r.publishEntry(&r.recordSet.Entries[i])
+}
+
+func (r *Replayer) IndexAt(t time.Time) (int, error) {
+	return r.recordSet.IndexAt(t)
+}
+
+// computeOffsets computes delay of each entry since first entry, interval is used when frame ids aren't timestamps
+func computeOffsets(rs *recordset.RecordSet, interval time.Duration) []time.Duration {
+	entries := rs.Entries
+	offsets := make([]time.Duration, len(entries))
+
+	first, err := entries[0].Time()
+	if err != nil {
+		zap.S().Infof("frame ids of %v aren't timestamps, replay at fixed rate", rs.Name())
+		for i := range entries {
+			offsets[i] = time.Duration(i) * interval
+		}
+		return offsets
+	}
+
+	last := time.Duration(0)
+	for i := range entries {
+		t, err := entries[i].Time()
+		if err != nil || t.Sub(first) < last {
+			// Keep previous timing for frames without timestamp or out of order
+			offsets[i] = last
+			continue
+		}
+		last = t.Sub(first)
+		offsets[i] = last
+	}
+	return offsets
+}
+
+func (r *Replayer) publishEntry(e *recordset.Entry) error {
+	frame, err := ioutil.ReadFile(e.ImagePath)
+	if err != nil {
+		return fmt.Errorf("unable to read image %v: %w", e.ImagePath, err)
+	}
+	rcd, err := e.Record()
+	if err != nil {
+		return fmt.Errorf("unable to read record %v: %w", e.RecordPath, err)
+	}
+
+	createdAt, err := e.Time()
+	if err != nil {
+		createdAt = time.Now()
+	}
+	frameRef := events.FrameRef{
+		Name: "camera",
+		Id:   e.Index,
+		CreatedAt: &timestamp.Timestamp{
+			Seconds: createdAt.Unix(),
+			Nanos:   int32(createdAt.Nanosecond()),
+		},
+	}
+	frameMsg := events.FrameMessage{
+		Id:    &frameRef,
+		Frame: frame,
+	}
+	steeringMsg := events.SteeringMessage{
+		Steering:   rcd.UserAngle,
+		Confidence: 1.,
+		FrameRef:   &frameRef,
+	}
+
+	if err := r.publishMsg(r.frameTopic, &frameMsg); err != nil {
+		return err
+	}
+	if err := r.publishMsg(r.steeringTopic, &steeringMsg); err != nil {
+		return err
+	}
+	return r.publishMsg(r.recordTopic, &events.RecordMessage{
+		Frame:     &frameMsg,
+		Steering:  &steeringMsg,
+		RecordSet: r.recordSet.Name(),
+	})
+}
+
+func (r *Replayer) publishMsg(topic string, msg proto.Message) error {
+	if topic == "" {
+		return nil
+	}
+	payload, err := proto.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("unable to marshal protobuf message %T: %w", msg, err)
+	}
+	publish(r.client, topic, &payload)
+	return nil
+}
+
+var publish = func(client mqtt.Client, topic string, payload *[]byte) {
+	client.Publish(topic, 0, false, *payload)
+}
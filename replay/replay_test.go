@@ -0,0 +1,156 @@
+package replay
+
+import (
+	"github.com/cyrilix/robocar-protobuf/go/events"
+	"github.com/cyrilix/robocar-tools/pkg/recordset"
+	"github.com/cyrilix/robocar-tools/record"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/golang/protobuf/proto"
+	"io/ioutil"
+	"path"
+	"sync"
+	"testing"
+	"time"
+)
+
+type published struct {
+	topic   string
+	payload []byte
+	at      time.Time
+}
+
+func mockPublish(t *testing.T) (*[]published, *sync.Mutex) {
+	oldPublish := publish
+	t.Cleanup(func() {
+		publish = oldPublish
+	})
+
+	var mu sync.Mutex
+	msgs := make([]published, 0, 10)
+	publish = func(client mqtt.Client, topic string, payload *[]byte) {
+		mu.Lock()
+		defer mu.Unlock()
+		msgs = append(msgs, published{topic: topic, payload: *payload, at: time.Now()})
+	}
+	return &msgs, &mu
+}
+
+func buildRecordSet(t *testing.T, ids ...string) string {
+	img, err := ioutil.ReadFile("testdata/frame.jpg")
+	if err != nil {
+		t.Fatalf("unable to read test frame: %v", err)
+	}
+	dir := path.Join(t.TempDir(), "replay-test")
+	for i, id := range ids {
+		if _, err := recordset.AddEntry(dir, id, img, &record.Record{UserAngle: 0.1 * float32(i+1)}); err != nil {
+			t.Fatalf("unable to build record set: %v", err)
+		}
+	}
+	return dir
+}
+
+func TestReplayer_Start(t *testing.T) {
+	msgs, _ := mockPublish(t)
+	dir := buildRecordSet(t, "1581992400000", "1581992400040", "1581992400120")
+
+	r, err := New(nil, dir, "topic/frame", "topic/steering", "topic/record", 2., 25, false)
+	if err != nil {
+		t.Fatalf("unable to load record set: %v", err)
+	}
+	if err := r.Start(); err != nil {
+		t.Fatalf("unable to replay record set: %v", err)
+	}
+
+	if len(*msgs) != 9 {
+		t.Fatalf("bad number of messages published: %v, wants %v", len(*msgs), 9)
+	}
+	elapsed := (*msgs)[8].at.Sub((*msgs)[0].at)
+	if elapsed < 60*time.Millisecond {
+		t.Errorf("replay is too fast: %v, wants at least %v", elapsed, 60*time.Millisecond)
+	}
+
+	expectedTopics := []string{"topic/frame", "topic/steering", "topic/record"}
+	for i, m := range *msgs {
+		if m.topic != expectedTopics[i%3] {
+			t.Errorf("bad topic for message %d: %v, wants %v", i, m.topic, expectedTopics[i%3])
+		}
+	}
+
+	var frameMsg events.FrameMessage
+	if err := proto.Unmarshal((*msgs)[3].payload, &frameMsg); err != nil {
+		t.Fatalf("unable to unmarshal frame: %v", err)
+	}
+	if frameMsg.GetId().GetId() != "1581992400040" {
+		t.Errorf("bad frame id: %v, wants %v", frameMsg.GetId().GetId(), "1581992400040")
+	}
+	if frameMsg.GetId().GetCreatedAt().GetSeconds() != 1581992400 || frameMsg.GetId().GetCreatedAt().GetNanos() != 40000000 {
+		t.Errorf("bad frame creation date: %v", frameMsg.GetId().GetCreatedAt())
+	}
+
+	var steeringMsg events.SteeringMessage
+	if err := proto.Unmarshal((*msgs)[4].payload, &steeringMsg); err != nil {
+		t.Fatalf("unable to unmarshal steering: %v", err)
+	}
+	if steeringMsg.GetSteering() != 0.2 {
+		t.Errorf("bad steering: %v, wants %v", steeringMsg.GetSteering(), 0.2)
+	}
+	if steeringMsg.GetFrameRef().GetId() != "1581992400040" {
+		t.Errorf("bad steering frame ref: %v", steeringMsg.GetFrameRef().GetId())
+	}
+
+	var recordMsg events.RecordMessage
+	if err := proto.Unmarshal((*msgs)[5].payload, &recordMsg); err != nil {
+		t.Fatalf("unable to unmarshal record: %v", err)
+	}
+	if recordMsg.GetRecordSet() != "replay-test" {
+		t.Errorf("bad record set: %v, wants %v", recordMsg.GetRecordSet(), "replay-test")
+	}
+	if recordMsg.GetFrame().GetId().GetId() != "1581992400040" {
+		t.Errorf("bad record frame: %v", recordMsg.GetFrame().GetId().GetId())
+	}
+}
+
+func TestReplayer_Loop(t *testing.T) {
+	msgs, mu := mockPublish(t)
+	dir := buildRecordSet(t, "0000001", "0000002")
+
+	r, err := New(nil, dir, "topic/frame", "", "", 1., 200, true)
+	if err != nil {
+		t.Fatalf("unable to load record set: %v", err)
+	}
+	done := make(chan error)
+	go func() {
+		done <- r.Start()
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	r.Stop()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("replay hasn't been stopped")
+	}
+	// Stop must be idempotent
+	r.Stop()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(*msgs) <= 2 {
+		t.Errorf("record set hasn't been looped: %v messages published", len(*msgs))
+	}
+	for _, m := range *msgs {
+		if m.topic != "topic/frame" {
+			t.Errorf("message published on disabled topic %v", m.topic)
+		}
+	}
+}
+
+func TestNew_InvalidSpeed(t *testing.T) {
+	dir := buildRecordSet(t, "0000001")
+	if _, err := New(nil, dir, "topic/frame", "", "", 0., 25, false); err == nil {
+		t.Errorf("null speed must be rejected")
+	}
+}
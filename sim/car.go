@@ -0,0 +1,54 @@
+package sim
+
+import (
+	"math"
+	"time"
+)
+
+// Car follows a kinematic bicycle model
+type Car struct {
+	Position Point
+	// Heading is the car direction in radians, counterclockwise from x axis
+	Heading float64
+	// Speed in meters per second
+	Speed float64
+
+	// Wheelbase is the distance between axles, in meters
+	Wheelbase float64
+	// MaxSteeringAngle is the wheels angle for steering 1, in radians
+	MaxSteeringAngle float64
+	// MaxAcceleration is the acceleration for throttle 1, in m/s²
+	MaxAcceleration float64
+	// Drag slows car proportionally to its speed
+	Drag     float64
+	MaxSpeed float64
+}
+
+// NewCar builds a car with the geometry of a 1/10 scale model
+func NewCar(position Point, heading float64) *Car {
+	return &Car{
+		Position:         position,
+		Heading:          heading,
+		Wheelbase:        0.26,
+		MaxSteeringAngle: 25. * math.Pi / 180.,
+		MaxAcceleration:  4.,
+		Drag:             1.,
+		MaxSpeed:         4.,
+	}
+}
+
+// Step integrates car motion during dt. Steering and throttle are in [-1, 1], positive steering turns right.
+func (c *Car) Step(steering, throttle float64, dt time.Duration) {
+	s := dt.Seconds()
+	steering = math.Max(-1., math.Min(1., steering))
+	throttle = math.Max(-1., math.Min(1., throttle))
+
+	c.Speed += (throttle*c.MaxAcceleration - c.Drag*c.Speed) * s
+	c.Speed = math.Max(-c.MaxSpeed, math.Min(c.MaxSpeed, c.Speed))
+
+	c.Position.X += c.Speed * math.Cos(c.Heading) * s
+	c.Position.Y += c.Speed * math.Sin(c.Heading) * s
+	// Heading is counterclockwise, a right turn decreases it
+	c.Heading -= c.Speed / c.Wheelbase * math.Tan(steering*c.MaxSteeringAngle) * s
+	c.Heading = math.Remainder(c.Heading, 2*math.Pi)
+}
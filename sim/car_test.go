@@ -0,0 +1,37 @@
+package sim
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestCar_Step(t *testing.T) {
+	straight := NewCar(Point{}, 0)
+	right := NewCar(Point{}, 0)
+	left := NewCar(Point{}, 0)
+	for i := 0; i < 50; i++ {
+		straight.Step(0, 0.5, 20*time.Millisecond)
+		right.Step(0.5, 0.5, 20*time.Millisecond)
+		left.Step(-0.5, 0.5, 20*time.Millisecond)
+	}
+
+	if straight.Position.X <= 0 || straight.Position.Y != 0 || straight.Heading != 0 {
+		t.Errorf("car must go straight: %v", straight)
+	}
+	if straight.Speed <= 0 || straight.Speed > 2. {
+		t.Errorf("bad speed: %v", straight.Speed)
+	}
+	if right.Heading >= 0 || right.Position.Y >= 0 {
+		t.Errorf("car must turn right: %v", right)
+	}
+	if math.Abs(left.Heading+right.Heading) > 1e-9 {
+		t.Errorf("left and right turns must be symmetric: %v, %v", left.Heading, right.Heading)
+	}
+
+	stopped := NewCar(Point{}, 0)
+	stopped.Step(1., 0, time.Second)
+	if stopped.Heading != 0 || stopped.Position != (Point{}) {
+		t.Errorf("stopped car must not move: %v", stopped)
+	}
+}
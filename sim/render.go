@@ -0,0 +1,101 @@
+package sim
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+var (
+	skyColor    = color.RGBA{R: 150, G: 190, B: 230, A: 255}
+	groundColor = color.RGBA{R: 70, G: 120, B: 60, A: 255}
+	roadColor   = color.RGBA{R: 60, G: 60, B: 60, A: 255}
+	laneColor   = color.RGBA{R: 240, G: 240, B: 240, A: 255}
+	centerColor = color.RGBA{R: 230, G: 200, B: 40, A: 255}
+)
+
+// Camera is a pinhole camera fixed on car, looking forward with the horizon at a fixed row
+type Camera struct {
+	Width  int
+	Height int
+	// Horizon is the fraction of image height above the ground
+	Horizon float64
+	// FieldOfView is the horizontal angle of view, in radians
+	FieldOfView float64
+	// Elevation is the camera height above the ground, in meters
+	Elevation float64
+	// MaxDistance limits the rendered ground, in meters
+	MaxDistance float64
+	// LineWidth is the width of lane lines, in meters
+	LineWidth float64
+	// DashLength is the length of center line dashes and gaps, in meters
+	DashLength float64
+}
+
+func NewCamera(width, height int) *Camera {
+	return &Camera{
+		Width:       width,
+		Height:      height,
+		Horizon:     0.4,
+		FieldOfView: 120. * math.Pi / 180.,
+		Elevation:   0.2,
+		MaxDistance: 15.,
+		LineWidth:   0.05,
+		DashLength:  0.3,
+	}
+}
+
+// Render draws track seen from car
+func (c *Camera) Render(track *Track, car *Car) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, c.Width, c.Height))
+
+	horizonY := float64(c.Height) * c.Horizon
+	focal := float64(c.Width) / 2. / math.Tan(c.FieldOfView/2.)
+	forward := Point{X: math.Cos(car.Heading), Y: math.Sin(car.Heading)}
+	right := Point{X: math.Sin(car.Heading), Y: -math.Cos(car.Heading)}
+
+	for y := 0; y < c.Height; y++ {
+		row := float64(y) + 0.5 - horizonY
+		if row <= 0 {
+			for x := 0; x < c.Width; x++ {
+				img.SetRGBA(x, y, skyColor)
+			}
+			continue
+		}
+		// Ground distance seen by this row
+		distance := c.Elevation * focal / row
+		for x := 0; x < c.Width; x++ {
+			if distance > c.MaxDistance {
+				img.SetRGBA(x, y, groundColor)
+				continue
+			}
+			side := (float64(x) + 0.5 - float64(c.Width)/2.) * distance / focal
+			p := Point{
+				X: car.Position.X + distance*forward.X + side*right.X,
+				Y: car.Position.Y + distance*forward.Y + side*right.Y,
+			}
+			img.SetRGBA(x, y, c.surface(track, p))
+		}
+	}
+	return img
+}
+
+func (c *Camera) surface(track *Track, p Point) color.RGBA {
+	segments := track.segmentsAt(p)
+	if len(segments) == 0 {
+		return groundColor
+	}
+	progress, lateral, _ := track.locate(p, segments)
+	dist := math.Abs(lateral)
+	halfWidth := track.Width / 2.
+	switch {
+	case dist > halfWidth:
+		return groundColor
+	case dist > halfWidth-c.LineWidth:
+		return laneColor
+	case dist < c.LineWidth/2. && math.Mod(progress, 2*c.DashLength) < c.DashLength:
+		return centerColor
+	default:
+		return roadColor
+	}
+}
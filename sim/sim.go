@@ -0,0 +1,229 @@
+package sim
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/cyrilix/robocar-base/service"
+	"github.com/cyrilix/robocar-protobuf/go/events"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"go.uber.org/zap"
+	"image/jpeg"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	EventLap      = "lap"
+	EventOffTrack = "off_track"
+)
+
+// Event is published as json when car completes a lap or leaves the track
+type Event struct {
+	Type string `json:"type"`
+	// Lap is the number of completed laps
+	Lap       int       `json:"lap"`
+	LapTimeMs int64     `json:"lap_time_ms,omitempty"`
+	Progress  float64   `json:"progress"`
+	Lateral   float64   `json:"lateral"`
+	Time      time.Time `json:"time"`
+}
+
+// Simulator drives a car on track from steering and throttle messages and publishes camera frames
+type Simulator struct {
+	client                                                mqtt.Client
+	steeringTopic, throttleTopic, frameTopic, eventsTopic string
+	fps                                                   int
+
+	track  *Track
+	car    *Car
+	camera *Camera
+
+	muCommands sync.Mutex
+	steering   float64
+	throttle   float64
+
+	// distance driven along centerline since start
+	distance     float64
+	lastProgress float64
+	lap          int
+	lapStart     time.Time
+	// simulated time
+	now time.Time
+
+	cancel   chan interface{}
+	stopOnce sync.Once
+}
+
+// New places car at the start of track, events aren't published if eventsTopic is empty. Simulation runs at fps steps
+// per second, at least 1.
+func New(client mqtt.Client, track *Track, camera *Camera, steeringTopic, throttleTopic, frameTopic, eventsTopic string, fps int) *Simulator {
+	if fps <= 0 {
+		fps = 1
+	}
+	start, heading := track.PoseAt(0)
+	now := time.Now()
+	return &Simulator{
+		client:        client,
+		steeringTopic: steeringTopic,
+		throttleTopic: throttleTopic,
+		frameTopic:    frameTopic,
+		eventsTopic:   eventsTopic,
+		fps:           fps,
+		track:         track,
+		car:           NewCar(start, heading),
+		camera:        camera,
+		lapStart:      now,
+		now:           now,
+		cancel:        make(chan interface{}),
+	}
+}
+
+func (s *Simulator) Start() error {
+	if err := service.RegisterCallback(s.client, s.steeringTopic, s.onSteering); err != nil {
+		return fmt.Errorf("unable to start simulator: %v", err)
+	}
+	if err := service.RegisterCallback(s.client, s.throttleTopic, s.onThrottle); err != nil {
+		return fmt.Errorf("unable to start simulator: %v", err)
+	}
+
+	dt := time.Second / time.Duration(s.fps)
+	ticker := time.NewTicker(dt)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.cancel:
+			return nil
+		}
+		for _, e := range s.step(dt) {
+			s.publishEvent(&e)
+		}
+		if err := s.publishFrame(); err != nil {
+			zap.S().Errorf("unable to publish frame: %v", err)
+		}
+	}
+}
+
+// Stop may be called several times
+func (s *Simulator) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.cancel)
+		service.StopService("sim", s.client, s.steeringTopic, s.throttleTopic)
+	})
+}
+
+func (s *Simulator) onSteering(_ mqtt.Client, message mqtt.Message) {
+	var msg events.SteeringMessage
+	if err := proto.Unmarshal(message.Payload(), &msg); err != nil {
+		zap.S().Errorf("unable to unmarshal protobuf %T: %v", &msg, err)
+		return
+	}
+	s.muCommands.Lock()
+	defer s.muCommands.Unlock()
+	s.steering = float64(msg.GetSteering())
+}
+
+func (s *Simulator) onThrottle(_ mqtt.Client, message mqtt.Message) {
+	var msg events.ThrottleMessage
+	if err := proto.Unmarshal(message.Payload(), &msg); err != nil {
+		zap.S().Errorf("unable to unmarshal protobuf %T: %v", &msg, err)
+		return
+	}
+	s.muCommands.Lock()
+	defer s.muCommands.Unlock()
+	s.throttle = float64(msg.GetThrottle())
+}
+
+// step moves car and returns lap and off-track events, car is placed back on centerline when it leaves the track
+func (s *Simulator) step(dt time.Duration) []Event {
+	s.muCommands.Lock()
+	steering, throttle := s.steering, s.throttle
+	s.muCommands.Unlock()
+
+	s.now = s.now.Add(dt)
+	s.car.Step(steering, throttle, dt)
+
+	progress, lateral, _ := s.track.Locate(s.car.Position)
+	delta := progress - s.lastProgress
+	// Start line crossed
+	if delta < -s.track.Length()/2 {
+		delta += s.track.Length()
+	} else if delta > s.track.Length()/2 {
+		delta -= s.track.Length()
+	}
+	s.lastProgress = progress
+	s.distance += delta
+
+	evts := make([]Event, 0)
+	if s.distance >= float64(s.lap+1)*s.track.Length() {
+		s.lap += 1
+		evts = append(evts, Event{
+			Type:      EventLap,
+			Lap:       s.lap,
+			LapTimeMs: s.now.Sub(s.lapStart).Milliseconds(),
+			Progress:  progress,
+			Lateral:   lateral,
+			Time:      s.now,
+		})
+		s.lapStart = s.now
+	}
+
+	if math.Abs(lateral) > s.track.Width/2 {
+		evts = append(evts, Event{
+			Type:     EventOffTrack,
+			Lap:      s.lap,
+			Progress: progress,
+			Lateral:  lateral,
+			Time:     s.now,
+		})
+		s.car.Position, s.car.Heading = s.track.PoseAt(progress)
+		s.car.Speed = 0
+	}
+	return evts
+}
+
+func (s *Simulator) publishFrame() error {
+	buf := bytes.Buffer{}
+	if err := jpeg.Encode(&buf, s.camera.Render(s.track, s.car), &jpeg.Options{Quality: 90}); err != nil {
+		return fmt.Errorf("unable to encode frame: %w", err)
+	}
+	now := time.Now()
+	msg := events.FrameMessage{
+		Id: &events.FrameRef{
+			Name: "camera",
+			Id:   fmt.Sprintf("%d%03d", now.Unix(), now.Nanosecond()/1000/1000),
+			CreatedAt: &timestamp.Timestamp{
+				Seconds: now.Unix(),
+				Nanos:   int32(now.Nanosecond()),
+			},
+		},
+		Frame: buf.Bytes(),
+	}
+	payload, err := proto.Marshal(&msg)
+	if err != nil {
+		return fmt.Errorf("unable to marshal protobuf message: %w", err)
+	}
+	publish(s.client, s.frameTopic, payload)
+	return nil
+}
+
+func (s *Simulator) publishEvent(e *Event) {
+	zap.S().Infof("sim event %v: lap %d, progress %.2f, lateral %.2f", e.Type, e.Lap, e.Progress, e.Lateral)
+	if s.eventsTopic == "" {
+		return
+	}
+	payload, err := json.Marshal(e)
+	if err != nil {
+		zap.S().Errorf("unable to marshal sim event: %v", err)
+		return
+	}
+	publish(s.client, s.eventsTopic, payload)
+}
+
+var publish = func(client mqtt.Client, topic string, payload []byte) {
+	client.Publish(topic, 0, false, payload)
+}
@@ -0,0 +1,129 @@
+package sim
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/cyrilix/robocar-protobuf/go/events"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/golang/protobuf/proto"
+	"image/jpeg"
+	"testing"
+	"time"
+)
+
+func TestCamera_Render(t *testing.T) {
+	track, err := NewTrack(1., []Point{{-50, 0}, {50, 0}, {50, 50}, {-50, 50}})
+	if err != nil {
+		t.Fatalf("unable to build track: %v", err)
+	}
+	camera := NewCamera(160, 120)
+
+	img := camera.Render(track, NewCar(Point{}, 0))
+	if img.RGBAAt(80, 5) != skyColor {
+		t.Errorf("bad sky color: %v", img.RGBAAt(80, 5))
+	}
+	if img.RGBAAt(70, 119) != roadColor {
+		t.Errorf("road must be in front of car: %v", img.RGBAAt(70, 119))
+	}
+	if img.RGBAAt(2, 60) != groundColor {
+		t.Errorf("bad ground color: %v", img.RGBAAt(2, 60))
+	}
+
+	// Car on the right side of road sees road on its left
+	shifted := camera.Render(track, NewCar(Point{Y: -0.4}, 0))
+	if shifted.RGBAAt(150, 119) != groundColor {
+		t.Errorf("right of image must be out of road: %v", shifted.RGBAAt(150, 119))
+	}
+	if shifted.RGBAAt(40, 119) != roadColor {
+		t.Errorf("left of image must be on road: %v", shifted.RGBAAt(40, 119))
+	}
+}
+
+func TestSimulator_Step(t *testing.T) {
+	track := squareTrack(t)
+	s := New(nil, track, NewCamera(32, 24), "steering", "throttle", "frame", "events", 20)
+	// Start from the middle of first segment to drive straight
+	s.car.Position = Point{X: 1}
+	s.lastProgress = 1
+
+	s.throttle = 0.5
+	var offTrack []Event
+	for i := 0; i < 200 && len(offTrack) == 0; i++ {
+		offTrack = s.step(50 * time.Millisecond)
+	}
+	if len(offTrack) != 1 || offTrack[0].Type != EventOffTrack {
+		t.Fatalf("car driving straight must leave square track: %v", offTrack)
+	}
+	if offTrack[0].Progress < 9 || offTrack[0].Progress > 12 {
+		t.Errorf("car must leave track at first corner: %v", offTrack[0].Progress)
+	}
+	if _, lateral, _ := track.Locate(s.car.Position); lateral != 0 || s.car.Speed != 0 {
+		t.Errorf("car must be placed back on centerline: %v", s.car)
+	}
+}
+
+func TestSimulator_Lap(t *testing.T) {
+	track := squareTrack(t)
+	s := New(nil, track, NewCamera(32, 24), "steering", "throttle", "frame", "events", 20)
+
+	var laps []Event
+	// Teleport car along track to complete a lap
+	for progress := 1.; progress <= 41.; progress += 1. {
+		s.car.Position, s.car.Heading = track.PoseAt(progress)
+		for _, e := range s.step(100 * time.Millisecond) {
+			if e.Type == EventLap {
+				laps = append(laps, e)
+			}
+		}
+	}
+	if len(laps) != 1 {
+		t.Fatalf("bad number of laps: %v", laps)
+	}
+	if laps[0].Lap != 1 || laps[0].LapTimeMs != 4000 {
+		t.Errorf("bad lap event: %v", laps[0])
+	}
+}
+
+func TestSimulator_Publish(t *testing.T) {
+	oldPublish := publish
+	defer func() {
+		publish = oldPublish
+	}()
+	published := make(map[string][]byte)
+	publish = func(client mqtt.Client, topic string, payload []byte) {
+		published[topic] = payload
+	}
+
+	s := New(nil, DefaultTrack(), NewCamera(32, 24), "steering", "throttle", "frame", "events", 20)
+	if err := s.publishFrame(); err != nil {
+		t.Fatalf("unable to publish frame: %v", err)
+	}
+	var frame events.FrameMessage
+	if err := proto.Unmarshal(published["frame"], &frame); err != nil {
+		t.Fatalf("unable to unmarshal frame: %v", err)
+	}
+	if len(frame.GetId().GetId()) != 13 {
+		t.Errorf("bad frame id: %v", frame.GetId().GetId())
+	}
+	img, err := jpeg.Decode(bytes.NewReader(frame.GetFrame()))
+	if err != nil || img.Bounds().Dx() != 32 {
+		t.Errorf("invalid frame: %v", err)
+	}
+
+	s.publishEvent(&Event{Type: EventOffTrack, Lateral: 0.7})
+	var e Event
+	if err := json.Unmarshal(published["events"], &e); err != nil {
+		t.Fatalf("unable to unmarshal event: %v", err)
+	}
+	if e.Type != EventOffTrack || e.Lateral != 0.7 {
+		t.Errorf("bad event: %v", e)
+	}
+}
+
+func TestNew_InvalidFps(t *testing.T) {
+	for _, fps := range []int{0, -1} {
+		if s := New(nil, DefaultTrack(), NewCamera(32, 24), "steering", "throttle", "frame", "", fps); s.fps != 1 {
+			t.Errorf("invalid frame per second %v must be replaced by 1: %v", fps, s.fps)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package sim
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+)
+
+// Point is a position on track map, in meters
+type Point struct {
+	X float64
+	Y float64
+}
+
+// Track is a closed road described by its centerline
+type Track struct {
+	// Width of road, in meters
+	Width float64
+	// Points of centerline, last point is joined to first one
+	Points []Point
+	// cumulative length of centerline at each point
+	lengths []float64
+	// cells index segments close to each cell of a grid, to find road under a point without checking all segments
+	cells map[cell][]int
+}
+
+type cell struct {
+	X int
+	Y int
+}
+
+// cellSize of segments grid, in meters
+const cellSize = 1.
+
+type trackFile struct {
+	Width  float64      `json:"width"`
+	Points [][2]float64 `json:"points"`
+}
+
+func NewTrack(width float64, points []Point) (*Track, error) {
+	if width <= 0 {
+		return nil, fmt.Errorf("invalid track width %v", width)
+	}
+	if len(points) < 3 {
+		return nil, fmt.Errorf("track requires at least 3 points, got %v", len(points))
+	}
+	t := Track{Width: width, Points: points, lengths: make([]float64, len(points)+1)}
+	for i := range points {
+		a, b := t.segment(i)
+		t.lengths[i+1] = t.lengths[i] + math.Hypot(b.X-a.X, b.Y-a.Y)
+	}
+	t.indexSegments()
+	return &t, nil
+}
+
+// indexSegments registers each segment into cells whose center is close enough that any point of the cell on the
+// road is on this segment
+func (t *Track) indexSegments() {
+	t.cells = make(map[cell][]int)
+	margin := t.Width/2 + cellSize/math.Sqrt2
+	for i := range t.Points {
+		a, b := t.segment(i)
+		minX, maxX := int(math.Floor((math.Min(a.X, b.X)-margin)/cellSize)), int(math.Floor((math.Max(a.X, b.X)+margin)/cellSize))
+		minY, maxY := int(math.Floor((math.Min(a.Y, b.Y)-margin)/cellSize)), int(math.Floor((math.Max(a.Y, b.Y)+margin)/cellSize))
+		for x := minX; x <= maxX; x++ {
+			for y := minY; y <= maxY; y++ {
+				center := Point{X: (float64(x) + 0.5) * cellSize, Y: (float64(y) + 0.5) * cellSize}
+				if t.distance(center, i) <= margin {
+					c := cell{X: x, Y: y}
+					t.cells[c] = append(t.cells[c], i)
+				}
+			}
+		}
+	}
+}
+
+// segmentsAt lists segments that may be under p, p is out of road if empty
+func (t *Track) segmentsAt(p Point) []int {
+	return t.cells[cell{X: int(math.Floor(p.X / cellSize)), Y: int(math.Floor(p.Y / cellSize))}]
+}
+
+// LoadTrack reads json track file like {"width": 1.2, "points": [[0, 0], [10, 0], [10, 10]]}
+func LoadTrack(file string) (*Track, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read track file %v: %w", file, err)
+	}
+	var tf trackFile
+	if err := json.Unmarshal(content, &tf); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal track file %v: %w", file, err)
+	}
+	points := make([]Point, 0, len(tf.Points))
+	for _, p := range tf.Points {
+		points = append(points, Point{X: p[0], Y: p[1]})
+	}
+	return NewTrack(tf.Width, points)
+}
+
+// DefaultTrack is a winding loop of about 70 meters
+func DefaultTrack() *Track {
+	nb := 200
+	points := make([]Point, 0, nb)
+	for i := 0; i < nb; i++ {
+		a := 2. * math.Pi * float64(i) / float64(nb)
+		r := 10. * (1. + 0.2*math.Sin(3.*a))
+		points = append(points, Point{X: r * math.Cos(a), Y: r * math.Sin(a)})
+	}
+	t, _ := NewTrack(1.2, points)
+	return t
+}
+
+// Length returns centerline length
+func (t *Track) Length() float64 {
+	return t.lengths[len(t.Points)]
+}
+
+func (t *Track) segment(i int) (Point, Point) {
+	return t.Points[i], t.Points[(i+1)%len(t.Points)]
+}
+
+// Locate projects p on centerline. It returns the distance along centerline since first point, the signed
+// lateral distance to centerline (positive on the right side) and the centerline direction at projection.
+func (t *Track) Locate(p Point) (progress, lateral, direction float64) {
+	return t.locate(p, nil)
+}
+
+func (t *Track) distance(p Point, i int) float64 {
+	a, b := t.segment(i)
+	dx, dy := b.X-a.X, b.Y-a.Y
+	u := t.projection(p, i)
+	return math.Hypot(a.X+u*dx-p.X, a.Y+u*dy-p.Y)
+}
+
+// projection returns position of p projected on segment i, in [0, 1]
+func (t *Track) projection(p Point, i int) float64 {
+	a, b := t.segment(i)
+	dx, dy := b.X-a.X, b.Y-a.Y
+	segLen2 := dx*dx + dy*dy
+	if segLen2 == 0 {
+		return 0.
+	}
+	return math.Max(0., math.Min(1., ((p.X-a.X)*dx+(p.Y-a.Y)*dy)/segLen2))
+}
+
+// locate projects p on segments, all segments are used if nil
+func (t *Track) locate(p Point, segments []int) (progress, lateral, direction float64) {
+	best := math.Inf(1)
+	check := func(i int) {
+		a, b := t.segment(i)
+		dx, dy := b.X-a.X, b.Y-a.Y
+		u := t.projection(p, i)
+		px, py := a.X+u*dx-p.X, a.Y+u*dy-p.Y
+		d2 := px*px + py*py
+		if d2 < best {
+			best = d2
+			progress = t.lengths[i] + u*(t.lengths[i+1]-t.lengths[i])
+			direction = math.Atan2(dy, dx)
+			// Cross product is negative when p is on the right of segment
+			cross := dx*(p.Y-a.Y) - dy*(p.X-a.X)
+			lateral = math.Copysign(math.Sqrt(d2), -cross)
+		}
+	}
+	if segments == nil {
+		for i := range t.Points {
+			check(i)
+		}
+	} else {
+		for _, i := range segments {
+			check(i)
+		}
+	}
+	return progress, lateral, direction
+}
+
+// PoseAt returns centerline point and direction at progress
+func (t *Track) PoseAt(progress float64) (Point, float64) {
+	progress = math.Mod(progress, t.Length())
+	if progress < 0 {
+		progress += t.Length()
+	}
+	for i := range t.Points {
+		if progress <= t.lengths[i+1] {
+			a, b := t.segment(i)
+			segLen := t.lengths[i+1] - t.lengths[i]
+			u := 0.
+			if segLen > 0 {
+				u = (progress - t.lengths[i]) / segLen
+			}
+			return Point{X: a.X + u*(b.X-a.X), Y: a.Y + u*(b.Y-a.Y)}, math.Atan2(b.Y-a.Y, b.X-a.X)
+		}
+	}
+	return t.Points[0], 0
+}
@@ -0,0 +1,82 @@
+package sim
+
+import (
+	"io/ioutil"
+	"math"
+	"path"
+	"testing"
+)
+
+// squareTrack is a 10m side square, driven counterclockwise
+func squareTrack(t *testing.T) *Track {
+	track, err := NewTrack(1., []Point{{0, 0}, {10, 0}, {10, 10}, {0, 10}})
+	if err != nil {
+		t.Fatalf("unable to build track: %v", err)
+	}
+	return track
+}
+
+func TestTrack_Locate(t *testing.T) {
+	track := squareTrack(t)
+	if track.Length() != 40. {
+		t.Errorf("bad length: %v, wants %v", track.Length(), 40.)
+	}
+
+	cases := []struct {
+		name              string
+		p                 Point
+		progress, lateral float64
+		direction         float64
+	}{
+		{"on centerline", Point{5, 0}, 5., 0., 0.},
+		{"left side", Point{5, 0.3}, 5., -0.3, 0.},
+		{"right side", Point{5, -0.3}, 5., 0.3, 0.},
+		{"second segment", Point{10.2, 4}, 14., 0.2, math.Pi / 2},
+		{"last segment", Point{0, 3}, 37., 0., -math.Pi / 2},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			progress, lateral, direction := track.Locate(c.p)
+			if math.Abs(progress-c.progress) > 1e-9 {
+				t.Errorf("bad progress: %v, wants %v", progress, c.progress)
+			}
+			if math.Abs(lateral-c.lateral) > 1e-9 {
+				t.Errorf("bad lateral: %v, wants %v", lateral, c.lateral)
+			}
+			if math.Abs(direction-c.direction) > 1e-9 {
+				t.Errorf("bad direction: %v, wants %v", direction, c.direction)
+			}
+		})
+	}
+}
+
+func TestTrack_PoseAt(t *testing.T) {
+	track := squareTrack(t)
+	p, direction := track.PoseAt(45.)
+	if p != (Point{5, 0}) || direction != 0. {
+		t.Errorf("bad pose: %v %v", p, direction)
+	}
+	p, direction = track.PoseAt(-5.)
+	if p != (Point{0, 5}) || direction != -math.Pi/2 {
+		t.Errorf("bad pose: %v %v", p, direction)
+	}
+}
+
+func TestLoadTrack(t *testing.T) {
+	file := path.Join(t.TempDir(), "track.json")
+	err := ioutil.WriteFile(file, []byte(`{"width": 1.5, "points": [[0, 0], [10, 0], [10, 10]]}`), 0644)
+	if err != nil {
+		t.Fatalf("unable to write track file: %v", err)
+	}
+	track, err := LoadTrack(file)
+	if err != nil {
+		t.Fatalf("unable to load track: %v", err)
+	}
+	if track.Width != 1.5 || len(track.Points) != 3 || track.Points[1] != (Point{10, 0}) {
+		t.Errorf("bad track: %v", track)
+	}
+
+	if _, err := NewTrack(1., []Point{{0, 0}, {1, 1}}); err == nil {
+		t.Errorf("track with 2 points must be rejected")
+	}
+}
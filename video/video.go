@@ -3,21 +3,23 @@ package video
 import (
 	"fmt"
 	"github.com/cyrilix/robocar-protobuf/go/events"
+	"github.com/cyrilix/robocar-tools/pkg/synth"
+	"github.com/cyrilix/robocar-tools/replay"
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 	"github.com/golang/protobuf/proto"
 	"github.com/golang/protobuf/ptypes/timestamp"
-	"go.uber.org/zap"
 	"io/ioutil"
-	"os"
 	"time"
 )
 
+// CameraFake publishes jpeg frames in loop
 type CameraFake struct {
 	client     mqtt.Client
 	frameTopic string
-	videoPath  string
 	fps        int
-	cancel     chan interface{}
+	count      int
+	loadFrame  func(i int) ([]byte, error)
+	player     *replay.Player
 }
 
 func NewCameraFake(client mqtt.Client, frameTopic string, videoPath string, fps int) (*CameraFake, error) {
@@ -29,72 +31,103 @@ func NewCameraFake(client mqtt.Client, frameTopic string, videoPath string, fps
 	if len(files) == 0 {
 		return nil, fmt.Errorf("no files in directory %v", videoPath)
 	}
-	return &CameraFake{
+	loadFrame := func(i int) ([]byte, error) {
+		framePath := fmt.Sprintf("%s/%s", videoPath, files[i].Name())
+		frameContent, err := ioutil.ReadFile(framePath)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load frame content for %v: %v", framePath, err)
+		}
+		return frameContent, nil
+	}
+	return newCameraFake(client, frameTopic, len(files), loadFrame, fps), nil
+}
+
+// NewCameraSynth builds a fake camera that publishes count synthetic frames rendered by generator
+func NewCameraSynth(client mqtt.Client, frameTopic string, generator *synth.Generator, count int, fps int) (*CameraFake, error) {
+	if count <= 0 {
+		return nil, fmt.Errorf("invalid number of synthetic frames: %v", count)
+	}
+	frames := make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
+		content, err := generator.Next().JPEG()
+		if err != nil {
+			return nil, fmt.Errorf("unable to render synthetic frame: %v", err)
+		}
+		frames = append(frames, content)
+	}
+	loadFrame := func(i int) ([]byte, error) {
+		return frames[i], nil
+	}
+	return newCameraFake(client, frameTopic, count, loadFrame, fps), nil
+}
+
+func newCameraFake(client mqtt.Client, frameTopic string, count int, loadFrame func(i int) ([]byte, error), fps int) *CameraFake {
+	c := CameraFake{
 		client:     client,
 		frameTopic: frameTopic,
-		videoPath:  videoPath,
 		fps:        fps,
-		cancel:     make(chan interface{}),
-	}, nil
+		count:      count,
+		loadFrame:  loadFrame,
+	}
+	c.player = replay.NewPlayer(&c, 1., true)
+	return &c
 }
 
-func (c CameraFake) Start() error {
-	files, err := ioutil.ReadDir(c.videoPath)
+func (c *CameraFake) Start() error {
+	go func() {
+		_ = c.player.Run()
+	}()
+	return nil
+}
+
+func (c *CameraFake) Stop() {
+	c.player.Stop()
+}
+
+// Player returns the player that controls frames publication
+func (c *CameraFake) Player() *replay.Player {
+	return c.player
+}
+
+func (c *CameraFake) Len() int {
+	return c.count
+}
+
+func (c *CameraFake) Offset(i int) time.Duration {
+	return time.Duration(i) * time.Second / time.Duration(c.fps)
+}
+
+func (c *CameraFake) Publish(i int) error {
+	frameContent, err := c.loadFrame(i)
 	if err != nil {
-		return fmt.Errorf("unable to found camera frame in directory %v: %v", c.videoPath, err)
+		return err
+	}
+	msg := &events.FrameMessage{
+		Id:    newFrameRef(time.Now()),
+		Frame: frameContent,
+	}
+
+	payload, err := proto.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("unable to marshal protobuf message: %v", err)
 	}
 
-	go c.loop(files)
+	publish(c.client, c.frameTopic, &payload)
 	return nil
 }
 
-func (c CameraFake) loop(files []os.FileInfo) {
-	l := zap.S()
-	ticker := time.NewTicker(time.Second / time.Duration(c.fps))
-	defer ticker.Stop()
-
-	for {
-
-		for _, file := range files {
-			framePath := fmt.Sprintf("%s/%s", c.videoPath, file.Name())
-			frameContent, err := ioutil.ReadFile(framePath)
-			if err != nil {
-				l.Errorf("unable to load frame content for %v: %v", framePath, err)
-				continue
-			}
-			now := time.Now()
-			msg := &events.FrameMessage{
-				Id: &events.FrameRef{
-					Name: "camera",
-					Id:   fmt.Sprintf("%d%000d", now.Unix(), now.Nanosecond()/1000/1000),
-					CreatedAt: &timestamp.Timestamp{
-						Seconds: now.Unix(),
-						Nanos:   int32(now.Nanosecond()),
-					},
-				},
-				Frame: frameContent,
-			}
-
-			payload, err := proto.Marshal(msg)
-			if err != nil {
-				l.Errorf("unable to marshal protobuf message: %v", err)
-			}
-
-			publish(c.client, c.frameTopic, &payload)
-
-			select {
-			case <-ticker.C:
-			case <-c.cancel:
-				return
-			}
-		}
+// newFrameRef builds camera frame reference, id is the creation date as unix milliseconds
+func newFrameRef(now time.Time) *events.FrameRef {
+	return &events.FrameRef{
+		Name: "camera",
+		Id:   fmt.Sprintf("%d%03d", now.Unix(), now.Nanosecond()/1000/1000),
+		CreatedAt: &timestamp.Timestamp{
+			Seconds: now.Unix(),
+			Nanos:   int32(now.Nanosecond()),
+		},
 	}
 }
 
-func (c CameraFake) Stop() {
-	close(c.cancel)
-}
-
 var publish = func(client mqtt.Client, topic string, payload *[]byte) {
 	client.Publish(topic, 0, true, *payload)
 }
@@ -1,11 +1,14 @@
 package video
 
 import (
+	"bytes"
 	"encoding/base64"
 	"fmt"
 	"github.com/cyrilix/robocar-protobuf/go/events"
+	"github.com/cyrilix/robocar-tools/pkg/synth"
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 	"github.com/golang/protobuf/proto"
+	"image/jpeg"
 	"io/ioutil"
 	"sync"
 	"testing"
@@ -83,3 +86,45 @@ func TestNewCameraFake(t *testing.T) {
 	}
 
 }
+
+func TestNewCameraSynth(t *testing.T) {
+	oldPublish := publish
+	defer func() {
+		publish = oldPublish
+	}()
+
+	var muEventsPublished sync.Mutex
+	eventsPublished := make([]*[]byte, 0, 10)
+	publish = func(client mqtt.Client, topic string, payload *[]byte) {
+		muEventsPublished.Lock()
+		defer muEventsPublished.Unlock()
+		eventsPublished = append(eventsPublished, payload)
+	}
+
+	camera, err := NewCameraSynth(nil, "topic/fake/video", synth.NewGenerator(32, 24, 1), 3, 250)
+	if err != nil {
+		t.Fatalf("unable to render synthetic frames: %v", err)
+	}
+	if err := camera.Start(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	defer camera.Stop()
+
+	time.Sleep(50 * time.Millisecond)
+	muEventsPublished.Lock()
+	defer muEventsPublished.Unlock()
+	if len(eventsPublished) <= 3 {
+		t.Fatalf("synthetic frames must be published in loop: %v frames published", len(eventsPublished))
+	}
+	var frameMsg events.FrameMessage
+	if err := proto.Unmarshal(*eventsPublished[0], &frameMsg); err != nil {
+		t.Fatalf("unable to unmarshal msg frame: %v", err)
+	}
+	img, err := jpeg.Decode(bytes.NewReader(frameMsg.GetFrame()))
+	if err != nil {
+		t.Fatalf("invalid jpeg frame: %v", err)
+	}
+	if img.Bounds().Dx() != 32 || img.Bounds().Dy() != 24 {
+		t.Errorf("bad frame size: %v", img.Bounds())
+	}
+}
@@ -0,0 +1,164 @@
+package video
+
+import (
+	"fmt"
+	"github.com/cyrilix/robocar-protobuf/go/events"
+	"github.com/cyrilix/robocar-tools/replay"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/golang/protobuf/proto"
+	"go.uber.org/zap"
+	"gocv.io/x/gocv"
+	"image"
+	"time"
+)
+
+// VideoFileCamera publishes frames decoded from a video file, resized and encoded as jpeg
+type VideoFileCamera struct {
+	client     mqtt.Client
+	frameTopic string
+	videoFile  string
+	width      int
+	height     int
+	fps        int
+	// count is the number of frames published at fps
+	count  int
+	player *replay.Player
+
+	// Decoding state, only used by player
+	vc      *gocv.VideoCapture
+	img     gocv.Mat
+	resized gocv.Mat
+	// next is the position of frame decoded by next read without seeking
+	next int
+}
+
+// NewVideoFileCamera checks video file can be decoded. Frames keep their original size if width or height is 0.
+func NewVideoFileCamera(client mqtt.Client, frameTopic string, videoFile string, width, height, fps int, loop bool) (*VideoFileCamera, error) {
+	if fps <= 0 {
+		return nil, fmt.Errorf("invalid frame per second %v, must be greater than 0", fps)
+	}
+	vc, err := gocv.VideoCaptureFile(videoFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open video file %v: %v", videoFile, err)
+	}
+
+	c := VideoFileCamera{
+		client:     client,
+		frameTopic: frameTopic,
+		videoFile:  videoFile,
+		width:      width,
+		height:     height,
+		fps:        fps,
+		vc:         vc,
+		img:        gocv.NewMat(),
+		resized:    gocv.NewMat(),
+	}
+	if !vc.Read(&c.img) || c.img.Empty() {
+		c.close()
+		return nil, fmt.Errorf("unable to decode frame of video file %v", videoFile)
+	}
+
+	duration := c.duration()
+	c.count = int(duration*time.Duration(fps)/time.Second) + 1
+	vc.Set(gocv.VideoCapturePosFrames, 0)
+	c.player = replay.NewPlayer(&c, 1., loop)
+	return &c, nil
+}
+
+// duration returns position of last frame, read from video metadata or by decoding all frames
+func (c *VideoFileCamera) duration() time.Duration {
+	frames, videoFps := c.vc.Get(gocv.VideoCaptureFrameCount), c.vc.Get(gocv.VideoCaptureFPS)
+	if frames >= 1 && videoFps > 0 {
+		return time.Duration((frames - 1) / videoFps * float64(time.Second))
+	}
+
+	zap.S().Infof("no duration in metadata of video %v, decode all frames", c.videoFile)
+	var last time.Duration
+	for c.vc.Read(&c.img) && !c.img.Empty() {
+		last = time.Duration(c.vc.Get(gocv.VideoCapturePosMsec) * float64(time.Millisecond))
+	}
+	return last
+}
+
+// Start publishes frames until the end of video, or until stopped in loop mode
+func (c *VideoFileCamera) Start() error {
+	go func() {
+		defer c.close()
+		if err := c.player.Run(); err != nil {
+			zap.S().Errorf("unable to publish video %v: %v", c.videoFile, err)
+		}
+		zap.S().Infof("end of video %v", c.videoFile)
+	}()
+	return nil
+}
+
+func (c *VideoFileCamera) Stop() {
+	c.player.Stop()
+}
+
+// Player returns the player that controls frames publication
+func (c *VideoFileCamera) Player() *replay.Player {
+	return c.player
+}
+
+func (c *VideoFileCamera) close() {
+	_ = c.img.Close()
+	_ = c.resized.Close()
+	_ = c.vc.Close()
+}
+
+func (c *VideoFileCamera) Len() int {
+	return c.count
+}
+
+func (c *VideoFileCamera) Offset(i int) time.Duration {
+	return time.Duration(i) * time.Second / time.Duration(c.fps)
+}
+
+func (c *VideoFileCamera) Publish(i int) error {
+	pos := c.Offset(i)
+	if i != c.next {
+		c.vc.Set(gocv.VideoCapturePosMsec, float64(pos.Milliseconds()))
+	}
+	// Skip frames to publish video at target fps, whatever the video frame rate
+	if !readUntil(c.vc, &c.img, pos) {
+		c.next = -1
+		return fmt.Errorf("unable to decode frame at %v of video %v", pos, c.videoFile)
+	}
+	c.next = i + 1
+
+	frame := c.img
+	if c.width > 0 && c.height > 0 {
+		gocv.Resize(c.img, &c.resized, image.Point{X: c.width, Y: c.height}, 0, 0, gocv.InterpolationArea)
+		frame = c.resized
+	}
+	buf, err := gocv.IMEncode(gocv.JPEGFileExt, frame)
+	if err != nil {
+		return fmt.Errorf("unable to encode frame as jpeg: %v", err)
+	}
+	defer buf.Close()
+
+	msg := &events.FrameMessage{
+		Id:    newFrameRef(time.Now()),
+		Frame: buf.GetBytes(),
+	}
+	payload, err := proto.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("unable to marshal protobuf message: %v", err)
+	}
+	publish(c.client, c.frameTopic, &payload)
+	return nil
+}
+
+// readUntil decodes frames until video position reaches pos, returns false at the end of video
+func readUntil(vc *gocv.VideoCapture, img *gocv.Mat, pos time.Duration) bool {
+	for {
+		if !vc.Read(img) || img.Empty() {
+			return false
+		}
+		current := time.Duration(vc.Get(gocv.VideoCapturePosMsec) * float64(time.Millisecond))
+		if current >= pos {
+			return true
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package videxpt
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/cyrilix/robocar-tools/pkg/overlay"
+	"go.uber.org/zap"
+	"gocv.io/x/gocv"
+	"image"
+	"image/jpeg"
+)
+
+/* video export */
+
+// Writer writes frames, ordered by time, with their overlay burned in as mp4 or avi video at fps. Frames are repeated
+// or dropped to keep original timing, all frames are resized to the size of the first one. Only the last frame is kept
+// in memory.
+type Writer struct {
+	output  string
+	fps     int
+	style   *overlay.Style
+	sampler resampler
+
+	vw            *gocv.VideoWriter
+	width, height int
+	// mat is the last frame rendered, written again until next frame
+	mat    gocv.Mat
+	frames int
+	late   int
+}
+
+// NewWriter checks output format, video file is created with first frame. Overlays are drawn with style, or default
+// style if nil.
+func NewWriter(output string, fps int, style *overlay.Style) (*Writer, error) {
+	if fps <= 0 {
+		return nil, fmt.Errorf("invalid frame per second %v, must be greater than 0", fps)
+	}
+	if _, err := Codec(output); err != nil {
+		return nil, err
+	}
+	return &Writer{
+		output:  output,
+		fps:     fps,
+		style:   style,
+		sampler: resampler{fps: fps},
+		mat:     gocv.NewMat(),
+	}, nil
+}
+
+// Write renders frame, previous frame is written to video until position of f. Late frames are dropped.
+func (w *Writer) Write(f *Frame) error {
+	repeat, ok := w.sampler.next(f.Time)
+	if !ok {
+		w.late += 1
+		return nil
+	}
+	if w.vw == nil {
+		if err := w.open(f); err != nil {
+			return err
+		}
+	}
+	if err := w.repeat(repeat); err != nil {
+		return err
+	}
+
+	rendered, err := render(f, w.style, w.width, w.height)
+	if err != nil {
+		return fmt.Errorf("unable to render frame %d: %w", w.frames, err)
+	}
+	_ = w.mat.Close()
+	w.mat = rendered
+	w.frames += 1
+	return nil
+}
+
+func (w *Writer) open(first *Frame) error {
+	fourcc, err := Codec(w.output)
+	if err != nil {
+		return err
+	}
+	cfg, err := jpeg.DecodeConfig(bytes.NewReader(first.Jpeg))
+	if err != nil {
+		return fmt.Errorf("unable to decode first frame: %w", err)
+	}
+	vw, err := gocv.VideoWriterFile(w.output, fourcc, float64(w.fps), cfg.Width, cfg.Height, true)
+	if err != nil {
+		return fmt.Errorf("unable to open video %v: %w", w.output, err)
+	}
+	w.vw, w.width, w.height = vw, cfg.Width, cfg.Height
+	return nil
+}
+
+func (w *Writer) repeat(count int) error {
+	for i := 0; i < count; i++ {
+		if err := w.vw.Write(w.mat); err != nil {
+			return fmt.Errorf("unable to write frame %d: %w", w.frames-1, err)
+		}
+	}
+	return nil
+}
+
+// Close writes last frame and closes video, it fails if no frame has been written
+func (w *Writer) Close() error {
+	defer w.mat.Close()
+	if w.vw == nil {
+		return fmt.Errorf("no frame to export")
+	}
+	defer w.vw.Close()
+	if err := w.repeat(w.sampler.end()); err != nil {
+		return err
+	}
+	zap.S().Infof("%d frames exported into %v, %d video frames at %d fps, %d late frames dropped", w.frames, w.output, w.sampler.ticks, w.fps, w.late)
+	return nil
+}
+
+func render(f *Frame, style *overlay.Style, width, height int) (gocv.Mat, error) {
+	img, err := jpeg.Decode(bytes.NewReader(f.Jpeg))
+	if err != nil {
+		return gocv.Mat{}, fmt.Errorf("unable to decode frame: %w", err)
+	}
+	o := f.Overlay
+	o.Style = style
+	mat, err := gocv.ImageToMatRGB(overlay.Render(img, &o))
+	if err != nil {
+		return gocv.Mat{}, fmt.Errorf("unable to convert frame: %w", err)
+	}
+	if mat.Cols() != width || mat.Rows() != height {
+		gocv.Resize(mat, &mat, image.Point{X: width, Y: height}, 0, 0, gocv.InterpolationLinear)
+	}
+	return mat, nil
+}
@@ -0,0 +1,297 @@
+package videxpt
+
+import (
+	"fmt"
+	"github.com/cyrilix/robocar-base/service"
+	"github.com/cyrilix/robocar-protobuf/go/events"
+	"github.com/cyrilix/robocar-tools/pkg/overlay"
+	"github.com/cyrilix/robocar-tools/pkg/recordset"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/golang/protobuf/proto"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Frame is a jpeg image with events to draw over it
+type Frame struct {
+	Time    time.Time
+	Jpeg    []byte
+	Overlay overlay.Overlay
+}
+
+// FrameWriter receives frames ordered by time
+type FrameWriter interface {
+	Write(f *Frame) error
+}
+
+// ReadRecordSet reads frames of record set with their steering one by one and passes them to handle. Frames ids that
+// aren't timestamps are assumed to be recorded at fps.
+func ReadRecordSet(dir string, fps int, handle func(f *Frame) error) error {
+	if fps <= 0 {
+		return fmt.Errorf("invalid frame per second %v, must be greater than 0", fps)
+	}
+	rs, err := recordset.Open(dir)
+	if err != nil {
+		return fmt.Errorf("unable to open record set: %w", err)
+	}
+
+	for i := range rs.Entries {
+		e := &rs.Entries[i]
+		ts, err := e.Time()
+		if err != nil {
+			ts = time.Unix(0, 0).Add(time.Duration(i) * time.Second / time.Duration(fps))
+		}
+		img, err := ioutil.ReadFile(e.ImagePath)
+		if err != nil {
+			return fmt.Errorf("unable to read image %v: %w", e.ImagePath, err)
+		}
+		rcd, err := e.Record()
+		if err != nil {
+			return fmt.Errorf("unable to read record %v: %w", e.RecordPath, err)
+		}
+		err = handle(&Frame{
+			Time:    ts,
+			Jpeg:    img,
+			Overlay: overlay.Overlay{Steering: &events.SteeringMessage{Steering: rcd.UserAngle, Confidence: 1.}},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// maxPendingFrames is the number of frames received by collector and not yet written, next frames are dropped
+const maxPendingFrames = 100
+
+// Collector passes frames published on mqtt, with last events received before each of them, to a writer. Frames are
+// written outside of mqtt callbacks, only maxPendingFrames frames are kept in memory.
+type Collector struct {
+	client                                   mqtt.Client
+	frameTopic, steeringTopic, throttleTopic string
+	objectsTopic, roadTopic, driveModeTopic  string
+	writer                                   FrameWriter
+	muFrames                                 sync.Mutex
+	current                                  overlay.Overlay
+	frames                                   chan Frame
+	dropped                                  int
+	cancel                                   chan interface{}
+	stopOnce                                 sync.Once
+}
+
+// NewCollector builds collector that writes frames to writer, events topics are ignored if empty
+func NewCollector(client mqtt.Client, writer FrameWriter, frameTopic, steeringTopic, throttleTopic, objectsTopic, roadTopic, driveModeTopic string) *Collector {
+	return &Collector{
+		client:         client,
+		frameTopic:     frameTopic,
+		steeringTopic:  steeringTopic,
+		throttleTopic:  throttleTopic,
+		objectsTopic:   objectsTopic,
+		roadTopic:      roadTopic,
+		driveModeTopic: driveModeTopic,
+		writer:         writer,
+		frames:         make(chan Frame, maxPendingFrames),
+		cancel:         make(chan interface{}),
+	}
+}
+
+// Start writes frames until stopped, pending frames are written before it returns
+func (c *Collector) Start() error {
+	callbacks := map[string]mqtt.MessageHandler{
+		c.frameTopic:     c.onFrame,
+		c.steeringTopic:  c.onSteering,
+		c.throttleTopic:  c.onThrottle,
+		c.objectsTopic:   c.onObjects,
+		c.roadTopic:      c.onRoad,
+		c.driveModeTopic: c.onDriveMode,
+	}
+	for topic, callback := range callbacks {
+		if topic == "" {
+			continue
+		}
+		if err := service.RegisterCallback(c.client, topic, callback); err != nil {
+			return fmt.Errorf("unable to start collector: %v", err)
+		}
+	}
+	return c.writeFrames()
+}
+
+func (c *Collector) writeFrames() error {
+	for {
+		select {
+		case f := <-c.frames:
+			if err := c.writer.Write(&f); err != nil {
+				return fmt.Errorf("unable to write frame: %w", err)
+			}
+		case <-c.cancel:
+			// Frames received before stop are still written, collector is the only reader of frames
+			for len(c.frames) > 0 {
+				f := <-c.frames
+				if err := c.writer.Write(&f); err != nil {
+					return fmt.Errorf("unable to write frame: %w", err)
+				}
+			}
+			c.muFrames.Lock()
+			dropped := c.dropped
+			c.muFrames.Unlock()
+			if dropped > 0 {
+				zap.S().Warnf("%d frames dropped, video writer is too slow", dropped)
+			}
+			return nil
+		}
+	}
+}
+
+func (c *Collector) Stop() {
+	c.stopOnce.Do(func() {
+		topics := make([]string, 0, 6)
+		for _, topic := range []string{c.frameTopic, c.steeringTopic, c.throttleTopic, c.objectsTopic, c.roadTopic, c.driveModeTopic} {
+			if topic != "" {
+				topics = append(topics, topic)
+			}
+		}
+		service.StopService("video-export", c.client, topics...)
+		close(c.cancel)
+	})
+}
+
+func (c *Collector) onFrame(_ mqtt.Client, message mqtt.Message) {
+	var msg events.FrameMessage
+	if err := proto.Unmarshal(message.Payload(), &msg); err != nil {
+		zap.S().Errorf("unable to unmarshal protobuf %T: %v", &msg, err)
+		return
+	}
+	ts := time.Now()
+	if msg.GetId().GetCreatedAt() != nil {
+		ts = msg.GetId().GetCreatedAt().AsTime()
+	}
+	c.muFrames.Lock()
+	defer c.muFrames.Unlock()
+	select {
+	case c.frames <- Frame{Time: ts, Jpeg: msg.GetFrame(), Overlay: c.current}:
+	default:
+		c.dropped += 1
+	}
+}
+
+func (c *Collector) onSteering(_ mqtt.Client, message mqtt.Message) {
+	var msg events.SteeringMessage
+	if err := proto.Unmarshal(message.Payload(), &msg); err != nil {
+		zap.S().Errorf("unable to unmarshal protobuf %T: %v", &msg, err)
+		return
+	}
+	c.muFrames.Lock()
+	defer c.muFrames.Unlock()
+	c.current.Steering = &msg
+}
+
+func (c *Collector) onThrottle(_ mqtt.Client, message mqtt.Message) {
+	var msg events.ThrottleMessage
+	if err := proto.Unmarshal(message.Payload(), &msg); err != nil {
+		zap.S().Errorf("unable to unmarshal protobuf %T: %v", &msg, err)
+		return
+	}
+	c.muFrames.Lock()
+	defer c.muFrames.Unlock()
+	c.current.Throttle = &msg
+}
+
+func (c *Collector) onObjects(_ mqtt.Client, message mqtt.Message) {
+	var msg events.ObjectsMessage
+	if err := proto.Unmarshal(message.Payload(), &msg); err != nil {
+		zap.S().Errorf("unable to unmarshal protobuf %T: %v", &msg, err)
+		return
+	}
+	c.muFrames.Lock()
+	defer c.muFrames.Unlock()
+	c.current.Objects = &msg
+}
+
+func (c *Collector) onRoad(_ mqtt.Client, message mqtt.Message) {
+	var msg events.RoadMessage
+	if err := proto.Unmarshal(message.Payload(), &msg); err != nil {
+		zap.S().Errorf("unable to unmarshal protobuf %T: %v", &msg, err)
+		return
+	}
+	c.muFrames.Lock()
+	defer c.muFrames.Unlock()
+	c.current.Road = &msg
+}
+
+func (c *Collector) onDriveMode(_ mqtt.Client, message mqtt.Message) {
+	var msg events.DriveModeMessage
+	if err := proto.Unmarshal(message.Payload(), &msg); err != nil {
+		zap.S().Errorf("unable to unmarshal protobuf %T: %v", &msg, err)
+		return
+	}
+	c.muFrames.Lock()
+	defer c.muFrames.Unlock()
+	c.current.DriveMode = &msg
+}
+
+// maxGap is the longest pause kept between two frames, longer pauses are shortened
+const maxGap = time.Second
+
+// resampler computes how many times frames are repeated into a video at fps to keep their original timing
+type resampler struct {
+	fps     int
+	started bool
+	last    time.Time
+	// offset is the position of last frame into the video, ticks the number of video frames already computed
+	offset time.Duration
+	ticks  int
+}
+
+// next returns the number of video frames that show previous frame, before frame received at t. Frames received
+// before previous frame are late, ok is false and they must be dropped.
+func (r *resampler) next(t time.Time) (repeat int, ok bool) {
+	if !r.started {
+		r.started = true
+		r.last = t
+		return 0, true
+	}
+	gap := t.Sub(r.last)
+	if gap < 0 {
+		return 0, false
+	}
+	if gap > maxGap {
+		gap = maxGap
+	}
+	r.last = t
+	r.offset += gap
+	for time.Duration(r.ticks)*time.Second/time.Duration(r.fps) < r.offset {
+		r.ticks += 1
+		repeat += 1
+	}
+	return repeat, true
+}
+
+// end returns the number of video frames that show last frame
+func (r *resampler) end() int {
+	if !r.started {
+		return 0
+	}
+	count := int(r.offset*time.Duration(r.fps)/time.Second) + 1
+	repeat := count - r.ticks
+	r.ticks = count
+	if repeat < 0 {
+		return 0
+	}
+	return repeat
+}
+
+// Codec returns fourcc codec of video file from its extension
+func Codec(output string) (string, error) {
+	switch strings.ToLower(path.Ext(output)) {
+	case ".avi":
+		return "MJPG", nil
+	case ".mp4", ".m4v", ".mov":
+		return "mp4v", nil
+	default:
+		return "", fmt.Errorf("unsupported video format '%v', use .mp4 or .avi file", path.Ext(output))
+	}
+}
@@ -0,0 +1,209 @@
+package videxpt
+
+import (
+	"github.com/cyrilix/robocar-protobuf/go/events"
+	"github.com/cyrilix/robocar-tools/pkg/recordset"
+	"github.com/cyrilix/robocar-tools/pkg/synth"
+	"github.com/cyrilix/robocar-tools/pkg/testutil"
+	"github.com/cyrilix/robocar-tools/record"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func readRecordSet(t *testing.T, dir string, fps int) []Frame {
+	frames := make([]Frame, 0)
+	err := ReadRecordSet(dir, fps, func(f *Frame) error {
+		frames = append(frames, *f)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unable to read record set: %v", err)
+	}
+	return frames
+}
+
+func TestReadRecordSet(t *testing.T) {
+	dir := path.Join(t.TempDir(), "synth")
+	start := time.UnixMilli(1600000000000)
+	if err := synth.WriteRecordSet(dir, synth.NewGenerator(32, 24, 1), 5, start, 50*time.Millisecond); err != nil {
+		t.Fatalf("unable to write record set: %v", err)
+	}
+
+	frames := readRecordSet(t, dir, 25)
+	if len(frames) != 5 {
+		t.Fatalf("bad number of frames: %v", len(frames))
+	}
+	for i, f := range frames {
+		if !f.Time.Equal(start.Add(time.Duration(i) * 50 * time.Millisecond)) {
+			t.Errorf("bad time for frame %d: %v", i, f.Time)
+		}
+		if len(f.Jpeg) == 0 || f.Overlay.Steering == nil {
+			t.Errorf("frame %d must have image and steering", i)
+		}
+	}
+}
+
+func TestReadRecordSet_NoTimestamp(t *testing.T) {
+	dir := path.Join(t.TempDir(), "indexes")
+	for _, idx := range []string{"1", "2", "3"} {
+		if _, err := recordset.AddEntry(dir, idx, []byte("jpeg"), &record.Record{UserAngle: 0.5}); err != nil {
+			t.Fatalf("unable to add entry: %v", err)
+		}
+	}
+	frames := readRecordSet(t, dir, 10)
+	if d := frames[2].Time.Sub(frames[0].Time); d != 200*time.Millisecond {
+		t.Errorf("frames must be spaced at fps: %v", d)
+	}
+	if frames[1].Overlay.Steering.GetSteering() != 0.5 {
+		t.Errorf("bad steering: %v", frames[1].Overlay.Steering)
+	}
+
+	for _, fps := range []int{0, -1} {
+		if err := ReadRecordSet(dir, fps, func(*Frame) error { return nil }); err == nil {
+			t.Errorf("invalid frame per second %v must return an error", fps)
+		}
+	}
+}
+
+// resample returns for each video frame at fps the position of the frame it shows
+func resample(frames []Frame, fps int) []int {
+	r := resampler{fps: fps}
+	positions := make([]int, 0)
+	last := 0
+	for i := range frames {
+		repeat, ok := r.next(frames[i].Time)
+		for j := 0; j < repeat; j++ {
+			positions = append(positions, last)
+		}
+		if ok {
+			last = i
+		}
+	}
+	for j := r.end(); j > 0; j-- {
+		positions = append(positions, last)
+	}
+	return positions
+}
+
+func TestResampler(t *testing.T) {
+	start := time.UnixMilli(1600000000000)
+	at := func(offsets ...time.Duration) []Frame {
+		frames := make([]Frame, 0, len(offsets))
+		for _, o := range offsets {
+			frames = append(frames, Frame{Time: start.Add(o)})
+		}
+		return frames
+	}
+	ms := time.Millisecond
+	cases := []struct {
+		name     string
+		frames   []Frame
+		fps      int
+		expected []int
+	}{
+		{"empty", at(), 10, []int{}},
+		{"single", at(0), 10, []int{0}},
+		{"same rate", at(0, 100*ms, 200*ms), 10, []int{0, 1, 2}},
+		{"slow frames are repeated", at(0, 200*ms, 400*ms), 10, []int{0, 0, 1, 1, 2}},
+		{"fast frames are dropped", at(0, 50*ms, 100*ms, 150*ms, 200*ms), 10, []int{0, 2, 4}},
+		{"long gap is shortened", at(0, time.Hour), 2, []int{0, 0, 1}},
+		{"late frame is dropped", at(0, 200*ms, 100*ms, 300*ms), 10, []int{0, 0, 1, 3}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if r := resample(c.frames, c.fps); !reflect.DeepEqual(r, c.expected) {
+				t.Errorf("bad positions: %v, wants %v", r, c.expected)
+			}
+		})
+	}
+}
+
+func TestCodec(t *testing.T) {
+	for output, expected := range map[string]string{"review.avi": "MJPG", "review.MP4": "mp4v"} {
+		if c, err := Codec(output); err != nil || c != expected {
+			t.Errorf("bad codec for %v: %v, %v", output, c, err)
+		}
+	}
+	if _, err := Codec("review.gif"); err == nil {
+		t.Errorf("unsupported format must return an error")
+	}
+}
+
+func marshal(t *testing.T, msg proto.Message) *testutil.FakeMessage {
+	payload, err := proto.Marshal(msg)
+	if err != nil {
+		t.Fatalf("unable to marshal %T: %v", msg, err)
+	}
+	return testutil.NewMessage("", payload)
+}
+
+type fakeWriter struct {
+	frames []Frame
+}
+
+func (w *fakeWriter) Write(f *Frame) error {
+	w.frames = append(w.frames, *f)
+	return nil
+}
+
+func TestCollector(t *testing.T) {
+	w := fakeWriter{}
+	c := NewCollector(nil, &w, "frame", "steering", "throttle", "objects", "road", "mode")
+	frame := func(ms int64) *events.FrameMessage {
+		ts := time.UnixMilli(ms)
+		return &events.FrameMessage{
+			Id:    &events.FrameRef{Name: "camera", CreatedAt: &timestamp.Timestamp{Seconds: ts.Unix(), Nanos: int32(ts.Nanosecond())}},
+			Frame: []byte("jpeg"),
+		}
+	}
+
+	c.onFrame(nil, marshal(t, frame(1600000000100)))
+	c.onSteering(nil, marshal(t, &events.SteeringMessage{Steering: 0.3}))
+	c.onDriveMode(nil, marshal(t, &events.DriveModeMessage{DriveMode: events.DriveMode_PILOT}))
+	c.onFrame(nil, marshal(t, frame(1600000000200)))
+	c.onThrottle(nil, marshal(t, &events.ThrottleMessage{Throttle: 0.6}))
+	// Late frame
+	c.onFrame(nil, marshal(t, frame(1600000000000)))
+
+	// Frames received before stop are written
+	close(c.cancel)
+	if err := c.writeFrames(); err != nil {
+		t.Fatalf("unable to write frames: %v", err)
+	}
+
+	frames := w.frames
+	if len(frames) != 3 {
+		t.Fatalf("bad number of frames: %v", len(frames))
+	}
+	if frames[0].Time.UnixMilli() != 1600000000100 || frames[2].Time.UnixMilli() != 1600000000000 {
+		t.Errorf("frames must be written as received: %v, %v", frames[0].Time, frames[2].Time)
+	}
+	if frames[0].Overlay.Steering != nil {
+		t.Errorf("first frame must not have steering: %v", frames[0].Overlay)
+	}
+	if frames[1].Overlay.Steering.GetSteering() != 0.3 || frames[1].Overlay.DriveMode.GetDriveMode() != events.DriveMode_PILOT || frames[1].Overlay.Throttle != nil {
+		t.Errorf("bad overlay for second frame: %v", frames[1].Overlay)
+	}
+	if frames[2].Overlay.Throttle.GetThrottle() != 0.6 {
+		t.Errorf("bad overlay for late frame: %v", frames[2].Overlay)
+	}
+}
+
+func TestCollector_Dropped(t *testing.T) {
+	w := fakeWriter{}
+	c := NewCollector(nil, &w, "frame", "", "", "", "", "")
+	for i := 0; i < maxPendingFrames+10; i++ {
+		c.onFrame(nil, marshal(t, &events.FrameMessage{Frame: []byte("jpeg")}))
+	}
+	close(c.cancel)
+	if err := c.writeFrames(); err != nil {
+		t.Fatalf("unable to write frames: %v", err)
+	}
+	if len(w.frames) != maxPendingFrames || c.dropped != 10 {
+		t.Errorf("frames must be dropped when writer is too slow: %v written, %v dropped", len(w.frames), c.dropped)
+	}
+}
@@ -0,0 +1,87 @@
+package vidimpt
+
+import (
+	"fmt"
+	"github.com/cyrilix/robocar-tools/pkg/recordset"
+	"github.com/cyrilix/robocar-tools/record"
+	"go.uber.org/zap"
+	"gocv.io/x/gocv"
+	"os"
+	"path"
+	"strconv"
+	"time"
+)
+
+/* video import */
+
+// ImportVideo decodes videoPath frames and writes a record set into destDir/recordSet. Each frame is labeled with
+// the steering log row nearest to videoStart + frame position + offset, frames without row less than maxDelta
+// away are skipped. If videoStart is zero, video is assumed to start with steering log. Record set must not
+// already exist.
+func ImportVideo(videoPath, steeringLogPath, destDir, recordSet string, videoStart time.Time, offset, maxDelta time.Duration) error {
+	l := zap.S().With("video", videoPath)
+
+	recordSetDir := path.Join(destDir, recordSet)
+	if _, err := os.Stat(recordSetDir); err == nil {
+		return fmt.Errorf("destination record set %v already exists", recordSetDir)
+	}
+
+	steeringLog, err := LoadSteeringLog(steeringLogPath)
+	if err != nil {
+		return err
+	}
+	if videoStart.IsZero() {
+		videoStart = steeringLog[0].Time
+	}
+
+	vc, err := gocv.VideoCaptureFile(videoPath)
+	if err != nil {
+		return fmt.Errorf("unable to open video %v: %w", videoPath, err)
+	}
+	defer vc.Close()
+
+	img := gocv.NewMat()
+	defer img.Close()
+
+	imported, skipped := 0, 0
+	lastId := ""
+	for vc.Read(&img) {
+		if img.Empty() {
+			continue
+		}
+		pos := time.Duration(vc.Get(gocv.VideoCapturePosMsec) * float64(time.Millisecond))
+		frameTime := videoStart.Add(pos).Add(offset)
+
+		row, ok := steeringLog.Nearest(frameTime, maxDelta)
+		if !ok {
+			l.Debugf("no steering logged around %v, skip frame", frameTime)
+			skipped += 1
+			continue
+		}
+
+		// Frame id is timestamp in milliseconds as for camera frames
+		id := strconv.FormatInt(frameTime.UnixMilli(), 10)
+		if id == lastId {
+			l.Debugf("frame %v already imported, skip frame", id)
+			skipped += 1
+			continue
+		}
+		lastId = id
+
+		buf, err := gocv.IMEncode(gocv.JPEGFileExt, img)
+		if err != nil {
+			return fmt.Errorf("unable to encode frame at %v: %w", pos, err)
+		}
+		_, err = recordset.AddEntry(recordSetDir, id, buf.GetBytes(), &record.Record{UserAngle: row.Steering})
+		buf.Close()
+		if err != nil {
+			return fmt.Errorf("unable to write record at %v: %w", pos, err)
+		}
+		imported += 1
+	}
+	if imported == 0 {
+		return fmt.Errorf("no frame of %v matches steering log, check video start and offset", videoPath)
+	}
+	l.Infof("%d frames imported into %v, %d skipped", imported, recordSetDir, skipped)
+	return nil
+}
@@ -0,0 +1,115 @@
+package vidimpt
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SteeringRow is a steering command logged by the remote
+type SteeringRow struct {
+	Time     time.Time
+	Steering float32
+}
+
+// SteeringLog is a list of steering commands ordered by time
+type SteeringLog []SteeringRow
+
+// LoadSteeringLog reads a csv file with a header line that contains at least 'timestamp' and 'steering' columns.
+// Timestamps are unix timestamps, in seconds if value has less than 12 digits, else in milliseconds.
+func LoadSteeringLog(logPath string) (SteeringLog, error) {
+	f, err := os.Open(logPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open steering log %v: %w", logPath, err)
+	}
+	defer f.Close()
+	return ReadSteeringLog(f)
+}
+
+func ReadSteeringLog(r io.Reader) (SteeringLog, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read steering log header: %w", err)
+	}
+	tsCol, steeringCol := -1, -1
+	for i, col := range header {
+		switch strings.ToLower(strings.TrimSpace(col)) {
+		case "timestamp":
+			tsCol = i
+		case "steering":
+			steeringCol = i
+		}
+	}
+	if tsCol < 0 || steeringCol < 0 {
+		return nil, fmt.Errorf("steering log header must contains 'timestamp' and 'steering' columns: %v", header)
+	}
+
+	rows := make(SteeringLog, 0)
+	for {
+		line, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to read steering log: %w", err)
+		}
+		ts, err := parseTimestamp(line[tsCol])
+		if err != nil {
+			return nil, fmt.Errorf("invalid timestamp at line %d: %w", len(rows)+2, err)
+		}
+		steering, err := strconv.ParseFloat(line[steeringCol], 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid steering at line %d: %w", len(rows)+2, err)
+		}
+		rows = append(rows, SteeringRow{Time: ts, Steering: float32(steering)})
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("empty steering log")
+	}
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].Time.Before(rows[j].Time) })
+	return rows, nil
+}
+
+func parseTimestamp(s string) (time.Time, error) {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if v < 1e11 {
+		v = v * 1000.
+	}
+	ms := math.Round(v)
+	return time.UnixMilli(int64(ms)), nil
+}
+
+// Nearest returns row logged closest to t if it is less than maxDelta away
+func (l SteeringLog) Nearest(t time.Time, maxDelta time.Duration) (SteeringRow, bool) {
+	idx := sort.Search(len(l), func(i int) bool { return !l[i].Time.Before(t) })
+
+	best := -1
+	var bestDelta time.Duration
+	for _, i := range []int{idx - 1, idx} {
+		if i < 0 || i >= len(l) {
+			continue
+		}
+		delta := l[i].Time.Sub(t)
+		if delta < 0 {
+			delta = -delta
+		}
+		if best < 0 || delta < bestDelta {
+			best, bestDelta = i, delta
+		}
+	}
+	if best < 0 || bestDelta > maxDelta {
+		return SteeringRow{}, false
+	}
+	return l[best], true
+}
@@ -0,0 +1,70 @@
+package vidimpt
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadSteeringLog(t *testing.T) {
+	content := `steering, throttle, timestamp
+0.5, 0.2, 1581992400200
+-0.25, 0.2, 1581992400100
+0.1, 0.3, 1581992400.3
+`
+	log, err := ReadSteeringLog(strings.NewReader(content))
+	if err != nil {
+		t.Fatalf("unable to read steering log: %v", err)
+	}
+	expected := []struct {
+		ms       int64
+		steering float32
+	}{{1581992400100, -0.25}, {1581992400200, 0.5}, {1581992400300, 0.1}}
+	if len(log) != len(expected) {
+		t.Fatalf("bad number of rows: %v, wants %v", len(log), len(expected))
+	}
+	for i, e := range expected {
+		if log[i].Time.UnixMilli() != e.ms || log[i].Steering != e.steering {
+			t.Errorf("bad row %d: %v/%v, wants %v/%v", i, log[i].Time.UnixMilli(), log[i].Steering, e.ms, e.steering)
+		}
+	}
+}
+
+func TestReadSteeringLog_InvalidHeader(t *testing.T) {
+	_, err := ReadSteeringLog(strings.NewReader("time,angle\n1581992400100,0.5\n"))
+	if err == nil {
+		t.Errorf("an error is expected when columns are missing")
+	}
+}
+
+func TestSteeringLog_Nearest(t *testing.T) {
+	start := time.UnixMilli(1581992400000)
+	log := SteeringLog{
+		{start, 0.1},
+		{start.Add(100 * time.Millisecond), 0.2},
+		{start.Add(200 * time.Millisecond), 0.3},
+	}
+	cases := []struct {
+		name     string
+		at       time.Time
+		found    bool
+		steering float32
+	}{
+		{"exact", start.Add(100 * time.Millisecond), true, 0.2},
+		{"closest before", start.Add(140 * time.Millisecond), true, 0.2},
+		{"closest after", start.Add(160 * time.Millisecond), true, 0.3},
+		{"too early", start.Add(-60 * time.Millisecond), false, 0},
+		{"too late", start.Add(260 * time.Millisecond), false, 0},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			row, found := log.Nearest(c.at, 50*time.Millisecond)
+			if found != c.found {
+				t.Fatalf("bad found value: %v, wants %v", found, c.found)
+			}
+			if found && row.Steering != c.steering {
+				t.Errorf("bad row: %v, wants %v", row.Steering, c.steering)
+			}
+		})
+	}
+}
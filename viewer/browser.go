@@ -0,0 +1,260 @@
+package viewer
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/cyrilix/robocar-protobuf/go/events"
+	"github.com/cyrilix/robocar-tools/pkg/overlay"
+	"github.com/cyrilix/robocar-tools/pkg/recordset"
+	"github.com/cyrilix/robocar-tools/record"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MarksFileName is the default name of file, into record set directory, that lists marked frames indexes
+const MarksFileName = "marks.txt"
+
+// Browser is a replay source that shows frames of a record set on disk and keeps marked frames
+type Browser struct {
+	rs        *recordset.RecordSet
+	times     []time.Time
+	marksFile string
+
+	muBrowser sync.Mutex
+	// pos is the frame currently shown, -1 before first frame
+	pos   int
+	marks map[string]bool
+	// selection is the first frame of selected range, -1 if there is no selection
+	selection   int
+	edits       *recordset.Edits
+	corrections *recordset.Corrections
+
+	// shown is notified when a new frame has to be shown
+	shown chan struct{}
+}
+
+// NewBrowser opens record set dir, frames ids that aren't timestamps are assumed to be recorded at fps. Marks are
+// read from and saved to marksFile, edits to record set sidecar file.
+func NewBrowser(dir string, fps int, marksFile string) (*Browser, error) {
+	rs, err := recordset.Open(dir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open record set: %w", err)
+	}
+	if len(rs.Entries) == 0 {
+		return nil, fmt.Errorf("no frame in record set %v", dir)
+	}
+	if fps <= 0 {
+		fps = 1
+	}
+
+	times := make([]time.Time, 0, len(rs.Entries))
+	for i := range rs.Entries {
+		ts, err := rs.Entries[i].Time()
+		if err != nil {
+			ts = time.Unix(0, 0).Add(time.Duration(i) * time.Second / time.Duration(fps))
+		}
+		times = append(times, ts)
+	}
+
+	marks, err := readMarks(marksFile)
+	if err != nil {
+		return nil, err
+	}
+	edits, err := recordset.LoadEdits(dir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load record set edits: %w", err)
+	}
+	return &Browser{
+		rs:          rs,
+		times:       times,
+		marksFile:   marksFile,
+		pos:         -1,
+		marks:       marks,
+		selection:   -1,
+		edits:       edits,
+		corrections: edits.Apply(rs.Indexes()),
+		shown:       make(chan struct{}, 1),
+	}, nil
+}
+
+func (b *Browser) Len() int {
+	return len(b.rs.Entries)
+}
+
+func (b *Browser) Offset(i int) time.Duration {
+	return b.times[i].Sub(b.times[0])
+}
+
+// IndexAt returns position of first frame recorded at or after t
+func (b *Browser) IndexAt(t time.Time) (int, error) {
+	return sort.Search(len(b.times), func(i int) bool { return !b.times[i].Before(t) }), nil
+}
+
+// Publish makes frame i the current frame, it never blocks
+func (b *Browser) Publish(i int) error {
+	if i < 0 || i >= b.Len() {
+		return fmt.Errorf("invalid frame position %v", i)
+	}
+	b.muBrowser.Lock()
+	b.pos = i
+	b.muBrowser.Unlock()
+
+	select {
+	case b.shown <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Pos returns position of current frame, -1 if no frame has been shown
+func (b *Browser) Pos() int {
+	b.muBrowser.Lock()
+	defer b.muBrowser.Unlock()
+	return b.pos
+}
+
+// ToggleMark marks or unmarks current frame and saves marks
+func (b *Browser) ToggleMark() error {
+	b.muBrowser.Lock()
+	defer b.muBrowser.Unlock()
+	if b.pos < 0 {
+		return nil
+	}
+	idx := b.rs.Entries[b.pos].Index
+	if b.marks[idx] {
+		delete(b.marks, idx)
+	} else {
+		b.marks[idx] = true
+	}
+	return b.saveMarks()
+}
+
+// NextMark returns position of first marked frame after current one, ok is false if there isn't any
+func (b *Browser) NextMark() (pos int, ok bool) {
+	b.muBrowser.Lock()
+	defer b.muBrowser.Unlock()
+	for i := b.pos + 1; i < len(b.rs.Entries); i++ {
+		if b.marks[b.rs.Entries[i].Index] {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// PreviousMark returns position of last marked frame before current one, ok is false if there isn't any
+func (b *Browser) PreviousMark() (pos int, ok bool) {
+	b.muBrowser.Lock()
+	defer b.muBrowser.Unlock()
+	for i := b.pos - 1; i >= 0; i-- {
+		if b.marks[b.rs.Entries[i].Index] {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// Current reads jpeg content of current frame with its overlay: corrected steering and throttle of record, frame
+// position, timestamp, mark, edits and selection
+func (b *Browser) Current() ([]byte, *overlay.Overlay, error) {
+	b.muBrowser.Lock()
+	pos, selection, corrections := b.pos, b.selection, b.corrections
+	marked := pos >= 0 && b.marks[b.rs.Entries[pos].Index]
+	b.muBrowser.Unlock()
+	if pos < 0 {
+		return nil, nil, fmt.Errorf("no current frame")
+	}
+
+	e := &b.rs.Entries[pos]
+	img, err := ioutil.ReadFile(e.ImagePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to read image %v: %w", e.ImagePath, err)
+	}
+	rcd, err := readRecord(e.RecordPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	steering, corrected := corrections.Steering[e.Index]
+	if !corrected {
+		steering = rcd.UserAngle
+	}
+	o := overlay.Overlay{
+		Steering: &events.SteeringMessage{Steering: steering, Confidence: 1.},
+		Gauges:   true,
+		Status: []string{
+			fmt.Sprintf("Frame: %d/%d", pos+1, b.Len()),
+			b.times[pos].UTC().Format("2006-01-02 15:04:05.000"),
+		},
+	}
+	if rcd.UserThrottle != nil {
+		o.Throttle = &events.ThrottleMessage{Throttle: *rcd.UserThrottle, Confidence: 1.}
+	}
+	if marked {
+		o.Status = append(o.Status, "Marked")
+	}
+	if corrections.Excluded[e.Index] {
+		o.Status = append(o.Status, "Excluded")
+	}
+	if corrected {
+		o.Status = append(o.Status, fmt.Sprintf("Steering corrected, was %.2f", rcd.UserAngle))
+	}
+	if selection >= 0 {
+		o.Status = append(o.Status, fmt.Sprintf("Selection: %d-%d", selection+1, pos+1))
+	}
+	return img, &o, nil
+}
+
+func readRecord(recordPath string) (*record.Record, error) {
+	content, err := ioutil.ReadFile(recordPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read json content: %w", err)
+	}
+	var rcd record.Record
+	if err := json.Unmarshal(content, &rcd); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal record %v: %w", recordPath, err)
+	}
+	return &rcd, nil
+}
+
+// readMarks reads frame indexes, one by line, a missing file has no mark
+func readMarks(marksFile string) (map[string]bool, error) {
+	marks := make(map[string]bool)
+	f, err := os.Open(marksFile)
+	if os.IsNotExist(err) {
+		return marks, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to open marks file %v: %w", marksFile, err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if idx := strings.TrimSpace(scanner.Text()); idx != "" {
+			marks[idx] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read marks file %v: %w", marksFile, err)
+	}
+	return marks, nil
+}
+
+// saveMarks writes marked frame indexes in record set order, it must be called with muBrowser locked
+func (b *Browser) saveMarks() error {
+	var content strings.Builder
+	for _, e := range b.rs.Entries {
+		if b.marks[e.Index] {
+			content.WriteString(e.Index + "\n")
+		}
+	}
+	if err := ioutil.WriteFile(b.marksFile, []byte(content.String()), os.FileMode(0644)); err != nil {
+		return fmt.Errorf("unable to write marks file %v: %w", b.marksFile, err)
+	}
+	return nil
+}
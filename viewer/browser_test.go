@@ -0,0 +1,243 @@
+package viewer
+
+import (
+	"github.com/cyrilix/robocar-tools/pkg/recordset"
+	"github.com/cyrilix/robocar-tools/record"
+	"github.com/cyrilix/robocar-tools/replay"
+	"io/ioutil"
+	"math"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func newTestBrowser(t *testing.T, indexes ...string) *Browser {
+	tmpDir, err := ioutil.TempDir("", "viewer")
+	if err != nil {
+		t.Fatalf("unable to make tmpdir: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = os.RemoveAll(tmpDir)
+	})
+
+	dir := path.Join(tmpDir, "rs")
+	for i, idx := range indexes {
+		if _, err := recordset.AddEntry(dir, idx, []byte("jpeg"), &record.Record{UserAngle: float32(i) / 10.}); err != nil {
+			t.Fatalf("unable to add entry: %v", err)
+		}
+	}
+	b, err := NewBrowser(dir, 10, path.Join(dir, MarksFileName))
+	if err != nil {
+		t.Fatalf("unable to open browser: %v", err)
+	}
+	return b
+}
+
+func TestBrowser_Offset(t *testing.T) {
+	b := newTestBrowser(t, "1600000000000", "1600000000050", "1600000000200")
+	if b.Len() != 3 {
+		t.Fatalf("bad number of frames: %v", b.Len())
+	}
+	if b.Offset(2) != 200*time.Millisecond {
+		t.Errorf("bad offset: %v", b.Offset(2))
+	}
+	idx, _ := b.IndexAt(time.UnixMilli(1600000000100))
+	if idx != 2 {
+		t.Errorf("bad index at date: %v", idx)
+	}
+
+	b = newTestBrowser(t, "0000001", "0000002", "0000003")
+	if b.Offset(2) != 200*time.Millisecond {
+		t.Errorf("bad offset without timestamps: %v", b.Offset(2))
+	}
+}
+
+func TestBrowser_Marks(t *testing.T) {
+	b := newTestBrowser(t, "1600000000000", "1600000000100", "1600000000200", "1600000000300")
+	if b.Pos() != -1 {
+		t.Errorf("bad initial position: %v", b.Pos())
+	}
+	if err := b.Publish(4); err == nil {
+		t.Errorf("invalid position should fail")
+	}
+
+	for _, pos := range []int{3, 1} {
+		_ = b.Publish(pos)
+		if err := b.ToggleMark(); err != nil {
+			t.Fatalf("unable to toggle mark: %v", err)
+		}
+	}
+	content, err := ioutil.ReadFile(b.marksFile)
+	if err != nil {
+		t.Fatalf("unable to read marks: %v", err)
+	}
+	if string(content) != "1600000000100\n1600000000300\n" {
+		t.Errorf("bad marks file: %q", content)
+	}
+
+	_ = b.Publish(0)
+	if pos, ok := b.NextMark(); !ok || pos != 1 {
+		t.Errorf("bad next mark: %v, %v", pos, ok)
+	}
+	if _, ok := b.PreviousMark(); ok {
+		t.Errorf("no previous mark expected")
+	}
+	_ = b.Publish(3)
+	if pos, ok := b.PreviousMark(); !ok || pos != 1 {
+		t.Errorf("bad previous mark: %v, %v", pos, ok)
+	}
+
+	// Marks are read again on open
+	marks, err := readMarks(b.marksFile)
+	if err != nil {
+		t.Fatalf("unable to read marks: %v", err)
+	}
+	if !reflect.DeepEqual(marks, map[string]bool{"1600000000100": true, "1600000000300": true}) {
+		t.Errorf("bad marks: %v", marks)
+	}
+
+	// Toggle removes mark
+	if err := b.ToggleMark(); err != nil {
+		t.Fatalf("unable to toggle mark: %v", err)
+	}
+	if _, ok := b.NextMark(); ok {
+		t.Errorf("no next mark expected")
+	}
+}
+
+func TestBrowser_Current(t *testing.T) {
+	b := newTestBrowser(t, "1600000000000", "1600000000100")
+	if _, _, err := b.Current(); err == nil {
+		t.Errorf("no current frame expected")
+	}
+
+	_ = b.Publish(1)
+	_ = b.ToggleMark()
+	img, o, err := b.Current()
+	if err != nil {
+		t.Fatalf("unable to read current frame: %v", err)
+	}
+	if string(img) != "jpeg" {
+		t.Errorf("bad image content: %q", img)
+	}
+	if o.Steering.GetSteering() != 0.1 {
+		t.Errorf("bad steering: %v", o.Steering.GetSteering())
+	}
+	if o.Throttle != nil {
+		t.Errorf("no throttle expected: %v", o.Throttle)
+	}
+	expected := []string{"Frame: 2/2", "2020-09-13 12:26:40.100", "Marked"}
+	if !reflect.DeepEqual(o.Status, expected) {
+		t.Errorf("bad status: %v, wants %v", o.Status, expected)
+	}
+}
+
+func TestCommandForKey(t *testing.T) {
+	b := newTestBrowser(t, "1600000000000", "1600000000100", "1600000000200")
+	_ = b.Publish(2)
+	_ = b.ToggleMark()
+	_ = b.Publish(1)
+
+	cases := []struct {
+		key      int
+		expected *replay.Command
+	}{
+		{'.', &replay.Command{Type: replay.CommandSeek, Frame: 11}},
+		{',', &replay.Command{Type: replay.CommandSeek, Frame: -9}},
+		{']', &replay.Command{Type: replay.CommandSeek, Frame: 2}},
+		{'[', nil},
+		{'z', nil},
+	}
+	for _, c := range cases {
+		cmd, ok := commandForKey(c.key, b, 10)
+		if ok != (c.expected != nil) {
+			t.Errorf("key %c: bad result %v", c.key, ok)
+			continue
+		}
+		if ok && !reflect.DeepEqual(cmd, c.expected) {
+			t.Errorf("key %c: bad command %v, wants %v", c.key, cmd, c.expected)
+		}
+	}
+	if cmd, ok := commandForKey(' ', b, 10); !ok || cmd.Type != replay.CommandToggle {
+		t.Errorf("replay keys should be supported: %v", cmd)
+	}
+}
+
+func TestBrowser_Edits(t *testing.T) {
+	b := newTestBrowser(t, "1600000000000", "1600000000100", "1600000000200", "1600000000300", "1600000000400")
+
+	// Exclude frames 1 to 3, selected backward
+	_ = b.Publish(3)
+	b.ToggleSelection()
+	_ = b.Publish(1)
+	if ok, err := editForKey('x', b); !ok || err != nil {
+		t.Fatalf("unable to exclude frames: %v, %v", ok, err)
+	}
+	_ = b.Publish(2)
+	if ok, err := editForKey('i', b); !ok || err != nil {
+		t.Fatalf("unable to include frame: %v, %v", ok, err)
+	}
+	if !reflect.DeepEqual(b.corrections.Excluded, map[string]bool{"1600000000100": true, "1600000000300": true}) {
+		t.Errorf("bad excluded frames: %v", b.corrections.Excluded)
+	}
+
+	// Successive adjustments of a frame are merged
+	_ = b.Publish(4)
+	for i := 0; i < 3; i++ {
+		if err := b.AdjustSteering(0.1); err != nil {
+			t.Fatalf("unable to adjust steering: %v", err)
+		}
+	}
+	if len(b.edits.Edits) != 3 {
+		t.Errorf("bad number of edits: %v", b.edits.Edits)
+	}
+	if math.Abs(float64(b.corrections.Steering["1600000000400"]-0.7)) > 1e-6 {
+		t.Errorf("bad adjusted steering: %v", b.corrections.Steering)
+	}
+
+	if err := b.Interpolate(); err == nil {
+		t.Errorf("interpolation without selection should fail")
+	}
+	_ = b.Publish(0)
+	b.ToggleSelection()
+	_ = b.Publish(4)
+	if err := b.Interpolate(); err != nil {
+		t.Fatalf("unable to interpolate: %v", err)
+	}
+	if math.Abs(float64(b.corrections.Steering["1600000000200"]-0.35)) > 1e-6 {
+		t.Errorf("bad interpolated steering: %v", b.corrections.Steering)
+	}
+	_, o, err := b.Current()
+	if err != nil {
+		t.Fatalf("unable to read current frame: %v", err)
+	}
+	if math.Abs(float64(o.Steering.GetSteering()-0.7)) > 1e-6 {
+		t.Errorf("bad corrected steering: %v", o.Steering.GetSteering())
+	}
+	if o.Status[len(o.Status)-1] != "Steering corrected, was 0.40" {
+		t.Errorf("bad status: %v", o.Status)
+	}
+
+	// Edits are saved into record set sidecar file
+	edits, err := recordset.LoadEdits(b.rs.Dir)
+	if err != nil {
+		t.Fatalf("unable to load edits: %v", err)
+	}
+	if !reflect.DeepEqual(edits.Edits, b.edits.Edits) {
+		t.Errorf("bad saved edits: %v", edits.Edits)
+	}
+
+	for i := 0; i < 4; i++ {
+		if ok, err := b.Undo(); !ok || err != nil {
+			t.Fatalf("unable to undo edit: %v, %v", ok, err)
+		}
+	}
+	if ok, _ := b.Undo(); ok {
+		t.Errorf("no more edit expected")
+	}
+	if len(b.corrections.Excluded) != 0 || len(b.corrections.Steering) != 0 {
+		t.Errorf("no correction expected: %v", b.corrections)
+	}
+}
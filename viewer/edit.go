@@ -0,0 +1,139 @@
+package viewer
+
+import (
+	"fmt"
+	"github.com/cyrilix/robocar-tools/pkg/recordset"
+	"math"
+)
+
+// ToggleSelection starts selected range at current frame, or clears selection if any
+func (b *Browser) ToggleSelection() {
+	b.muBrowser.Lock()
+	defer b.muBrowser.Unlock()
+	if b.selection >= 0 {
+		b.selection = -1
+		return
+	}
+	b.selection = b.pos
+}
+
+// Exclude excludes selected frames, or current frame without selection, from training data
+func (b *Browser) Exclude() error {
+	return b.editSelection(recordset.EditExclude)
+}
+
+// Include restores excluded frames of selection, or current frame without selection
+func (b *Browser) Include() error {
+	return b.editSelection(recordset.EditInclude)
+}
+
+func (b *Browser) editSelection(t recordset.EditType) error {
+	b.muBrowser.Lock()
+	defer b.muBrowser.Unlock()
+	if b.pos < 0 {
+		return nil
+	}
+	from, to := b.selectedRange()
+	b.selection = -1
+	return b.addEdit(recordset.Edit{Type: t, From: b.rs.Entries[from].Index, To: b.rs.Entries[to].Index})
+}
+
+// AdjustSteering adds delta to steering of current frame, successive adjustments of a frame are a single edit
+func (b *Browser) AdjustSteering(delta float32) error {
+	b.muBrowser.Lock()
+	defer b.muBrowser.Unlock()
+	if b.pos < 0 {
+		return nil
+	}
+	idx := b.rs.Entries[b.pos].Index
+	steering, err := b.steering(b.pos)
+	if err != nil {
+		return err
+	}
+	steering = float32(math.Max(-1, math.Min(1, float64(steering+delta))))
+
+	edits := b.edits.Edits
+	if n := len(edits); n > 0 && edits[n-1].Type == recordset.EditSteering && edits[n-1].From == idx && edits[n-1].To == idx {
+		b.edits.Undo()
+	}
+	return b.addEdit(recordset.Edit{Type: recordset.EditSteering, From: idx, To: idx, Steering: steering, ToSteering: steering})
+}
+
+// Interpolate sets steering of selected frames linearly interpolated between steering of selection bounds
+func (b *Browser) Interpolate() error {
+	b.muBrowser.Lock()
+	defer b.muBrowser.Unlock()
+	if b.selection < 0 || b.selection == b.pos {
+		return fmt.Errorf("select a range of frames to interpolate")
+	}
+	from, to := b.selectedRange()
+	fromSteering, err := b.steering(from)
+	if err != nil {
+		return err
+	}
+	toSteering, err := b.steering(to)
+	if err != nil {
+		return err
+	}
+	b.selection = -1
+	return b.addEdit(recordset.Edit{
+		Type:       recordset.EditSteering,
+		From:       b.rs.Entries[from].Index,
+		To:         b.rs.Entries[to].Index,
+		Steering:   fromSteering,
+		ToSteering: toSteering,
+	})
+}
+
+// Undo removes last edit, ok is false if there is no edit
+func (b *Browser) Undo() (ok bool, err error) {
+	b.muBrowser.Lock()
+	defer b.muBrowser.Unlock()
+	if _, ok := b.edits.Undo(); !ok {
+		return false, nil
+	}
+	return true, b.saveEdits()
+}
+
+// selectedRange returns ordered positions of selection bounds, it must be called with muBrowser locked
+func (b *Browser) selectedRange() (from, to int) {
+	if b.selection < 0 {
+		return b.pos, b.pos
+	}
+	if b.selection > b.pos {
+		return b.pos, b.selection
+	}
+	return b.selection, b.pos
+}
+
+// steering returns corrected steering of frame at pos, it must be called with muBrowser locked
+func (b *Browser) steering(pos int) (float32, error) {
+	e := &b.rs.Entries[pos]
+	if v, ok := b.corrections.Steering[e.Index]; ok {
+		return v, nil
+	}
+	rcd, err := readRecord(e.RecordPath)
+	if err != nil {
+		return 0, err
+	}
+	return rcd.UserAngle, nil
+}
+
+// addEdit saves edit, edit is dropped if it can't be saved. It must be called with muBrowser locked.
+func (b *Browser) addEdit(edit recordset.Edit) error {
+	if err := b.edits.Add(edit); err != nil {
+		return err
+	}
+	if err := b.saveEdits(); err != nil {
+		b.edits.Undo()
+		b.corrections = b.edits.Apply(b.rs.Indexes())
+		return err
+	}
+	return nil
+}
+
+// saveEdits writes edits and updates corrections, it must be called with muBrowser locked
+func (b *Browser) saveEdits() error {
+	b.corrections = b.edits.Apply(b.rs.Indexes())
+	return b.edits.Save()
+}
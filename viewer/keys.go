@@ -0,0 +1,54 @@
+package viewer
+
+import "github.com/cyrilix/robocar-tools/replay"
+
+// commandForKey maps viewer keystrokes to replay commands: replay keys, '.' and ',' jump forward and back of jump
+// frames, ']' and '[' go to next and previous marked frames
+func commandForKey(key int, b *Browser, jump int) (*replay.Command, bool) {
+	if cmd, ok := replay.CommandForKey(key); ok {
+		return cmd, true
+	}
+	switch key {
+	case '.':
+		return &replay.Command{Type: replay.CommandSeek, Frame: b.Pos() + jump}, true
+	case ',':
+		return &replay.Command{Type: replay.CommandSeek, Frame: b.Pos() - jump}, true
+	case ']':
+		if pos, ok := b.NextMark(); ok {
+			return &replay.Command{Type: replay.CommandSeek, Frame: pos}, true
+		}
+	case '[':
+		if pos, ok := b.PreviousMark(); ok {
+			return &replay.Command{Type: replay.CommandSeek, Frame: pos}, true
+		}
+	}
+	return nil, false
+}
+
+// steeringStep is the steering change of a keystroke
+const steeringStep = 0.05
+
+// editForKey applies editing keystrokes to browser: 's' starts or clears selection, 'x' and 'i' exclude and include
+// selected frames, 'a' and 'd' turn steering of current frame left and right, 'p' interpolates steering over selection
+// and 'u' undoes last edit. ok is false if key isn't an editing key.
+func editForKey(key int, b *Browser) (ok bool, err error) {
+	switch key {
+	case 's':
+		b.ToggleSelection()
+	case 'x':
+		err = b.Exclude()
+	case 'i':
+		err = b.Include()
+	case 'a':
+		err = b.AdjustSteering(-steeringStep)
+	case 'd':
+		err = b.AdjustSteering(steeringStep)
+	case 'p':
+		err = b.Interpolate()
+	case 'u':
+		_, err = b.Undo()
+	default:
+		return false, nil
+	}
+	return true, err
+}
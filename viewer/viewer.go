@@ -0,0 +1,129 @@
+package viewer
+
+import (
+	"bytes"
+	"github.com/cyrilix/robocar-tools/pkg/overlay"
+	"github.com/cyrilix/robocar-tools/replay"
+	"go.uber.org/zap"
+	"gocv.io/x/gocv"
+	"image"
+	_ "image/jpeg"
+	"sync"
+	"time"
+)
+
+const keyEscape = 27
+
+// Viewer shows frames of a browser into a window, keystrokes control playback, marks and edits
+type Viewer struct {
+	browser *Browser
+	player  *replay.Player
+	window  *gocv.Window
+	start   int
+	jump    int
+
+	cancel     chan interface{}
+	cancelOnce sync.Once
+}
+
+// New builds viewer paused on frame start, playback runs at speed and jump is the number of frames skipped by jump
+// keys
+func New(browser *Browser, start int, speed float64, jump int) *Viewer {
+	player := replay.NewPlayer(browser, speed, false)
+	player.PauseAtEnd()
+	return &Viewer{
+		browser: browser,
+		player:  player,
+		window:  gocv.NewWindow(browser.rs.Name()),
+		start:   start,
+		jump:    jump,
+		cancel:  make(chan interface{}),
+	}
+}
+
+// Start shows frames until window is closed with 'q' or escape key
+func (v *Viewer) Start() error {
+	go func() {
+		if err := v.player.Run(); err != nil {
+			zap.S().Errorf("unable to play record set: %v", err)
+		}
+	}()
+	v.player.Send(replay.Command{Type: replay.CommandPause})
+	v.player.Send(replay.Command{Type: replay.CommandSeek, Frame: v.start})
+
+	keyTicker := time.NewTicker(30 * time.Millisecond)
+	defer keyTicker.Stop()
+	for {
+		select {
+		case <-keyTicker.C:
+			if quit := v.onKey(v.window.WaitKey(1)); quit {
+				return nil
+			}
+		case <-v.browser.shown:
+			v.draw()
+		case <-v.cancel:
+			return nil
+		}
+	}
+}
+
+func (v *Viewer) Stop() {
+	v.cancelOnce.Do(func() {
+		close(v.cancel)
+	})
+	v.player.Stop()
+	v.window.Close()
+}
+
+func (v *Viewer) onKey(key int) (quit bool) {
+	switch key {
+	case -1:
+		return false
+	case 'q', keyEscape:
+		return true
+	case 'm':
+		if err := v.browser.ToggleMark(); err != nil {
+			zap.S().Errorf("unable to mark frame: %v", err)
+		}
+		v.redraw()
+		return false
+	}
+	if ok, err := editForKey(key, v.browser); ok {
+		if err != nil {
+			zap.S().Errorf("unable to edit record set: %v", err)
+		}
+		v.redraw()
+		return false
+	}
+	if cmd, ok := commandForKey(key, v.browser, v.jump); ok {
+		v.player.Send(*cmd)
+	}
+	return false
+}
+
+// redraw shows current frame again with its marks and edits
+func (v *Viewer) redraw() {
+	if pos := v.browser.Pos(); pos >= 0 {
+		_ = v.browser.Publish(pos)
+	}
+}
+
+func (v *Viewer) draw() {
+	content, o, err := v.browser.Current()
+	if err != nil {
+		zap.S().Errorf("unable to read frame: %v", err)
+		return
+	}
+	img, _, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		zap.S().Errorf("unable to decode frame: %v", err)
+		return
+	}
+	mat, err := gocv.ImageToMatRGB(overlay.Render(img, o))
+	if err != nil {
+		zap.S().Errorf("unable to convert frame: %v", err)
+		return
+	}
+	defer mat.Close()
+	v.window.IMShow(mat)
+}